@@ -11,6 +11,7 @@ import (
 type Node interface {
 	TokenLiteral() string // Returns the literal value of the token (for debugging)
 	String() string       // Returns a string representation of the node
+	NodeSpan() Span       // Returns where the node sits in the source
 }
 
 // Statement represents a statement node (doesn't produce a value)
@@ -25,11 +26,96 @@ type Expression interface {
 	expressionNode()
 }
 
+// Position is a place in the source, counting lines and columns from 1
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Span is the stretch of source a node was parsed from: Start is its first
+// character and End is just past its last. Every node embeds one, so each
+// has Start and End fields.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// NodeSpan returns the span, and makes every node that embeds one a Node
+func (s *Span) NodeSpan() Span { return *s }
+
+// SetSpan records where the node starts and ends
+func (s *Span) SetSpan(start, end Position) {
+	s.Start = start
+	s.End = end
+}
+
+// Line returns the line of the token a node is built around, or 0 if it
+// has none. The compiler tags bytecode with it and the interpreter its
+// errors, so both backends report an error on the same line.
+func Line(node Node) int {
+	switch node := node.(type) {
+	case *MakeStatement:
+		return node.Token.Line
+	case *AssignStatement:
+		return node.Token.Line
+	case *BringStatement:
+		return node.Token.Line
+	case *BreakStatement:
+		return node.Token.Line
+	case *ContinueStatement:
+		return node.Token.Line
+	case *ExpressionStatement:
+		return node.Token.Line
+	case *BlockStatement:
+		return node.Token.Line
+	case *Identifier:
+		return node.Token.Line
+	case *IntegerLiteral:
+		return node.Token.Line
+	case *FloatLiteral:
+		return node.Token.Line
+	case *StringLiteral:
+		return node.Token.Line
+	case *Boolean:
+		return node.Token.Line
+	case *NothingLiteral:
+		return node.Token.Line
+	case *PrefixExpression:
+		return node.Token.Line
+	case *InfixExpression:
+		return node.Token.Line
+	case *ChainExpression:
+		return node.Token.Line
+	case *BindExpression:
+		return node.Token.Line
+	case *SupposeExpression:
+		return node.Token.Line
+	case *WhileExpression:
+		return node.Token.Line
+	case *ForExpression:
+		return node.Token.Line
+	case *TryExpression:
+		return node.Token.Line
+	case *DoExpression:
+		return node.Token.Line
+	case *CallExpression:
+		return node.Token.Line
+	case *ArrayLiteral:
+		return node.Token.Line
+	case *IndexExpression:
+		return node.Token.Line
+	case *HashLiteral:
+		return node.Token.Line
+	}
+	return 0
+}
+
 // =============================================================================
 // Program - The root node of every AST
 // =============================================================================
 
 type Program struct {
+	Span
 	Statements []Statement
 }
 
@@ -54,6 +140,7 @@ func (p *Program) String() string {
 
 // MakeStatement represents: make x be 5
 type MakeStatement struct {
+	Span
 	Token token.Token // the 'make' token
 	Name  *Identifier // variable name
 	Value Expression  // the value being assigned
@@ -72,8 +159,29 @@ func (ms *MakeStatement) String() string {
 	return out.String()
 }
 
+// AssignStatement represents: x be 5 (changing a variable that already exists)
+type AssignStatement struct {
+	Span
+	Token token.Token // the variable's IDENT token
+	Name  *Identifier
+	Value Expression
+}
+
+func (as *AssignStatement) statementNode()       {}
+func (as *AssignStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AssignStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(as.Name.String())
+	out.WriteString(" be ")
+	if as.Value != nil {
+		out.WriteString(as.Value.String())
+	}
+	return out.String()
+}
+
 // BringStatement represents: bring x (return statement)
 type BringStatement struct {
+	Span
 	Token       token.Token // the 'bring' token
 	ReturnValue Expression
 }
@@ -89,8 +197,29 @@ func (bs *BringStatement) String() string {
 	return out.String()
 }
 
+// BreakStatement represents: comot (leave the loop early)
+type BreakStatement struct {
+	Span
+	Token token.Token // the 'comot' token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string       { return bs.Token.Literal }
+
+// ContinueStatement represents: kontinu (skip to the loop's next round)
+type ContinueStatement struct {
+	Span
+	Token token.Token // the 'kontinu' token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string       { return cs.Token.Literal }
+
 // ExpressionStatement represents a statement consisting of a single expression
 type ExpressionStatement struct {
+	Span
 	Token      token.Token // the first token of the expression
 	Expression Expression
 }
@@ -106,6 +235,7 @@ func (es *ExpressionStatement) String() string {
 
 // BlockStatement represents a block of statements: { ... }
 type BlockStatement struct {
+	Span
 	Token      token.Token // the '{' token
 	Statements []Statement
 }
@@ -126,6 +256,7 @@ func (bs *BlockStatement) String() string {
 
 // Identifier represents a variable name
 type Identifier struct {
+	Span
 	Token token.Token // the IDENT token
 	Value string
 }
@@ -136,6 +267,7 @@ func (i *Identifier) String() string       { return i.Value }
 
 // IntegerLiteral represents an integer: 5, 42, 1000
 type IntegerLiteral struct {
+	Span
 	Token token.Token
 	Value int64
 }
@@ -144,8 +276,20 @@ func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+// FloatLiteral represents a floating-point number: 3.14, 0.5
+type FloatLiteral struct {
+	Span
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 // StringLiteral represents a string: "How far!"
 type StringLiteral struct {
+	Span
 	Token token.Token
 	Value string
 }
@@ -156,6 +300,7 @@ func (sl *StringLiteral) String() string       { return "\"" + sl.Value + "\"" }
 
 // Boolean represents: tru or lie
 type Boolean struct {
+	Span
 	Token token.Token
 	Value bool
 }
@@ -166,6 +311,7 @@ func (b *Boolean) String() string       { return b.Token.Literal }
 
 // NothingLiteral represents: nothing (null)
 type NothingLiteral struct {
+	Span
 	Token token.Token
 }
 
@@ -175,6 +321,7 @@ func (nl *NothingLiteral) String() string       { return "nothing" }
 
 // PrefixExpression represents: -5, !tru, no be x
 type PrefixExpression struct {
+	Span
 	Token    token.Token // the prefix token (!, -, no)
 	Operator string
 	Right    Expression
@@ -193,6 +340,7 @@ func (pe *PrefixExpression) String() string {
 
 // InfixExpression represents: 5 + 5, x big pass y, a and b
 type InfixExpression struct {
+	Span
 	Token    token.Token // the operator token
 	Left     Expression
 	Operator string
@@ -213,6 +361,7 @@ func (ie *InfixExpression) String() string {
 
 // SupposeExpression represents: suppose x big pass 5 { ... } abi { ... }
 type SupposeExpression struct {
+	Span
 	Token       token.Token // the 'suppose' token
 	Condition   Expression
 	Consequence *BlockStatement
@@ -236,9 +385,11 @@ func (se *SupposeExpression) String() string {
 
 // WhileExpression represents: dey do while x no reach 10 { ... }
 type WhileExpression struct {
+	Span
 	Token     token.Token // the 'dey' token
 	Condition Expression
 	Body      *BlockStatement
+	Otherwise *BlockStatement // optional, runs unless the loop was left with comot
 }
 
 func (we *WhileExpression) expressionNode()      {}
@@ -249,14 +400,99 @@ func (we *WhileExpression) String() string {
 	out.WriteString(we.Condition.String())
 	out.WriteString(" ")
 	out.WriteString(we.Body.String())
+	if we.Otherwise != nil {
+		out.WriteString(" otherwise ")
+		out.WriteString(we.Otherwise.String())
+	}
+	return out.String()
+}
+
+// ForExpression represents: count i from 1 reach 10 { ... }
+// Both bounds are inclusive.
+type ForExpression struct {
+	Span
+	Token    token.Token // the 'count' token
+	Variable *Identifier
+	From     Expression
+	To       Expression
+	Body     *BlockStatement
+}
+
+func (fe *ForExpression) expressionNode()      {}
+func (fe *ForExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe *ForExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("count ")
+	out.WriteString(fe.Variable.String())
+	out.WriteString(" from ")
+	out.WriteString(fe.From.String())
+	out.WriteString(" reach ")
+	out.WriteString(fe.To.String())
+	out.WriteString(" ")
+	out.WriteString(fe.Body.String())
+	return out.String()
+}
+
+// TryExpression represents: try { ... } rescue err { ... }
+// The rescue block runs with the error's message in Name when the try
+// block fails with a runtime error.
+type TryExpression struct {
+	Span
+	Token  token.Token // the 'try' token
+	Body   *BlockStatement
+	Name   *Identifier
+	Rescue *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(te.Body.String())
+	out.WriteString(" rescue ")
+	out.WriteString(te.Name.String())
+	out.WriteString(" ")
+	out.WriteString(te.Rescue.String())
 	return out.String()
 }
 
+// ChainExpression is a chained comparison like 1 < f() < 10, which the
+// parser desugars into Chain, an 'and' of its comparisons. The hidden
+// variables its BindExpressions fill belong to the chain alone.
+type ChainExpression struct {
+	Span
+	Token token.Token // the first comparison operator
+	Chain *InfixExpression
+}
+
+func (ce *ChainExpression) expressionNode()      {}
+func (ce *ChainExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *ChainExpression) String() string       { return ce.Chain.String() }
+
+// BindExpression works out Value and keeps it in the hidden variable Name
+// as well as giving it back. The parser makes these so a chained
+// comparison's middle operand is only worked out once; the next comparison
+// in the chain reads Name.
+type BindExpression struct {
+	Span
+	Token token.Token // the comparison operator the value belongs to
+	Name  *Identifier
+	Value Expression
+}
+
+func (be *BindExpression) expressionNode()      {}
+func (be *BindExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BindExpression) String() string       { return be.Value.String() }
+
 // DoExpression represents function definition: do add(a, b) { bring a + b }
+// An optional return type can follow the parameters: do add(a, b) bring number { ... }
 type DoExpression struct {
+	Span
 	Token      token.Token   // the 'do' token
 	Name       *Identifier   // function name (optional for anonymous functions)
 	Parameters []*Identifier // function parameters
+	ReturnType *Identifier   // declared return type (optional)
 	Body       *BlockStatement
 }
 
@@ -275,14 +511,18 @@ func (de *DoExpression) String() string {
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
+	if de.ReturnType != nil {
+		out.WriteString("bring " + de.ReturnType.String() + " ")
+	}
 	out.WriteString(de.Body.String())
 	return out.String()
 }
 
 // CallExpression represents function call: add(1, 2) or yarn("hello")
 type CallExpression struct {
-	Token     token.Token  // the '(' token
-	Function  Expression   // Identifier or DoExpression
+	Span
+	Token     token.Token // the '(' token
+	Function  Expression  // Identifier or DoExpression
 	Arguments []Expression
 }
 
@@ -299,4 +539,53 @@ func (ce *CallExpression) String() string {
 	out.WriteString(strings.Join(args, ", "))
 	out.WriteString(")")
 	return out.String()
-}
\ No newline at end of file
+}
+
+// ArrayLiteral represents an array: [1, 2, 3]
+type ArrayLiteral struct {
+	Span
+	Token    token.Token // the '[' token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) String() string {
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// IndexExpression represents indexing into a value: arr[0]
+type IndexExpression struct {
+	Span
+	Token token.Token // the '[' token
+	Left  Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) String() string {
+	return "(" + ie.Left.String() + "[" + ie.Index.String() + "])"
+}
+
+// HashLiteral represents a hash: {"name": "Ada", "age": 25}
+type HashLiteral struct {
+	Span
+	Token token.Token // the '{' token
+	Keys  []Expression
+	Pairs map[Expression]Expression
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) String() string {
+	pairs := []string{}
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+": "+hl.Pairs[key].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
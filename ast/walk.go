@@ -0,0 +1,120 @@
+package ast
+
+// =============================================================================
+// Walk - Generic traversal of the tree
+// =============================================================================
+
+// Walk visits node and everything under it depth-first, in source order.
+// fn is called on each node before its children; returning false skips
+// that node's children but the walk carries on with its siblings.
+func Walk(node Node, fn func(Node) bool) {
+	if node == nil || !fn(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			Walk(s, fn)
+		}
+
+	// Statements
+	case *MakeStatement:
+		walkIdent(n.Name, fn)
+		walkExpr(n.Value, fn)
+	case *AssignStatement:
+		walkIdent(n.Name, fn)
+		walkExpr(n.Value, fn)
+	case *BringStatement:
+		walkExpr(n.ReturnValue, fn)
+	case *ExpressionStatement:
+		walkExpr(n.Expression, fn)
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			Walk(s, fn)
+		}
+
+	// Operators
+	case *PrefixExpression:
+		walkExpr(n.Right, fn)
+	case *InfixExpression:
+		walkExpr(n.Left, fn)
+		walkExpr(n.Right, fn)
+	case *ChainExpression:
+		walkExpr(n.Chain, fn)
+	case *BindExpression:
+		walkIdent(n.Name, fn)
+		walkExpr(n.Value, fn)
+
+	// Control flow
+	case *SupposeExpression:
+		walkExpr(n.Condition, fn)
+		walkBlock(n.Consequence, fn)
+		walkBlock(n.Alternative, fn)
+	case *WhileExpression:
+		walkExpr(n.Condition, fn)
+		walkBlock(n.Body, fn)
+		walkBlock(n.Otherwise, fn)
+	case *ForExpression:
+		walkIdent(n.Variable, fn)
+		walkExpr(n.From, fn)
+		walkExpr(n.To, fn)
+		walkBlock(n.Body, fn)
+	case *TryExpression:
+		walkBlock(n.Body, fn)
+		walkIdent(n.Name, fn)
+		walkBlock(n.Rescue, fn)
+
+	// Functions
+	case *DoExpression:
+		walkIdent(n.Name, fn)
+		for _, p := range n.Parameters {
+			walkIdent(p, fn)
+		}
+		walkIdent(n.ReturnType, fn)
+		walkBlock(n.Body, fn)
+	case *CallExpression:
+		walkExpr(n.Function, fn)
+		for _, a := range n.Arguments {
+			walkExpr(a, fn)
+		}
+
+	// Collections
+	case *ArrayLiteral:
+		for _, el := range n.Elements {
+			walkExpr(el, fn)
+		}
+	case *IndexExpression:
+		walkExpr(n.Left, fn)
+		walkExpr(n.Index, fn)
+	case *HashLiteral:
+		for _, key := range n.Keys {
+			walkExpr(key, fn)
+			walkExpr(n.Pairs[key], fn)
+		}
+
+		// Identifier, literals, comot and kontinu have no children.
+	}
+}
+
+// The optional fields below are typed pointers, so a missing one would
+// reach Walk as a non-nil Node holding a nil pointer. These helpers stop
+// that from happening.
+
+func walkExpr(e Expression, fn func(Node) bool) {
+	if e != nil {
+		Walk(e, fn)
+	}
+}
+
+func walkBlock(b *BlockStatement, fn func(Node) bool) {
+	if b != nil {
+		Walk(b, fn)
+	}
+}
+
+func walkIdent(i *Identifier, fn func(Node) bool) {
+	if i != nil {
+		Walk(i, fn)
+	}
+}
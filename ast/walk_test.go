@@ -0,0 +1,96 @@
+package ast_test
+
+import (
+	"testing"
+
+	"pidgin-lang/ast"
+	"pidgin-lang/lexer"
+	"pidgin-lang/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parser errors for %q: %v", input, errs)
+	}
+	return program
+}
+
+func countIntegers(node ast.Node) int {
+	count := 0
+	ast.Walk(node, func(n ast.Node) bool {
+		if _, ok := n.(*ast.IntegerLiteral); ok {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+func TestWalkCountsIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"make x be 5", 1},
+		{"make x be 1 + 2 * -3", 3},
+		{"x be 4", 1},
+		{`yarn("no numbers here")`, 0},
+		{"suppose 1 no reach 2 { 3 } abi { 4 }", 4},
+		{"suppose tru { 1 }", 1},
+		{"dey do while 1 { comot } otherwise { 2 }", 2},
+		{"count i from 1 reach 10 { yarn(i * 2) }", 3},
+		{"try { 1 } rescue err { 2 }", 2},
+		{"do add(a, b) { bring a + b + 1 }", 1},
+		{"do (n) { bring n }(7)", 1},
+		{"[1, 2, [3, 4]][0]", 5},
+		{`{"a": 1, 2: 3}`, 3},
+		{"make f be do(x) { suppose x big pass 0 { bring f(x - 1) } bring 0 }", 3},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		if got := countIntegers(program); got != tt.expected {
+			t.Errorf("countIntegers(%q) = %d, want %d", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestWalkSkipsChildren(t *testing.T) {
+	program := parse(t, "make a be 1; do f() { bring 2 + 3 }; make b be 4")
+
+	count := 0
+	ast.Walk(program, func(n ast.Node) bool {
+		if _, ok := n.(*ast.IntegerLiteral); ok {
+			count++
+		}
+		_, isFunction := n.(*ast.DoExpression)
+		return !isFunction
+	})
+
+	if count != 2 {
+		t.Errorf("expected the walk to skip the function body and count 2 integers, got %d", count)
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	program := parse(t, "make x be 1 + 2")
+
+	var got []string
+	ast.Walk(program, func(n ast.Node) bool {
+		got = append(got, n.TokenLiteral())
+		return true
+	})
+
+	expected := []string{"make", "make", "x", "+", "1", "2"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d nodes, got %d: %v", len(expected), len(got), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("node %d: expected %q, got %q", i, expected[i], got[i])
+		}
+	}
+}
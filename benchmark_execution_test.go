@@ -207,6 +207,46 @@ func BenchmarkExecution_Loop1000_VM(b *testing.B) {
 	}
 }
 
+// ============================================================================
+// String Building Benchmarks
+// ============================================================================
+
+// Each round of '+' copies the whole string so far, where a builder only
+// adds the new piece
+
+func BenchmarkExecution_StringConcatLoop_Interpreter(b *testing.B) {
+	input := `
+	make s be ""
+	count i from 1 reach 2000 { s be s + "x" }
+	`
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		env := object.NewEnvironment()
+		_ = evaluator.Eval(program, env)
+	}
+}
+
+func BenchmarkExecution_StringBuilder_Interpreter(b *testing.B) {
+	input := `
+	make s be make_builder()
+	count i from 1 reach 2000 { append(s, "x") }
+	build(s)
+	`
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		env := object.NewEnvironment()
+		_ = evaluator.Eval(program, env)
+	}
+}
+
 // ============================================================================
 // Variable Access Benchmarks
 // ============================================================================
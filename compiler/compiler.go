@@ -2,6 +2,7 @@ package compiler
 
 import (
 	"fmt"
+	"math"
 	"sort"
 
 	"pidgin-lang/ast"
@@ -10,29 +11,70 @@ import (
 
 // Compiler compiles Pidgin AST into bytecode
 type Compiler struct {
-	chunk       *vm.Chunk      // Output bytecode chunk
-	symbolTable *SymbolTable   // Symbol table for variable tracking
-	scopeDepth  int            // Current scope nesting level
-	constants   map[string]int // Cache for constant indices
+	chunk       *vm.Chunk    // Output bytecode chunk
+	symbolTable *SymbolTable // Symbol table for variable tracking
+	scopeDepth  int          // Current scope nesting level
+	loops       []*loop      // Loops enclosing the code being compiled, innermost last
+	tries       int          // Try blocks enclosing the code being compiled
+	line        int          // Source line of the node being compiled
+	warnShadow  bool         // Record a warning when a local hides an outer variable
+	warnings    []string     // Warnings found while compiling
+	longJumps   map[int]int  // Jumps too far for a 16-bit offset, by position, with their targets
+	err         error        // First error found by code that can't return one, reported by Compile
+}
+
+// maxConstants is how many constants a chunk can hold, since OP_CONSTANT
+// takes a 16-bit index
+const maxConstants = math.MaxUint16 + 1
+
+// maxUpvalues is how many variables a function can capture, since
+// OP_GET_UPVALUE takes an 8-bit index
+const maxUpvalues = math.MaxUint8 + 1
+
+// loop collects the jumps comot and kontinu make while a loop body compiles
+type loop struct {
+	continueTarget int   // where kontinu loops back to, or -1 to jump forward
+	tries          int   // try blocks already open when the loop started
+	breakJumps     []int // comot jumps, patched to the loop's exit
+	continueJumps  []int // forward kontinu jumps, patched to the next round
 }
 
 // New creates a new compiler
 func New() *Compiler {
 	symbolTable := NewSymbolTable()
 
-	// Define builtins
-	symbolTable.DefineBuiltin(0, "yarn")
-	symbolTable.DefineBuiltin(1, "len")
-	symbolTable.DefineBuiltin(2, "type")
+	// Define builtins in the same order as the VM's dispatch table
+	for i, builtin := range vm.Builtins {
+		symbolTable.DefineBuiltin(i, builtin.Name)
+	}
 
 	return &Compiler{
 		chunk:       vm.NewChunk(),
 		symbolTable: symbolTable,
 		scopeDepth:  0,
-		constants:   make(map[string]int),
 	}
 }
 
+// WarnShadow makes the compiler record a warning each time a parameter or
+// a local hides a variable from an enclosing scope
+func (c *Compiler) WarnShadow() {
+	c.warnShadow = true
+}
+
+// Warnings returns the warnings recorded while compiling
+func (c *Compiler) Warnings() []string {
+	return c.warnings
+}
+
+// defineLocal defines name in the current function scope, warning first if
+// it hides a variable from an enclosing scope
+func (c *Compiler) defineLocal(name string) Symbol {
+	if _, outer := c.symbolTable.ResolveOuter(name); outer && c.warnShadow {
+		c.warnings = append(c.warnings, fmt.Sprintf("You dey shadow outer '%s' for line %d", name, c.line))
+	}
+	return c.symbolTable.Define(name)
+}
+
 // Compile compiles an AST program into bytecode
 func (c *Compiler) Compile(program *ast.Program) (*vm.Chunk, error) {
 	numStmts := len(program.Statements)
@@ -45,17 +87,24 @@ func (c *Compiler) Compile(program *ast.Program) (*vm.Chunk, error) {
 		}
 	}
 
+	if c.err != nil {
+		return nil, c.err
+	}
+
 	// Emit halt at the end
 	c.emit(vm.OP_HALT)
 
+	widenJumps(c.chunk, c.longJumps)
+	optimize(c.chunk)
+
 	return c.chunk, nil
 }
 
 // compileStatementWithContext compiles a statement with knowledge of whether it's the last one
 func (c *Compiler) compileStatementWithContext(stmt ast.Statement, isLast bool) error {
-	// For the last statement, don't pop expression results
-	if exprStmt, ok := stmt.(*ast.ExpressionStatement); ok && isLast {
-		return c.compileExpression(exprStmt.Expression)
+	// The last statement's value is what the program gives back
+	if isLast {
+		return c.compileStatementValue(stmt)
 	}
 
 	return c.compileStatement(stmt)
@@ -65,10 +114,29 @@ func (c *Compiler) compileStatementWithContext(stmt ast.Statement, isLast bool)
 // Statement Compilation
 // ============================================================================
 
+// compileStatement compiles a statement for its effects only.
+//
+// Stack discipline: every statement compiled here leaves the stack as it
+// found it, and every expression pushes exactly one value. Blocks used as
+// values (suppose branches, function bodies) go through compileBlockValue,
+// and the program's last statement through compileStatementValue, which
+// leave exactly one value. Loop bodies are plain statements, so a loop
+// round never grows the stack.
+//
+// OP_JUMP_IF_LIE and OP_JUMP_IF_TRU pop their condition, which suits
+// suppose and loops. 'and' and 'abi' give back the operand that decided
+// them, so they use the _PEEK variants, which leave it in place.
 func (c *Compiler) compileStatement(stmt ast.Statement) error {
+	defer c.setLine(stmt)()
+
 	switch node := stmt.(type) {
 
 	case *ast.ExpressionStatement:
+		// A suppose whose value nobody uses needs no value on either branch
+		if suppose, ok := node.Expression.(*ast.SupposeExpression); ok {
+			return c.compileSupposeStatement(suppose)
+		}
+
 		// Compile the expression
 		if err := c.compileExpression(node.Expression); err != nil {
 			return err
@@ -78,47 +146,26 @@ func (c *Compiler) compileStatement(stmt ast.Statement) error {
 		return nil
 
 	case *ast.MakeStatement:
-		// Compile the value first
-		if err := c.compileExpression(node.Value); err != nil {
+		if err := c.compileMakeStatement(node); err != nil {
 			return err
 		}
+		c.emit(vm.OP_POP)
+		return nil
 
-		// Define or set the variable
-		name := node.Name.Value
-		symbol, exists := c.symbolTable.Resolve(name)
-
-		if c.scopeDepth == 0 {
-			// Global scope
-			if !exists {
-				symbol = c.symbolTable.Define(name)
-			}
-
-			// Add variable name to constants pool
-			nameStr := c.chunk.InternString(name)
-			idx := c.addConstant(vm.NewString(nameStr))
-
-			c.emitShort(vm.OP_SET_GLOBAL, uint16(idx))
-		} else {
-			// Local scope
-			if !exists {
-				symbol = c.symbolTable.Define(name)
-			}
-
-			// Emit optimized SET_LOCAL for first two locals
-			if symbol.Index == 0 {
-				c.emit(vm.OP_SET_LOCAL_0)
-			} else if symbol.Index == 1 {
-				c.emit(vm.OP_SET_LOCAL_1)
-			} else {
-				c.emitByte(vm.OP_SET_LOCAL, byte(symbol.Index))
-			}
+	case *ast.AssignStatement:
+		if err := c.compileAssignStatement(node); err != nil {
+			return err
 		}
-
+		c.emit(vm.OP_POP)
 		return nil
 
 	case *ast.BringStatement:
 		// Compile the return value
-		if node.ReturnValue != nil {
+		if c.isTailPosition(node, false) {
+			if err := c.compileCall(node.ReturnValue.(*ast.CallExpression), true); err != nil {
+				return err
+			}
+		} else if node.ReturnValue != nil {
 			if err := c.compileExpression(node.ReturnValue); err != nil {
 				return err
 			}
@@ -129,20 +176,33 @@ func (c *Compiler) compileStatement(stmt ast.Statement) error {
 		c.emit(vm.OP_BRING)
 		return nil
 
+	case *ast.BreakStatement:
+		if len(c.loops) == 0 {
+			return fmt.Errorf("'%s' fit only dey inside loop", node.Token.Literal)
+		}
+		current := c.loops[len(c.loops)-1]
+		c.leaveTries(current)
+		current.breakJumps = append(current.breakJumps, c.emitJump(vm.OP_JUMP))
+		return nil
+
+	case *ast.ContinueStatement:
+		if len(c.loops) == 0 {
+			return fmt.Errorf("'%s' fit only dey inside loop", node.Token.Literal)
+		}
+		current := c.loops[len(c.loops)-1]
+		c.leaveTries(current)
+		if current.continueTarget >= 0 {
+			c.emitLoop(current.continueTarget)
+		} else {
+			current.continueJumps = append(current.continueJumps, c.emitJump(vm.OP_JUMP))
+		}
+		return nil
+
 	case *ast.BlockStatement:
-		numStmts := len(node.Statements)
-		for i, stmt := range node.Statements {
-			isLast := (i == numStmts-1)
-
-			// Don't pop the last expression in a block (it becomes the block's value)
-			if exprStmt, ok := stmt.(*ast.ExpressionStatement); ok && isLast {
-				if err := c.compileExpression(exprStmt.Expression); err != nil {
-					return err
-				}
-			} else {
-				if err := c.compileStatement(stmt); err != nil {
-					return err
-				}
+		// A block run for its effects, like a loop body, keeps nothing
+		for _, stmt := range node.Statements {
+			if err := c.compileStatement(stmt); err != nil {
+				return err
 			}
 		}
 		return nil
@@ -152,16 +212,108 @@ func (c *Compiler) compileStatement(stmt ast.Statement) error {
 	}
 }
 
+// compileMakeStatement defines or sets the variable, leaving its new value
+// on the stack
+func (c *Compiler) compileMakeStatement(node *ast.MakeStatement) error {
+	// Compile the value first
+	if err := c.compileExpression(node.Value); err != nil {
+		return err
+	}
+
+	// Define or set the variable
+	name := node.Name.Value
+	var symbol Symbol
+	var exists bool
+
+	if c.scopeDepth == 0 {
+		// Global scope: a variable named like a builtin replaces the
+		// builtin from here on, as it does in the interpreter
+		symbol, exists = c.symbolTable.Resolve(name)
+		if !exists || symbol.Scope == SCOPE_BUILTIN {
+			symbol = c.symbolTable.Define(name)
+		}
+	} else {
+		// Local scope: names from outside the function get a new local
+		symbol, exists = c.symbolTable.ResolveLocal(name)
+		if !exists {
+			symbol = c.defineLocal(name)
+		}
+	}
+	c.emitSetSymbol(symbol)
+
+	return nil
+}
+
+// compileAssignStatement changes an existing variable, leaving its new
+// value on the stack
+func (c *Compiler) compileAssignStatement(node *ast.AssignStatement) error {
+	// Only variables made earlier can change, so nothing new is defined
+	name := node.Name.Value
+	symbol, exists := c.symbolTable.Resolve(name)
+	if !exists || symbol.Scope == SCOPE_BUILTIN {
+		return fmt.Errorf("You never make %s, so you no fit change am", name)
+	}
+
+	if err := c.compileExpression(node.Value); err != nil {
+		return err
+	}
+	c.emitSetSymbol(symbol)
+
+	return nil
+}
+
+// compileBlockValue compiles a block whose value is used, leaving exactly
+// one value on the stack: nothing for an empty block
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	n := len(block.Statements)
+	if n == 0 {
+		c.emit(vm.OP_NOTHING)
+		return nil
+	}
+
+	for _, stmt := range block.Statements[:n-1] {
+		if err := c.compileStatement(stmt); err != nil {
+			return err
+		}
+	}
+	return c.compileStatementValue(block.Statements[n-1])
+}
+
+// compileStatementValue compiles the last statement of a block so it leaves
+// the block's value: an expression's value, the value a make or assignment
+// stored, or nothing, as in the interpreter
+func (c *Compiler) compileStatementValue(stmt ast.Statement) error {
+	switch node := stmt.(type) {
+	case *ast.ExpressionStatement:
+		return c.compileExpression(node.Expression)
+	case *ast.MakeStatement:
+		return c.compileMakeStatement(node)
+	case *ast.AssignStatement:
+		return c.compileAssignStatement(node)
+	}
+
+	if err := c.compileStatement(stmt); err != nil {
+		return err
+	}
+	c.emit(vm.OP_NOTHING)
+	return nil
+}
+
 // ============================================================================
 // Expression Compilation
 // ============================================================================
 
 func (c *Compiler) compileExpression(expr ast.Expression) error {
+	defer c.setLine(expr)()
+
 	switch node := expr.(type) {
 
 	case *ast.IntegerLiteral:
 		return c.compileIntegerLiteral(node)
 
+	case *ast.FloatLiteral:
+		return c.compileFloatLiteral(node)
+
 	case *ast.StringLiteral:
 		return c.compileStringLiteral(node)
 
@@ -176,20 +328,44 @@ func (c *Compiler) compileExpression(expr ast.Expression) error {
 		return c.compileIdentifier(node)
 
 	case *ast.PrefixExpression:
+		if value, ok := foldConstant(node); ok {
+			c.emitConstant(value)
+			return nil
+		}
 		return c.compilePrefixExpression(node)
 
 	case *ast.InfixExpression:
+		if value, ok := foldConstant(node); ok {
+			c.emitConstant(value)
+			return nil
+		}
 		return c.compileInfixExpression(node)
 
+	case *ast.ChainExpression:
+		if value, ok := foldConstant(node); ok {
+			c.emitConstant(value)
+			return nil
+		}
+		return c.compileChainExpression(node)
+
 	case *ast.SupposeExpression:
 		return c.compileSupposeExpression(node)
 
 	case *ast.WhileExpression:
 		return c.compileWhileExpression(node)
 
+	case *ast.ForExpression:
+		return c.compileForExpression(node)
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+
 	case *ast.CallExpression:
 		return c.compileCallExpression(node)
 
+	case *ast.DoExpression:
+		return c.compileDoExpression(node)
+
 	default:
 		return fmt.Errorf("unknown expression type: %T", expr)
 	}
@@ -200,8 +376,16 @@ func (c *Compiler) compileExpression(expr ast.Expression) error {
 // ============================================================================
 
 func (c *Compiler) compileIntegerLiteral(node *ast.IntegerLiteral) error {
-	val := node.Value
+	// NewInt would quietly cut a bigger literal down to 48 bits
+	if node.Value < vm.MIN_INT_48 || node.Value > vm.MAX_INT_48 {
+		return fmt.Errorf("Number too big for Pidgin: %d (line %d)", node.Value, node.Token.Line)
+	}
+	c.emitInteger(node.Value)
+	return nil
+}
 
+// emitInteger pushes an integer, inline when it is small enough
+func (c *Compiler) emitInteger(val int64) {
 	// Optimize for common small integers
 	if val == 0 {
 		c.emit(vm.OP_CONST_0)
@@ -220,7 +404,11 @@ func (c *Compiler) compileIntegerLiteral(node *ast.IntegerLiteral) error {
 		idx := c.addConstant(vm.NewInt(val))
 		c.emitShort(vm.OP_CONSTANT, uint16(idx))
 	}
+}
 
+func (c *Compiler) compileFloatLiteral(node *ast.FloatLiteral) error {
+	idx := c.addConstant(vm.NewFloat(node.Value))
+	c.emitShort(vm.OP_CONSTANT, uint16(idx))
 	return nil
 }
 
@@ -249,13 +437,23 @@ func (c *Compiler) compileIdentifier(node *ast.Identifier) error {
 	symbol, ok := c.symbolTable.Resolve(name)
 
 	if !ok {
-		return fmt.Errorf("I no sabi dis one: %s", name)
+		if c.tries == 0 {
+			return fmt.Errorf("I no sabi dis one: %s", name)
+		}
+		// Inside a try block the name is looked up when it runs, so not
+		// knowing it is an error the rescue code can catch
+		symbol = Symbol{Name: name, Scope: SCOPE_GLOBAL}
 	}
 
+	return c.emitGetSymbol(symbol)
+}
+
+// emitGetSymbol pushes the value a resolved symbol refers to
+func (c *Compiler) emitGetSymbol(symbol Symbol) error {
 	switch symbol.Scope {
 	case SCOPE_GLOBAL:
 		// Add variable name to constants pool
-		nameStr := c.chunk.InternString(name)
+		nameStr := c.chunk.InternString(symbol.Name)
 		idx := c.addConstant(vm.NewString(nameStr))
 		c.emitShort(vm.OP_GET_GLOBAL, uint16(idx))
 
@@ -273,6 +471,9 @@ func (c *Compiler) compileIdentifier(node *ast.Identifier) error {
 			c.emitByte(vm.OP_GET_LOCAL, byte(symbol.Index))
 		}
 
+	case SCOPE_UPVALUE:
+		c.emitByte(vm.OP_GET_UPVALUE, byte(symbol.Index))
+
 	case SCOPE_BUILTIN:
 		// Push builtin function reference
 		idx := c.addConstant(vm.NewBuiltin(symbol.Index))
@@ -285,6 +486,41 @@ func (c *Compiler) compileIdentifier(node *ast.Identifier) error {
 	return nil
 }
 
+// emitSetSymbol stores the value on top of the stack into a symbol,
+// leaving the value on the stack
+func (c *Compiler) emitSetSymbol(symbol Symbol) {
+	if symbol.Scope == SCOPE_UPVALUE {
+		c.emitByte(vm.OP_SET_UPVALUE, byte(symbol.Index))
+		return
+	}
+	if symbol.Scope != SCOPE_LOCAL {
+		// Add variable name to constants pool
+		nameStr := c.chunk.InternString(symbol.Name)
+		idx := c.addConstant(vm.NewString(nameStr))
+		c.emitShort(vm.OP_SET_GLOBAL, uint16(idx))
+		return
+	}
+
+	// Emit optimized SET_LOCAL for first two locals
+	if symbol.Index == 0 {
+		c.emit(vm.OP_SET_LOCAL_0)
+	} else if symbol.Index == 1 {
+		c.emit(vm.OP_SET_LOCAL_1)
+	} else {
+		c.emitByte(vm.OP_SET_LOCAL, byte(symbol.Index))
+	}
+}
+
+// emitUnbind leaves symbol holding the mark that says name has gone out of
+// scope. Reading it through a global or an upvalue fails with name unknown.
+func (c *Compiler) emitUnbind(symbol Symbol, name string) {
+	nameStr := c.chunk.InternString(name)
+	idx := c.addConstant(vm.NewString(nameStr))
+	c.emitShort(vm.OP_UNBOUND, uint16(idx))
+	c.emitSetSymbol(symbol)
+	c.emit(vm.OP_POP)
+}
+
 // ============================================================================
 // Operator Compilation
 // ============================================================================
@@ -324,21 +560,37 @@ func (c *Compiler) compileInfixExpression(node *ast.InfixExpression) error {
 		return err
 	}
 
+	if op, n, ok := shiftFor(node); ok {
+		c.emitByte(op, n)
+		return nil
+	}
+
 	// Compile right operand
 	if err := c.compileExpression(node.Right); err != nil {
 		return err
 	}
 
-	// Emit the operator
+	return c.emitInfixOperator(node)
+}
+
+// emitInfixOperator emits the instruction for node's operator, once both
+// operands are on the stack
+func (c *Compiler) emitInfixOperator(node *ast.InfixExpression) error {
 	switch node.Operator {
 	case "+":
-		c.emit(vm.OP_ADD)
+		if isStringExpression(node.Left) && isStringExpression(node.Right) {
+			c.emit(vm.OP_CONCAT)
+		} else {
+			c.emit(vm.OP_ADD)
+		}
 	case "-":
 		c.emit(vm.OP_SUB)
 	case "*":
 		c.emit(vm.OP_MUL)
 	case "/":
 		c.emit(vm.OP_DIV)
+	case "%":
+		c.emit(vm.OP_MOD)
 	case "be", "na", "==":
 		c.emit(vm.OP_EQUAL)
 	case "no be", "!=":
@@ -347,6 +599,10 @@ func (c *Compiler) compileInfixExpression(node *ast.InfixExpression) error {
 		c.emit(vm.OP_GREATER)
 	case "no reach", "<":
 		c.emit(vm.OP_LESS)
+	case "reach", ">=":
+		c.emit(vm.OP_GREATER_EQUAL)
+	case "<=":
+		c.emit(vm.OP_LESS_EQUAL)
 	default:
 		return fmt.Errorf("unknown infix operator: %s", node.Operator)
 	}
@@ -362,11 +618,8 @@ func (c *Compiler) compileShortCircuitAnd(node *ast.InfixExpression) error {
 		return err
 	}
 
-	// Duplicate it for the jump condition
-	c.emit(vm.OP_DUP)
-
-	// Jump if left is false (short-circuit)
-	jumpIfFalse := c.emitJump(vm.OP_JUMP_IF_LIE)
+	// Jump if left is false (short-circuit), keeping it as the result
+	jumpIfFalse := c.emitJump(vm.OP_JUMP_IF_LIE_PEEK)
 
 	// Left was true, pop it and evaluate right
 	c.emit(vm.OP_POP)
@@ -388,11 +641,8 @@ func (c *Compiler) compileShortCircuitOr(node *ast.InfixExpression) error {
 		return err
 	}
 
-	// Duplicate it for the jump condition
-	c.emit(vm.OP_DUP)
-
-	// Jump if left is true (short-circuit)
-	jumpIfTrue := c.emitJump(vm.OP_JUMP_IF_TRU)
+	// Jump if left is true (short-circuit), keeping it as the result
+	jumpIfTrue := c.emitJump(vm.OP_JUMP_IF_TRU_PEEK)
 
 	// Left was false, pop it and evaluate right
 	c.emit(vm.OP_POP)
@@ -406,21 +656,118 @@ func (c *Compiler) compileShortCircuitOr(node *ast.InfixExpression) error {
 	return nil
 }
 
+// compileChainExpression compiles a chained comparison one link after
+// another, jumping to the end with the result of the first link that
+// fails. A middle operand the parser bound stays on the stack under that
+// link's result, where the next link finds it as its left side, so the
+// hidden variable never takes a slot and is gone when the chain is.
+func (c *Compiler) compileChainExpression(node *ast.ChainExpression) error {
+	links := chainLinks(node.Chain)
+
+	// Jumps taken with a bound operand still under the result, and without
+	var bound, plain []int
+	kept := false
+	for i, link := range links {
+		if !kept {
+			if err := c.compileExpression(link.Left); err != nil {
+				return err
+			}
+		}
+
+		right := link.Right
+		bind, binds := right.(*ast.BindExpression)
+		if binds {
+			right = bind.Value
+		}
+		if err := c.compileExpression(right); err != nil {
+			return err
+		}
+		if binds {
+			// left, value becomes value, left, value
+			c.emit(vm.OP_SWAP)
+			c.emit(vm.OP_OVER)
+		}
+
+		restore := c.setLine(link)
+		err := c.emitInfixOperator(link)
+		restore()
+		if err != nil {
+			return err
+		}
+
+		if i == len(links)-1 {
+			break
+		}
+		jump := c.emitJump(vm.OP_JUMP_IF_LIE_PEEK)
+		if binds {
+			bound = append(bound, jump)
+		} else {
+			plain = append(plain, jump)
+		}
+		c.emit(vm.OP_POP)
+		kept = binds
+	}
+
+	if len(bound) > 0 {
+		done := c.emitJump(vm.OP_JUMP)
+		for _, jump := range bound {
+			c.patchJump(jump)
+		}
+		c.emit(vm.OP_SWAP)
+		c.emit(vm.OP_POP)
+		c.patchJump(done)
+	}
+	for _, jump := range plain {
+		c.patchJump(jump)
+	}
+
+	return nil
+}
+
+// chainLinks lists the comparisons a desugared chain is made of, in order
+func chainLinks(chain *ast.InfixExpression) []*ast.InfixExpression {
+	link := chain.Right.(*ast.InfixExpression)
+	left := chain.Left.(*ast.InfixExpression)
+	if left.Operator == "and" {
+		return append(chainLinks(left), link)
+	}
+	return []*ast.InfixExpression{left, link}
+}
+
 // ============================================================================
 // Control Flow Compilation
 // ============================================================================
 
+// compileCondition compiles a suppose or while condition and emits the
+// jump taken when it doesn't hold. A negated condition leaves out its
+// OP_NOT and jumps on the operand being true instead; OP_NOT gives the
+// operand's falsiness, so the two always agree.
+func (c *Compiler) compileCondition(condition ast.Expression) (int, error) {
+	jump := vm.OP_JUMP_IF_LIE
+	for {
+		prefix, ok := condition.(*ast.PrefixExpression)
+		if !ok || (prefix.Operator != "!" && prefix.Operator != "no" && prefix.Operator != "no be") {
+			break
+		}
+		condition = prefix.Right
+		jump = invertedJump[jump]
+	}
+
+	if err := c.compileExpression(condition); err != nil {
+		return 0, err
+	}
+	return c.emitJump(jump), nil
+}
+
 func (c *Compiler) compileSupposeExpression(node *ast.SupposeExpression) error {
-	// Compile condition
-	if err := c.compileExpression(node.Condition); err != nil {
+	// Compile condition, jumping to the alternative if it's false
+	jumpIfFalse, err := c.compileCondition(node.Condition)
+	if err != nil {
 		return err
 	}
 
-	// Jump if condition is false
-	jumpIfFalse := c.emitJump(vm.OP_JUMP_IF_LIE)
-
 	// Compile consequence
-	if err := c.compileStatement(node.Consequence); err != nil {
+	if err := c.compileBlockValue(node.Consequence); err != nil {
 		return err
 	}
 
@@ -432,7 +779,7 @@ func (c *Compiler) compileSupposeExpression(node *ast.SupposeExpression) error {
 
 	// Compile alternative (or push nothing if there isn't one)
 	if node.Alternative != nil {
-		if err := c.compileStatement(node.Alternative); err != nil {
+		if err := c.compileBlockValue(node.Alternative); err != nil {
 			return err
 		}
 	} else {
@@ -445,40 +792,463 @@ func (c *Compiler) compileSupposeExpression(node *ast.SupposeExpression) error {
 	return nil
 }
 
+// compileSupposeStatement compiles a suppose used as a statement. Both
+// branches are run for their effects only, so there is no nothing to push
+// for a missing abi and no value to pop afterwards.
+func (c *Compiler) compileSupposeStatement(node *ast.SupposeExpression) error {
+	jumpIfFalse, err := c.compileCondition(node.Condition)
+	if err != nil {
+		return err
+	}
+
+	if err := c.compileStatement(node.Consequence); err != nil {
+		return err
+	}
+
+	if node.Alternative == nil {
+		c.patchJump(jumpIfFalse)
+		return nil
+	}
+
+	jumpEnd := c.emitJump(vm.OP_JUMP)
+	c.patchJump(jumpIfFalse)
+
+	if err := c.compileStatement(node.Alternative); err != nil {
+		return err
+	}
+
+	c.patchJump(jumpEnd)
+
+	return nil
+}
+
 func (c *Compiler) compileWhileExpression(node *ast.WhileExpression) error {
 	// Mark loop start
 	loopStart := c.chunk.Count()
 
-	// Compile condition
-	if err := c.compileExpression(node.Condition); err != nil {
+	// Compile condition, jumping out of the loop if it's false
+	exitJump, err := c.compileCondition(node.Condition)
+	if err != nil {
 		return err
 	}
 
-	// Jump if condition is false (exit loop)
-	exitJump := c.emitJump(vm.OP_JUMP_IF_LIE)
-
-	// Compile loop body
-	if err := c.compileStatement(node.Body); err != nil {
+	// Compile loop body, where kontinu goes straight back to the condition
+	current := c.enterLoop(loopStart)
+	err = c.compileStatement(node.Body)
+	c.leaveLoop()
+	if err != nil {
 		return err
 	}
 
 	// Loop back to start
 	c.emitLoop(loopStart)
 
-	// Patch exit jump
+	// Patch exit jump, and send comot to the same place
 	c.patchJump(exitJump)
 
+	// The condition turning false runs otherwise, which gives the loop its
+	// value. comot skips it.
+	if node.Otherwise != nil {
+		if err := c.compileBlockValue(node.Otherwise); err != nil {
+			return err
+		}
+		skipBreak := c.emitJump(vm.OP_JUMP)
+		c.patchJumps(current.breakJumps)
+		c.emit(vm.OP_NOTHING)
+		c.patchJump(skipBreak)
+		return nil
+	}
+
+	c.patchJumps(current.breakJumps)
+
 	// Push nothing as the result (loops return nothing)
 	c.emit(vm.OP_NOTHING)
 
 	return nil
 }
 
+// compileForExpression lowers a count loop onto the while loop's jumps.
+// A new name counts in a hidden variable the name points at only while
+// the body compiles, and which is marked unbound when the loop ends. A
+// name the scope already has counts in place and gets its old value back
+// afterwards, as the interpreter does. Inside a try block the loop gets a
+// try of its own, so an error leaving the body tidies up the same way
+// before the outer rescue sees it. The bound stays on the stack under the
+// body, where OP_OVER copies it up for each check.
+func (c *Compiler) compileForExpression(node *ast.ForExpression) error {
+	name := node.Variable.Value
+	pos := fmt.Sprintf("@%d:%d", node.Token.Line, node.Token.Column)
+
+	// Both ends are worked out before the variable changes, so they
+	// still see what the name meant before the loop
+	if err := c.compileExpression(node.From); err != nil {
+		return err
+	}
+	if err := c.compileExpression(node.To); err != nil {
+		return err
+	}
+
+	// A name this scope already has counts in its own variable, so
+	// closures made in the body capture that variable. Its old value
+	// waits in a hidden slot and goes back when the loop ends.
+	counter, hadPrevious := c.symbolTable.ResolveOwn(name)
+	var saved Symbol
+	if hadPrevious {
+		saved = c.symbolTable.Define(name + "@saved" + pos)
+		if err := c.emitGetSymbol(counter); err != nil {
+			return err
+		}
+		c.emitSetSymbol(saved)
+		c.emit(vm.OP_POP)
+	} else {
+		var restore func()
+		counter, restore = c.symbolTable.DefineShadow(name, name+pos)
+		defer restore()
+	}
+
+	// The start goes into the counter, leaving the bound
+	c.emit(vm.OP_SWAP)
+	c.emitSetSymbol(counter)
+	c.emit(vm.OP_POP)
+
+	// A hidden counter is marked unbound, so a closure from the body
+	// that reads it after the loop fails the way the interpreter does
+	leave := func() error {
+		if !hadPrevious {
+			c.emitUnbind(counter, name)
+			return nil
+		}
+		if err := c.emitGetSymbol(saved); err != nil {
+			return err
+		}
+		c.emitSetSymbol(counter)
+		c.emit(vm.OP_POP)
+		return nil
+	}
+
+	// Outside a try block an error stops the program or becomes a value
+	// in place, so only code a rescue carries on with needs the loop's
+	// own try
+	guarded := c.tries > 0
+	var try int
+	if guarded {
+		try = c.emit(vm.OP_TRY)
+		for i := 0; i < 3; i++ {
+			c.chunk.WriteByte(0xFF, c.line) // Placeholder
+		}
+		c.tries++
+	}
+
+	// Loop while counter <= bound
+	loopStart := c.chunk.Count()
+	if err := c.emitGetSymbol(counter); err != nil {
+		return err
+	}
+	c.emit(vm.OP_OVER)
+	c.emit(vm.OP_LESS_EQUAL)
+	exitJump := c.emitJump(vm.OP_JUMP_IF_LIE)
+
+	// kontinu can't loop back yet since the counter still needs bumping
+	current := c.enterLoop(-1)
+	err := c.compileStatement(node.Body)
+	c.leaveLoop()
+	if err != nil {
+		return err
+	}
+
+	// counter = counter + 1
+	c.patchJumps(current.continueJumps)
+	if err := c.emitGetSymbol(counter); err != nil {
+		return err
+	}
+	c.emit(vm.OP_CONST_1)
+	c.emit(vm.OP_ADD)
+	c.emitSetSymbol(counter)
+	c.emit(vm.OP_POP)
+
+	c.emitLoop(loopStart)
+	c.patchJump(exitJump)
+	c.patchJumps(current.breakJumps)
+
+	if !guarded {
+		if err := leave(); err != nil {
+			return err
+		}
+	} else {
+		c.tries--
+		c.emit(vm.OP_END_TRY)
+		if err := leave(); err != nil {
+			return err
+		}
+		jumpEnd := c.emitJump(vm.OP_JUMP)
+
+		// The rescue puts the variable right, then hands the error on
+		rescue := c.chunk.Count()
+		if _, ok := jumpOffset(vm.OP_TRY, try, rescue); !ok {
+			return fmt.Errorf("Count loop too long: e no fit pass %d bytes (line %d)", maxLongJump, node.Token.Line)
+		}
+		setJumpTarget(c.chunk.Code, try, rescue)
+		if err := leave(); err != nil {
+			return err
+		}
+		c.emit(vm.OP_THROW)
+		c.patchJump(jumpEnd)
+	}
+
+	// Drop the bound, and push nothing as the result (loops return nothing)
+	c.emit(vm.OP_POP)
+	c.emit(vm.OP_NOTHING)
+
+	return nil
+}
+
+// compileTryExpression compiles the try block between OP_TRY and OP_END_TRY,
+// leaving its value. The rescue code comes after it. A failure lands there
+// with the error's message on the stack, which goes into a hidden variable
+// the rescue name points at while the rescue block compiles, as a count
+// loop's variable does. The rescue block's value is then the try's value.
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	try := c.emit(vm.OP_TRY)
+	for i := 0; i < 3; i++ {
+		c.chunk.WriteByte(0xFF, c.line) // Placeholder
+	}
+
+	c.tries++
+	err := c.compileBlockValue(node.Body)
+	c.tries--
+	if err != nil {
+		return err
+	}
+	c.emit(vm.OP_END_TRY)
+	jumpEnd := c.emitJump(vm.OP_JUMP)
+
+	rescue := c.chunk.Count()
+	if _, ok := jumpOffset(vm.OP_TRY, try, rescue); !ok {
+		return fmt.Errorf("Try block too long: e no fit pass %d bytes (line %d)", maxLongJump, node.Token.Line)
+	}
+	setJumpTarget(c.chunk.Code, try, rescue)
+
+	name := node.Name.Value
+	pos := fmt.Sprintf("@%d:%d", node.Token.Line, node.Token.Column)
+	message, restore := c.symbolTable.DefineShadow(name, name+pos)
+	defer restore()
+	c.emitSetSymbol(message)
+	c.emit(vm.OP_POP)
+
+	if err := c.compileBlockValue(node.Rescue); err != nil {
+		return err
+	}
+	c.patchJump(jumpEnd)
+
+	return nil
+}
+
+// ============================================================================
+// Function Compilation
+// ============================================================================
+
+// compileDoExpression compiles a function body into its own chunk and pushes
+// the resulting function. Named functions are also bound in the enclosing scope.
+func (c *Compiler) compileDoExpression(node *ast.DoExpression) error {
+	name := ""
+	var symbol Symbol
+	if node.Name != nil {
+		name = node.Name.Value
+
+		// Define the name before compiling the body so the function can call itself
+		var existing Symbol
+		var exists bool
+		if c.scopeDepth > 0 {
+			existing, exists = c.symbolTable.ResolveLocal(name)
+		} else {
+			existing, exists = c.symbolTable.Resolve(name)
+		}
+		if exists && existing.Scope != SCOPE_BUILTIN {
+			symbol = existing
+		} else if c.scopeDepth > 0 {
+			symbol = c.defineLocal(name)
+		} else {
+			symbol = c.symbolTable.Define(name)
+		}
+	}
+
+	// The VM checks the declared return type each time the function
+	// brings something back, so only the name needs checking here
+	returnType := ""
+	if node.ReturnType != nil {
+		returnType = node.ReturnType.Value
+		if _, ok := vm.ReturnTypes[returnType]; !ok {
+			return fmt.Errorf("I no sabi dis return type: %s", returnType)
+		}
+	}
+
+	// Compile the body into a fresh chunk with its own scope. Loops
+	// outside the function can't be left from inside it.
+	enclosingChunk := c.chunk
+	enclosingTable := c.symbolTable
+	enclosingLoops := c.loops
+	enclosingTries := c.tries
+	enclosingLongJumps := c.longJumps
+	c.chunk = vm.NewChunk()
+	c.symbolTable = NewEnclosedSymbolTable(enclosingTable)
+	c.loops = nil
+	c.tries = 0
+	c.longJumps = nil
+	c.scopeDepth++
+
+	// Parameters are the first locals, in the order the caller pushed them
+	for _, param := range node.Parameters {
+		c.defineLocal(param.Value)
+	}
+
+	err := c.compileFunctionBody(node.Body)
+	widenJumps(c.chunk, c.longJumps)
+	optimize(c.chunk)
+
+	fn := &vm.Function{
+		Arity:      len(node.Parameters),
+		Chunk:      c.chunk,
+		Name:       name,
+		LocalCount: c.symbolTable.NumDefinitions(),
+		ReturnType: returnType,
+	}
+
+	// Each captured variable is a local or an upvalue of the enclosing function
+	free := c.symbolTable.FreeSymbols
+	for _, symbol := range free {
+		fn.Captures = append(fn.Captures, vm.Capture{
+			IsLocal: symbol.Scope == SCOPE_LOCAL,
+			Index:   symbol.Index,
+		})
+	}
+	if len(free) > maxUpvalues && err == nil {
+		err = fmt.Errorf("Upvalue dem too plenty: one function fit catch only %d (line %d)", maxUpvalues, c.line)
+	}
+
+	c.chunk = enclosingChunk
+	c.symbolTable = enclosingTable
+	c.loops = enclosingLoops
+	c.tries = enclosingTries
+	c.longJumps = enclosingLongJumps
+	c.scopeDepth--
+
+	if err != nil {
+		return err
+	}
+
+	// A function that captures nothing is the same every time, so only
+	// one that captures needs a fresh closure
+	idx := c.checkConstant(c.chunk.AddFunction(fn))
+	if len(fn.Captures) > 0 {
+		c.emitShort(vm.OP_CLOSURE, uint16(idx))
+	} else {
+		c.emitShort(vm.OP_CONSTANT, uint16(idx))
+	}
+
+	if node.Name == nil {
+		return nil
+	}
+
+	// Bind the name, leaving the function on the stack as the expression's value
+	c.emitSetSymbol(symbol)
+
+	return nil
+}
+
+// compileFunctionBody compiles a function body so it always ends by bringing
+// a value: the last expression if there is one, otherwise nothing
+func (c *Compiler) compileFunctionBody(body *ast.BlockStatement) error {
+	n := len(body.Statements)
+	if last, ok := lastExpression(body); ok && c.isTailPosition(last, true) {
+		for _, stmt := range body.Statements[:n-1] {
+			if err := c.compileStatement(stmt); err != nil {
+				return err
+			}
+		}
+		if err := c.compileCall(last.Expression.(*ast.CallExpression), true); err != nil {
+			return err
+		}
+	} else if _, ok := lastStatement(body).(*ast.BringStatement); ok {
+		// The bring hands its value back itself, so the body never ends
+		for _, stmt := range body.Statements {
+			if err := c.compileStatement(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	} else if err := c.compileBlockValue(body); err != nil {
+		return err
+	}
+
+	// Running off the end of the body returns its value
+	c.emit(vm.OP_RETURN)
+	return nil
+}
+
+// lastStatement gives the statement that ends block, or nil if it's empty
+func lastStatement(block *ast.BlockStatement) ast.Statement {
+	if len(block.Statements) == 0 {
+		return nil
+	}
+	return block.Statements[len(block.Statements)-1]
+}
+
+// lastExpression gives the expression statement that ends block, if any
+func lastExpression(block *ast.BlockStatement) (*ast.ExpressionStatement, bool) {
+	n := len(block.Statements)
+	if n == 0 {
+		return nil, false
+	}
+	last, ok := block.Statements[n-1].(*ast.ExpressionStatement)
+	return last, ok
+}
+
+// isTailPosition reports whether stmt is a call to a user function whose
+// result the function brings straight back, so the caller's frame has
+// nothing left to do once it returns. That is a bring of a call, or a call
+// that ends the function body (endsBody). Builtin calls don't count, as
+// they never make a frame, and neither does a bring inside a try block,
+// whose rescue code lives in this frame.
+func (c *Compiler) isTailPosition(stmt ast.Statement, endsBody bool) bool {
+	if c.scopeDepth == 0 || c.tries > 0 {
+		return false
+	}
+
+	var expr ast.Expression
+	switch node := stmt.(type) {
+	case *ast.BringStatement:
+		expr = node.ReturnValue
+	case *ast.ExpressionStatement:
+		if !endsBody {
+			return false
+		}
+		expr = node.Expression
+	default:
+		return false
+	}
+
+	call, ok := expr.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+	if ident, ok := call.Function.(*ast.Identifier); ok {
+		if symbol, found := c.symbolTable.Resolve(ident.Value); found && symbol.Scope == SCOPE_BUILTIN {
+			return false
+		}
+	}
+	return true
+}
+
 // ============================================================================
 // Function Call Compilation
 // ============================================================================
 
 func (c *Compiler) compileCallExpression(node *ast.CallExpression) error {
+	return c.compileCall(node, false)
+}
+
+// compileCall compiles a call, as OP_TAIL_CALL when it is in tail position
+func (c *Compiler) compileCall(node *ast.CallExpression, tail bool) error {
 	// Check if this is a builtin call
 	if ident, ok := node.Function.(*ast.Identifier); ok {
 		if symbol, found := c.symbolTable.Resolve(ident.Value); found && symbol.Scope == SCOPE_BUILTIN {
@@ -501,7 +1271,9 @@ func (c *Compiler) compileCallExpression(node *ast.CallExpression) error {
 
 	// Emit optimized CALL for 0-2 arguments
 	argCount := len(node.Arguments)
-	if argCount == 0 {
+	if tail {
+		c.emitByte(vm.OP_TAIL_CALL, byte(argCount))
+	} else if argCount == 0 {
 		c.emit(vm.OP_CALL_0)
 	} else if argCount == 1 {
 		c.emit(vm.OP_CALL_1)
@@ -548,35 +1320,35 @@ func (c *Compiler) compileBuiltinCall(name string, builtinIdx int, args []ast.Ex
 
 func (c *Compiler) emit(op vm.Opcode) int {
 	pos := c.chunk.Count()
-	c.chunk.WriteOpcode(op, 0) // Line number 0 for now (Phase 2 doesn't track lines)
+	c.chunk.WriteOpcode(op, c.line)
 	return pos
 }
 
 func (c *Compiler) emitByte(op vm.Opcode, operand byte) int {
 	pos := c.emit(op)
-	c.chunk.WriteByte(operand, 0)
+	c.chunk.WriteByte(operand, c.line)
 	return pos
 }
 
 func (c *Compiler) emitBytes(op vm.Opcode, operands ...byte) int {
 	pos := c.emit(op)
 	for _, b := range operands {
-		c.chunk.WriteByte(b, 0)
+		c.chunk.WriteByte(b, c.line)
 	}
 	return pos
 }
 
 func (c *Compiler) emitShort(op vm.Opcode, operand uint16) int {
 	pos := c.emit(op)
-	c.chunk.WriteByte(byte(operand>>8), 0)
-	c.chunk.WriteByte(byte(operand&0xFF), 0)
+	c.chunk.WriteByte(byte(operand>>8), c.line)
+	c.chunk.WriteByte(byte(operand&0xFF), c.line)
 	return pos
 }
 
 func (c *Compiler) emitJump(op vm.Opcode) int {
 	c.emit(op)
-	c.chunk.WriteByte(0xFF, 0) // Placeholder
-	c.chunk.WriteByte(0xFF, 0) // Placeholder
+	c.chunk.WriteByte(0xFF, c.line) // Placeholder
+	c.chunk.WriteByte(0xFF, c.line) // Placeholder
 	return c.chunk.Count() - 2
 }
 
@@ -584,35 +1356,87 @@ func (c *Compiler) patchJump(offset int) {
 	// Calculate jump distance
 	jump := c.chunk.Count() - offset - 2
 
-	if jump > 65535 {
-		panic("Too much code to jump over")
+	// Too far for the 16-bit offset: widenJumps makes it long once the
+	// chunk is finished
+	if jump > math.MaxInt16 {
+		c.addLongJump(offset-1, c.chunk.Count())
+		return
 	}
 
 	c.chunk.Code[offset] = byte(jump >> 8)
 	c.chunk.Code[offset+1] = byte(jump & 0xFF)
 }
 
+// patchJumps points each of the given jumps at the current position
+func (c *Compiler) patchJumps(offsets []int) {
+	for _, offset := range offsets {
+		c.patchJump(offset)
+	}
+}
+
+// enterLoop starts collecting comot and kontinu jumps for a new loop
+func (c *Compiler) enterLoop(continueTarget int) *loop {
+	current := &loop{continueTarget: continueTarget, tries: c.tries}
+	c.loops = append(c.loops, current)
+	return current
+}
+
+// leaveLoop stops collecting jumps for the innermost loop
+func (c *Compiler) leaveLoop() {
+	c.loops = c.loops[:len(c.loops)-1]
+}
+
+// leaveTries ends the try blocks a comot or kontinu jumps out of, the ones
+// opened inside the loop it acts on
+func (c *Compiler) leaveTries(current *loop) {
+	for i := current.tries; i < c.tries; i++ {
+		c.emit(vm.OP_END_TRY)
+	}
+}
+
 func (c *Compiler) emitLoop(loopStart int) {
-	c.emit(vm.OP_LOOP)
+	pos := c.emit(vm.OP_LOOP)
 
 	offset := c.chunk.Count() - loopStart + 2
-	if offset > 65535 {
-		panic("Loop body too large")
+	if offset > math.MaxUint16 {
+		c.addLongJump(pos, loopStart)
+		offset = 0
 	}
 
-	c.chunk.WriteByte(byte(offset>>8), 0)
-	c.chunk.WriteByte(byte(offset&0xFF), 0)
+	c.chunk.WriteByte(byte(offset>>8), c.line)
+	c.chunk.WriteByte(byte(offset&0xFF), c.line)
 }
 
-func (c *Compiler) addConstant(value vm.Value) int {
-	// Check if we already have this constant
-	key := value.String()
-	if idx, exists := c.constants[key]; exists {
-		return idx
+// addLongJump records that the jump at pos must reach target, which is
+// beyond its 16-bit offset
+func (c *Compiler) addLongJump(pos, target int) {
+	if c.longJumps == nil {
+		c.longJumps = make(map[int]int)
 	}
+	c.longJumps[pos] = target
+}
 
-	idx := c.chunk.AddConstant(value)
-	c.constants[key] = idx
+// setLine makes the code emitted from now on carry node's source line, and
+// returns a func that puts the previous line back once node is compiled
+func (c *Compiler) setLine(node ast.Node) func() {
+	previous := c.line
+	if line := ast.Line(node); line > 0 {
+		c.line = line
+	}
+	return func() { c.line = previous }
+}
+
+func (c *Compiler) addConstant(value vm.Value) int {
+	// The chunk deduplicates the pool itself
+	return c.checkConstant(c.chunk.AddConstant(value))
+}
+
+// checkConstant records an error when idx is past what OP_CONSTANT can
+// reach, and returns idx
+func (c *Compiler) checkConstant(idx int) int {
+	if idx >= maxConstants && c.err == nil {
+		c.err = fmt.Errorf("Constant dem too plenty: one chunk fit hold only %d (line %d)", maxConstants, c.line)
+	}
 	return idx
 }
 
@@ -637,9 +1461,9 @@ func (c *Compiler) SymbolTable() *SymbolTable {
 
 // Constants returns a sorted list of constants for debugging
 func (c *Compiler) Constants() []string {
-	keys := make([]string, 0, len(c.constants))
-	for k := range c.constants {
-		keys = append(keys, k)
+	keys := make([]string, 0, len(c.chunk.Constants))
+	for _, constant := range c.chunk.Constants {
+		keys = append(keys, constant.String())
 	}
 	sort.Strings(keys)
 	return keys
@@ -1,11 +1,15 @@
 package compiler
 
 import (
+	"bytes"
+	"fmt"
+	"strings"
 	"testing"
 
 	"pidgin-lang/ast"
 	"pidgin-lang/lexer"
 	"pidgin-lang/parser"
+	"pidgin-lang/token"
 	"pidgin-lang/vm"
 )
 
@@ -25,10 +29,10 @@ func TestCompileIntegerLiterals(t *testing.T) {
 		input    string
 		expected []byte
 	}{
-		// Optimized small integers
-		{"0", []byte{byte(vm.OP_CONST_0), byte(vm.OP_POP), byte(vm.OP_HALT)}},
-		{"1", []byte{byte(vm.OP_CONST_1), byte(vm.OP_POP), byte(vm.OP_HALT)}},
-		{"42", []byte{byte(vm.OP_CONST_I8), 42, byte(vm.OP_POP), byte(vm.OP_HALT)}},
+		// Optimized small integers, kept on the stack as the program's value
+		{"0", []byte{byte(vm.OP_CONST_0), byte(vm.OP_HALT)}},
+		{"1", []byte{byte(vm.OP_CONST_1), byte(vm.OP_HALT)}},
+		{"42", []byte{byte(vm.OP_CONST_I8), 42, byte(vm.OP_HALT)}},
 		// Note: -1 is parsed as prefix expression, not a literal
 	}
 
@@ -60,6 +64,75 @@ func TestCompileIntegerLiterals(t *testing.T) {
 	}
 }
 
+func TestCompileInt16Literals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []byte
+	}{
+		// Operand is big-endian: high byte first
+		{"128", []byte{byte(vm.OP_CONST_I16), 0x00, 0x80}},
+		{"1000", []byte{byte(vm.OP_CONST_I16), 0x03, 0xE8}},
+		{"32767", []byte{byte(vm.OP_CONST_I16), 0x7F, 0xFF}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			program := parse(tt.input)
+			compiler := New()
+
+			chunk, err := compiler.Compile(program)
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+
+			if len(chunk.Code) < len(tt.expected) {
+				t.Fatalf("bytecode too short. want at least %d bytes, got %v", len(tt.expected), chunk.Code)
+			}
+
+			for i, expectedByte := range tt.expected {
+				if chunk.Code[i] != expectedByte {
+					t.Errorf("wrong byte at position %d. want=%d, got=%d", i, expectedByte, chunk.Code[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCompileNegativeLiterals(t *testing.T) {
+	// A minus sign on a literal folds into the literal itself
+	tests := []struct {
+		input    string
+		expected []byte
+	}{
+		{"-1", []byte{byte(vm.OP_CONST_MINUS1)}},
+		{"-42", []byte{byte(vm.OP_CONST_I8), 0xD6}},
+		{"-1000", []byte{byte(vm.OP_CONST_I16), 0xFC, 0x18}},
+		{"-1000000", []byte{byte(vm.OP_CONSTANT), 0x00, 0x00}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			program := parse(tt.input)
+			compiler := New()
+
+			chunk, err := compiler.Compile(program)
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+
+			if len(chunk.Code) < len(tt.expected) {
+				t.Fatalf("bytecode too short. want at least %d bytes, got %v", len(tt.expected), chunk.Code)
+			}
+
+			for i, expectedByte := range tt.expected {
+				if chunk.Code[i] != expectedByte {
+					t.Errorf("wrong byte at position %d. want=%d, got=%d", i, expectedByte, chunk.Code[i])
+				}
+			}
+		})
+	}
+}
+
 // ============================================================================
 // Boolean Literal Tests
 // ============================================================================
@@ -99,16 +172,18 @@ func TestCompileArithmetic(t *testing.T) {
 		input    string
 		hasOp    vm.Opcode
 	}{
-		{"5 + 3", vm.OP_ADD},
-		{"10 - 4", vm.OP_SUB},
-		{"6 * 7", vm.OP_MUL},
-		{"20 / 4", vm.OP_DIV},
-		{"-42", vm.OP_NEGATE},
+		{"x + 3", vm.OP_ADD},
+		{"x - 4", vm.OP_SUB},
+		{"x * 7", vm.OP_MUL},
+		{"x / 3", vm.OP_DIV},
+		{"x % 3", vm.OP_MOD},
+		{"-(x * 7)", vm.OP_NEGATE},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			program := parse(tt.input)
+			// A variable operand keeps the operator from being folded away
+			program := parse("make x be 5;\n" + tt.input)
 			compiler := New()
 
 			chunk, err := compiler.Compile(program)
@@ -141,15 +216,19 @@ func TestCompileComparison(t *testing.T) {
 		input    string
 		hasOp    vm.Opcode
 	}{
-		{"5 be 5", vm.OP_EQUAL},
+		{"(x be 5)", vm.OP_EQUAL},
 		// Note: "no be" is not a single operator in the parser
-		{"5 big pass 3", vm.OP_GREATER},
-		{"3 no reach 5", vm.OP_LESS},
+		{"x big pass 3", vm.OP_GREATER},
+		{"x no reach 5", vm.OP_LESS},
+		{"x reach 5", vm.OP_GREATER_EQUAL},
+		{"x >= 3", vm.OP_GREATER_EQUAL},
+		{"x <= 5", vm.OP_LESS_EQUAL},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			program := parse(tt.input)
+			// A variable operand keeps the operator from being folded away
+			program := parse("make x be 5;\n" + tt.input)
 			compiler := New()
 
 			chunk, err := compiler.Compile(program)
@@ -237,6 +316,73 @@ func TestCompileStringLiterals(t *testing.T) {
 	}
 }
 
+func TestCompileConstantDeduplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int // size of the constant pool
+	}{
+		{"100000\n100000", 1},
+		{`"wetin"` + "\n" + `"wetin"`, 1},
+		{"2.0\n2.0", 1},
+		{"100000\n100000.0", 2}, // equal numbers, different types
+		{`"100000"` + "\n100000", 2},
+		{`"tru"` + "\ntru", 1}, // tru is inline, only the string needs a slot
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			chunk, err := New().Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+			if len(chunk.Constants) != tt.expected {
+				t.Errorf("expected %d constants, got %d: %v", tt.expected, len(chunk.Constants), chunk.Constants)
+			}
+		})
+	}
+}
+
+func TestCompileConstantPoolLimit(t *testing.T) {
+	// distinct gives n statements that each need their own constant
+	distinct := func(n int, format string) string {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&b, format+"\n", i)
+		}
+		return b.String()
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		fails bool
+	}{
+		{"integers at the limit", distinct(65536, "1%07d"), false},
+		{"integers past the limit", distinct(65537, "1%07d"), true},
+		{"strings past the limit", distinct(65537, `"s%d"`), true},
+		{"mixed past the limit", distinct(40000, "1%07d") + distinct(30000, `"s%d"`), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New().Compile(parse(tt.input))
+			if !tt.fails {
+				if err != nil {
+					t.Fatalf("compilation error: %v", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected an error for too many constants")
+			}
+			if !strings.Contains(err.Error(), "Constant dem too plenty") || !strings.Contains(err.Error(), "65536") {
+				t.Errorf("expected a constant pool error, got %q", err)
+			}
+		})
+	}
+}
+
 // ============================================================================
 // Control Flow Tests
 // ============================================================================
@@ -272,6 +418,130 @@ func TestCompileSupposeExpression(t *testing.T) {
 	}
 }
 
+func TestCompileSupposeStatement(t *testing.T) {
+	// A suppose whose value is thrown away pushes no nothing and pops nothing
+	tests := []struct {
+		input    string
+		expected []byte
+	}{
+		{
+			"suppose tru { 1 }\n2",
+			[]byte{
+				byte(vm.OP_TRU),
+				byte(vm.OP_JUMP_IF_LIE), 0, 2,
+				byte(vm.OP_CONST_1),
+				byte(vm.OP_POP),
+				byte(vm.OP_CONST_I8), 2,
+				byte(vm.OP_HALT),
+			},
+		},
+		{
+			"suppose lie { 1 } abi { 0 }\n2",
+			[]byte{
+				byte(vm.OP_LIE),
+				byte(vm.OP_JUMP_IF_LIE), 0, 5,
+				byte(vm.OP_CONST_1),
+				byte(vm.OP_POP),
+				byte(vm.OP_JUMP), 0, 2,
+				byte(vm.OP_CONST_0),
+				byte(vm.OP_POP),
+				byte(vm.OP_CONST_I8), 2,
+				byte(vm.OP_HALT),
+			},
+		},
+		// As the last statement its value is the program's, so it still
+		// gives nothing when the condition is false
+		{
+			"suppose tru { 1 }",
+			[]byte{
+				byte(vm.OP_TRU),
+				byte(vm.OP_JUMP_IF_LIE), 0, 4,
+				byte(vm.OP_CONST_1),
+				byte(vm.OP_JUMP), 0, 1,
+				byte(vm.OP_NOTHING),
+				byte(vm.OP_HALT),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			chunk, err := New().Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+			if string(chunk.Code) != string(tt.expected) {
+				t.Errorf("wrong bytecode.\nExpected: %v\nGot:      %v", tt.expected, chunk.Code)
+			}
+		})
+	}
+}
+
+func TestCompileNegatedCondition(t *testing.T) {
+	// A negated condition drops its OP_NOT and jumps on the operand instead
+	tests := []struct {
+		input    string
+		expected []vm.Opcode
+	}{
+		{
+			"make done be lie\nsuppose no be done { }\n1",
+			[]vm.Opcode{
+				vm.OP_LIE, vm.OP_SET_GLOBAL, vm.OP_POP,
+				vm.OP_GET_GLOBAL, vm.OP_JUMP_IF_TRU,
+				vm.OP_CONST_1, vm.OP_HALT,
+			},
+		},
+		{
+			"make done be lie\nsuppose !done { 1 } abi { 0 }",
+			[]vm.Opcode{
+				vm.OP_LIE, vm.OP_SET_GLOBAL, vm.OP_POP,
+				vm.OP_GET_GLOBAL, vm.OP_JUMP_IF_TRU,
+				vm.OP_CONST_1, vm.OP_JUMP, vm.OP_CONST_0, vm.OP_HALT,
+			},
+		},
+		{
+			"make done be lie\ndey do while no be done { done be tru }",
+			[]vm.Opcode{
+				vm.OP_LIE, vm.OP_SET_GLOBAL, vm.OP_POP,
+				vm.OP_GET_GLOBAL, vm.OP_JUMP_IF_TRU,
+				vm.OP_TRU, vm.OP_SET_GLOBAL, vm.OP_POP,
+				vm.OP_LOOP, vm.OP_NOTHING, vm.OP_HALT,
+			},
+		},
+		// Two negations cancel out
+		{
+			"make done be lie\nsuppose !!done { 1 } abi { 0 }",
+			[]vm.Opcode{
+				vm.OP_LIE, vm.OP_SET_GLOBAL, vm.OP_POP,
+				vm.OP_GET_GLOBAL, vm.OP_JUMP_IF_LIE,
+				vm.OP_CONST_1, vm.OP_JUMP, vm.OP_CONST_0, vm.OP_HALT,
+			},
+		},
+		// A negation inside a larger condition still needs its OP_NOT
+		{
+			"make done be lie\nsuppose !done and tru { 1 } abi { 0 }",
+			[]vm.Opcode{
+				vm.OP_LIE, vm.OP_SET_GLOBAL, vm.OP_POP,
+				vm.OP_GET_GLOBAL, vm.OP_NOT, vm.OP_JUMP_IF_LIE_PEEK, vm.OP_POP, vm.OP_TRU,
+				vm.OP_JUMP_IF_LIE,
+				vm.OP_CONST_1, vm.OP_JUMP, vm.OP_CONST_0, vm.OP_HALT,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			chunk, err := New().Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+			if got := opcodes(chunk.Code); fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Errorf("wrong opcodes.\nExpected: %v\nGot:      %v", tt.expected, got)
+			}
+		})
+	}
+}
+
 func TestCompileWhileExpression(t *testing.T) {
 	input := `dey do while tru { 42 }`
 
@@ -303,12 +573,45 @@ func TestCompileWhileExpression(t *testing.T) {
 	}
 }
 
+func TestCompileForExpression(t *testing.T) {
+	chunk, err := New().Compile(parse("count i from 1 reach 3 { yarn(i) }"))
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+
+	// Both ends are worked out first. The bound stays on the stack, copied
+	// up by OP_OVER for each check and dropped once the loop ends, after
+	// the counter is marked unbound
+	expected := []vm.Opcode{
+		vm.OP_CONST_1, vm.OP_CONST_I8, vm.OP_SWAP, vm.OP_SET_GLOBAL, vm.OP_POP,
+		vm.OP_GET_GLOBAL, vm.OP_OVER, vm.OP_LESS_EQUAL, vm.OP_JUMP_IF_LIE,
+		vm.OP_GET_GLOBAL, vm.OP_YARN, vm.OP_POP,
+		vm.OP_GET_GLOBAL, vm.OP_CONST_1, vm.OP_ADD, vm.OP_SET_GLOBAL, vm.OP_POP,
+		vm.OP_LOOP,
+		vm.OP_UNBOUND, vm.OP_SET_GLOBAL, vm.OP_POP,
+		vm.OP_POP, vm.OP_NOTHING, vm.OP_HALT,
+	}
+	if got := opcodes(chunk.Code); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("wrong opcodes.\nExpected: %v\nGot:      %v", expected, got)
+	}
+
+	// Inside a function only the counter takes a local slot
+	chunk, err = New().Compile(parse("do f(n) { count i from 1 reach n { yarn(i) } }"))
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+	if fn := chunk.Constants[0].AsFunc(); fn.LocalCount != 2 {
+		t.Errorf("expected 2 locals (n and i), got %d", fn.LocalCount)
+	}
+}
+
 // ============================================================================
 // Short-Circuit Tests
 // ============================================================================
 
 func TestCompileShortCircuitAnd(t *testing.T) {
-	input := `tru and lie`
+	// A variable operand keeps the and from being folded away
+	input := "make a be tru;\na and lie"
 
 	program := parse(input)
 	compiler := New()
@@ -318,29 +621,80 @@ func TestCompileShortCircuitAnd(t *testing.T) {
 		t.Fatalf("compilation error: %v", err)
 	}
 
-	// Check for DUP and JUMP_IF_LIE (short-circuit pattern)
+	// The left operand stays as the result when it decides, so the jump
+	// peeks at it instead of duplicating it
 	hasDup := false
-	hasJumpIfLie := false
+	hasJumpIfLiePeek := false
 	for _, b := range chunk.Code {
 		if vm.Opcode(b) == vm.OP_DUP {
 			hasDup = true
 		}
-		if vm.Opcode(b) == vm.OP_JUMP_IF_LIE {
-			hasJumpIfLie = true
+		if vm.Opcode(b) == vm.OP_JUMP_IF_LIE_PEEK {
+			hasJumpIfLiePeek = true
 		}
 	}
 
-	if !hasDup {
-		t.Error("expected OP_DUP not found (needed for short-circuit)")
+	if hasDup {
+		t.Error("unexpected OP_DUP (short-circuit should peek)")
 	}
-	if !hasJumpIfLie {
-		t.Error("expected OP_JUMP_IF_LIE not found")
+	if !hasJumpIfLiePeek {
+		t.Error("expected OP_JUMP_IF_LIE_PEEK not found")
 	}
 }
 
-// NOTE: OR operator ("abi") is not yet supported by the parser as an infix operator
-// It's only used in "suppose...abi" contexts
-// This test is skipped for Phase 2
+func TestCompileShortCircuitOr(t *testing.T) {
+	// A variable operand keeps the or from being folded away
+	for _, input := range []string{"make a be tru;\na abi lie", "make a be tru;\na or lie"} {
+		program := parse(input)
+		compiler := New()
+
+		chunk, err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compilation error: %v", err)
+		}
+
+		expected := []byte{
+			byte(vm.OP_TRU),
+			byte(vm.OP_SET_GLOBAL), 0, 0,
+			byte(vm.OP_POP),
+			byte(vm.OP_GET_GLOBAL), 0, 0,
+			byte(vm.OP_JUMP_IF_TRU_PEEK), 0, 2,
+			byte(vm.OP_POP),
+			byte(vm.OP_LIE),
+			byte(vm.OP_HALT),
+		}
+		if string(chunk.Code) != string(expected) {
+			t.Errorf("%s: wrong bytecode.\nExpected: %v\nGot:      %v", input, expected, chunk.Code)
+		}
+	}
+}
+
+func TestCompileChainExpression(t *testing.T) {
+	compiler := New()
+	chunk, err := compiler.Compile(parse("do f() { bring 5 }\n1 < f() < 10"))
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+
+	// f()'s value stays on the stack under the first result for the
+	// second comparison, and is dropped when the first one fails
+	expected := []vm.Opcode{
+		vm.OP_CONSTANT, vm.OP_SET_GLOBAL, vm.OP_POP,
+		vm.OP_CONST_1, vm.OP_GET_GLOBAL, vm.OP_CALL_0, vm.OP_SWAP, vm.OP_OVER, vm.OP_LESS,
+		vm.OP_JUMP_IF_LIE_PEEK, vm.OP_POP,
+		vm.OP_CONST_I8, vm.OP_LESS, vm.OP_JUMP,
+		vm.OP_SWAP, vm.OP_POP,
+		vm.OP_HALT,
+	}
+	if got := opcodes(chunk.Code); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("wrong opcodes.\nExpected: %v\nGot:      %v", expected, got)
+	}
+
+	// The hidden variable never became a global
+	if n := compiler.symbolTable.NumDefinitions(); n != 1 {
+		t.Errorf("expected only f to be defined, got %d definitions", n)
+	}
+}
 
 // ============================================================================
 // Builtin Function Tests
@@ -387,6 +741,389 @@ func TestCompileUndefinedVariable(t *testing.T) {
 	}
 }
 
+func TestCompileBreakOutsideLoop(t *testing.T) {
+	// The parser rejects this, so build the AST by hand
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.BreakStatement{Token: token.Token{Type: token.COMOT, Literal: "comot"}},
+	}}
+
+	_, err := New().Compile(program)
+	expected := "'comot' fit only dey inside loop"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+// ============================================================================
+// Function Tests
+// ============================================================================
+
+func TestCompileDoExpression(t *testing.T) {
+	input := `do add(a, b) { bring a + b }`
+
+	program := parse(input)
+	compiler := New()
+
+	chunk, err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+
+	// The function is a constant, bound to its name as a global
+	if vm.Opcode(chunk.Code[0]) != vm.OP_CONSTANT {
+		t.Fatalf("expected OP_CONSTANT, got %s", vm.Opcode(chunk.Code[0]))
+	}
+	if vm.Opcode(chunk.Code[3]) != vm.OP_SET_GLOBAL {
+		t.Errorf("expected OP_SET_GLOBAL, got %s", vm.Opcode(chunk.Code[3]))
+	}
+
+	idx := int(chunk.Code[1])<<8 | int(chunk.Code[2])
+	value := chunk.Constants[idx]
+	if !value.IsFunc() {
+		t.Fatalf("expected function constant, got %s", value.TypeName())
+	}
+
+	fn := value.AsFunc()
+	if fn.Name != "add" || fn.Arity != 2 || fn.LocalCount != 2 {
+		t.Errorf("wrong function: name=%q arity=%d locals=%d", fn.Name, fn.Arity, fn.LocalCount)
+	}
+
+	expected := []vm.Opcode{vm.OP_GET_LOCAL_0, vm.OP_GET_LOCAL_1, vm.OP_ADD, vm.OP_BRING}
+	for i, op := range expected {
+		if vm.Opcode(fn.Chunk.Code[i]) != op {
+			t.Errorf("body byte %d: expected %s, got %s", i, op, vm.Opcode(fn.Chunk.Code[i]))
+		}
+	}
+}
+
+func TestCompileDoExpressionLocals(t *testing.T) {
+	input := `do f(a) { make b be a * 2
+b }`
+
+	chunk, err := New().Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+
+	fn := chunk.Constants[0].AsFunc()
+	if fn.Arity != 1 || fn.LocalCount != 2 {
+		t.Errorf("expected arity 1 and 2 locals, got arity=%d locals=%d", fn.Arity, fn.LocalCount)
+	}
+
+	// A body ending in an expression returns that expression
+	code := fn.Chunk.Code
+	if vm.Opcode(code[len(code)-1]) != vm.OP_RETURN || vm.Opcode(code[len(code)-2]) != vm.OP_GET_LOCAL_1 {
+		t.Errorf("expected body to end with OP_GET_LOCAL_1, OP_RETURN, got % x", code)
+	}
+}
+
+func TestCompileClosure(t *testing.T) {
+	input := `do outer(n) { make m be 1; do inner() { m be m + n }; inner }`
+
+	chunk, err := New().Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+
+	outer := chunk.Constants[0].AsFunc()
+	if len(outer.Captures) != 0 {
+		t.Errorf("expected outer to capture nothing, got %+v", outer.Captures)
+	}
+
+	// inner captures outer's locals, so it is made with OP_CLOSURE
+	var inner *vm.Function
+	for _, value := range outer.Chunk.Constants {
+		if value.IsFunc() {
+			inner = value.AsFunc()
+		}
+	}
+	if inner == nil {
+		t.Fatal("expected inner among outer's constants")
+	}
+	ops := opcodes(outer.Chunk.Code)
+	found := false
+	for _, op := range ops {
+		found = found || op == vm.OP_CLOSURE
+	}
+	if !found {
+		t.Errorf("expected outer to make inner with OP_CLOSURE, got %v", ops)
+	}
+
+	// m is captured first, as the assignment names it before reading n
+	expectedCaptures := []vm.Capture{{IsLocal: true, Index: 1}, {IsLocal: true, Index: 0}}
+	if len(inner.Captures) != len(expectedCaptures) {
+		t.Fatalf("expected captures %+v, got %+v", expectedCaptures, inner.Captures)
+	}
+	for i, capture := range expectedCaptures {
+		if inner.Captures[i] != capture {
+			t.Errorf("capture %d: expected %+v, got %+v", i, capture, inner.Captures[i])
+		}
+	}
+
+	expected := []byte{
+		byte(vm.OP_GET_UPVALUE), 0,
+		byte(vm.OP_GET_UPVALUE), 1,
+		byte(vm.OP_ADD),
+		byte(vm.OP_SET_UPVALUE), 0,
+		byte(vm.OP_RETURN),
+	}
+	if !bytes.Equal(inner.Chunk.Code, expected) {
+		t.Errorf("expected inner body % x, got % x", expected, inner.Chunk.Code)
+	}
+}
+
+func TestCompileFunctionReturns(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []vm.Opcode // The end of the function body
+	}{
+		// Running off the end returns the last expression
+		{"do f(a) { a }", []vm.Opcode{vm.OP_GET_LOCAL_0, vm.OP_RETURN}},
+		{"do f(a) { make b be a }", []vm.Opcode{vm.OP_GET_LOCAL_0, vm.OP_SET_LOCAL_1, vm.OP_RETURN}},
+		// or nothing, when there is no value to give
+		{"do f() { }", []vm.Opcode{vm.OP_NOTHING, vm.OP_RETURN}},
+		{"do f(a) { suppose a { bring 1 } }", []vm.Opcode{vm.OP_NOTHING, vm.OP_RETURN}},
+		// A body ending in bring needs nothing after it
+		{"do f(a) { bring a }", []vm.Opcode{vm.OP_GET_LOCAL_0, vm.OP_BRING}},
+		{"do f(a) { bring nothing }", []vm.Opcode{vm.OP_NOTHING, vm.OP_BRING}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			chunk, err := New().Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+
+			ops := opcodes(chunk.Constants[0].AsFunc().Chunk.Code)
+			if len(ops) < len(tt.expected) {
+				t.Fatalf("expected body to end with %v, got %v", tt.expected, ops)
+			}
+			end := ops[len(ops)-len(tt.expected):]
+			for i, op := range tt.expected {
+				if end[i] != op {
+					t.Errorf("expected body to end with %v, got %v", tt.expected, ops)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestCompileTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		tail     bool // whether the function makes its call as OP_TAIL_CALL
+		expected vm.Opcode
+	}{
+		// Bringing a call straight back
+		{"do down(n) { suppose n na 0 { bring 0 }\nbring down(n - 1) }", true, vm.OP_TAIL_CALL},
+		// A call that ends the function body
+		{"do down(n) { suppose n na 0 { bring 0 }\ndown(n - 1) }", true, vm.OP_TAIL_CALL},
+		// Work left to do after the call returns
+		{"do fact(n) { bring n * fact(n - 1) }", false, vm.OP_CALL_1},
+		{"do f(n) { make x be f(n)\nx }", false, vm.OP_CALL_1},
+		{"do f(n) { f(n)\nbring 1 }", false, vm.OP_CALL_1},
+		// Builtins don't make a frame, so they are never tail calls
+		{"do f(n) { bring len(n) }", false, vm.OP_BUILTIN},
+		// A try block's rescue code runs in the caller's frame
+		{"do f(n) { try { bring f(n - 1) } rescue err { 0 } }", false, vm.OP_CALL_1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			chunk, err := New().Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+
+			code := chunk.Constants[0].AsFunc().Chunk.Code
+			ops := opcodes(code)
+
+			found := false
+			for i, op := range ops {
+				if op == vm.OP_TAIL_CALL {
+					if !tt.tail {
+						t.Errorf("unexpected OP_TAIL_CALL in % x", code)
+					}
+					// The function hands the result straight back
+					if i+1 == len(ops) || (ops[i+1] != vm.OP_BRING && ops[i+1] != vm.OP_RETURN) {
+						t.Errorf("expected OP_BRING or OP_RETURN after OP_TAIL_CALL in % x", code)
+					}
+				}
+				if op == tt.expected {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected %s in % x", tt.expected, code)
+			}
+		})
+	}
+}
+
+func TestCompileTry(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []vm.Opcode
+	}{
+		{"try { 1 } rescue err { err }", []vm.Opcode{
+			vm.OP_TRY, vm.OP_CONST_1, vm.OP_END_TRY, vm.OP_JUMP,
+			// The rescue code: store the message, then run the block
+			vm.OP_SET_GLOBAL, vm.OP_POP, vm.OP_GET_GLOBAL,
+			vm.OP_HALT,
+		}},
+		// comot leaves the try block before jumping out of the loop
+		{"dey do while tru { try { comot } rescue err { } }", []vm.Opcode{
+			vm.OP_TRU, vm.OP_JUMP_IF_LIE,
+			vm.OP_TRY, vm.OP_END_TRY, vm.OP_JUMP, vm.OP_NOTHING, vm.OP_END_TRY, vm.OP_JUMP,
+			vm.OP_SET_GLOBAL, vm.OP_POP, vm.OP_NOTHING,
+			vm.OP_POP, vm.OP_LOOP, vm.OP_NOTHING,
+			vm.OP_HALT,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			chunk, err := New().Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+
+			ops := opcodes(chunk.Code)
+			if len(ops) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, ops)
+			}
+			for i, op := range tt.expected {
+				if ops[i] != op {
+					t.Errorf("instruction %d: expected %s, got %s", i, op, ops[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCompileTopLevelCallIsNotTail(t *testing.T) {
+	chunk, err := New().Compile(parse("do f(n) { n }\nf(1)"))
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+
+	for _, op := range opcodes(chunk.Code) {
+		if op == vm.OP_TAIL_CALL {
+			t.Errorf("unexpected OP_TAIL_CALL at top level in % x", chunk.Code)
+		}
+	}
+}
+
+// opcodes lists the instructions in code, skipping their operands
+func opcodes(code []byte) []vm.Opcode {
+	var ops []vm.Opcode
+	for i := 0; i < len(code); {
+		op := vm.Opcode(code[i])
+		ops = append(ops, op)
+		i += 1 + op.GetOperandCount()
+	}
+	return ops
+}
+
+// ============================================================================
+// Line Number Tests
+// ============================================================================
+
+func TestCompileLineNumbers(t *testing.T) {
+	input := "make x be 1\n\nsuppose x be 1 {\n    yarn(x)\n}"
+
+	chunk, err := New().Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+
+	// Each instruction, with the line its opcode byte carries
+	expected := []struct {
+		op   vm.Opcode
+		line int
+	}{
+		{vm.OP_CONST_1, 1},
+		{vm.OP_SET_GLOBAL, 1},
+		{vm.OP_POP, 1},
+		{vm.OP_GET_GLOBAL, 3},
+		{vm.OP_CONST_1, 3},
+		{vm.OP_EQUAL, 3},
+		{vm.OP_JUMP_IF_LIE, 3},
+		{vm.OP_GET_GLOBAL, 4},
+		{vm.OP_YARN, 4},
+		{vm.OP_JUMP, 3},
+	}
+
+	ip := 0
+	for i, want := range expected {
+		if ip >= len(chunk.Code) {
+			t.Fatalf("instruction %d: code ends early", i)
+		}
+		op := vm.Opcode(chunk.Code[ip])
+		if op != want.op || chunk.Lines[ip] != want.line {
+			t.Errorf("instruction %d: expected %s on line %d, got %s on line %d",
+				i, want.op, want.line, op, chunk.Lines[ip])
+		}
+		// Operand bytes share their opcode's line
+		for j := 1; j <= op.GetOperandCount(); j++ {
+			if chunk.Lines[ip+j] != chunk.Lines[ip] {
+				t.Errorf("instruction %d: operand byte %d on line %d", i, j, chunk.Lines[ip+j])
+			}
+		}
+		ip += 1 + op.GetOperandCount()
+	}
+}
+
+// ============================================================================
+// Shadow Warning Tests
+// ============================================================================
+
+func TestWarnShadow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"make x be 1;\ndo f(x) {\n    bring x\n}", []string{"You dey shadow outer 'x' for line 2"}},
+		{"make x be 1;\ndo f(y) {\n    make x be y;\n    bring x\n}", []string{"You dey shadow outer 'x' for line 3"}},
+		{"make x be 1;\ndo outer(a) {\n    do inner(a) {\n        bring a\n    }\n    bring inner(a)\n}",
+			[]string{"You dey shadow outer 'a' for line 3"}},
+		{"make x be 1;\ndo f(y) {\n    make z be y;\n    bring z\n}", nil},
+		{"make x be 1;\ndo f(y) {\n    x be y;\n    bring x\n}", nil},
+		{"do f(len) {\n    bring len\n}", nil},
+	}
+
+	for _, tt := range tests {
+		c := New()
+		c.WarnShadow()
+		if _, err := c.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compilation error: %v", err)
+		}
+
+		warnings := c.Warnings()
+		if len(warnings) != len(tt.expected) {
+			t.Errorf("input %q: expected warnings %q, got %q", tt.input, tt.expected, warnings)
+			continue
+		}
+		for i, want := range tt.expected {
+			if warnings[i] != want {
+				t.Errorf("input %q: expected warning %q, got %q", tt.input, want, warnings[i])
+			}
+		}
+	}
+}
+
+func TestNoShadowWarningsByDefault(t *testing.T) {
+	c := New()
+	if _, err := c.Compile(parse("make x be 1;\ndo f(x) {\n    bring x\n}")); err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+	if warnings := c.Warnings(); len(warnings) != 0 {
+		t.Errorf("expected no warnings without WarnShadow, got %q", warnings)
+	}
+}
+
 // ============================================================================
 // Disassembly Test
 // ============================================================================
@@ -405,3 +1142,24 @@ func TestDisassemble(t *testing.T) {
 	// This should not panic
 	compiler.Disassemble("test")
 }
+
+// ============================================================================
+// Benchmarks
+// ============================================================================
+
+func BenchmarkCompileManyConstants(b *testing.B) {
+	// Thousands of distinct large integers, each repeated, so every
+	// literal goes through the constant pool
+	var sb strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&sb, "%d\n%d\n", 100000+i, 100000+i)
+	}
+	program := parse(sb.String())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := New().Compile(program); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
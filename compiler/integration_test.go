@@ -1,10 +1,15 @@
 package compiler
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
 	"pidgin-lang/lexer"
 	"pidgin-lang/parser"
+	"pidgin-lang/token"
 	"pidgin-lang/vm"
 )
 
@@ -28,23 +33,64 @@ func compileAndRun(input string) (vm.Value, error) {
 	return vmachine.Run(chunk)
 }
 
+// runOutput runs input and returns what it printed
+func runOutput(t *testing.T, input string) string {
+	t.Helper()
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	chunk, err := New().Compile(program)
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+
+	var out bytes.Buffer
+	if _, err := vm.NewVMWithOutput(&out).Run(chunk); err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+	return out.String()
+}
+
 // ============================================================================
-// Arithmetic Integration Tests
+// Output Tests
 // ============================================================================
 
-func TestIntegration_Arithmetic(t *testing.T) {
+func TestIntegration_YarnOutput(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`yarn("hi")`, "hi\n"},
+		{`yarn("a", 1, tru)`, "a1tru\n"},
+		{`yarn()`, "\n"},
+		{`make say be yarn` + "\n" + `say("via value")`, "via value\n"},
+		{`count i from 1 reach 3 { yarn(i) }`, "1\n2\n3\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := runOutput(t, tt.input); got != tt.expected {
+				t.Errorf("expected output %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Stack Discipline Tests
+// ============================================================================
+
+func TestIntegration_SupposeStatements(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected int64
 	}{
-		{"5 + 3", 8},
-		{"10 - 4", 6},
-		{"6 * 7", 42},
-		{"20 / 4", 5},
-		{"(5 + 3) * 2", 16},
-		{"10 + 5 * 2", 20},
-		{"-5", -5},
-		{"-5 + 10", 5},
+		{"make n be 0\nsuppose tru { n be 1 }\nn", 1},
+		{"make n be 0\nsuppose lie { n be 1 }\nn", 0},
+		{"make n be 0\nsuppose lie { n be 1 } abi { n be 2 }\nn", 2},
+		{"make n be 0\ncount i from 1 reach 100 { suppose i % 2 na 0 { n be n + 1 } }\nn", 50},
+		{"make n be 0\ncount i from 1 reach 10 { suppose i % 2 na 0 { n be n + 1 } abi { n be n + 10 } }\nn", 55},
+		{"make n be 0\ndey do while tru { n be n + 1\nsuppose n reach 5 { comot } abi { kontinu } }\nn", 5},
+		{"do pick(x) { suppose x big pass 5 { bring 1 }\n0 }\npick(9) * 10 + pick(2)", 10},
 	}
 
 	for _, tt := range tests {
@@ -53,33 +99,81 @@ func TestIntegration_Arithmetic(t *testing.T) {
 			if err != nil {
 				t.Fatalf("execution error: %v", err)
 			}
+			if !result.IsInt() || result.AsInt() != tt.expected {
+				t.Errorf("expected %d, got %s", tt.expected, result)
+			}
+		})
+	}
+}
 
-			if !result.IsInt() {
-				t.Fatalf("expected int result, got %s", result.TypeName())
+func TestIntegration_StackDepth(t *testing.T) {
+	// Whatever the program does, only its result is left when it halts
+	tests := []string{
+		"suppose tru { 1 }",
+		"suppose lie { 1 }",
+		"suppose tru { 1 } abi { 2 }",
+		"suppose lie { 1 } abi { 2 }",
+		"suppose tru { }",
+		"suppose tru { make a be 1\nmake b be 2\na + b }",
+		"suppose lie { 1 } abi { make c be 3 }",
+		"tru and lie",
+		"lie and tru",
+		"tru abi lie",
+		"lie or tru",
+		"nothing abi 0 and 5",
+		"make x be 1\nx be 2",
+		"make total be 0\ndey do while total no reach 50 { make total be total + 1\ntotal }\ntotal",
+		"make total be 0\ncount i from 1 reach 50 { total be total + i\nsuppose i na 3 { kontinu }\ni }\ntotal",
+		"make n be 0\ndey do while tru { n be n + 1\nsuppose n reach 10 { comot } }\nn",
+		"do f(a) { make b be a * 2\nsuppose b big pass 2 { b } abi { 0 } }\nf(1) + f(5)",
+		"do g() { count i from 1 reach 10 { make j be i } }\ng()\ng()",
+		"make n be 0\ndey do while n no reach 3 { n be n + 1 } otherwise { n * 10 }\nn",
+		"dey do while tru { comot } otherwise { 1 }\n2",
+		"make r be 0\ndey do while tru { r be r + 1\ndey do while lie { } otherwise { comot } }\nr",
+		// suppose as a statement leaves nothing behind on either branch
+		"suppose tru { 1 }\n2",
+		"suppose lie { 1 }\n2",
+		"suppose lie { 1 } abi { 2 }\n3",
+		"make n be 0\ncount i from 1 reach 100 { suppose i % 2 na 0 { n be n + 1 } }\nn",
+		"make n be 0\ncount i from 1 reach 100 { suppose i % 2 na 0 { n be n + 1 } abi { n be n + 2 } }\nn",
+		"do h(x) { suppose x big pass 5 { bring x }\nsuppose x na 0 { bring 0 } abi { make y be 1 }\nx }\nh(1) + h(9)",
+		// A rescued error throws away whatever the try block had pushed
+		"try { 1 + 2 * (3 / 0) } rescue e { 0 }",
+		"try { 1 + 2 * (3 / 0) } rescue e { 0 }\n5",
+		"do f(x) { bring 1 + 10 / x }\ntry { 1 + f(0) } rescue e { e }",
+		"make n be 0\ncount i from 1 reach 5 { try { n be n + 1\nsuppose i na 3 { comot } } rescue e { } }\nn",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			program := parser.New(lexer.New(input)).ParseProgram()
+			chunk, err := New().Compile(program)
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
 			}
 
-			if got := result.AsInt(); got != tt.expected {
-				t.Errorf("expected %d, got %d", tt.expected, got)
+			vmachine := vm.NewVM()
+			if _, err := vmachine.Run(chunk); err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if depth := vmachine.StackDepth(); depth != 1 {
+				t.Errorf("stack depth after halt = %d, want 1", depth)
 			}
 		})
 	}
 }
 
-// ============================================================================
-// Comparison Integration Tests
-// ============================================================================
-
-func TestIntegration_Comparison(t *testing.T) {
+func TestIntegration_BlockValues(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected bool
+		expected int64
 	}{
-		{"5 be 5", true},
-		{"5 be 3", false},
-		{"5 big pass 3", true},
-		{"3 big pass 5", false},
-		{"3 no reach 5", true},
-		{"5 no reach 3", false},
+		{"suppose tru { make a be 4 }", 4},
+		{"suppose tru { make a be 1\na be a + 6 }", 7},
+		{"do f() { make a be 9 }\nf()", 9},
+		{"4 and 5", 5},
+		{"0 abi 5", 0},
 	}
 
 	for _, tt := range tests {
@@ -89,29 +183,30 @@ func TestIntegration_Comparison(t *testing.T) {
 				t.Fatalf("execution error: %v", err)
 			}
 
-			if !result.IsBool() {
-				t.Fatalf("expected bool result, got %s", result.TypeName())
-			}
-
-			if got := result.AsBool(); got != tt.expected {
-				t.Errorf("expected %v, got %v", tt.expected, got)
+			if !result.IsInt() || result.AsInt() != tt.expected {
+				t.Errorf("expected %d, got %s", tt.expected, result.String())
 			}
 		})
 	}
 }
 
 // ============================================================================
-// Variable Integration Tests
+// Arithmetic Integration Tests
 // ============================================================================
 
-func TestIntegration_GlobalVariables(t *testing.T) {
+func TestIntegration_Arithmetic(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected int64
 	}{
-		{"make x be 42\nx", 42},
-		{"make x be 5\nmake y be 10\nx + y", 15},
-		{"make x be 10\nmake x be 20\nx", 20}, // Variable reassignment
+		{"5 + 3", 8},
+		{"10 - 4", 6},
+		{"6 * 7", 42},
+		{"20 / 4", 5},
+		{"(5 + 3) * 2", 16},
+		{"10 + 5 * 2", 20},
+		{"-5", -5},
+		{"-5 + 10", 5},
 	}
 
 	for _, tt := range tests {
@@ -132,18 +227,28 @@ func TestIntegration_GlobalVariables(t *testing.T) {
 	}
 }
 
-// ============================================================================
-// String Integration Tests
-// ============================================================================
-
-func TestIntegration_Strings(t *testing.T) {
+func TestIntegration_InlineIntegerBoundaries(t *testing.T) {
 	tests := []struct {
 		input    string
-		expected string
+		expected int64
 	}{
-		{`"Wetin dey happen?"`, "Wetin dey happen?"},
-		{`"Hello" + " " + "World"`, "Hello World"},
-		{"make name be \"Chidi\"\nname", "Chidi"}, // Use actual newline
+		// OP_CONST_I8 edges
+		{"127", 127},
+		{"-128", -128},
+		// OP_CONST_I16 range, including values whose low byte has the high bit set
+		{"128", 128},
+		{"-129", -129},
+		{"255", 255},
+		{"256", 256},
+		{"1000", 1000},
+		{"-1000", -1000},
+		{"32767", 32767},
+		{"-32767", -32767},
+		// 32768 falls out of the 16-bit range and goes through the constant pool
+		{"32768", 32768},
+		{"-32768", -32768},
+		{"32767 + 1", 32768},
+		{"0 - 32768", -32768},
 	}
 
 	for _, tt := range tests {
@@ -153,30 +258,35 @@ func TestIntegration_Strings(t *testing.T) {
 				t.Fatalf("execution error: %v", err)
 			}
 
-			if !result.IsString() {
-				t.Fatalf("expected string result, got %s", result.TypeName())
+			if !result.IsInt() {
+				t.Fatalf("expected int result, got %s", result.TypeName())
 			}
 
-			if got := *result.AsString(); got != tt.expected {
-				t.Errorf("expected %q, got %q", tt.expected, got)
+			if got := result.AsInt(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
 			}
 		})
 	}
 }
 
-// ============================================================================
-// Control Flow Integration Tests
-// ============================================================================
-
-func TestIntegration_SupposeExpression(t *testing.T) {
+func TestIntegration_LargeNegativeIntegers(t *testing.T) {
+	// Values past the 16-bit range go through the constant pool as
+	// NaN-boxed 48-bit integers, which must keep their sign
 	tests := []struct {
 		input    string
 		expected int64
 	}{
-		{"suppose 5 big pass 3 { 1 } abi { 0 }", 1},
-		{"suppose 3 big pass 5 { 1 } abi { 0 }", 0},
-		{"suppose tru { 42 } abi { 0 }", 42},
-		{"suppose lie { 42 } abi { 99 }", 99},
+		{"-1000000", -1000000},
+		{"0 - 1000000", -1000000},
+		{"-1000000 + 1000000", 0},
+		{"-1000000 * 3", -3000000},
+		{"-32769", -32769},
+		{"-8589934592", -8589934592},
+		// The 48-bit edges, only writable as literals thanks to folding
+		{"-140737488355328", vm.MIN_INT_48},
+		{"-140737488355327 - 1", vm.MIN_INT_48},
+		{"140737488355327", vm.MAX_INT_48},
+		{"-140737488355327", -vm.MAX_INT_48},
 	}
 
 	for _, tt := range tests {
@@ -197,43 +307,80 @@ func TestIntegration_SupposeExpression(t *testing.T) {
 	}
 }
 
-func TestIntegration_WhileLoop(t *testing.T) {
-	input := `
-	make counter be 0
-	dey do while counter no reach 5 {
-		make counter be counter + 1
+func TestIntegration_IntegerOverflow(t *testing.T) {
+	// Every way of leaving the 48-bit range stops the program rather than
+	// wrapping around, whether it happens while compiling or running
+	tests := []string{
+		"140737488355328",
+		"0x800000000000",
+		"-140737488355329",
+		"1 + 140737488355328",
+		"140737488355327 + 1",
+		"-140737488355328 - 1",
+		"140737488355327 * 2",
+		"-(-140737488355327 - 1)",
+		"make x be 140737488355327;\nx + 1",
+		"make x be -140737488355328;\nx - 1",
+		"make x be 70368744177664;\nx * 2",
+		"make x be -140737488355328;\n-x",
+		"make x be -140737488355328;\nx / -1",
 	}
-	counter
-	`
 
-	result, err := compileAndRun(input)
-	if err != nil {
-		t.Fatalf("execution error: %v", err)
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			_, err := compileAndRun(input)
+			if err == nil || !strings.Contains(err.Error(), "Number too big for Pidgin") {
+				t.Errorf("expected overflow error, got %v", err)
+			}
+		})
 	}
+}
 
-	if !result.IsInt() {
-		t.Fatalf("expected int result, got %s", result.TypeName())
+func TestIntegration_RadixIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF", 255},
+		{"0b1010", 10},
+		{"0o17", 15},
+		{"0x10 + 0b1", 17},
 	}
 
-	expected := int64(5)
-	if got := result.AsInt(); got != expected {
-		t.Errorf("expected %d, got %d", expected, got)
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if got := result.AsInt(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
 	}
 }
 
 // ============================================================================
-// Short-Circuit Integration Tests
+// Comparison Integration Tests
 // ============================================================================
 
-func TestIntegration_ShortCircuitAnd(t *testing.T) {
+func TestIntegration_Comparison(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected bool
 	}{
-		{"tru and tru", true},
-		{"tru and lie", false},
-		{"lie and tru", false},
-		{"lie and lie", false},
+		{"5 be 5", true},
+		{"5 be 3", false},
+		{"5 big pass 3", true},
+		{"3 big pass 5", false},
+		{"3 no reach 5", true},
+		{"5 no reach 3", false},
+		{"18 reach 18", true},
+		{"17 reach 18", false},
+		{"5 >= 3", true},
+		{"5 <= 3", false},
+		{"3 <= 3", true},
 	}
 
 	for _, tt := range tests {
@@ -254,75 +401,2012 @@ func TestIntegration_ShortCircuitAnd(t *testing.T) {
 	}
 }
 
-// ============================================================================
-// Complex Integration Tests
-// ============================================================================
-
-func TestIntegration_ComplexExpression(t *testing.T) {
-	input := `
-	make x be 10
-	make y be 20
-	suppose x no reach y {
-		x * 2 + y
-	} abi {
-		x + y * 2
+func TestIntegration_ComparisonChaining(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"make x be 5\n1 no reach x no reach 10", true},
+		{"make x be 15\n1 no reach x no reach 10", false},
+		{"make x be 0\n1 no reach x no reach 10", false},
+		{"make x be 10\n1 <= x <= 10", true},
+		{"make x be 3\n1 < 2 < x < 4", true},
+		// A chain that ends the program gives its own result, not the
+		// value it kept for the next link
+		{"do f() { bring 5 }\n1 < f() < 10", true},
+		{"do f() { bring 5 }\n9 < f() < 10", false},
 	}
-	`
 
-	result, err := compileAndRun(input)
-	if err != nil {
-		t.Fatalf("execution error: %v", err)
-	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
 
-	expected := int64(40) // (10 * 2) + 20 = 40
-	if got := result.AsInt(); got != expected {
-		t.Errorf("expected %d, got %d", expected, got)
+			if !result.IsBool() {
+				t.Fatalf("expected bool result, got %s", result.TypeName())
+			}
+
+			if got := result.AsBool(); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
 	}
 }
 
-func TestIntegration_FizzBuzzPattern(t *testing.T) {
-	// Simplified FizzBuzz pattern (without modulo)
-	input := `
-	make i be 0
-	make count be 0
-	dey do while i no reach 10 {
-		make i be i + 1
-		make count be count + 1
+func TestIntegration_ComparisonChainEvaluatesMiddleOnce(t *testing.T) {
+	setup := "make calls be 0\ndo next() { calls be calls + 1; bring 5 }\n"
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"yarn(1 < next() < 10); yarn(calls)", "tru\n1\n"},
+		{"yarn(1 < next() < 3); yarn(calls)", "lie\n1\n"},
+		// The first comparison fails, so the rest of the chain never runs
+		{"yarn(8 < next() < next() + 1); yarn(calls)", "lie\n1\n"},
+		{"yarn(1 < next() < next() + 1 < 10); yarn(calls)", "tru\n2\n"},
+		// A link that fails drops the value it kept for the next one
+		{"yarn(9 < next() < 10); yarn(calls)", "lie\n1\n"},
+		{"yarn(1 < next() < next() - 1 < 10); yarn(calls)", "lie\n2\n"},
+		{"do second(a, b) { bring b }\nyarn(second(9 < next() < 10, 3))", "3\n"},
+		// Inside a function the hidden variable is a local
+		{"do f(x) { bring 0 reach x * 2 reach -4 }\nyarn(f(1)); yarn(f(-2)); yarn(f(-3))", "lie\ntru\nlie\n"},
+		{"count i from 1 reach 3 { yarn(2 <= i * 2 - 1 <= 4) }", "lie\ntru\nlie\n"},
 	}
-	count
-	`
 
-	result, err := compileAndRun(input)
-	if err != nil {
-		t.Fatalf("execution error: %v", err)
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := runOutput(t, setup+tt.input); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
 	}
 
-	expected := int64(10)
-	if got := result.AsInt(); got != expected {
-		t.Errorf("expected %d, got %d", expected, got)
+	// Parentheses stop a comparison from chaining
+	_, err := compileAndRun("(3 < 5) < 4")
+	expected := "I no fit compare boolean and number"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error %q, got %v", expected, err)
 	}
 }
 
 // ============================================================================
-// Error Handling Integration Tests
+// Variable Integration Tests
 // ============================================================================
 
-func TestIntegration_Errors(t *testing.T) {
+func TestIntegration_GlobalVariables(t *testing.T) {
 	tests := []struct {
-		name  string
-		input string
+		input    string
+		expected int64
 	}{
-		{"undefined variable", "undefined_var"},
-		{"division by zero", "10 / 0"},
-		{"type error subtract", "5 - tru"},
-		{"type error multiply", "5 * lie"},
+		{"make x be 42\nx", 42},
+		{"make x be 5\nmake y be 10\nx + y", 15},
+		{"make x be 10\nmake x be 20\nx", 20}, // Variable reassignment
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			_, err := compileAndRun(tt.input)
-			if err == nil {
-				t.Error("expected error, got nil")
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if !result.IsInt() {
+				t.Fatalf("expected int result, got %s", result.TypeName())
+			}
+
+			if got := result.AsInt(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_Assignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"make x be 1\nx be 2\nx", 2},
+		{"make x be 1\nx be x + 41", 42},
+		{"make counter be 0\ndey do while counter no reach 5 { counter be counter + 1 }\ncounter", 5},
+		{"make calls be 0\ndo tick() { calls be calls + 1 }\ntick()\ntick()\ncalls", 2},
+		{"make x be 1\ndo f() { make x be 5 }\nf()\nx", 1},
+		{"make x be 1\ndo f() { x be 5 }\nf()\nx", 5},
+		{"do f(n) { make total be 0\ncount i from 1 reach n { total be total + i }\nbring total }\nf(10)", 55},
+		{"do f(n) { n be n * 2\nbring n }\nf(21)", 42},
+		{"make total be 0\ncount i from 1 reach 10 { total be total + i }\ntotal", 55},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if !result.IsInt() {
+				t.Fatalf("expected int result, got %s", result.TypeName())
+			}
+			if got := result.AsInt(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_AssignUndeclared(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x be 5", "You never make x, so you no fit change am"},
+		{"do f() { make y be 1 }\nf()\ny be 2", "You never make y, so you no fit change am"},
+		{"len be 5", "You never make len, so you no fit change am"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := compileAndRun(tt.input)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestIntegration_ShadowBuiltin(t *testing.T) {
+	// A program's own definition of a builtin name wins from that point on,
+	// for both reading the name and calling it
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"make len be 3\nlen", 3},
+		{"len(\"ab\") + 0\nmake len be 3\nlen", 3},
+		{"make len be 3\nlen be len + 1\nlen", 4},
+		{"do len(x) { bring 99 }\nlen(\"ab\")", 99},
+		{"make len be do(x) { bring 7 }\nlen(\"ab\")", 7},
+		// A local shadow leaves the builtin alone outside the function
+		{"do f() { make len be 2\nbring len }\nf() + len(\"abc\")", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if !result.IsInt() {
+				t.Fatalf("expected int result, got %s", result.TypeName())
+			}
+
+			if got := result.AsInt(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_ShadowedBuiltinIsNotCallable(t *testing.T) {
+	_, err := compileAndRun("make len be 3\nlen(\"abcd\")")
+	if err == nil || !strings.Contains(err.Error(), "Dis one no be function") {
+		t.Errorf("expected calling the shadowed len to fail, got %v", err)
+	}
+}
+
+func TestIntegration_UnboundedRecursion(t *testing.T) {
+	// Wide calls fill the value stack before the call depth limit
+	params := make([]string, 200)
+	args := make([]string, 200)
+	for i := range params {
+		params[i] = fmt.Sprintf("a%d", i)
+		args[i] = "1"
+	}
+	wide := fmt.Sprintf("do f(%s) { bring f(%s) }\nf(%s)",
+		strings.Join(params, ", "), strings.Join(params, ", "), strings.Join(args, ", "))
+
+	tests := map[string]string{
+		"deep": "do f(n) { bring f(n + 1) }\nf(0)",
+		"wide": wide,
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := compileAndRun(input)
+			if err == nil || !strings.Contains(err.Error(), "Stack don full, program too deep") {
+				t.Errorf("expected a stack error, got %v", err)
+			}
+		})
+	}
+}
+
+// ============================================================================
+// String Integration Tests
+// ============================================================================
+
+func TestIntegration_Strings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"Wetin dey happen?"`, "Wetin dey happen?"},
+		{`"Hello" + " " + "World"`, "Hello World"},
+		{"make name be \"Chidi\"\nname", "Chidi"}, // Use actual newline
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if !result.IsString() {
+				t.Fatalf("expected string result, got %s", result.TypeName())
+			}
+
+			if got := *result.AsString(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_StringEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"abi" na "abi"`, true},
+		{`"abi" na "abeg"`, false},
+		// Strings made in a function's chunk against the program's own
+		{"do word() { bring \"abi\" }\nword() na \"abi\"", true},
+		{"do word() { bring \"abi\" }\nflip(word() na \"abi\")", false},
+		{"do word() { bring \"abeg\" }\nword() na \"abi\"", false},
+		// Strings built at run time
+		{`"a" + "bi" na "abi"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if !result.IsBool() || result.AsBool() != tt.expected {
+				t.Errorf("expected %v, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestIntegration_StringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"apple" no reach "banana"`, true},
+		// Variables keep the comparison from being folded away
+		{`make a be "apple"; make b be "banana"; a no reach b`, true},
+		{`make a be "apple"; make b be "banana"; a big pass b`, false},
+		{`make a be "pear"; make b be "peach"; a > b`, true},
+		{`make a be "pea"; make b be "peach"; a < b`, true},
+		{`make a be "abi"; a reach "abi"`, true},
+		{`make a be "abeg"; a >= "abi"`, false},
+		{`make a be ""; a <= "a"`, true},
+		// Strings built at run time
+		{`make a be "ban"; a + "ana" reach "banana"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if !result.IsBool() || result.AsBool() != tt.expected {
+				t.Errorf("expected %v, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	// Strings and numbers still don't compare
+	failures := []string{
+		`make a be "apple"; a no reach 5`,
+		`make a be 2.5; a big pass "a"`,
+		`"a" <= 1`,
+	}
+
+	for _, input := range failures {
+		t.Run(input, func(t *testing.T) {
+			_, err := compileAndRun(input)
+			if err == nil || !strings.Contains(err.Error(), "I no fit compare") {
+				t.Errorf("expected a compare error, got %v", err)
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Control Flow Integration Tests
+// ============================================================================
+
+func TestIntegration_SupposeExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"suppose 5 big pass 3 { 1 } abi { 0 }", 1},
+		{"suppose 3 big pass 5 { 1 } abi { 0 }", 0},
+		{"suppose tru { 42 } abi { 0 }", 42},
+		{"suppose lie { 42 } abi { 99 }", 99},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if !result.IsInt() {
+				t.Fatalf("expected int result, got %s", result.TypeName())
+			}
+
+			if got := result.AsInt(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_NegatedCondition(t *testing.T) {
+	// Conditions the compiler inverts instead of running OP_NOT, including
+	// operands that aren't booleans
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"make done be lie\nsuppose no be done { yarn(1) } abi { yarn(0) }", "1\n"},
+		{"make done be tru\nsuppose no be done { yarn(1) } abi { yarn(0) }", "0\n"},
+		{"suppose !0 { yarn(1) } abi { yarn(0) }", "0\n"},
+		{`suppose !"" { yarn(1) } abi { yarn(0) }`, "0\n"},
+		{"suppose !nothing { yarn(1) } abi { yarn(0) }", "1\n"},
+		{"suppose !5 { yarn(1) } abi { yarn(0) }", "0\n"},
+		{"suppose !!5 { yarn(1) } abi { yarn(0) }", "1\n"},
+		{"make x be !lie; suppose !x { yarn(1) }; yarn(2)", "2\n"},
+		{"make i be 0\ndey do while no be (i na 3) { yarn(i); i be i + 1 }", "0\n1\n2\n"},
+		{"make i be 0\ndey do while !(i big pass 1) { i be i + 1 } otherwise { yarn(i) }", "2\n"},
+		{"do f(ready) { bring suppose no be ready { \"wait\" } abi { \"go\" } }\nyarn(f(lie)); yarn(f(tru))", "wait\ngo\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := runOutput(t, tt.input); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_CallSupposeResult(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"(suppose tru { do (x) { bring x + 1 } } abi { do (x) { bring x - 1 } })(10)", 11},
+		{"(suppose lie { do (x) { bring x + 1 } } abi { do (x) { bring x - 1 } })(10)", 9},
+		{"suppose 3 big pass 5 { do () { 1 } } abi { do () { 2 } }()", 2},
+		{"make up be tru;\nmake step be suppose up { do (x) { bring x * 2 } } abi { do (x) { bring x } };\nstep(21)", 42},
+		{"do twice(x) { bring x * 2 };\n(suppose tru { twice } abi { len })(4)", 8},
+		{`(suppose lie { do (s) { bring 0 } } abi { len })("wetin")`, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if !result.IsInt() || result.AsInt() != tt.expected {
+				t.Errorf("expected %d, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	_, err := compileAndRun("(suppose tru { do () { 1 } } abi { do () { 2 } })(5)")
+	expected := "function wan make 0 argument, you give am 1"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestIntegration_LogicalOr(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"suppose lie abi tru { 1 } abi { 0 }", 1},
+		{"suppose lie or lie { 1 } abi { 0 }", 0},
+		{"suppose 3 big pass 5 abi 2 big pass 1 { 1 } abi { 0 }", 1},
+		{"nothing abi 7", 7},
+		{"4 or 7", 4},
+		{"lie and tru abi 9", 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if !result.IsInt() {
+				t.Fatalf("expected int result, got %s", result.TypeName())
+			}
+
+			if got := result.AsInt(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_WhileLoop(t *testing.T) {
+	input := `
+	make counter be 0
+	dey do while counter no reach 5 {
+		make counter be counter + 1
+	}
+	counter
+	`
+
+	result, err := compileAndRun(input)
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+
+	if !result.IsInt() {
+		t.Fatalf("expected int result, got %s", result.TypeName())
+	}
+
+	expected := int64(5)
+	if got := result.AsInt(); got != expected {
+		t.Errorf("expected %d, got %d", expected, got)
+	}
+}
+
+func TestIntegration_CountLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"make total be 0\ncount i from 1 reach 10 { make total be total + i }\ntotal", 55},
+		{"make total be 0\ncount i from 5 reach 5 { make total be total + i }\ntotal", 5},
+		{"make total be 0\ncount i from 3 reach 1 { make total be total + i }\ntotal", 0},
+		{"make total be 0\ncount i from -2 reach 2 { make total be total + i }\ntotal", 0},
+		{"make n be 4\nmake total be 0\ncount i from 1 reach n * 2 { make total be total + i }\ntotal", 36},
+		{"make i be 100\ncount i from 1 reach 3 { i }\ni", 100},
+		{"make total be 0\ncount i from 1 reach 3 { count j from 1 reach 3 { make total be total + i * j } }\ntotal", 36},
+		{"make steps be 0\ncount i from 1 reach 10 { make steps be steps + 1\nmake i be i + 1 }\nsteps", 5},
+		{"do sum(n) { make total be 0\ncount i from 1 reach n { make total be total + i }\nbring total }\nsum(10)", 55},
+		{"do sum(n) { count i from 1 reach n { suppose i na 4 { bring i } } }\nsum(10)", 4},
+		{"do f() { make i be 100\ncount i from 1 reach 3 { i be i + 1 }\nbring i }\nf()", 100},
+		{"make steps be 0\nmake i be 0\ncount i from 1 reach 10 { steps be steps + 1\ni be i + 1 }\nsteps * 100 + i", 500},
+		// Both ends are worked out before the variable starts counting
+		{"make i be 5\nmake total be 0\ncount i from 1 reach i { make total be total + i }\ntotal * 10 + i", 155},
+		// A closure made in the loop sees what the name means afterwards
+		{"do f() { make f1 be nothing\nmake i be 100\ncount i from 1 reach 3 { suppose i na 1 { f1 be do() { bring i } } }\nbring f1() }\nf()", 100},
+		{"make f1 be nothing\nmake i be 100\ncount i from 1 reach 3 { suppose i na 1 { f1 be do() { bring i } } }\nf1()", 100},
+		{"do f() { make i be 100\nmake seen be 0\ncount i from 1 reach 3 { make g be do() { bring i }\nseen be seen * 10 + g() }\nbring seen }\nf()", 123},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if !result.IsInt() {
+				t.Fatalf("expected int result, got %s", result.TypeName())
+			}
+			if got := result.AsInt(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_CountLoopVariableScope(t *testing.T) {
+	_, err := compileAndRun("count i from 1 reach 3 { i }\ni")
+	if err == nil || !strings.Contains(err.Error(), "I no sabi dis one: i") {
+		t.Errorf("expected i to be unknown after the loop, got %v", err)
+	}
+}
+
+func TestIntegration_BreakAndContinue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// Stop at a condition
+		{"make i be 0\ndey do while tru { suppose i na 5 { comot }\nmake i be i + 1 }\ni", 5},
+		// Skip the even numbers
+		{"make i be 0\nmake total be 0\ndey do while i no reach 10 { make i be i + 1\nsuppose i % 2 na 0 { kontinu }\nmake total be total + i }\ntotal", 25},
+		{"make total be 0\ncount i from 1 reach 10 { suppose i na 4 { comot }\nmake total be total + i }\ntotal", 6},
+		{"make total be 0\ncount i from 1 reach 10 { suppose i % 3 na 0 { kontinu }\nmake total be total + i }\ntotal", 37},
+		// comot only leaves the innermost loop
+		{"make total be 0\ncount i from 1 reach 3 { count j from 1 reach 3 { suppose j na 2 { comot }\nmake total be total + 1 } }\ntotal", 3},
+		// Inside a function, where the loop variable is a local
+		{"do sum_odd(n) { make total be 0\ncount i from 1 reach n { suppose i % 2 na 0 { kontinu }\nmake total be total + i }\nbring total }\nsum_odd(9)", 25},
+		{"do first(n) { count i from 1 reach n { suppose i * i big pass n { bring i } } }\nfirst(30)", 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if !result.IsInt() {
+				t.Fatalf("expected int result, got %s", result.TypeName())
+			}
+			if got := result.AsInt(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_WhileOtherwise(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"make n be 0\nmake done be 0\ndey do while n no reach 3 { n be n + 1 } otherwise { done be 1 }\ndone", 1},
+		{"make n be 0\nmake done be 0\ndey do while tru { n be n + 1\nsuppose n na 3 { comot } } otherwise { done be 1 }\ndone", 0},
+		{"make done be 0\ndey do while lie { } otherwise { done be 1 }\ndone", 1},
+		// kontinu is not comot, so otherwise still runs
+		{"make n be 0\nmake done be 0\ndey do while n no reach 3 { n be n + 1\nkontinu } otherwise { done be 1 }\ndone", 1},
+		// otherwise gives the loop its value
+		{"make n be 0\ndey do while n no reach 3 { n be n + 1 } otherwise { n * 10 }", 30},
+		// otherwise is outside its loop, so comot there leaves the outer one
+		{"make rounds be 0\ndey do while tru { rounds be rounds + 1\ndey do while lie { } otherwise { comot } }\nrounds", 1},
+		// Search, with otherwise for when nothing was found
+		{"do root(n) { make i be 0\ndey do while i no reach 10 { suppose i * i na n { comot }\ni be i + 1 } otherwise { bring -1 }\nbring i }\nroot(49) * 100 + root(50)", 699},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if !result.IsInt() || result.AsInt() != tt.expected {
+				t.Errorf("expected %d, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	// Left with comot, the loop gives nothing
+	result, err := compileAndRun("dey do while tru { comot } otherwise { 1 }")
+	if err != nil || !result.IsNothing() {
+		t.Errorf("expected nothing, got %s (%v)", result, err)
+	}
+}
+
+func TestIntegration_LongJumps(t *testing.T) {
+	// Each "make y be y + 1;" is 9 bytes of global code, or 5 in a function
+	steps := func(n int) string { return strings.Repeat("make y be y + 1;\n", n) }
+
+	tests := []struct {
+		name     string
+		input    string
+		expected int64
+		long     vm.Opcode
+	}{
+		{"loop", "make i be 0;\nmake y be 0;\ndey do while i no reach 3 {\nmake i be i + 1;\n" + steps(8000) + "};\ny",
+			24000, vm.OP_LOOP_LONG},
+		{"suppose taken", "make y be 0;\nsuppose y be 0 {\n" + steps(5000) + "} abi {\nmake y be 7\n};\ny",
+			5000, vm.OP_JUMP_LONG},
+		{"suppose skipped", "make y be 0;\nsuppose y be 1 {\n" + steps(5000) + "} abi {\nmake y be 7\n};\ny",
+			7, vm.OP_JUMP_LONG},
+		{"and", "make y be 0;\nmake both be lie and (suppose y be 0 {\n" + steps(5000) + "y\n} abi {\n0\n});\nsuppose both be lie { y + 2 } abi { y }",
+			2, vm.OP_JUMP_LONG},
+		{"function", "do f(n) {\nmake y be 0;\nsuppose n be 1 {\n" + steps(8000) + "}\nbring y\n};\nf(0) + f(1)",
+			8000, vm.OP_JUMP_LONG},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := parser.New(lexer.New(tt.input)).ParseProgram()
+			chunk, err := New().Compile(program)
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+
+			// The long form shows up in the program or in a function it defines
+			found := false
+			chunks := []*vm.Chunk{chunk}
+			for _, constant := range chunk.Constants {
+				if constant.IsFunc() {
+					chunks = append(chunks, constant.AsFunc().Chunk)
+				}
+			}
+			for _, c := range chunks {
+				for _, op := range opcodes(c.Code) {
+					found = found || op == tt.long
+				}
+			}
+			if !found {
+				t.Errorf("expected the code to use %s", tt.long)
+			}
+
+			result, err := vm.NewVM().Run(chunk)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if !result.IsInt() || result.AsInt() != tt.expected {
+				t.Errorf("expected %d, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestIntegration_RunStepsResumesLoop(t *testing.T) {
+	input := `
+	make counter be 0
+	dey do while counter no reach 10 {
+		make counter be counter + 1
+	}
+	counter
+	`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	chunk, err := New().Compile(p.ParseProgram())
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+
+	vmachine := vm.NewVM()
+
+	// Not enough steps to finish the loop
+	_, halted, err := vmachine.RunSteps(chunk, 20)
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+	if halted {
+		t.Fatal("expected first RunSteps to pause, but it halted")
+	}
+
+	// Plenty of steps to finish from where it paused
+	result, halted, err := vmachine.RunSteps(chunk, 10000)
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+	if !halted {
+		t.Fatal("expected second RunSteps to halt, but it paused")
+	}
+
+	if !result.IsInt() || result.AsInt() != 10 {
+		t.Errorf("expected 10, got %s", result)
+	}
+}
+
+func TestIntegration_MaxSteps(t *testing.T) {
+	l := lexer.New(`dey do while tru { }`)
+	p := parser.New(l)
+	chunk, err := New().Compile(p.ParseProgram())
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+
+	vmachine := vm.NewVM()
+	vmachine.MaxSteps = 10000
+	_, err = vmachine.Run(chunk)
+	if err == nil {
+		t.Fatal("expected step limit error, got nil")
+	}
+	if !strings.Contains(err.Error(), "Program dey waka too long") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// A program that finishes inside the limit runs as normal
+	l = lexer.New("make i be 0\ndey do while i no reach 10 { i be i + 1 }\ni")
+	p = parser.New(l)
+	chunk, err = New().Compile(p.ParseProgram())
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+	result, err := vmachine.Run(chunk)
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+	if !result.IsInt() || result.AsInt() != 10 {
+		t.Errorf("expected 10, got %s", result)
+	}
+}
+
+func TestIntegration_RecoverErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"yarn(is_error(1 / 0))", "tru\n"},
+		{"yarn(is_error(1 / 2))", "lie\n"},
+		{`yarn(1 - "a")`, "I no fit subtract number and string\n"},
+		{`yarn(-"a")`, "I no fit negate string\n"},
+		{`make s be "a"; yarn(is_error(s * 8))`, "tru\n"},
+		{"yarn(len(5))", "I no fit check length of number\n"},
+		{"yarn(is_error(140737488355327 + 1))", "tru\n"},
+		// The program carries on after the error
+		{"make x be 5 % 0; yarn(is_error(x)); yarn(\"still here\")", "tru\nstill here\n"},
+		{"do safe_div(a, b) { bring a / b }\nyarn(is_error(safe_div(1, 0)), safe_div(6, 3))", "tru2\n"},
+		// Enough errors to sweep the heap; the one kept in a global survives
+		{"make kept be 0\ncount i from 1 reach 5000 { make e be i / 0\nsuppose i na 10 { kept be e } }\nyarn(kept)", "Omo! You no fit divide by zero o!\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			program := parser.New(lexer.New(tt.input)).ParseProgram()
+			chunk, err := New().Compile(program)
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+
+			var out bytes.Buffer
+			machine := vm.NewVMWithOutput(&out)
+			machine.RecoverErrors = true
+			if _, err := machine.Run(chunk); err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if got := out.String(); got != tt.expected {
+				t.Errorf("expected output %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_SerializeRoundTrip(t *testing.T) {
+	tests := []string{
+		"5 + 3",
+		"-1000000 * 3",
+		"1.5 * 4",
+		"tru and lie",
+		"nothing",
+		`make name be "Ada"
+yarn("How far, " + name)
+name`,
+		`do greet(who) { bring "How far, " + who }
+greet("Ada")`,
+		`do outer(n) {
+	do inner(m) { bring m * 2 }
+	bring inner(n) + 1
+}
+outer(20)`,
+		`make total be 0
+count i from 1 reach 10 { total be total + i * 1.5 }
+yarn(total)
+total`,
+		`do fact(n) { suppose n no reach 2 { bring 1 }
+bring n * fact(n - 1) }
+fact(10)`,
+		`do adder(a) { bring do(b) { bring a + b } }
+make add2 be adder(2);
+add2(40)`,
+		`do half(n) { try { bring n / 2 } rescue err { bring err } }
+yarn(half(0), half(7))
+try { 1 / 0 } rescue err { err }`,
+		`yarn(len("abc"), type(1), tru, nothing)`,
+		`do name() bring string { bring 1 }
+try { name() } rescue err { err }`,
+	}
+
+	// run runs chunk and describes everything it did
+	run := func(chunk *vm.Chunk) string {
+		var out bytes.Buffer
+		result, err := vm.NewVMWithOutput(&out).Run(chunk)
+		return fmt.Sprintf("result=%s err=%v output=%q", result, err, out.String())
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			program := parser.New(lexer.New(input)).ParseProgram()
+			chunk, err := New().Compile(program)
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+
+			data, err := chunk.Serialize()
+			if err != nil {
+				t.Fatalf("serialize error: %v", err)
+			}
+			loaded, err := vm.DeserializeChunk(data)
+			if err != nil {
+				t.Fatalf("deserialize error: %v", err)
+			}
+
+			if !bytes.Equal(loaded.Code, chunk.Code) {
+				t.Errorf("code changed:\nwant % x\ngot  % x", chunk.Code, loaded.Code)
+			}
+			if len(loaded.Constants) != len(chunk.Constants) {
+				t.Errorf("expected %d constants, got %d", len(chunk.Constants), len(loaded.Constants))
+			}
+
+			if want, got := run(chunk), run(loaded); want != got {
+				t.Errorf("loaded chunk ran differently:\nwant %s\ngot  %s", want, got)
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Short-Circuit Integration Tests
+// ============================================================================
+
+func TestIntegration_ShortCircuitAnd(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"tru and tru", true},
+		{"tru and lie", false},
+		{"lie and tru", false},
+		{"lie and lie", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if !result.IsBool() {
+				t.Fatalf("expected bool result, got %s", result.TypeName())
+			}
+
+			if got := result.AsBool(); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// shortCircuitSetup counts the calls to check, which brings back its argument
+const shortCircuitSetup = `
+make calls be 0
+make hit be 0
+do check(result) {
+	calls be calls + 1
+	bring result
+}
+`
+
+func TestIntegration_ShortCircuitConditions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64 // calls to check * 10 + what the program counted
+	}{
+		// suppose: a false left comparison skips the right one
+		{"make a be 5; make b be 3; make c be 9;\nsuppose a no reach b and check(b no reach c) { hit be 1 };\ncalls * 10 + hit", 0},
+		{"make a be 1; make b be 3; make c be 9;\nsuppose a no reach b and check(b no reach c) { hit be 1 };\ncalls * 10 + hit", 11},
+		{"make a be 1; make b be 3; make c be 2;\nsuppose a no reach b and check(b no reach c) { hit be 1 };\ncalls * 10 + hit", 10},
+		{"make a be 1; make b be 3;\nsuppose a no reach b abi check(b no reach 0) { hit be 1 };\ncalls * 10 + hit", 1},
+		{"make a be 5; make b be 3;\nsuppose a no reach b abi check(b no reach 0) { hit be 1 } abi { hit be 2 };\ncalls * 10 + hit", 12},
+		{"make a be 5; make b be 3;\nsuppose (a no reach b and check(tru)) abi check(a big pass b) { hit be 1 };\ncalls * 10 + hit", 11},
+		// Loops test the condition each round, skipping the right side once
+		// the left one fails
+		{"make i be 0;\ndey do while i no reach 3 and check(i no reach 10) { i be i + 1 };\ncalls * 10 + i", 33},
+		{"make i be 0;\ndey do while i no reach 10 and check(i no reach 3) { i be i + 1 };\ncalls * 10 + i", 43},
+		{"make i be 0;\ndey do while i big pass 5 abi check(i no reach 2) { i be i + 1 };\ncalls * 10 + i", 32},
+		{"count i from 1 reach 5 {\nsuppose i % 2 be 0 and check(i big pass 2) { hit be hit + 1 }\n};\ncalls * 10 + hit", 21},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(shortCircuitSetup + tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if !result.IsInt() || result.AsInt() != tt.expected {
+				t.Errorf("expected %d, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Complex Integration Tests
+// ============================================================================
+
+func TestIntegration_ComplexExpression(t *testing.T) {
+	input := `
+	make x be 10
+	make y be 20
+	suppose x no reach y {
+		x * 2 + y
+	} abi {
+		x + y * 2
+	}
+	`
+
+	result, err := compileAndRun(input)
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+
+	expected := int64(40) // (10 * 2) + 20 = 40
+	if got := result.AsInt(); got != expected {
+		t.Errorf("expected %d, got %d", expected, got)
+	}
+}
+
+func TestIntegration_FizzBuzzPattern(t *testing.T) {
+	// Simplified FizzBuzz pattern (without modulo)
+	input := `
+	make i be 0
+	make count be 0
+	dey do while i no reach 10 {
+		make i be i + 1
+		make count be count + 1
+	}
+	count
+	`
+
+	result, err := compileAndRun(input)
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+
+	expected := int64(10)
+	if got := result.AsInt(); got != expected {
+		t.Errorf("expected %d, got %d", expected, got)
+	}
+}
+
+func TestIntegration_Floats(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"10.0 / 4", 2.5},
+		{"5 / 2.0", 2.5},
+		{"1.5 + 1.5", 3.0},
+		{"2 * 0.5", 1.0},
+		{"-0.25", -0.25},
+		{"7.5 % 2", 1.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if !result.IsFloat() {
+				t.Fatalf("expected float result, got %s", result.TypeName())
+			}
+
+			if got := result.AsFloat(); got != tt.expected {
+				t.Errorf("expected %g, got %g", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_AddDispatch(t *testing.T) {
+	// Two numbers always add, and a string on either side concatenates,
+	// whether the compiler picked OP_ADD or OP_CONCAT
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"5 + 3", int64(8)},
+		{"5 + 3.0", 8.0},
+		{"2.5 + 5", 7.5},
+		{"0.5 + 0.25", 0.75},
+		{"-1 + 0.5", -0.5},
+		{`"a" + 1`, "a1"},
+		{`1 + "a"`, "1a"},
+		{`"a" + 2.5`, "a2.5"},
+		{`3.0 + "a"`, "3.0a"},
+		{`"5" + "3"`, "53"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			switch expected := tt.expected.(type) {
+			case int64:
+				if !result.IsInt() || result.AsInt() != expected {
+					t.Errorf("expected int %d, got %s %s", expected, result.TypeName(), result.String())
+				}
+			case float64:
+				if !result.IsFloat() || result.AsFloat() != expected {
+					t.Errorf("expected float %g, got %s %s", expected, result.TypeName(), result.String())
+				}
+			case string:
+				if !result.IsString() || *result.AsString() != expected {
+					t.Errorf("expected string %q, got %s %s", expected, result.TypeName(), result.String())
+				}
+			}
+		})
+	}
+}
+
+func TestIntegration_Modulo(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"10 % 3", 1},
+		{"9 % 3", 0},
+		{"-7 % 3", -1},
+		{"1 + 10 % 4", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if got := result.AsInt(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_FizzBuzzCount(t *testing.T) {
+	// Count the FizzBuzz numbers (divisible by both 3 and 5) up to 100
+	input := `
+	make i be 1
+	make count be 0
+	dey do while i no reach 101 {
+		suppose i % 15 be 0 {
+			make count be count + 1
+		}
+		make i be i + 1
+	}
+	count
+	`
+
+	result, err := compileAndRun(input)
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+
+	expected := int64(6)
+	if got := result.AsInt(); got != expected {
+		t.Errorf("expected %d, got %d", expected, got)
+	}
+}
+
+// ============================================================================
+// Builtin Integration Tests
+// ============================================================================
+
+func TestIntegration_BuiltinAsValue(t *testing.T) {
+	input := `
+	make f be len
+	f("abc")
+	`
+
+	result, err := compileAndRun(input)
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+
+	if !result.IsInt() {
+		t.Fatalf("expected int result, got %s", result.TypeName())
+	}
+
+	if got := result.AsInt(); got != 3 {
+		t.Errorf("expected 3, got %d", got)
+	}
+}
+
+func TestIntegration_BuiltinTypeAsValue(t *testing.T) {
+	input := `
+	make check be type
+	check(5)
+	`
+
+	result, err := compileAndRun(input)
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+
+	if !result.IsString() {
+		t.Fatalf("expected string result, got %s", result.TypeName())
+	}
+
+	if got := *result.AsString(); got != "INTEGER" {
+		t.Errorf("expected %q, got %q", "INTEGER", got)
+	}
+}
+
+func TestIntegration_BuiltinCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len("abc")`, "3"},
+		{`len("")`, "0"},
+		{`len("How far") + 1`, "8"},
+		{"type(5)", "INTEGER"},
+		{"type(2.5)", "FLOAT"},
+		{`type("wetin")`, "STRING"},
+		{"type(tru)", "BOOLEAN"},
+		{"type(nothing)", "NOTHING"},
+		{"type(len)", "BUILTIN"},
+		{"do f() { 1 }\ntype(f)", "FUNCTION"},
+		{`do size(s) { bring len(s) }` + "\n" + `size("abcd")`, "4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if got := result.String(); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_Flip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"flip(5)", false},
+		{"flip(0)", false},
+		{"flip(2.5)", false},
+		{`flip("wetin")`, false},
+		{`flip("")`, false},
+		{"flip(nothing)", true},
+		{"flip(tru)", false},
+		{"flip(lie)", true},
+		{"flip(len)", false},
+		{"flip(5) be (no be 5)", true},
+		{"do apply(fn, x) { bring fn(x) }\napply(flip, lie)", true},
+		{"make f be flip\nf(nothing)", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if !result.IsBool() {
+				t.Fatalf("expected bool result, got %s", result.TypeName())
+			}
+
+			if got := result.AsBool(); got != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_Coalesce(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"coalesce(nothing, 2, 3)", "2"},
+		{"coalesce(1, nothing)", "1"},
+		{"coalesce(nothing, lie, 3)", "lie"},
+		{`coalesce(nothing, nothing, "last")`, "last"},
+		{"coalesce(nothing, nothing)", "nothing"},
+		{"coalesce()", "nothing"},
+		{"coalesce(7)", "7"},
+		{"coalesce(nothing)", "nothing"},
+		// Every argument runs, even after the one that's picked
+		{"make seen be 0\ndo note(x) { seen be seen + 1\nbring x }\ncoalesce(note(1), note(2))\nseen", "2"},
+		{"make c be coalesce\nc(nothing, 4)", "4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if got := result.String(); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_StringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`upper("how far")`, "HOW FAR"},
+		{`upper("Lagôs")`, "LAGÔS"},
+		{`lower("NA WA O")`, "na wa o"},
+		{`reverse("Lagôs")`, "sôgaL"},
+		{`reverse("")`, ""},
+		{`make r be reverse` + "\n" + `upper(r("oga"))`, "AGO"},
+		{`trim_prefix("foobar", "foo")`, "bar"},
+		{`trim_suffix("foobar", "bar")`, "foo"},
+		{`trim_prefix("foobar", "bar")`, "foobar"},
+		{`trim_suffix("foobar", "")`, "foobar"},
+		{`repeat_string("-", 10)`, "----------"},
+		{`repeat_string("ab", 3)`, "ababab"},
+		{`repeat_string("ab", 0)`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if !result.IsString() || *result.AsString() != tt.expected {
+				t.Errorf("expected %q, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{"upper(5)", "upper wan make STRING, you give am INTEGER"},
+		{`reverse("a", "b")`, "reverse wan make one argument, you give am 2"},
+		{`trim_prefix("foo")`, "trim_prefix wan make 2 argument, you give am 1"},
+		{`trim_suffix("foo", 1)`, "trim_suffix wan make STRING, you give am INTEGER"},
+		{`repeat_string("ab", -1)`, "repeat_string no fit repeat -1 times"},
+		{`repeat_string("ab", 1000000000000)`, "repeat_string go make string wey too long"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := compileAndRun(tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestIntegration_ToNumberAndText(t *testing.T) {
+	numbers := []struct {
+		input    string
+		expected int64
+	}{
+		{`to_number("42")`, 42},
+		{`to_number(" -7 ")`, -7},
+		{`to_number("140737488355327")`, 140737488355327},
+		{`to_number(to_text(42)) + 1`, 43},
+	}
+
+	for _, tt := range numbers {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if !result.IsInt() || result.AsInt() != tt.expected {
+				t.Errorf("expected %d, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	texts := []struct {
+		input    string
+		expected string
+	}{
+		{`to_text(tru)`, "tru"},
+		{`to_text(42)`, "42"},
+		{`to_text(-2.5)`, "-2.5"},
+		{`to_text("wetin")`, "wetin"},
+		{`to_text(nothing)`, "nothing"},
+		{`to_text(2) + to_text(3)`, "23"},
+	}
+
+	for _, tt := range texts {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if !result.IsString() || *result.AsString() != tt.expected {
+				t.Errorf("expected %q, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{`to_number("abc")`, `to_number no fit turn "abc" to number`},
+		{`to_number(42)`, "to_number wan make STRING, you give am INTEGER"},
+		{`to_number("140737488355328")`, "Number too big for Pidgin"},
+		{`to_text()`, "to_text wan make one argument, you give am 0"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := compileAndRun(tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestIntegration_AbsMinMax(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"abs(-5)", 5},
+		{"abs(5)", 5},
+		{"abs(-140737488355327)", 140737488355327},
+		{"min(3, 1, 2)", 1},
+		{"max(3, 1, 2)", 3},
+		{"max(-4)", -4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if !result.IsInt() || result.AsInt() != tt.expected {
+				t.Errorf("expected %d, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{"abs(2.5)", "abs wan make INTEGER, you give am FLOAT"},
+		{"min()", "min wan make at least one argument, you give am 0"},
+		{`max(1, "2")`, "max wan make INTEGER, but argument 2 na STRING"},
+		{"abs(-140737488355327 - 1)", "Number too big for Pidgin"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := compileAndRun(tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+
+	// With floats allowed, abs(MIN_INT_48) gives the float instead
+	program := parser.New(lexer.New("abs(-140737488355327 - 1)")).ParseProgram()
+	chunk, err := New().Compile(program)
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+	machine := vm.NewVM()
+	machine.SetOverflowMode(vm.OverflowFloat)
+	result, err := machine.Run(chunk)
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+	if !result.IsFloat() || result.AsFloat() != 140737488355328 {
+		t.Errorf("expected 140737488355328 as a float, got %s", result)
+	}
+}
+
+func TestIntegration_Compose(t *testing.T) {
+	const setup = "do inc(x) { bring x + 1 }\ndo double(x) { bring x * 2 }\n"
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// The function compose gives back is called straight away by OP_CALL
+		{"compose(inc, double)(5)", "11"},
+		{"compose(double, inc)(5)", "12"},
+		{"make both be compose(inc, double);\nboth(1) + both(2)", "8"},
+		{"compose(compose(inc, inc), double)(10)", "22"},
+		{`compose(upper, reverse)("abc")`, "CBA"},
+		{`compose(len, upper)("wetin")`, "5"},
+		{"do apply(fn, x) { bring fn(x) }\napply(compose(inc, double), 3)", "7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(setup + tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if got := result.String(); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{"compose(1, inc)", "I no fit compose INTEGER"},
+		{"compose(inc)", "compose wan make two functions, you give am 1 argument"},
+		{"compose(inc, double)(1, 2)", "wan make 1 argument, you give am 2"},
+		{`compose(inc, double)("a")`, "I no fit multiply"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := compileAndRun(setup + tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestIntegration_TryRescue(t *testing.T) {
+	const setup = "do risky(x) { bring 10 / x }\n"
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 10 / 0 } rescue err { yarn(err) }`, "Omo! You no fit divide by zero o!\n"},
+		{`yarn(try { 10 / 2 } rescue err { 0 })`, "5\n"},
+		{`yarn(try { 10 / 0 } rescue err { 0 })`, "0\n"},
+		// A name made on a branch that never ran is only missing at runtime
+		{"suppose lie { make ghost be 1 }\ntry { yarn(ghost) } rescue err { yarn(err) }", "I no sabi dis one: ghost\n"},
+		// So is a name the program never makes
+		{"try { yarn(nope) } rescue err { yarn(\"caught: \", err) }", "caught: I no sabi dis one: nope\n"},
+		{"do f() { try { bring nope } rescue err { bring err } }\nyarn(f())", "I no sabi dis one: nope\n"},
+		// Errors come back out of the functions the try block calls
+		{`try { risky(0) } rescue err { yarn("caught") }`, "caught\n"},
+		{`do safe(x) { try { bring risky(x) } rescue err { bring -1 } }
+yarn(safe(0), " ", safe(5))`, "-1 2\n"},
+		{`try { 1(2) } rescue err { yarn(err) }`, "Dis one no be function: number\n"},
+		{`try { risky(1, 2) } rescue err { yarn(err) }`, "risky wan make 1 argument, you give am 2\n"},
+		{`try { len(5) } rescue err { yarn(err) }`, "I no fit check length of number\n"},
+		// The error lands in the innermost try
+		{`try { try { 1 / 0 } rescue a { yarn("inner") } } rescue b { yarn("outer") }`, "inner\n"},
+		{`try { try { 1 / 0 } rescue a { 2 % 0 } } rescue b { yarn("outer") }`, "outer\n"},
+		// The rescue name only lives in the rescue block
+		{`make err be "before"
+try { 1 / 0 } rescue err { yarn(err) }
+yarn(err)`, "Omo! You no fit divide by zero o!\nbefore\n"},
+		// comot and kontinu leave the try block behind
+		{`count i from 1 reach 3 { try { suppose i na 2 { kontinu }
+yarn(i) } rescue err { } }
+try { 1 / 0 } rescue err { yarn("still caught") }`, "1\n3\nstill caught\n"},
+		{`dey do while tru { try { comot } rescue err { } }
+try { 1 / 0 } rescue err { yarn("still caught") }`, "still caught\n"},
+		// Closures made in the try block keep their variables
+		{`do outer() {
+	make n be 1
+	try { make get be do() { bring n }
+	n be 7
+	risky(0) } rescue err { bring get() }
+}
+yarn(outer())`, "7\n"},
+		// A count loop the error leaves still puts its variable back
+		{`make i be 100
+try { count i from 1 reach 3 { suppose i na 2 { make z be 1/0 } } } rescue e { }
+yarn(i)`, "100\n"},
+		{`try { count i from 1 reach 3 { make f be do() { bring i }
+suppose i na 2 { 1 / 0 } } } rescue e { }
+try { f() } rescue e { yarn(e) }`, "I no sabi dis one: i\n"},
+		{`do f() { make i be 100
+try { count i from 1 reach 3 { 1 / 0 } } rescue e { }
+bring i }
+yarn(f())`, "100\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := runOutput(t, setup+tt.input); got != tt.expected {
+				t.Errorf("expected output %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	// Errors outside any try block, or thrown again by a rescue block,
+	// still stop the program
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{"risky(0)", "Omo! You no fit divide by zero o!"},
+		{"try { 1 } rescue err { 2 }\nrisky(0)", "Omo! You no fit divide by zero o!"},
+		{"try { risky(0) } rescue err { risky(0) }", "Omo! You no fit divide by zero o!"},
+		{"do f() { try { 1 } rescue err { 2 } }\nf()\nrisky(0)", "Omo! You no fit divide by zero o!"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := compileAndRun(setup + tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+
+	// A try block rescues the error before RecoverErrors makes it a value
+	program := parser.New(lexer.New("try { 1 / 0 } rescue err { yarn(\"rescued\") }\nyarn(is_error(1 / 0))")).ParseProgram()
+	chunk, err := New().Compile(program)
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+	var out bytes.Buffer
+	machine := vm.NewVMWithOutput(&out)
+	machine.RecoverErrors = true
+	if _, err := machine.Run(chunk); err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+	if got := out.String(); got != "rescued\ntru\n" {
+		t.Errorf("expected output %q, got %q", "rescued\ntru\n", got)
+	}
+}
+
+// ============================================================================
+// Function Integration Tests
+// ============================================================================
+
+func TestIntegration_Functions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"do seven() { bring 7 }\nseven()", 7},
+		{"do seven() { 7 }\nseven()", 7},
+		{"do seven() { 7 }\nseven() + seven()", 14},
+		{"do seven() { 7 }\ndo fourteen() { bring seven() * 2 }\nfourteen()", 14},
+		{"do pick(a, b) { bring 42 }\npick(1, 2) + 0", 42},
+		{"make f be do () { bring 5 }\nf()", 5},
+		{"do () { 9 }()", 9},
+		{"do add(a, b) { bring a + b }\nadd(2, 3)", 5},
+		{"do add(a, b) { a + b }\nadd(2, 3)", 5},
+		{"do sub(a, b) { bring a - b }\nsub(10, 3)", 7},
+		{"do sum4(a, b, c, d) { bring a + b + c + d }\nsum4(1, 2, 3, 4)", 10},
+		{"do sum5(a, b, c, d, e) { bring e * 10 + a }\nsum5(1, 2, 3, 4, 5)", 51},
+		{"do double(x) { make y be x * 2\ny }\ndouble(21)", 42},
+		{"do twice(x) { make x be x + x\nbring x }\ntwice(4)", 8},
+		{"make x be 100\ndo shadow(y) { make x be y\nx }\nshadow(1) + x", 101},
+		{"do fact(n) { suppose n no reach 2 { bring 1 }\nbring n * fact(n - 1) }\nfact(10)", 3628800},
+		{"do fib(n) { suppose n no reach 2 { bring n }\nbring fib(n - 1) + fib(n - 2) }\nfib(15)", 610},
+		{"do add(a, b) { bring a + b }\ndo add3(a, b, c) { bring add(add(a, b), c) }\nadd3(1, 2, 3)", 6},
+		// Tail calls
+		{"do total(n, acc) { suppose n na 0 { bring acc }\nbring total(n - 1, acc + n) }\ntotal(100, 0)", 5050},
+		{"do total(n, acc) { suppose n na 0 { bring acc }\ntotal(n - 1, acc + n) }\ntotal(100, 0)", 5050},
+		{"do spread(a, b, c) { a + b + c }\ndo call3(x) { spread(x, x, x) }\ncall3(4)", 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if !result.IsInt() {
+				t.Fatalf("expected int result, got %s", result.TypeName())
+			}
+
+			if got := result.AsInt(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_FunctionReturnType(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"do add(x, y) bring number { bring x + y }\nyarn(add(2, 3))", "5\n"},
+		{"do add(x, y) bring number { x + y }\nyarn(add(2, 0.5))", "2.5\n"},
+		{"do noop() bring nothing { }\nyarn(noop())", "nothing\n"},
+		{"do pick() bring function { bring len }\nyarn(pick()(\"abc\"))", "3\n"},
+		{"do add(x, y) bring number { bring \"five\" }\ntry { add(2, 3) } rescue err { yarn(err) }", "add suppose bring number, but e bring STRING\n"},
+		{"make f be do() bring string { 1 }\ntry { f() } rescue err { yarn(err) }", "dis function suppose bring string, but e bring INTEGER\n"},
+		// The check happens in the caller, outside the function's own try
+		{"do f() bring number { try { bring \"x\" } rescue err { bring 1 } }\ntry { f() } rescue err { yarn(err) }", "f suppose bring number, but e bring STRING\n"},
+		// A tail call's result is checked against the caller's type too
+		{"do one() { bring 1 }\ndo wrap() bring string { bring one() }\ntry { wrap() } rescue err { yarn(err) }", "wrap suppose bring string, but e bring INTEGER\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := runOutput(t, tt.input); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	_, err := compileAndRun("do add(x, y) bring wahala { bring x + y }")
+	if err == nil || err.Error() != "I no sabi dis return type: wahala" {
+		t.Errorf("expected unknown return type error, got %v", err)
+	}
+}
+
+func TestIntegration_Closures(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"counter",
+			`do make_counter() {
+	make c be 0
+	bring do() {
+		c be c + 1
+		bring c
+	}
+}
+make counter be make_counter();
+yarn(counter())
+yarn(counter())
+make other be make_counter();
+yarn(other())
+yarn(counter())`,
+			"1\n2\n1\n3\n",
+		},
+		{
+			"parameter",
+			`do outer(n) {
+	do inner() { bring n + 1 }
+	bring inner()
+}
+yarn(outer(20))`,
+			"21\n",
+		},
+		{
+			// b and c reach the innermost function through the one around it
+			"nested",
+			`do adder(a) {
+	bring do(b) { bring do(c) { bring a + b + c } }
+}
+yarn(adder(1)(20)(300))`,
+			"321\n",
+		},
+		{
+			// Closures over the same variable share it, before and after
+			// the function that made it returns
+			"shared",
+			`do pair() {
+	make v be 0
+	do get() { bring v }
+	do set(x) { v be x }
+	set(5)
+	yarn(get())
+	yarn(v)
+	bring get
+}
+make g be pair();
+yarn(g())`,
+			"5\n5\n5\n",
+		},
+		{
+			"recursive inner function",
+			`do outer(n) {
+	do fact(k) {
+		suppose k no reach 2 { bring 1 }
+		bring k * fact(k - 1)
+	}
+	bring fact(n)
+}
+yarn(outer(5))`,
+			"120\n",
+		},
+		{
+			// make inside the inner function gives it its own x
+			"make shadows",
+			`do outer() {
+	make x be 1
+	do inner() {
+		make x be 2
+		bring x
+	}
+	yarn(inner())
+	bring x
+}
+yarn(outer())`,
+			"2\n1\n",
+		},
+		{
+			// Enough closures to sweep the heap a few times; the ones a
+			// global still reaches, directly or through upvalues, survive
+			"many closures",
+			`do adder(n) { bring do(x) { bring x + n } }
+do wrap(g) { bring do() { bring g() + 1 } }
+make keep be adder(0)
+make chain be do() { bring 0 }
+count i from 1 reach 5000 {
+	make junk be adder(i)
+	suppose i na 2500 { keep be junk }
+	suppose i % 10 na 0 { chain be wrap(chain) }
+}
+yarn(keep(1))
+yarn(chain())`,
+			"2501\n500\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runOutput(t, tt.input); got != tt.expected {
+				t.Errorf("expected output %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIntegration_FunctionWithoutValue(t *testing.T) {
+	input := `
+	do noop() { }
+	noop()
+	`
+
+	result, err := compileAndRun(input)
+	if err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+
+	if !result.IsNothing() {
+		t.Errorf("expected nothing, got %s", result.String())
+	}
+}
+
+func TestIntegration_ImplicitAndExplicitReturn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Running off the end of the body (OP_RETURN)
+		{"do f(a) { make b be a * 3 }\nf(2)", "6"},
+		{"do f(a) { suppose a { bring 1 } }\nf(lie)", "nothing"},
+		{"do f(a) { a; \"done\" }\nf(1)", "done"},
+		// bring (OP_BRING)
+		{"do f(a) { suppose a { bring 1 } }\nf(tru)", "1"},
+		{"do f(a) { bring a; 5 }\nf(2)", "2"},
+		{"do f() { bring nothing }\nf()", "nothing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := compileAndRun(tt.input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if got := result.String(); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// argumentOrderSetup records each note() and pick() call in order
+const argumentOrderSetup = `
+make order be ""
+do note(s) {
+	order be order + s
+	bring s
+}
+do join3(a, b, c) { bring a + b + c }
+do pick() {
+	order be order + "f"
+	bring join3
+}
+`
+
+func TestIntegration_CallArgumentOrder(t *testing.T) {
+	tests := []struct {
+		call     string
+		expected string
+	}{
+		{`join3(note("a"), note("b"), note("c"))`, "abc"},
+		// Arguments are pushed before the function
+		{`pick()(note("a"), note("b"), note("c"))`, "abcf"},
+		{`join3(note("a"), join3(note("b"), note("c"), ""), note("d"))`, "abcd"},
+		{`len(note("a") + note("b"))`, "ab"},
+	}
+
+	for _, tt := range tests {
+		result, err := compileAndRun(argumentOrderSetup + tt.call + "\norder")
+		if err != nil {
+			t.Errorf("%s: execution error: %v", tt.call, err)
+			continue
+		}
+		if !result.IsString() || *result.AsString() != tt.expected {
+			t.Errorf("%s: expected order %q, got %s", tt.call, tt.expected, result.String())
+		}
+	}
+}
+
+func TestIntegration_CallArgumentOutputOrder(t *testing.T) {
+	input := `
+	do both(a, b) { bring nothing }
+	both(yarn("a"), yarn("b"))
+	yarn(both(yarn("c"), yarn("d")))
+	`
+
+	if out := runOutput(t, input); out != "a\nb\nc\nd\nnothing\n" {
+		t.Errorf("expected arguments printed left to right, got %q", out)
+	}
+}
+
+func TestIntegration_ConstantFolding(t *testing.T) {
+	// Each expression, folded at compile time, must give what the same
+	// sum gives when the VM works it out from variables
+	tests := []string{
+		"2 + 3 * 4",
+		"-7 / 2",
+		"-7 % 3",
+		"140737488355327 - 1",
+		"1000000 * 1000000 / 7",
+		"(5 big pass 3) be tru",
+		"lie abi (2 <= 1)",
+		`"How " + "far"`,
+		`"a" be "a"`,
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			folded, err := compileAndRun(input)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			computed, err := compileAndRun(hideConstants(input))
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+
+			if folded.String() != computed.String() || folded.TypeName() != computed.TypeName() {
+				t.Errorf("folded to %s (%s), but works out to %s (%s)",
+					folded.String(), folded.TypeName(), computed.String(), computed.TypeName())
+			}
+		})
+	}
+}
+
+// hideConstants turns every literal in an expression into a read of a
+// global holding it, so nothing can be folded
+func hideConstants(expr string) string {
+	var globals, body strings.Builder
+	l := lexer.New(expr)
+	n := 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.INT, token.TRU, token.LIE:
+			fmt.Fprintf(&globals, "make c%d be %s;\n", n, tok.Literal)
+		case token.STRING:
+			fmt.Fprintf(&globals, "make c%d be %q;\n", n, tok.Literal)
+		default:
+			body.WriteString(tok.Literal + " ")
+			continue
+		}
+		fmt.Fprintf(&body, "c%d ", n)
+		n++
+	}
+	// Brackets keep "c0 be c1" from reading as an assignment
+	return globals.String() + "(" + body.String() + ")"
+}
+
+// ============================================================================
+// Error Handling Integration Tests
+// ============================================================================
+
+func TestIntegration_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"undefined variable", "undefined_var"},
+		{"division by zero", "10 / 0"},
+		{"modulo by zero", "10 % 0"},
+		{"type error subtract", "5 - tru"},
+		{"type error multiply", "5 * lie"},
+		{"calling a non-function", "make x be 5\nx()"},
+		{"builtin value wrong arg count", "make f be len\nf()"},
+		{"function wrong arg count", "do pick(a, b) { bring 1 }\npick(1)"},
+		{"len with no arguments", "len()"},
+		{"len of a number", "len(5)"},
+		{"type with two arguments", "type(1, 2)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileAndRun(tt.input)
+			if err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestIntegration_ErrorLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		line  int
+	}{
+		{"division on line 3", "make x be 10\nmake y be 2\nyarn(x / 0)\nyarn(y)", 3},
+		{"operator on its own line", "make x be 10\nmake y be x\n  / 0", 3},
+		{"inside suppose", "make x be 1\nsuppose x be 1 {\n    make y be 2\n    x - tru\n}", 4},
+		{"inside a loop", "make i be 0\ndey do while i no reach 3 {\n    i be i + 1\n}\ni % 0", 5},
+		{"inside a function", "do half(n) {\n    bring n / 0\n}\n\nhalf(4)", 2},
+		{"calling a non-function", "make x be 5\n\nx()", 3},
+		{"overflow", "make top be 140737488355327\ntop + 1", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileAndRun(tt.input)
+			var runtimeErr *vm.RuntimeError
+			if !errors.As(err, &runtimeErr) {
+				t.Fatalf("expected a runtime error, got %v", err)
+			}
+			if runtimeErr.Line != tt.line {
+				t.Errorf("expected the error on line %d, got line %d (%s)", tt.line, runtimeErr.Line, runtimeErr.Message)
+			}
+			if want := fmt.Sprintf("[line %d]", tt.line); !strings.Contains(err.Error(), want) {
+				t.Errorf("expected %q in %q", want, err.Error())
+			}
+		})
+	}
+}
+
+func TestIntegration_BuiltinAsOperand(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"len + 1", "You fit only call builtin len, no fit add am"},
+		{"1 + len", "You fit only call builtin len, no fit add am"},
+		{`len + "x"`, "You fit only call builtin len, no fit add am"},
+		{"type * 2", "You fit only call builtin type, no fit multiply am"},
+		{"len big pass 3", "You fit only call builtin len, no fit compare am"},
+		{"-yarn", "You fit only call builtin yarn, no fit negate am"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := compileAndRun(tt.input)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+
+			if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("expected error containing %q, got %q", tt.expected, err.Error())
 			}
 		})
 	}
@@ -0,0 +1,220 @@
+package compiler
+
+import (
+	"math"
+
+	"pidgin-lang/vm"
+)
+
+// maxLongJump is the farthest an OP_JUMP_LONG or OP_LOOP_LONG can go
+const maxLongJump = 1<<24 - 1
+
+// ============================================================================
+// Jump Offsets
+// ============================================================================
+
+// isForwardJump reports whether op takes a signed 16-bit offset from the end
+// of the instruction
+func isForwardJump(op vm.Opcode) bool {
+	switch op {
+	case vm.OP_JUMP, vm.OP_JUMP_IF_LIE, vm.OP_JUMP_IF_TRU,
+		vm.OP_JUMP_IF_LIE_PEEK, vm.OP_JUMP_IF_TRU_PEEK:
+		return true
+	}
+	return false
+}
+
+// isJump reports whether op moves ip by an offset operand. OP_TRY counts,
+// since its offset says where the rescue code starts.
+func isJump(op vm.Opcode) bool {
+	switch op {
+	case vm.OP_JUMP_LONG, vm.OP_LOOP, vm.OP_LOOP_LONG, vm.OP_TRY:
+		return true
+	}
+	return isForwardJump(op)
+}
+
+// jumpTarget returns the absolute position the jump at ip lands on
+func jumpTarget(code []byte, ip int) int {
+	switch vm.Opcode(code[ip]) {
+	case vm.OP_LOOP:
+		return ip + 3 - int(uint16(code[ip+1])<<8|uint16(code[ip+2]))
+	case vm.OP_JUMP_LONG, vm.OP_TRY:
+		return ip + 4 + readLong(code, ip+1)
+	case vm.OP_LOOP_LONG:
+		return ip + 4 - readLong(code, ip+1)
+	}
+	offset := int16(uint16(code[ip+1])<<8 | uint16(code[ip+2]))
+	return ip + 3 + int(offset)
+}
+
+// jumpOffset returns the operand a jump op at ip needs to land on target,
+// and whether that operand fits
+func jumpOffset(op vm.Opcode, ip, target int) (int, bool) {
+	switch op {
+	case vm.OP_LOOP:
+		offset := ip + 3 - target
+		return offset, offset >= 0 && offset <= math.MaxUint16
+	case vm.OP_JUMP_LONG, vm.OP_TRY:
+		offset := target - (ip + 4)
+		return offset, offset >= 0 && offset <= maxLongJump
+	case vm.OP_LOOP_LONG:
+		offset := ip + 4 - target
+		return offset, offset >= 0 && offset <= maxLongJump
+	}
+	offset := target - (ip + 3)
+	return offset, offset >= math.MinInt16 && offset <= math.MaxInt16
+}
+
+// setJumpTarget points the jump at ip at target, which must be in its reach
+func setJumpTarget(code []byte, ip, target int) {
+	op := vm.Opcode(code[ip])
+	offset, _ := jumpOffset(op, ip, target)
+	if op == vm.OP_JUMP_LONG || op == vm.OP_LOOP_LONG || op == vm.OP_TRY {
+		code[ip+1] = byte(offset >> 16)
+		code[ip+2] = byte(offset >> 8)
+		code[ip+3] = byte(offset)
+		return
+	}
+	code[ip+1] = byte(uint16(offset) >> 8)
+	code[ip+2] = byte(offset)
+}
+
+func readLong(code []byte, at int) int {
+	return int(code[at])<<16 | int(code[at+1])<<8 | int(code[at+2])
+}
+
+// ============================================================================
+// Long Jumps
+// ============================================================================
+
+// invertedJump is the conditional jump taken in exactly the cases op isn't
+var invertedJump = map[vm.Opcode]vm.Opcode{
+	vm.OP_JUMP_IF_LIE:      vm.OP_JUMP_IF_TRU,
+	vm.OP_JUMP_IF_TRU:      vm.OP_JUMP_IF_LIE,
+	vm.OP_JUMP_IF_LIE_PEEK: vm.OP_JUMP_IF_TRU_PEEK,
+	vm.OP_JUMP_IF_TRU_PEEK: vm.OP_JUMP_IF_LIE_PEEK,
+}
+
+// widenJumps rewrites the jumps whose 16-bit offsets can't reach their
+// targets into long form. long holds the position and target of each jump
+// the compiler couldn't patch:
+//
+//	OP_JUMP               → OP_JUMP_LONG
+//	OP_LOOP               → OP_LOOP_LONG
+//	OP_JUMP_IF_LIE target → OP_JUMP_IF_TRU +4, OP_JUMP_LONG target
+//
+// and likewise for the other conditional jumps. Widening a jump moves the
+// code after it, which can push other jumps out of reach, so this repeats
+// until every short jump left still fits.
+func widenJumps(chunk *vm.Chunk, long map[int]int) {
+	if len(long) == 0 {
+		return
+	}
+	code := chunk.Code
+
+	targets := make(map[int]int)
+	for ip := 0; ip < len(code); ip += 1 + vm.Opcode(code[ip]).GetOperandCount() {
+		if target, ok := long[ip]; ok {
+			targets[ip] = target
+		} else if isJump(vm.Opcode(code[ip])) {
+			targets[ip] = jumpTarget(code, ip)
+		}
+	}
+
+	wide := make(map[int]bool)
+	for ip := range long {
+		wide[ip] = true
+	}
+
+	var newPos []int
+	for {
+		newPos = widenedLayout(code, wide)
+		grew := false
+		for ip, target := range targets {
+			if wide[ip] {
+				continue
+			}
+			if _, ok := jumpOffset(vm.Opcode(code[ip]), newPos[ip], newPos[target]); !ok {
+				wide[ip] = true
+				grew = true
+			}
+		}
+		if !grew {
+			break
+		}
+	}
+
+	newCode := make([]byte, 0, newPos[len(code)])
+	newLines := make([]int, 0, newPos[len(code)])
+	for ip := 0; ip < len(code); {
+		op := vm.Opcode(code[ip])
+		next := ip + 1 + op.GetOperandCount()
+		line := chunk.Lines[ip]
+
+		target, isTarget := targets[ip]
+		if !isTarget {
+			newCode = append(newCode, code[ip:next]...)
+			newLines = append(newLines, chunk.Lines[ip:next]...)
+			ip = next
+			continue
+		}
+
+		if wide[ip] {
+			switch op {
+			case vm.OP_JUMP:
+				op = vm.OP_JUMP_LONG
+			case vm.OP_LOOP:
+				op = vm.OP_LOOP_LONG
+			default:
+				// Skip over the long jump when the condition goes the other way
+				newCode = append(newCode, byte(invertedJump[op]), 0, 4)
+				newLines = append(newLines, line, line, line)
+				op = vm.OP_JUMP_LONG
+			}
+		}
+
+		at := len(newCode)
+		newCode = append(newCode, byte(op))
+		for i := 0; i < op.GetOperandCount(); i++ {
+			newCode = append(newCode, 0)
+		}
+		for len(newLines) < len(newCode) {
+			newLines = append(newLines, line)
+		}
+		setJumpTarget(newCode, at, newPos[target])
+		ip = next
+	}
+
+	chunk.Code = newCode
+	chunk.Lines = newLines
+}
+
+// widenedLayout maps each position in code to where it ends up once the
+// jumps in wide are made long. The extra entry at the end maps len(code).
+func widenedLayout(code []byte, wide map[int]bool) []int {
+	newPos := make([]int, len(code)+1)
+	n := 0
+	for ip := 0; ip < len(code); {
+		op := vm.Opcode(code[ip])
+		next := ip + 1 + op.GetOperandCount()
+
+		size := next - ip
+		if wide[ip] {
+			switch op {
+			case vm.OP_JUMP, vm.OP_LOOP:
+				size = 4
+			default:
+				size = 3 + 4
+			}
+		}
+
+		for i := ip; i < next; i++ {
+			newPos[i] = n + i - ip
+		}
+		n += size
+		ip = next
+	}
+	newPos[len(code)] = n
+	return newPos
+}
@@ -0,0 +1,370 @@
+package compiler
+
+import (
+	"math/bits"
+
+	"pidgin-lang/ast"
+	"pidgin-lang/vm"
+)
+
+// optimize runs the passes that work on finished bytecode. Jumps are
+// threaded first, since that can leave jumps to the next instruction for
+// the peephole pass to remove.
+func optimize(chunk *vm.Chunk) {
+	threadJumps(chunk)
+	peephole(chunk)
+}
+
+// ============================================================================
+// Jump Threading
+// ============================================================================
+
+// threadJumps retargets any jump that lands on an unconditional OP_JUMP so it
+// goes straight to the final destination, saving a dispatch per hop.
+// Only OP_JUMP and OP_JUMP_LONG are followed: conditional jumps and OP_LOOP
+// do work at their target, so stopping there keeps the program's behaviour
+// the same.
+func threadJumps(chunk *vm.Chunk) {
+	code := chunk.Code
+
+	for ip := 0; ip < len(code); ip += 1 + vm.Opcode(code[ip]).GetOperandCount() {
+		op := vm.Opcode(code[ip])
+		if !isForwardJump(op) && op != vm.OP_JUMP_LONG {
+			continue
+		}
+
+		target := jumpTarget(code, ip)
+		final := target
+
+		// Follow the chain, giving up on cycles (a jump can't take more
+		// hops than there are bytes in the chunk)
+		for hops := 0; hops < len(code) && final >= 0 && final < len(code) && isUnconditionalJump(vm.Opcode(code[final])); hops++ {
+			final = jumpTarget(code, final)
+		}
+		if final == target || final < 0 || final > len(code) {
+			continue
+		}
+
+		if _, ok := jumpOffset(op, ip, final); ok {
+			setJumpTarget(code, ip, final)
+		}
+	}
+}
+
+func isUnconditionalJump(op vm.Opcode) bool {
+	return op == vm.OP_JUMP || op == vm.OP_JUMP_LONG
+}
+
+// ============================================================================
+// Peephole Optimization
+// ============================================================================
+
+// peephole shrinks common instruction pairs:
+//
+//	OP_EQUAL, OP_NOT      → OP_NOT_EQUAL
+//	OP_JUMP to the next instruction → nothing
+//	OP_POP, OP_HALT       → OP_HALT
+//
+// OP_HALT gives back the top of the stack, so dropping the OP_POP in front
+// of it makes the value of the last statement the program's result, the
+// way compileStatementValue lays it out. An OP_NOT that a jump lands on is
+// kept, since code arriving there must still run it, and an OP_POP stays
+// when a jump lands on the OP_HALT after it, since code arriving there
+// skipped it. Removing bytes moves everything after them, so every jump is
+// pointed at its target's new position afterwards.
+func peephole(chunk *vm.Chunk) {
+	code := chunk.Code
+
+	targets := make(map[int]bool)
+	for ip := 0; ip < len(code); ip += 1 + vm.Opcode(code[ip]).GetOperandCount() {
+		if isJump(vm.Opcode(code[ip])) {
+			targets[jumpTarget(code, ip)] = true
+		}
+	}
+
+	// Mark the bytes of every instruction that goes
+	drop := make([]bool, len(code))
+	dropped := false
+	for ip := 0; ip < len(code); {
+		op := vm.Opcode(code[ip])
+		next := ip + 1 + op.GetOperandCount()
+		var following vm.Opcode
+		if next < len(code) {
+			following = vm.Opcode(code[next])
+		}
+
+		switch {
+		case op == vm.OP_EQUAL && following == vm.OP_NOT && !targets[next]:
+			code[ip] = byte(vm.OP_NOT_EQUAL)
+			drop[next] = true
+			dropped = true
+			next++
+		case op == vm.OP_JUMP && jumpTarget(code, ip) == next:
+			for i := ip; i < next; i++ {
+				drop[i] = true
+			}
+			dropped = true
+		case op == vm.OP_POP && following == vm.OP_HALT && !targets[next]:
+			drop[ip] = true
+			dropped = true
+		}
+		ip = next
+	}
+	if !dropped {
+		return
+	}
+
+	// newPos maps each old position to where it ends up. A dropped
+	// instruction maps to whatever comes after it, which is where a jump
+	// landing on it now goes.
+	newPos := make([]int, len(code)+1)
+	n := 0
+	for i := range code {
+		newPos[i] = n
+		if !drop[i] {
+			n++
+		}
+	}
+	newPos[len(code)] = n
+
+	newCode := make([]byte, 0, n)
+	newLines := make([]int, 0, n)
+	for ip := 0; ip < len(code); {
+		op := vm.Opcode(code[ip])
+		next := ip + 1 + op.GetOperandCount()
+		if drop[ip] {
+			ip = next
+			continue
+		}
+
+		at := len(newCode)
+		newCode = append(newCode, code[ip:next]...)
+		newLines = append(newLines, chunk.Lines[ip:next]...)
+
+		// Code only shrinks, so the new offsets always fit
+		if isJump(op) {
+			setJumpTarget(newCode, at, newPos[jumpTarget(code, ip)])
+		}
+		ip = next
+	}
+
+	chunk.Code = newCode
+	chunk.Lines = newLines
+}
+
+// ============================================================================
+// Strength Reduction
+// ============================================================================
+
+// shiftFor reports whether node multiplies or divides by a constant power of
+// two, giving the shift that replaces the OP_MUL or OP_DIV and its power:
+//
+//	x * 8 → OP_SHIFT_LEFT 3
+//	x / 8 → OP_SHIFT_RIGHT 3
+//
+// The shifts give the same result as the operators for every value of x,
+// so this doesn't need to know x is an integer. Only a constant on the
+// right counts; 8 * x would have to swap the operands, which shows in the
+// error when x isn't a number.
+func shiftFor(node *ast.InfixExpression) (vm.Opcode, byte, bool) {
+	var op vm.Opcode
+	switch node.Operator {
+	case "*":
+		op = vm.OP_SHIFT_LEFT
+	case "/":
+		op = vm.OP_SHIFT_RIGHT
+	default:
+		return 0, 0, false
+	}
+
+	value, ok := foldConstant(node.Right)
+	if !ok {
+		return 0, 0, false
+	}
+	d, ok := value.(int64)
+	// x * 1 stays a multiplication, since it has nothing to shift
+	if !ok || d < 2 || d&(d-1) != 0 {
+		return 0, 0, false
+	}
+	return op, byte(bits.TrailingZeros64(uint64(d))), true
+}
+
+// isStringExpression reports whether expr always gives a string when it
+// gives anything: a string literal, or a '+' with one on either side, since
+// OP_ADD can only concatenate or fail once one operand is a string. When
+// both operands of '+' are known strings, the compiler emits OP_CONCAT.
+func isStringExpression(expr ast.Expression) bool {
+	switch node := expr.(type) {
+	case *ast.StringLiteral:
+		return true
+	case *ast.InfixExpression:
+		return node.Operator == "+" && (isStringExpression(node.Left) || isStringExpression(node.Right))
+	}
+	return false
+}
+
+// ============================================================================
+// Constant Folding
+// ============================================================================
+
+// constant is the value of an expression worked out at compile time: an
+// int64, a bool or a string
+type constant interface{}
+
+// foldConstant works out an expression built only from integer, boolean and
+// string literals, giving exactly what the VM would. Anything that would
+// stop the program at runtime, like dividing by zero or leaving the 48-bit
+// range, is not folded, so the error still happens when the code runs.
+func foldConstant(expr ast.Expression) (constant, bool) {
+	switch node := expr.(type) {
+	case *ast.IntegerLiteral:
+		return node.Value, node.Value >= vm.MIN_INT_48 && node.Value <= vm.MAX_INT_48
+	case *ast.Boolean:
+		return node.Value, true
+	case *ast.StringLiteral:
+		return node.Value, true
+	case *ast.PrefixExpression:
+		return foldPrefix(node)
+	case *ast.InfixExpression:
+		return foldInfix(node)
+	case *ast.ChainExpression:
+		return foldInfix(node.Chain)
+	}
+	return nil, false
+}
+
+func foldPrefix(node *ast.PrefixExpression) (constant, bool) {
+	// The smallest integer is only written as a negated literal, since its
+	// positive half doesn't fit
+	if lit, ok := node.Right.(*ast.IntegerLiteral); ok && node.Operator == "-" {
+		return -lit.Value, -lit.Value >= vm.MIN_INT_48 && -lit.Value <= vm.MAX_INT_48
+	}
+
+	right, ok := foldConstant(node.Right)
+	if !ok {
+		return nil, false
+	}
+
+	switch node.Operator {
+	case "-":
+		if n, ok := right.(int64); ok && n != vm.MIN_INT_48 {
+			return -n, true
+		}
+	case "!", "no", "no be":
+		if b, ok := right.(bool); ok {
+			return !b, true
+		}
+	}
+	return nil, false
+}
+
+func foldInfix(node *ast.InfixExpression) (constant, bool) {
+	left, ok := foldConstant(node.Left)
+	if !ok {
+		return nil, false
+	}
+	right, ok := foldConstant(node.Right)
+	if !ok {
+		return nil, false
+	}
+
+	switch a := left.(type) {
+	case int64:
+		if b, ok := right.(int64); ok {
+			return foldIntegers(node.Operator, a, b)
+		}
+	case bool:
+		if b, ok := right.(bool); ok {
+			switch node.Operator {
+			case "and":
+				return a && b, true
+			case "abi", "or":
+				return a || b, true
+			case "be", "na", "==":
+				return a == b, true
+			case "no be", "!=":
+				return a != b, true
+			}
+		}
+	case string:
+		if b, ok := right.(string); ok {
+			switch node.Operator {
+			case "+":
+				return a + b, true
+			case "be", "na", "==":
+				return a == b, true
+			case "no be", "!=":
+				return a != b, true
+			case "big pass", ">":
+				return a > b, true
+			case "no reach", "<":
+				return a < b, true
+			case "reach", ">=":
+				return a >= b, true
+			case "<=":
+				return a <= b, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func foldIntegers(operator string, a, b int64) (constant, bool) {
+	var result int64
+
+	switch operator {
+	case "+":
+		result = a + b
+	case "-":
+		result = a - b
+	case "*":
+		// Two 48-bit numbers can overflow even an int64
+		result = a * b
+		if a != 0 && result/a != b {
+			return nil, false
+		}
+	case "/":
+		if b == 0 {
+			return nil, false
+		}
+		result = a / b
+	case "%":
+		if b == 0 {
+			return nil, false
+		}
+		result = a % b
+	case "be", "na", "==":
+		return a == b, true
+	case "no be", "!=":
+		return a != b, true
+	case "big pass", ">":
+		return a > b, true
+	case "no reach", "<":
+		return a < b, true
+	case "reach", ">=":
+		return a >= b, true
+	case "<=":
+		return a <= b, true
+	default:
+		return nil, false
+	}
+
+	return result, result >= vm.MIN_INT_48 && result <= vm.MAX_INT_48
+}
+
+// emitConstant pushes a folded value
+func (c *Compiler) emitConstant(value constant) {
+	switch value := value.(type) {
+	case int64:
+		c.emitInteger(value)
+	case bool:
+		if value {
+			c.emit(vm.OP_TRU)
+		} else {
+			c.emit(vm.OP_LIE)
+		}
+	case string:
+		idx := c.addConstant(vm.NewString(c.chunk.InternString(value)))
+		c.emitShort(vm.OP_CONSTANT, uint16(idx))
+	}
+}
@@ -0,0 +1,485 @@
+package compiler
+
+import (
+	"fmt"
+	"testing"
+
+	"pidgin-lang/vm"
+)
+
+// ============================================================================
+// Jump Threading Tests
+// ============================================================================
+
+func TestThreadJumps(t *testing.T) {
+	// 0: JUMP_IF_LIE -> 7    (lands on the first hop)
+	// 3: CONST_1
+	// 4: JUMP -> 10
+	// 7: JUMP -> 10          (first hop)
+	// 10: JUMP -> 14         (second hop)
+	// 13: CONST_0
+	// 14: HALT
+	chunk := vm.NewChunk()
+	chunk.WriteOpcode(vm.OP_JUMP_IF_LIE, 1)
+	chunk.WriteBytes([]byte{0, 4}, 1)
+	chunk.WriteOpcode(vm.OP_CONST_1, 1)
+	chunk.WriteOpcode(vm.OP_JUMP, 1)
+	chunk.WriteBytes([]byte{0, 3}, 1)
+	chunk.WriteOpcode(vm.OP_JUMP, 1)
+	chunk.WriteBytes([]byte{0, 0}, 1)
+	chunk.WriteOpcode(vm.OP_JUMP, 1)
+	chunk.WriteBytes([]byte{0, 1}, 1)
+	chunk.WriteOpcode(vm.OP_CONST_0, 1)
+	chunk.WriteOpcode(vm.OP_HALT, 1)
+
+	threadJumps(chunk)
+
+	tests := []struct {
+		pos    int
+		target int
+	}{
+		{0, 14},
+		{4, 14},
+		{7, 14},
+		{10, 14},
+	}
+
+	for _, tt := range tests {
+		if got := jumpTarget(chunk.Code, tt.pos); got != tt.target {
+			t.Errorf("jump at %d: expected target %d, got %d", tt.pos, tt.target, got)
+		}
+	}
+}
+
+func TestThreadJumpsStopsAtLoop(t *testing.T) {
+	// 0: JUMP -> 3, where an OP_LOOP sends control backwards.
+	// The loop does real work, so the jump must keep landing on it.
+	chunk := vm.NewChunk()
+	chunk.WriteOpcode(vm.OP_JUMP, 1)
+	chunk.WriteBytes([]byte{0, 0}, 1)
+	chunk.WriteOpcode(vm.OP_LOOP, 1)
+	chunk.WriteBytes([]byte{0, 6}, 1)
+
+	threadJumps(chunk)
+
+	if got := jumpTarget(chunk.Code, 0); got != 3 {
+		t.Errorf("expected jump to stay on the loop at 3, got %d", got)
+	}
+}
+
+func TestThreadJumpsCycle(t *testing.T) {
+	// Two jumps pointing at each other must not hang the pass
+	chunk := vm.NewChunk()
+	chunk.WriteOpcode(vm.OP_JUMP, 1)
+	chunk.WriteBytes([]byte{0, 0}, 1)
+	chunk.WriteOpcode(vm.OP_JUMP, 1)
+	chunk.WriteBytes([]byte{0xFF, 0xFA}, 1) // -6
+
+	threadJumps(chunk)
+}
+
+func TestThreadJumpsNestedSuppose(t *testing.T) {
+	// The inner suppose's end jump lands on the outer suppose's end jump
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"suppose tru { suppose tru { 1 } abi { 2 } } abi { 3 }", 1},
+		{"suppose tru { suppose lie { 1 } abi { 2 } } abi { 3 }", 2},
+		{"suppose lie { suppose tru { 1 } abi { 2 } } abi { 3 }", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			chunk, err := New().Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+
+			// No jump should be left pointing at another unconditional jump
+			code := chunk.Code
+			for ip := 0; ip < len(code); ip += 1 + vm.Opcode(code[ip]).GetOperandCount() {
+				op := vm.Opcode(code[ip])
+				if op != vm.OP_JUMP && op != vm.OP_JUMP_IF_LIE && op != vm.OP_JUMP_IF_TRU {
+					continue
+				}
+				if target := jumpTarget(code, ip); target < len(code) && vm.Opcode(code[target]) == vm.OP_JUMP {
+					t.Errorf("jump at %d still lands on OP_JUMP at %d", ip, target)
+				}
+			}
+
+			result, err := vm.NewVM().Run(chunk)
+			if err != nil {
+				t.Fatalf("execution error: %v", err)
+			}
+			if got := result.AsInt(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Constant Folding Tests
+// ============================================================================
+
+func TestFoldConstants(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []byte
+	}{
+		{"2 + 3", []byte{byte(vm.OP_CONST_I8), 5}},
+		{"2 + 3 * 4", []byte{byte(vm.OP_CONST_I8), 14}},
+		{"(10 - 4) / 3 % 5", []byte{byte(vm.OP_CONST_I8), 2}},
+		{"-5", []byte{byte(vm.OP_CONST_I8), 0xFB}},
+		{"-(2 + 3)", []byte{byte(vm.OP_CONST_I8), 0xFB}},
+		{"-7 / 2", []byte{byte(vm.OP_CONST_I8), 0xFD}},
+		{"100 * 100", []byte{byte(vm.OP_CONST_I16), 0x27, 0x10}},
+		{"3 - 2", []byte{byte(vm.OP_CONST_1)}},
+		{"5 big pass 3", []byte{byte(vm.OP_TRU)}},
+		{"(2 + 2) be 5", []byte{byte(vm.OP_LIE)}},
+		{"3 <= 3", []byte{byte(vm.OP_TRU)}},
+		{"tru and lie", []byte{byte(vm.OP_LIE)}},
+		{"lie or (1 no reach 2)", []byte{byte(vm.OP_TRU)}},
+		{"!(tru be lie)", []byte{byte(vm.OP_TRU)}},
+		{`"How " + "far"`, []byte{byte(vm.OP_CONSTANT), 0, 0}},
+		{`("a" + "b") be "ab"`, []byte{byte(vm.OP_TRU)}},
+		{`"apple" no reach "banana"`, []byte{byte(vm.OP_TRU)}},
+		{`"abi" >= "abeg"`, []byte{byte(vm.OP_TRU)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			chunk, err := New().Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+
+			expected := append(tt.expected, byte(vm.OP_HALT))
+			if string(chunk.Code) != string(expected) {
+				t.Errorf("wrong bytecode.\nExpected: %v\nGot:      %v", expected, chunk.Code)
+			}
+		})
+	}
+}
+
+func TestFoldStringConstant(t *testing.T) {
+	chunk, err := New().Compile(parse(`"How " + "far" + "!"`))
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+
+	if len(chunk.Constants) != 1 || chunk.Constants[0].String() != "How far!" {
+		t.Errorf("expected one constant \"How far!\", got %v", chunk.Constants)
+	}
+}
+
+func TestFoldLeavesRuntimeErrors(t *testing.T) {
+	// These stop the program, so they must still run to do it
+	tests := []struct {
+		input string
+		op    vm.Opcode
+	}{
+		{"1 / 0", vm.OP_DIV},
+		{"10 % (5 - 5)", vm.OP_MOD},
+		{"140737488355327 + 1", vm.OP_ADD},
+		{"-140737488355328 - 1", vm.OP_SUB},
+		{"16777216 * 16777215", vm.OP_MUL},
+		{"16777216 * 16777216", vm.OP_SHIFT_LEFT},
+		{"-140737488355328 / -1", vm.OP_DIV},
+		{"-(-140737488355328)", vm.OP_NEGATE},
+		{`1 + "a"`, vm.OP_ADD},
+		{"tru + 1", vm.OP_ADD},
+		{"-tru", vm.OP_NEGATE},
+		{"5 big pass lie", vm.OP_GREATER},
+		{`"a" no reach 1`, vm.OP_LESS},
+		{"1.5 + 1", vm.OP_ADD},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			chunk, err := New().Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+
+			found := false
+			for _, op := range opcodes(chunk.Code) {
+				if op == tt.op {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected %s to be left for runtime, got %v", tt.op, chunk.Code)
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Peephole Tests
+// ============================================================================
+
+// writeCode builds a chunk from raw bytes, giving byte i line i+1 so the
+// test can tell which bytes survive
+func writeCode(code ...byte) *vm.Chunk {
+	chunk := vm.NewChunk()
+	for i, b := range code {
+		chunk.WriteByte(b, i+1)
+	}
+	return chunk
+}
+
+func TestPeephole(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     []byte
+		expected []byte
+		lines    []int
+	}{
+		{
+			"equal then not",
+			[]byte{byte(vm.OP_GET_LOCAL_0), byte(vm.OP_CONST_1), byte(vm.OP_EQUAL), byte(vm.OP_NOT), byte(vm.OP_HALT)},
+			[]byte{byte(vm.OP_GET_LOCAL_0), byte(vm.OP_CONST_1), byte(vm.OP_NOT_EQUAL), byte(vm.OP_HALT)},
+			[]int{1, 2, 3, 5},
+		},
+		{
+			"jump to the next instruction",
+			[]byte{byte(vm.OP_CONST_1), byte(vm.OP_JUMP), 0, 0, byte(vm.OP_HALT)},
+			[]byte{byte(vm.OP_CONST_1), byte(vm.OP_HALT)},
+			[]int{1, 5},
+		},
+		{
+			"pop before halt",
+			[]byte{byte(vm.OP_CONST_1), byte(vm.OP_POP), byte(vm.OP_HALT)},
+			[]byte{byte(vm.OP_CONST_1), byte(vm.OP_HALT)},
+			[]int{1, 3},
+		},
+		{
+			// 0: JUMP_IF_LIE -> 8, over the removed jump
+			// 3: JUMP -> 6 (removed)
+			// 6: CONST_0
+			// 7: POP
+			// 8: NOTHING
+			// 9: HALT
+			"jump over removed code",
+			[]byte{byte(vm.OP_JUMP_IF_LIE), 0, 5, byte(vm.OP_JUMP), 0, 0, byte(vm.OP_CONST_0), byte(vm.OP_POP), byte(vm.OP_NOTHING), byte(vm.OP_HALT)},
+			[]byte{byte(vm.OP_JUMP_IF_LIE), 0, 2, byte(vm.OP_CONST_0), byte(vm.OP_POP), byte(vm.OP_NOTHING), byte(vm.OP_HALT)},
+			[]int{1, 2, 3, 7, 8, 9, 10},
+		},
+		{
+			// 0: CONST_1
+			// 1: JUMP -> 4 (removed)
+			// 4: EQUAL, NOT (fused)
+			// 6: LOOP -> 0
+			// 9: HALT
+			"loop back over removed code",
+			[]byte{byte(vm.OP_CONST_1), byte(vm.OP_JUMP), 0, 0, byte(vm.OP_EQUAL), byte(vm.OP_NOT), byte(vm.OP_LOOP), 0, 9, byte(vm.OP_HALT)},
+			[]byte{byte(vm.OP_CONST_1), byte(vm.OP_NOT_EQUAL), byte(vm.OP_LOOP), 0, 5, byte(vm.OP_HALT)},
+			[]int{1, 5, 7, 8, 9, 10},
+		},
+		{
+			// 0: JUMP_IF_LIE -> 4, straight onto the NOT, so it must stay
+			// 3: EQUAL
+			// 4: NOT
+			"jump lands on the not",
+			[]byte{byte(vm.OP_JUMP_IF_LIE), 0, 1, byte(vm.OP_EQUAL), byte(vm.OP_NOT), byte(vm.OP_HALT)},
+			[]byte{byte(vm.OP_JUMP_IF_LIE), 0, 1, byte(vm.OP_EQUAL), byte(vm.OP_NOT), byte(vm.OP_HALT)},
+			[]int{1, 2, 3, 4, 5, 6},
+		},
+		{
+			// 0: JUMP_IF_LIE_PEEK -> 5, straight onto the HALT, so the
+			//    POP it skips must stay
+			// 3: SWAP
+			// 4: POP
+			"jump lands on the halt",
+			[]byte{byte(vm.OP_JUMP_IF_LIE_PEEK), 0, 2, byte(vm.OP_SWAP), byte(vm.OP_POP), byte(vm.OP_HALT)},
+			[]byte{byte(vm.OP_JUMP_IF_LIE_PEEK), 0, 2, byte(vm.OP_SWAP), byte(vm.OP_POP), byte(vm.OP_HALT)},
+			[]int{1, 2, 3, 4, 5, 6},
+		},
+		{
+			"nothing to do",
+			[]byte{byte(vm.OP_CONST_1), byte(vm.OP_NOT), byte(vm.OP_HALT)},
+			[]byte{byte(vm.OP_CONST_1), byte(vm.OP_NOT), byte(vm.OP_HALT)},
+			[]int{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunk := writeCode(tt.code...)
+			peephole(chunk)
+
+			if string(chunk.Code) != string(tt.expected) {
+				t.Errorf("wrong bytecode.\nExpected: %v\nGot:      %v", tt.expected, chunk.Code)
+			}
+			if fmt.Sprint(chunk.Lines) != fmt.Sprint(tt.lines) {
+				t.Errorf("wrong lines. expected %v, got %v", tt.lines, chunk.Lines)
+			}
+		})
+	}
+}
+
+func TestPeepholeShrinksCompiledCode(t *testing.T) {
+	tests := []struct {
+		input  string
+		result string
+	}{
+		{"make x be 2;\n!(x be 3)", "tru"},
+		{"make x be 2;\n!(x be 2)", "lie"},
+		// A condition that's only a negation jumps on its operand instead,
+		// so these keep theirs inside an and
+		{"make x be 2;\nsuppose !(x be 3) and tru { \"yes\" } abi { \"no\" }", "yes"},
+		{"make n be 0\ndey do while !(n be 5) and tru { n be n + 1 }\nn", "5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			program := parse(tt.input)
+
+			// The same program, compiled without the peephole pass
+			c := New()
+			for _, stmt := range program.Statements[:len(program.Statements)-1] {
+				if err := c.compileStatement(stmt); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := c.compileStatementValue(program.Statements[len(program.Statements)-1]); err != nil {
+				t.Fatal(err)
+			}
+			c.emit(vm.OP_HALT)
+			plain := c.chunk
+
+			optimized, err := New().Compile(program)
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+
+			if len(optimized.Code) >= len(plain.Code) {
+				t.Errorf("expected fewer than %d bytes, got %d", len(plain.Code), len(optimized.Code))
+			}
+
+			for _, chunk := range []*vm.Chunk{plain, optimized} {
+				result, err := vm.NewVM().Run(chunk)
+				if err != nil {
+					t.Fatalf("execution error: %v", err)
+				}
+				if result.String() != tt.result {
+					t.Errorf("expected %s, got %s", tt.result, result.String())
+				}
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Strength Reduction Tests
+// ============================================================================
+
+func TestStrengthReduction(t *testing.T) {
+	tests := []struct {
+		input    string
+		op       vm.Opcode
+		operand  byte
+		replaced bool
+	}{
+		{"x * 4", vm.OP_SHIFT_LEFT, 2, true},
+		{"x * 8", vm.OP_SHIFT_LEFT, 3, true},
+		{"x * 2", vm.OP_SHIFT_LEFT, 1, true},
+		{"x * (2 * 8)", vm.OP_SHIFT_LEFT, 4, true},
+		{"x * 70368744177664", vm.OP_SHIFT_LEFT, 46, true},
+		{"x / 2", vm.OP_SHIFT_RIGHT, 1, true},
+		{"x / 1024", vm.OP_SHIFT_RIGHT, 10, true},
+		// Not a power of two, or not on the right
+		{"x * 1", vm.OP_MUL, 0, false},
+		{"x * 6", vm.OP_MUL, 0, false},
+		{"x * -4", vm.OP_MUL, 0, false},
+		{"x * 0", vm.OP_MUL, 0, false},
+		{"x * 4.0", vm.OP_MUL, 0, false},
+		{"x * x", vm.OP_MUL, 0, false},
+		{"4 * x", vm.OP_MUL, 0, false},
+		{"x / 3", vm.OP_DIV, 0, false},
+		{"x % 4", vm.OP_MOD, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			chunk, err := New().Compile(parse("make x be 5;\n" + tt.input))
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+
+			found := false
+			for ip := 0; ip < len(chunk.Code); ip += 1 + vm.Opcode(chunk.Code[ip]).GetOperandCount() {
+				switch op := vm.Opcode(chunk.Code[ip]); op {
+				case vm.OP_MUL, vm.OP_DIV:
+					if tt.replaced {
+						t.Errorf("expected %s to be replaced by a shift", op)
+					}
+				case vm.OP_SHIFT_LEFT, vm.OP_SHIFT_RIGHT:
+					if !tt.replaced {
+						t.Errorf("expected no shift, got %s", op)
+					} else if chunk.Code[ip+1] != tt.operand {
+						t.Errorf("expected %s %d, got %s %d", tt.op, tt.operand, op, chunk.Code[ip+1])
+					}
+				}
+				if vm.Opcode(chunk.Code[ip]) == tt.op {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected %s in %v", tt.op, opcodes(chunk.Code))
+			}
+		})
+	}
+}
+
+// ============================================================================
+// String Concatenation Tests
+// ============================================================================
+
+func TestCompileConcat(t *testing.T) {
+	// The '+' instructions each input compiles to, in order
+	tests := []struct {
+		input string
+		ops   []vm.Opcode
+	}{
+		// b is only known to be a string while the program runs
+		{`"a" + b`, []vm.Opcode{vm.OP_ADD}},
+		{`b + "a"`, []vm.Opcode{vm.OP_ADD}},
+		{`"a" + b + "c"`, []vm.Opcode{vm.OP_ADD, vm.OP_CONCAT}},
+		{`"a" + (b + "c")`, []vm.Opcode{vm.OP_ADD, vm.OP_CONCAT}},
+		{`("a" + b) + ("c" + b)`, []vm.Opcode{vm.OP_ADD, vm.OP_ADD, vm.OP_CONCAT}},
+		{`b + 1 + "a"`, []vm.Opcode{vm.OP_ADD, vm.OP_ADD}},
+		{`b + b`, []vm.Opcode{vm.OP_ADD}},
+		{`b + 1`, []vm.Opcode{vm.OP_ADD}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			chunk, err := New().Compile(parse("make b be \"b\";\n" + tt.input))
+			if err != nil {
+				t.Fatalf("compilation error: %v", err)
+			}
+
+			var got []vm.Opcode
+			for _, op := range opcodes(chunk.Code) {
+				if op == vm.OP_ADD || op == vm.OP_CONCAT {
+					got = append(got, op)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.ops) {
+				t.Errorf("expected %v, got %v", tt.ops, got)
+			}
+		})
+	}
+
+	// Two literals still fold into one constant
+	chunk, err := New().Compile(parse(`"a" + "b"`))
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+	if ops := opcodes(chunk.Code); len(ops) != 2 || ops[0] != vm.OP_CONSTANT {
+		t.Errorf(`expected "a" + "b" to fold to one constant, got %v`, ops)
+	}
+}
@@ -22,6 +22,10 @@ type SymbolTable struct {
 	outer          *SymbolTable       // Enclosing scope (for nested functions)
 	store          map[string]Symbol  // Symbol storage
 	numDefinitions int                // Number of definitions in this scope
+
+	// FreeSymbols are the enclosing function's variables this function
+	// captures, as the enclosing scope sees them, in upvalue order
+	FreeSymbols []Symbol
 }
 
 // NewSymbolTable creates a new symbol table
@@ -86,11 +90,9 @@ func (st *SymbolTable) Resolve(name string) (Symbol, bool) {
 			return symbol, false
 		}
 
-		// If the symbol is a local in an outer scope, it becomes an upvalue
-		if symbol.Scope == SCOPE_LOCAL {
-			// For Phase 2, we'll treat upvalues as globals for simplicity
-			// Phase 4 will implement proper closure support
-			return symbol, true
+		// A variable of an enclosing function becomes an upvalue here
+		if symbol.Scope == SCOPE_LOCAL || symbol.Scope == SCOPE_UPVALUE {
+			return st.defineFree(name, symbol), true
 		}
 
 		return symbol, true
@@ -100,6 +102,83 @@ func (st *SymbolTable) Resolve(name string) (Symbol, bool) {
 	return Symbol{}, false
 }
 
+// defineFree records that this scope captures original, which name refers
+// to in the enclosing one, and returns the upvalue it reads it through
+func (st *SymbolTable) defineFree(name string, original Symbol) Symbol {
+	st.FreeSymbols = append(st.FreeSymbols, original)
+
+	symbol := Symbol{
+		Name:  original.Name,
+		Scope: SCOPE_UPVALUE,
+		Index: len(st.FreeSymbols) - 1,
+	}
+
+	st.store[name] = symbol
+	return symbol
+}
+
+// lookup finds name in this scope or an enclosing one without capturing
+// anything, for questions about a name that don't read the variable
+func (st *SymbolTable) lookup(name string) (Symbol, bool) {
+	for table := st; table != nil; table = table.outer {
+		if symbol, ok := table.store[name]; ok {
+			return symbol, true
+		}
+	}
+	return Symbol{}, false
+}
+
+// ResolveLocal looks up a symbol defined in this scope only, ignoring
+// enclosing scopes, so a new local can shadow an outer name
+func (st *SymbolTable) ResolveLocal(name string) (Symbol, bool) {
+	symbol, ok := st.store[name]
+	if !ok || symbol.Scope != SCOPE_LOCAL {
+		return Symbol{}, false
+	}
+	return symbol, true
+}
+
+// ResolveOwn looks up a variable this scope defines itself, globals
+// included at the top level, without searching enclosing scopes
+func (st *SymbolTable) ResolveOwn(name string) (Symbol, bool) {
+	symbol, ok := st.store[name]
+	if !ok || (symbol.Scope != SCOPE_LOCAL && symbol.Scope != SCOPE_GLOBAL) {
+		return Symbol{}, false
+	}
+	return symbol, true
+}
+
+// ResolveOuter looks up a variable in the enclosing scopes only, skipping
+// this one. Builtins don't count, since every scope can see them.
+func (st *SymbolTable) ResolveOuter(name string) (Symbol, bool) {
+	if st.outer == nil {
+		return Symbol{}, false
+	}
+	symbol, ok := st.outer.lookup(name)
+	if !ok || symbol.Scope == SCOPE_BUILTIN {
+		return Symbol{}, false
+	}
+	return symbol, true
+}
+
+// DefineShadow defines a fresh symbol stored under hidden and makes name
+// resolve to it until the returned restore function is called. Loops use
+// this to scope their variable to the loop body.
+func (st *SymbolTable) DefineShadow(name, hidden string) (Symbol, func()) {
+	previous, hadPrevious := st.store[name]
+	symbol := st.Define(hidden)
+	st.store[name] = symbol
+
+	restore := func() {
+		if hadPrevious {
+			st.store[name] = previous
+		} else {
+			delete(st.store, name)
+		}
+	}
+	return symbol, restore
+}
+
 // NumDefinitions returns the number of symbols defined in this scope
 func (st *SymbolTable) NumDefinitions() int {
 	return st.numDefinitions
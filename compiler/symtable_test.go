@@ -127,6 +127,135 @@ func TestResolveNestedLocal(t *testing.T) {
 	}
 }
 
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+	firstLocal.Define("d")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	thirdLocal := NewEnclosedSymbolTable(secondLocal)
+
+	tests := []struct {
+		table       *SymbolTable
+		expected    []Symbol
+		freeSymbols []Symbol
+	}{
+		{
+			secondLocal,
+			[]Symbol{
+				{Name: "a", Scope: SCOPE_GLOBAL, Index: 0},
+				{Name: "d", Scope: SCOPE_UPVALUE, Index: 0},
+				{Name: "e", Scope: SCOPE_LOCAL, Index: 0},
+				{Name: "c", Scope: SCOPE_UPVALUE, Index: 1},
+				{Name: "d", Scope: SCOPE_UPVALUE, Index: 0},
+			},
+			[]Symbol{
+				{Name: "d", Scope: SCOPE_LOCAL, Index: 1},
+				{Name: "c", Scope: SCOPE_LOCAL, Index: 0},
+			},
+		},
+		{
+			// e is a local two scopes up, and c already an upvalue there
+			thirdLocal,
+			[]Symbol{
+				{Name: "e", Scope: SCOPE_UPVALUE, Index: 0},
+				{Name: "c", Scope: SCOPE_UPVALUE, Index: 1},
+			},
+			[]Symbol{
+				{Name: "e", Scope: SCOPE_LOCAL, Index: 0},
+				{Name: "c", Scope: SCOPE_UPVALUE, Index: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, sym := range tt.expected {
+			result, ok := tt.table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+
+		if len(tt.table.FreeSymbols) != len(tt.freeSymbols) {
+			t.Fatalf("expected %d free symbols, got %d: %+v", len(tt.freeSymbols), len(tt.table.FreeSymbols), tt.table.FreeSymbols)
+		}
+		for i, sym := range tt.freeSymbols {
+			if got := tt.table.FreeSymbols[i]; got != sym {
+				t.Errorf("free symbol %d: expected %+v, got=%+v", i, sym, got)
+			}
+		}
+	}
+}
+
+func TestResolveOuterCapturesNothing(t *testing.T) {
+	global := NewSymbolTable()
+	outer := NewEnclosedSymbolTable(global)
+	outer.Define("x")
+	middle := NewEnclosedSymbolTable(outer)
+	inner := NewEnclosedSymbolTable(middle)
+
+	// Asking whether a name hides an outer one doesn't read it
+	if _, ok := inner.ResolveOuter("x"); !ok {
+		t.Fatal("expected x to be found outside")
+	}
+	if len(middle.FreeSymbols) != 0 || len(inner.FreeSymbols) != 0 {
+		t.Errorf("expected no captures, got %+v and %+v", middle.FreeSymbols, inner.FreeSymbols)
+	}
+}
+
+func TestResolveLocalSkipsOuterScopes(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("b")
+
+	if _, ok := local.ResolveLocal("a"); ok {
+		t.Errorf("expected global a not to resolve as a local")
+	}
+
+	expected := Symbol{Name: "b", Scope: SCOPE_LOCAL, Index: 0}
+	if result, ok := local.ResolveLocal("b"); !ok || result != expected {
+		t.Errorf("expected b to resolve to %+v, got=%+v", expected, result)
+	}
+}
+
+func TestDefineShadow(t *testing.T) {
+	global := NewSymbolTable()
+	i := global.Define("i")
+
+	shadow, restore := global.DefineShadow("i", "i@1:1")
+	expected := Symbol{Name: "i@1:1", Scope: SCOPE_GLOBAL, Index: 1}
+	if shadow != expected {
+		t.Errorf("expected shadow %+v, got=%+v", expected, shadow)
+	}
+	if result, ok := global.Resolve("i"); !ok || result != expected {
+		t.Errorf("expected i to resolve to the shadow %+v, got=%+v", expected, result)
+	}
+
+	restore()
+	if result, ok := global.Resolve("i"); !ok || result != i {
+		t.Errorf("expected i to resolve to %+v after restore, got=%+v", i, result)
+	}
+
+	// A name that wasn't defined before is gone again after restore
+	_, restore = global.DefineShadow("j", "j@2:1")
+	restore()
+	if _, ok := global.Resolve("j"); ok {
+		t.Errorf("expected j to be undefined after restore")
+	}
+}
+
 func TestDefineResolveBuiltins(t *testing.T) {
 	global := NewSymbolTable()
 
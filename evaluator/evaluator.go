@@ -1,21 +1,91 @@
 package evaluator
 
 import (
+	"bufio"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"pidgin-lang/ast"
 	"pidgin-lang/object"
 )
 
+// now is the clock benchmark reads; tests swap it for a fake one
+var now = time.Now
+
+// maxStringLength is the longest string repeat_string will build
+const maxStringLength = 1 << 30
+
+// maxRangeLength is the most numbers range will put in one array
+const maxRangeLength = 1 << 24
+
+// maxPatterns is how many compiled patterns the regex builtins remember
+const maxPatterns = 256
+
+// patterns holds compiled regular expressions by their pattern string, so a
+// pattern used in a loop is only compiled once
+var (
+	patternsMu sync.Mutex
+	patterns   = make(map[string]*regexp.Regexp)
+)
+
+// maxPrettyDepth is how many arrays and hashes deep pretty_print goes
+// before writing ... instead, which also stops it on one that holds itself
+const maxPrettyDepth = 32
+
+// stdin is where the input builtin reads lines from, and stdout where
+// yarn, pretty_print and input's prompt write. SetInput and SetOutput
+// point them elsewhere.
+var (
+	stdin            = bufio.NewReader(os.Stdin)
+	stdout io.Writer = os.Stdout
+)
+
+// SetInput makes the input builtin read from r instead of standard input
+func SetInput(r io.Reader) {
+	stdin = bufio.NewReader(r)
+}
+
+// SetOutput makes yarn, pretty_print and input's prompt write to w
+// instead of standard output
+func SetOutput(w io.Writer) {
+	stdout = w
+}
+
+// OverflowToFloat makes integer arithmetic that leaves the VM's 48-bit
+// range give a float instead of an error (the --overflow=float flag)
+var OverflowToFloat = false
+
 // Singleton objects for efficiency
 var (
-	NOTHING = &object.Nothing{}
-	TRU     = &object.Boolean{Value: true}
-	LIE     = &object.Boolean{Value: false}
+	NOTHING  = &object.Nothing{}
+	TRU      = &object.Boolean{Value: true}
+	LIE      = &object.Boolean{Value: false}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
-// Eval evaluates an AST node and returns an object
+// Eval evaluates an AST node and returns an object. An error takes the
+// line of the innermost node it came out of, the line the VM gives it.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := eval(node, env)
+	if err, ok := result.(*object.Error); ok && err.Line == 0 {
+		err.Line = ast.Line(node)
+	}
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 
 	// Statements
@@ -36,6 +106,16 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		env.Set(node.Name.Value, val)
 		return val
 
+	case *ast.AssignStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if _, ok := env.Assign(node.Name.Value, val); !ok {
+			return newError("You never make %s, so you no fit change am", node.Name.Value)
+		}
+		return val
+
 	case *ast.BringStatement:
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
@@ -43,9 +123,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
 	// Expressions
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return evalIntegerLiteral(node.Value)
+
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
@@ -60,6 +149,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalIdentifier(node, env)
 
 	case *ast.PrefixExpression:
+		// The smallest integer is only written as a negated literal, since
+		// its positive half doesn't fit
+		if lit, ok := node.Right.(*ast.IntegerLiteral); ok && node.Operator == "-" {
+			return evalIntegerLiteral(-lit.Value)
+		}
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
@@ -67,6 +161,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalPrefixExpression(node.Operator, right)
 
 	case *ast.InfixExpression:
+		// and / abi only look at the right side when they need to
+		if node.Operator == "and" || node.Operator == "abi" || node.Operator == "or" {
+			return evalLogicalExpression(node, env)
+		}
+
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
@@ -77,24 +176,65 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return evalInfixExpression(node.Operator, left, right)
 
+	case *ast.ChainExpression:
+		// The chain's hidden variables go in a scope of their own, so
+		// nothing can read them once it is done
+		return Eval(node.Chain, object.NewEnclosedEnvironment(env))
+
+	case *ast.BindExpression:
+		value := Eval(node.Value, env)
+		if !isError(value) {
+			env.Set(node.Name.Value, value)
+		}
+		return value
+
 	case *ast.SupposeExpression:
 		return evalSupposeExpression(node, env)
 
 	case *ast.WhileExpression:
 		return evalWhileExpression(node, env)
 
+	case *ast.ForExpression:
+		return evalForExpression(node, env)
+
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
 	case *ast.DoExpression:
 		return evalDoExpression(node, env)
 
-	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
 		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+
+	case *ast.CallExpression:
+		// Arguments go left to right before the function, the order the
+		// VM pushes them in
 		args := evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
 		return applyFunction(function, args)
 	}
 
@@ -112,6 +252,8 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 			return result.Value
 		case *object.Error:
 			return result
+		case *object.Break, *object.Continue:
+			return loopControlError(result)
 		}
 	}
 
@@ -126,7 +268,8 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -163,6 +306,80 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
+// =============================================================================
+// Index Expressions: arr[0], arr[-1], h["key"]
+// =============================================================================
+
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		return evalArrayIndexExpression(left, index)
+	case *object.Hash:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("I no fit index %s", left.Type())
+	}
+}
+
+// evalArrayIndexExpression looks up an array element. Negative indices
+// count back from the end, so arr[-1] is the last element.
+func evalArrayIndexExpression(array *object.Array, index object.Object) object.Object {
+	idx, ok := index.(*object.Integer)
+	if !ok {
+		return newError("Array index must be INTEGER, you give am %s", index.Type())
+	}
+
+	i := idx.Value
+	length := int64(len(array.Elements))
+	if i < 0 {
+		i += length
+	}
+	if i < 0 || i >= length {
+		return newError("Index %d no dey inside array wey get %d items", idx.Value, length)
+	}
+
+	return array.Elements[i]
+}
+
+// evalHashIndexExpression looks up a key, giving nothing when it's missing
+func evalHashIndexExpression(hash *object.Hash, index object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("I no fit use %s as hash key", index.Type())
+	}
+
+	pair, ok := hash.Pairs[key.HashKey()]
+	if !ok {
+		return NOTHING
+	}
+	return pair.Value
+}
+
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for _, keyNode := range node.Keys {
+		key := Eval(keyNode, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("I no fit use %s as hash key", key.Type())
+		}
+
+		value := Eval(node.Pairs[keyNode], env)
+		if isError(value) {
+			return value
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash
+}
+
 // =============================================================================
 // Prefix Expressions: -5, !tru, no be x
 // =============================================================================
@@ -180,6 +397,15 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 	}
 }
 
+// evalIntegerLiteral gives a literal as an integer, refusing one outside the
+// 48-bit range the VM's compiler refuses too
+func evalIntegerLiteral(value int64) object.Object {
+	if value < object.MIN_INT_48 || value > object.MAX_INT_48 {
+		return newError("Number too big for Pidgin: %d", value)
+	}
+	return &object.Integer{Value: value}
+}
+
 func evalBangOperatorExpression(right object.Object) object.Object {
 	switch right {
 	case TRU:
@@ -194,12 +420,14 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return integerResult(-right.Value)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("I no fit minus dis one: %s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
 // =============================================================================
@@ -210,6 +438,9 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		// At least one side is a float, so the whole operation is done in floats
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ || right.Type() == object.STRING_OBJ:
@@ -237,16 +468,34 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		result := leftVal + rightVal
+		// Overflow flips the sign: both operands share a sign the result lacks
+		if (leftVal >= 0) == (rightVal >= 0) && (result >= 0) != (leftVal >= 0) {
+			return integerOverflow(float64(leftVal) + float64(rightVal))
+		}
+		return integerResult(result)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		result := leftVal - rightVal
+		if (leftVal >= 0) != (rightVal >= 0) && (result >= 0) != (leftVal >= 0) {
+			return integerOverflow(float64(leftVal) - float64(rightVal))
+		}
+		return integerResult(result)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		result := leftVal * rightVal
+		if leftVal != 0 && result/leftVal != rightVal {
+			return integerOverflow(float64(leftVal) * float64(rightVal))
+		}
+		return integerResult(result)
 	case "/":
 		if rightVal == 0 {
 			return newError("Omo! You no fit divide by zero o!")
 		}
-		return &object.Integer{Value: leftVal / rightVal}
+		return integerResult(leftVal / rightVal)
+	case "%":
+		if rightVal == 0 {
+			return newError("Omo! You no fit divide by zero o!")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
 	case "big pass":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
 	case "no reach":
@@ -255,6 +504,10 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "reach", ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
 	case "be":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "na":
@@ -264,6 +517,62 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
+// integerResult gives n as an integer when it fits the VM's 48 bits, so
+// both backends overflow at the same place, and overflows otherwise
+func integerResult(n int64) object.Object {
+	if n < object.MIN_INT_48 || n > object.MAX_INT_48 {
+		return integerOverflow(float64(n))
+	}
+	return &object.Integer{Value: n}
+}
+
+// integerOverflow handles an integer result too big for 48 bits, giving
+// the float value when OverflowToFloat is set and an error otherwise
+func integerOverflow(value float64) object.Object {
+	if OverflowToFloat {
+		return &object.Float{Value: value}
+	}
+	return newError("Number too big for Pidgin")
+}
+
+// evalFloatInfixExpression handles float/float and mixed integer/float operands.
+// Unlike integer division, 5.0 / 2 gives 2.5.
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("Omo! You no fit divide by zero o!")
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("Omo! You no fit divide by zero o!")
+		}
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "big pass", ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "no reach", "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case "reach", ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case "be", "na":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	default:
+		return newError("I no understand dis operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
@@ -275,6 +584,15 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "na":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
+	// Strings compare letter by letter, the way a dictionary orders them
+	case "big pass", ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "no reach", "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case "reach", ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
 	default:
 		return newError("I no understand dis operator: %s %s %s", left.Type(), operator, right.Type())
 	}
@@ -308,6 +626,25 @@ func evalStringConcatenation(left, right object.Object) object.Object {
 	return &object.String{Value: leftVal + rightVal}
 }
 
+// evalLogicalExpression short-circuits the way the VM does: 'and' stops at
+// a falsy left side and 'abi' at a truthy one. The result is whichever
+// operand decided it, not a fresh boolean.
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if node.Operator == "and" && !isTruthy(left) {
+		return left
+	}
+	if node.Operator != "and" && isTruthy(left) {
+		return left
+	}
+
+	return Eval(node.Right, env)
+}
+
 // =============================================================================
 // Control Flow: suppose/abi, dey do while
 // =============================================================================
@@ -340,20 +677,128 @@ func evalWhileExpression(we *ast.WhileExpression, env *object.Environment) objec
 			break
 		}
 
-		result = Eval(we.Body, env)
+		body := Eval(we.Body, env)
+		if body != nil && body.Type() == object.BREAK_OBJ {
+			// Left with comot, so otherwise doesn't run
+			return NOTHING
+		}
 
-		// Check for return or error
-		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-				return result
-			}
+		var stop bool
+		if result, stop = loopBodyResult(body); stop {
+			return result
+		}
+	}
+
+	if we.Otherwise != nil {
+		return Eval(we.Otherwise, env)
+	}
+	return result
+}
+
+func evalForExpression(fe *ast.ForExpression, env *object.Environment) object.Object {
+	from := Eval(fe.From, env)
+	if isError(from) {
+		return from
+	}
+	to := Eval(fe.To, env)
+	if isError(to) {
+		return to
+	}
+
+	start, ok := from.(*object.Integer)
+	if !ok {
+		return newError("Count loop must start from INTEGER, you give am %s", from.Type())
+	}
+	end, ok := to.(*object.Integer)
+	if !ok {
+		return newError("Count loop must reach INTEGER, you give am %s", to.Type())
+	}
+
+	// The loop variable only lives inside the loop, so put back
+	// whatever the name meant before once we're done
+	name := fe.Variable.Value
+	previous, hadPrevious := env.GetLocal(name)
+	defer func() {
+		if hadPrevious {
+			env.Set(name, previous)
+		} else {
+			env.Delete(name)
+		}
+	}()
+
+	var result object.Object = NOTHING
+	for counter := start.Value; counter <= end.Value; counter++ {
+		env.Set(name, &object.Integer{Value: counter})
+
+		var stop bool
+		if result, stop = loopBodyResult(Eval(fe.Body, env)); stop {
+			return result
+		}
+
+		// Carry on from the variable's value in case the body changed it
+		current, _ := env.Get(name)
+		changed, ok := current.(*object.Integer)
+		if !ok {
+			return newError("Count loop variable %s must stay INTEGER", name)
 		}
+		counter = changed.Value
 	}
 
 	return result
 }
 
+// loopBodyResult works out what a loop should do after one run of its body.
+// It returns the loop's value so far and whether the loop must stop now.
+func loopBodyResult(result object.Object) (object.Object, bool) {
+	if result == nil {
+		return result, false
+	}
+
+	switch result.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, true
+	case object.BREAK_OBJ:
+		return NOTHING, true
+	case object.CONTINUE_OBJ:
+		return NOTHING, false
+	}
+	return result, false
+}
+
+// loopControlError reports a comot or kontinu that found no loop to act on
+func loopControlError(signal object.Object) *object.Error {
+	return newError("'%s' fit only dey inside loop", signal.Inspect())
+}
+
+// =============================================================================
+// Errors: try/rescue
+// =============================================================================
+
+// evalTryExpression runs the try block, and if it fails with a runtime error
+// runs the rescue block with the error's message in the rescue name. comot,
+// kontinu and bring pass through untouched.
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(te.Body, env)
+	failure, ok := result.(*object.Error)
+	if !ok {
+		return result
+	}
+
+	// Like a count loop's variable, the name only lives in the rescue block
+	name := te.Name.Value
+	previous, hadPrevious := env.GetLocal(name)
+	defer func() {
+		if hadPrevious {
+			env.Set(name, previous)
+		} else {
+			env.Delete(name)
+		}
+	}()
+
+	env.Set(name, &object.String{Value: failure.Message})
+	return Eval(te.Rescue, env)
+}
+
 // =============================================================================
 // Functions
 // =============================================================================
@@ -365,6 +810,13 @@ func evalDoExpression(de *ast.DoExpression, env *object.Environment) object.Obje
 		Env:        env,
 	}
 
+	if de.ReturnType != nil {
+		if _, ok := returnTypes[de.ReturnType.Value]; !ok {
+			return newError("I no sabi dis return type: %s", de.ReturnType.Value)
+		}
+		fn.ReturnType = de.ReturnType.Value
+	}
+
 	// If function has a name, bind it to the environment
 	if de.Name != nil {
 		fn.Name = de.Name.Value
@@ -374,12 +826,24 @@ func evalDoExpression(de *ast.DoExpression, env *object.Environment) object.Obje
 	return fn
 }
 
+// Apply calls a function or builtin value with the given arguments
+func Apply(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(fn, args)
+}
+
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
 		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		evaluated := unwrapReturnValue(Eval(fn.Body, extendedEnv))
+		switch evaluated.(type) {
+		case *object.Break, *object.Continue:
+			return loopControlError(evaluated)
+		}
+		if fn.ReturnType != "" && !isError(evaluated) {
+			return checkReturnType(fn, evaluated)
+		}
+		return evaluated
 
 	case *object.Builtin:
 		return fn.Fn(args...)
@@ -401,6 +865,35 @@ func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Enviro
 	return env
 }
 
+// returnTypes maps the type names allowed after 'bring' in a function
+// signature to the object types they accept
+var returnTypes = map[string][]object.ObjectType{
+	"number":   {object.INTEGER_OBJ, object.FLOAT_OBJ},
+	"string":   {object.STRING_OBJ},
+	"boolean":  {object.BOOLEAN_OBJ},
+	"nothing":  {object.NOTHING_OBJ},
+	"function": {object.FUNCTION_OBJ, object.BUILTIN_OBJ},
+}
+
+// checkReturnType errors if a function with a declared return type brings back something else
+func checkReturnType(fn *object.Function, result object.Object) object.Object {
+	if result == nil {
+		result = NOTHING
+	}
+
+	for _, allowed := range returnTypes[fn.ReturnType] {
+		if result.Type() == allowed {
+			return result
+		}
+	}
+
+	name := fn.Name
+	if name == "" {
+		name = "dis function"
+	}
+	return newError("%s suppose bring %s, but e bring %s", name, fn.ReturnType, result.Type())
+}
+
 func unwrapReturnValue(obj object.Object) object.Object {
 	if returnValue, ok := obj.(*object.ReturnValue); ok {
 		return returnValue.Value
@@ -416,11 +909,46 @@ var builtins = map[string]*object.Builtin{
 	"yarn": {
 		Fn: func(args ...object.Object) object.Object {
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				fmt.Fprintln(stdout, arg.Inspect())
+			}
+			return NOTHING
+		},
+	},
+	// pretty_print shows a value with every array item and hash pair on its
+	// own line, indented by how deep it sits
+	"pretty_print": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("pretty_print wan make one argument, you give am %d", len(args))
 			}
+			var out strings.Builder
+			writePretty(&out, args[0], 0)
+			out.WriteString("\n")
+			io.WriteString(stdout, out.String())
 			return NOTHING
 		},
 	},
+	// input shows the optional prompt and reads one line, without its line
+	// ending, or nothing once the input runs out
+	"input": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError("input wan make prompt or nothing, you give am %d argument", len(args))
+			}
+			if len(args) == 1 {
+				fmt.Fprint(stdout, args[0].Inspect())
+			}
+
+			line, err := stdin.ReadString('\n')
+			if err == io.EOF && line == "" {
+				return NOTHING
+			} else if err != nil && err != io.EOF {
+				return newError("I no fit read input: %s", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			return &object.String{Value: strings.TrimSuffix(line, "\r")}
+		},
+	},
 	"len": {
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
@@ -429,6 +957,12 @@ var builtins = map[string]*object.Builtin{
 			switch arg := args[0].(type) {
 			case *object.String:
 				return &object.Integer{Value: int64(len(arg.Value))}
+			case *object.Array:
+				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Hash:
+				return &object.Integer{Value: int64(len(arg.Pairs))}
+			case *object.Builder:
+				return &object.Integer{Value: int64(arg.Builder.Len())}
 			default:
 				return newError("I no fit check length of %s", args[0].Type())
 			}
@@ -442,29 +976,967 @@ var builtins = map[string]*object.Builtin{
 			return &object.String{Value: string(args[0].Type())}
 		},
 	},
-}
-
-// =============================================================================
-// Helpers
-// =============================================================================
-
-func nativeBoolToBooleanObject(input bool) *object.Boolean {
-	if input {
-		return TRU
-	}
-	return LIE
-}
-
-func isTruthy(obj object.Object) bool {
-	switch obj {
-	case NOTHING:
-		return false
-	case TRU:
-		return true
-	case LIE:
-		return false
-	default:
-		return true
+	// describe gives a hash saying what a value is: its type, its length
+	// when it has one, and how yarn would show it
+	"describe": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("describe wan make one argument, you give am %d", len(args))
+			}
+			info := object.NewHash()
+			info.Set(&object.String{Value: "type"}, &object.String{Value: string(args[0].Type())})
+			switch arg := args[0].(type) {
+			case *object.String:
+				info.Set(&object.String{Value: "length"}, &object.Integer{Value: int64(len(arg.Value))})
+			case *object.Array:
+				info.Set(&object.String{Value: "length"}, &object.Integer{Value: int64(len(arg.Elements))})
+			case *object.Hash:
+				info.Set(&object.String{Value: "length"}, &object.Integer{Value: int64(len(arg.Pairs))})
+			}
+			info.Set(&object.String{Value: "value"}, &object.String{Value: args[0].Inspect()})
+			return info
+		},
+	},
+	// is_error checks for an error value. Here an error stops the program
+	// before is_error can see it, so the answer is always lie; the VM can
+	// hand errors on as values when it is told to.
+	"is_error": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("is_error wan make one argument, you give am %d", len(args))
+			}
+			return nativeBoolToBooleanObject(args[0].Type() == object.ERROR_OBJ)
+		},
+	},
+	// flip is the function form of '!': lie for truthy values, tru for falsey ones
+	"flip": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("flip wan make one argument, you give am %d", len(args))
+			}
+			return evalBangOperatorExpression(args[0])
+		},
+	},
+	// assert stops the program when its condition is falsey
+	"assert": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 2 {
+				return newError("assert wan make condition and maybe message, you give am %d argument", len(args))
+			}
+			if isTruthy(args[0]) {
+				return NOTHING
+			}
+			if len(args) == 2 {
+				return newError("Assert fail: %s", args[1].Inspect())
+			}
+			return newError("Assert fail")
+		},
+	},
+	// coalesce gives back its first argument that isn't nothing, or nothing
+	// when they all are
+	"coalesce": {
+		Fn: func(args ...object.Object) object.Object {
+			for _, arg := range args {
+				if arg.Type() != object.NOTHING_OBJ {
+					return arg
+				}
+			}
+			return NOTHING
+		},
+	},
+	// copy duplicates an array or hash, still sharing whatever it holds
+	"copy": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("copy wan make one argument, you give am %d", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *object.Array:
+				return &object.Array{Elements: append([]object.Object(nil), arg.Elements...)}
+			case *object.Hash:
+				return copyHash(arg, func(value object.Object) object.Object { return value })
+			default:
+				return arg
+			}
+		},
+	},
+	// deep_copy duplicates arrays and hashes all the way down, so the
+	// result shares nothing that could change with the original
+	"deep_copy": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("deep_copy wan make one argument, you give am %d", len(args))
+			}
+			return deepCopy(args[0], make(map[object.Object]object.Object))
+		},
+	},
+	// hash gives a number that stays the same for the same value, from run
+	// to run, for keying caches and building sets
+	"hash": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("hash wan make one argument, you give am %d", len(args))
+			}
+			sum, ok := hashValue(args[0])
+			if !ok {
+				return newError("I no fit hash %s", args[0].Type())
+			}
+			return &object.Integer{Value: sum}
+		},
+	},
+	// unique, union, intersect and difference treat arrays as sets, keeping
+	// the first of any values that are equal by be, in the order they came
+	"unique": {
+		Fn: func(args ...object.Object) object.Object {
+			arrays, err := arrayArgs("unique", args, 1)
+			if err != nil {
+				return err
+			}
+			return uniqueWhere(arrays[0].Elements, nil)
+		},
+	},
+	"union": {
+		Fn: func(args ...object.Object) object.Object {
+			arrays, err := arrayArgs("union", args, 2)
+			if err != nil {
+				return err
+			}
+			both := append(append([]object.Object(nil), arrays[0].Elements...), arrays[1].Elements...)
+			return uniqueWhere(both, nil)
+		},
+	},
+	"intersect": {
+		Fn: func(args ...object.Object) object.Object {
+			arrays, err := arrayArgs("intersect", args, 2)
+			if err != nil {
+				return err
+			}
+			other := newValueSet(arrays[1].Elements)
+			return uniqueWhere(arrays[0].Elements, other.has)
+		},
+	},
+	"difference": {
+		Fn: func(args ...object.Object) object.Object {
+			arrays, err := arrayArgs("difference", args, 2)
+			if err != nil {
+				return err
+			}
+			other := newValueSet(arrays[1].Elements)
+			return uniqueWhere(arrays[0].Elements, func(obj object.Object) bool { return !other.has(obj) })
+		},
+	},
+	// take gives the first count items of an array, and drop the rest after
+	// them. A count past the end takes or drops everything.
+	"take": {Fn: countBuiltin("take", func(elements []object.Object, n int) []object.Object { return elements[:n] })},
+	"drop": {Fn: countBuiltin("drop", func(elements []object.Object, n int) []object.Object { return elements[n:] })},
+	// range counts from start up to, but not including, stop. range(n)
+	// starts from 0, and a stop at or before start gives an empty array.
+	"range": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 2 {
+				return newError("range wan make stop or start and stop, you give am %d argument", len(args))
+			}
+			bounds := make([]int64, len(args))
+			for i, arg := range args {
+				n, ok := arg.(*object.Integer)
+				if !ok {
+					return newError("range wan make INTEGER, but argument %d na %s", i+1, arg.Type())
+				}
+				bounds[i] = n.Value
+			}
+
+			start, stop := int64(0), bounds[0]
+			if len(bounds) == 2 {
+				start, stop = bounds[0], bounds[1]
+			}
+			if stop <= start {
+				return &object.Array{Elements: []object.Object{}}
+			}
+			if uint64(stop-start) > maxRangeLength {
+				return newError("range go make array wey too long")
+			}
+
+			elements := make([]object.Object, 0, stop-start)
+			for n := start; n < stop; n++ {
+				elements = append(elements, &object.Integer{Value: n})
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	// split cuts a string at every sep, or into characters when sep is ""
+	"split": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("split wan make 2 argument, you give am %d", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("split wan make STRING, you give am %s", args[0].Type())
+			}
+			sep, ok := args[1].(*object.String)
+			if !ok {
+				return newError("split wan make STRING, you give am %s", args[1].Type())
+			}
+			parts := strings.Split(str.Value, sep.Value)
+			elements := make([]object.Object, len(parts))
+			for i, part := range parts {
+				elements[i] = &object.String{Value: part}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	// join puts an array of strings together with sep between them
+	"join": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("join wan make 2 argument, you give am %d", len(args))
+			}
+			array, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("join wan make ARRAY, you give am %s", args[0].Type())
+			}
+			sep, ok := args[1].(*object.String)
+			if !ok {
+				return newError("join wan make STRING, you give am %s", args[1].Type())
+			}
+			parts := make([]string, len(array.Elements))
+			for i, element := range array.Elements {
+				str, ok := element.(*object.String)
+				if !ok {
+					return newError("join fit only join STRING, but item %d na %s", i, element.Type())
+				}
+				parts[i] = str.Value
+			}
+			return &object.String{Value: strings.Join(parts, sep.Value)}
+		},
+	},
+	"upper":   stringBuiltin("upper", strings.ToUpper),
+	"lower":   stringBuiltin("lower", strings.ToLower),
+	"reverse": stringBuiltin("reverse", reverseString),
+
+	"is_digit":  charBuiltin("is_digit", unicode.IsDigit),
+	"is_letter": charBuiltin("is_letter", unicode.IsLetter),
+	"is_space":  charBuiltin("is_space", unicode.IsSpace),
+
+	// Regular expressions, in Go's syntax
+	"matches": regexBuiltin("matches", func(re *regexp.Regexp, s string) object.Object {
+		return nativeBoolToBooleanObject(re.MatchString(s))
+	}),
+	"find": regexBuiltin("find", func(re *regexp.Regexp, s string) object.Object {
+		loc := re.FindStringIndex(s)
+		if loc == nil {
+			return NOTHING
+		}
+		return &object.String{Value: s[loc[0]:loc[1]]}
+	}),
+
+	// to_number reads a whole number written in a string
+	"to_number": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("to_number wan make one argument, you give am %d", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("to_number wan make STRING, you give am %s", args[0].Type())
+			}
+			text := strings.TrimSpace(str.Value)
+			n, err := strconv.ParseInt(text, 10, 64)
+			if errors.Is(err, strconv.ErrRange) {
+				value, _ := strconv.ParseFloat(text, 64)
+				return integerOverflow(value)
+			} else if err != nil {
+				return newError("to_number no fit turn %q to number", str.Value)
+			}
+			return integerResult(n)
+		},
+	},
+	// to_text gives any value as the string yarn would print for it
+	"to_text": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("to_text wan make one argument, you give am %d", len(args))
+			}
+			if str, ok := args[0].(*object.String); ok {
+				return str
+			}
+			return &object.String{Value: args[0].Inspect()}
+		},
+	},
+	// abs gives the distance of an integer from zero
+	"abs": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("abs wan make one argument, you give am %d", len(args))
+			}
+			n, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("abs wan make INTEGER, you give am %s", args[0].Type())
+			}
+			if n.Value < 0 {
+				return evalMinusPrefixOperatorExpression(n)
+			}
+			return n
+		},
+	},
+	"min": {Fn: pickInteger("min", func(a, b int64) bool { return a < b })},
+	"max": {Fn: pickInteger("max", func(a, b int64) bool { return a > b })},
+	// repeat_string gives count copies of a string, one after the other
+	"repeat_string": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("repeat_string wan make 2 argument, you give am %d", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("repeat_string wan make STRING, you give am %s", args[0].Type())
+			}
+			count, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError("repeat_string wan make INTEGER count, you give am %s", args[1].Type())
+			}
+			if count.Value < 0 {
+				return newError("repeat_string no fit repeat %d times", count.Value)
+			}
+			if len(str.Value) > 0 && count.Value > maxStringLength/int64(len(str.Value)) {
+				return newError("repeat_string go make string wey too long")
+			}
+			return &object.String{Value: strings.Repeat(str.Value, int(count.Value))}
+		},
+	},
+	// trim_prefix and trim_suffix cut an affix off one end, leaving the
+	// string alone when it isn't there
+	"trim_prefix": affixBuiltin("trim_prefix", strings.TrimPrefix),
+	"trim_suffix": affixBuiltin("trim_suffix", strings.TrimSuffix),
+	// make_builder, append and build put a string together a piece at a
+	// time without copying everything built so far at each step
+	"make_builder": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("make_builder no dey take argument, you give am %d", len(args))
+			}
+			return &object.Builder{}
+		},
+	},
+	"append": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("append wan make builder and value, you give am %d argument", len(args))
+			}
+			builder, ok := args[0].(*object.Builder)
+			if !ok {
+				return newError("append wan make BUILDER, you give am %s", args[0].Type())
+			}
+			// Anything else goes in the way '+' would join it to a string
+			builder.Builder.WriteString(args[1].Inspect())
+			return builder
+		},
+	},
+	"build": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("build wan make one argument, you give am %d", len(args))
+			}
+			builder, ok := args[0].(*object.Builder)
+			if !ok {
+				return newError("build wan make BUILDER, you give am %s", args[0].Type())
+			}
+			return &object.String{Value: builder.Builder.String()}
+		},
+	},
+}
+
+// stringBuiltin makes a builtin that takes one string and gives back fn of it
+func stringBuiltin(name string, fn func(string) string) *object.Builtin {
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("%s wan make one argument, you give am %d", name, len(args))
+		}
+		str, ok := args[0].(*object.String)
+		if !ok {
+			return newError("%s wan make STRING, you give am %s", name, args[0].Type())
+		}
+		return &object.String{Value: fn(str.Value)}
+	}}
+}
+
+// charBuiltin makes a builtin that tells whether a string has characters
+// and every one of them passes test, so it works on a single character or
+// a whole word
+func charBuiltin(name string, test func(rune) bool) *object.Builtin {
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("%s wan make one argument, you give am %d", name, len(args))
+		}
+		str, ok := args[0].(*object.String)
+		if !ok {
+			return newError("%s wan make STRING, you give am %s", name, args[0].Type())
+		}
+		if str.Value == "" {
+			return LIE
+		}
+		for _, r := range str.Value {
+			if !test(r) {
+				return LIE
+			}
+		}
+		return TRU
+	}}
+}
+
+// regexBuiltin makes a builtin that takes a string and a pattern and gives
+// back fn of the string and the compiled pattern
+func regexBuiltin(name string, fn func(re *regexp.Regexp, s string) object.Object) *object.Builtin {
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		if len(args) != 2 {
+			return newError("%s wan make 2 argument, you give am %d", name, len(args))
+		}
+		for _, arg := range args {
+			if _, ok := arg.(*object.String); !ok {
+				return newError("%s wan make STRING, you give am %s", name, arg.Type())
+			}
+		}
+		re, err := compilePattern(args[1].(*object.String).Value)
+		if err != nil {
+			return err
+		}
+		return fn(re, args[0].(*object.String).Value)
+	}}
+}
+
+// compilePattern compiles a regular expression, or gives back the one
+// compiled last time the same pattern came through
+func compilePattern(pattern string) (*regexp.Regexp, object.Object) {
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+
+	if re, ok := patterns[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, newError("Dis pattern no correct: %s", err)
+	}
+
+	// Programs that build patterns on the fly could fill the cache
+	// forever, so start again once it's full
+	if len(patterns) >= maxPatterns {
+		patterns = make(map[string]*regexp.Regexp)
+	}
+	patterns[pattern] = re
+	return re, nil
+}
+
+// affixBuiltin makes a builtin that takes a string and an affix and gives
+// back fn of them
+func affixBuiltin(name string, fn func(s, affix string) string) *object.Builtin {
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		if len(args) != 2 {
+			return newError("%s wan make 2 argument, you give am %d", name, len(args))
+		}
+		for _, arg := range args {
+			if _, ok := arg.(*object.String); !ok {
+				return newError("%s wan make STRING, you give am %s", name, arg.Type())
+			}
+		}
+		return &object.String{Value: fn(args[0].(*object.String).Value, args[1].(*object.String).Value)}
+	}}
+}
+
+// reverseString reverses s a character at a time, so letters made of more
+// than one byte stay whole
+func reverseString(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// arrayArgs checks a set builtin got n arguments, all arrays
+func arrayArgs(name string, args []object.Object, n int) ([]*object.Array, object.Object) {
+	if len(args) != n {
+		return nil, newError("%s wan make %d argument, you give am %d", name, n, len(args))
+	}
+	arrays := make([]*object.Array, n)
+	for i, arg := range args {
+		array, ok := arg.(*object.Array)
+		if !ok {
+			return nil, newError("%s wan make ARRAY, you give am %s", name, arg.Type())
+		}
+		arrays[i] = array
+	}
+	return arrays, nil
+}
+
+// countBuiltin makes a builtin that takes an array and a count, and gives a
+// new array of the items part picks. The count is capped at the array's
+// length before part sees it.
+func countBuiltin(name string, part func(elements []object.Object, n int) []object.Object) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 2 {
+			return newError("%s wan make 2 argument, you give am %d", name, len(args))
+		}
+		array, ok := args[0].(*object.Array)
+		if !ok {
+			return newError("%s wan make ARRAY, you give am %s", name, args[0].Type())
+		}
+		count, ok := args[1].(*object.Integer)
+		if !ok {
+			return newError("%s wan make INTEGER count, you give am %s", name, args[1].Type())
+		}
+		if count.Value < 0 {
+			return newError("%s no fit %s %d items", name, name, count.Value)
+		}
+
+		n := len(array.Elements)
+		if count.Value < int64(n) {
+			n = int(count.Value)
+		}
+		return &object.Array{Elements: append([]object.Object{}, part(array.Elements, n)...)}
+	}
+}
+
+// uniqueWhere returns the elements keep accepts, without repeats. A nil
+// keep accepts everything.
+func uniqueWhere(elements []object.Object, keep func(object.Object) bool) *object.Array {
+	seen := newValueSet(nil)
+	result := &object.Array{Elements: []object.Object{}}
+	for _, obj := range elements {
+		if (keep == nil || keep(obj)) && seen.add(obj) {
+			result.Elements = append(result.Elements, obj)
+		}
+	}
+	return result
+}
+
+// valueSet holds values with no two equal by be. Values hashValue can
+// hash are bucketed by their hash; arrays, hashes and functions are only
+// equal to themselves, so they are kept by identity.
+type valueSet struct {
+	buckets map[int64][]object.Object
+	others  map[object.Object]bool
+}
+
+func newValueSet(elements []object.Object) *valueSet {
+	s := &valueSet{buckets: make(map[int64][]object.Object), others: make(map[object.Object]bool)}
+	for _, obj := range elements {
+		s.add(obj)
+	}
+	return s
+}
+
+func (s *valueSet) has(obj object.Object) bool {
+	sum, ok := hashValue(obj)
+	if !ok {
+		return s.others[obj]
+	}
+	for _, other := range s.buckets[sum] {
+		if evalInfixExpression("be", obj, other) == TRU {
+			return true
+		}
+	}
+	return false
+}
+
+// add puts obj in the set, reporting false if an equal value was there
+func (s *valueSet) add(obj object.Object) bool {
+	if s.has(obj) {
+		return false
+	}
+	if sum, ok := hashValue(obj); ok {
+		s.buckets[sum] = append(s.buckets[sum], obj)
+	} else {
+		s.others[obj] = true
+	}
+	return true
+}
+
+// hashValue hashes a number, string, boolean or nothing with FNV-1a. The
+// first byte says what kind of value follows, and a float that holds a
+// whole number hashes like that integer, since 2 be 2.0. The top bit is
+// cleared so the hash is never negative.
+func hashValue(obj object.Object) (int64, bool) {
+	var buf [9]byte
+	var data []byte
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		data = hashInt(buf[:], obj.Value)
+	case *object.Float:
+		if f := obj.Value; f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			data = hashInt(buf[:], int64(f))
+		} else {
+			buf[0] = 'f'
+			binary.BigEndian.PutUint64(buf[1:], math.Float64bits(f))
+			data = buf[:]
+		}
+	case *object.String:
+		data = append([]byte{'s'}, obj.Value...)
+	case *object.Boolean:
+		buf[0], buf[1] = 'b', 0
+		if obj.Value {
+			buf[1] = 1
+		}
+		data = buf[:2]
+	case *object.Nothing:
+		data = []byte{'n'}
+	default:
+		return 0, false
+	}
+
+	h := fnv.New64a()
+	h.Write(data)
+	return int64(h.Sum64() &^ (1 << 63)), true
+}
+
+func hashInt(buf []byte, n int64) []byte {
+	buf[0] = 'i'
+	binary.BigEndian.PutUint64(buf[1:], uint64(n))
+	return buf
+}
+
+// copyHash duplicates a hash, passing each value through copyValue
+func copyHash(hash *object.Hash, copyValue func(object.Object) object.Object) *object.Hash {
+	result := &object.Hash{
+		Pairs: make(map[object.HashKey]object.HashPair, len(hash.Pairs)),
+		Order: append([]object.HashKey(nil), hash.Order...),
+	}
+	for key, pair := range hash.Pairs {
+		result.Pairs[key] = object.HashPair{Key: pair.Key, Value: copyValue(pair.Value)}
+	}
+	return result
+}
+
+// deepCopy copies obj and every array and hash inside it. copies maps each
+// collection already copied to its copy, so a collection that turns up twice,
+// even inside itself, is copied once and the copy keeps the same shape.
+func deepCopy(obj object.Object, copies map[object.Object]object.Object) object.Object {
+	if done, ok := copies[obj]; ok {
+		return done
+	}
+
+	switch obj := obj.(type) {
+	case *object.Array:
+		result := &object.Array{Elements: make([]object.Object, len(obj.Elements))}
+		copies[obj] = result
+		for i, el := range obj.Elements {
+			result.Elements[i] = deepCopy(el, copies)
+		}
+		return result
+	case *object.Hash:
+		// Register the copy before filling it in, for hashes holding themselves
+		result := &object.Hash{}
+		copies[obj] = result
+		*result = *copyHash(obj, func(value object.Object) object.Object {
+			return deepCopy(value, copies)
+		})
+		return result
+	default:
+		// Everything else can't change, so it is safe to share
+		return obj
+	}
+}
+
+// writePretty writes obj for pretty_print, JSON-style: strings are quoted,
+// and arrays and hashes put each item on its own line, indented two spaces
+// more than the line they open on
+func writePretty(out *strings.Builder, obj object.Object, depth int) {
+	var opening, closing string
+	var items []func()
+
+	switch obj := obj.(type) {
+	case *object.String:
+		out.WriteString(strconv.Quote(obj.Value))
+		return
+	case *object.Array:
+		opening, closing = "[", "]"
+		for _, el := range obj.Elements {
+			el := el
+			items = append(items, func() { writePretty(out, el, depth+1) })
+		}
+	case *object.Hash:
+		opening, closing = "{", "}"
+		for _, hashKey := range obj.Order {
+			pair := obj.Pairs[hashKey]
+			items = append(items, func() {
+				writePretty(out, pair.Key, depth+1)
+				out.WriteString(": ")
+				writePretty(out, pair.Value, depth+1)
+			})
+		}
+	default:
+		out.WriteString(obj.Inspect())
+		return
+	}
+
+	if len(items) == 0 {
+		out.WriteString(opening + closing)
+		return
+	}
+	if depth == maxPrettyDepth {
+		out.WriteString(opening + "..." + closing)
+		return
+	}
+
+	out.WriteString(opening + "\n")
+	for i, item := range items {
+		out.WriteString(strings.Repeat("  ", depth+1))
+		item()
+		if i < len(items)-1 {
+			out.WriteString(",")
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString(strings.Repeat("  ", depth) + closing)
+}
+
+// Builtins that call back into user functions are registered here, since
+// referencing applyFunction from the builtins literal would be an
+// initialization cycle
+func init() {
+	builtins["curry"] = &object.Builtin{Fn: curry}
+	builtins["compose"] = &object.Builtin{Fn: compose}
+	builtins["find_all"] = &object.Builtin{Fn: findAll}
+	builtins["memoize"] = &object.Builtin{Fn: memoize}
+	builtins["benchmark"] = &object.Builtin{Fn: benchmark}
+}
+
+// RegisterBuiltin makes a Go function callable from Pidgin as name, so a host
+// program can extend the language. A variable of the same name still wins,
+// as it does over every builtin, and registering an existing builtin's name
+// replaces it. The table isn't locked, so register before running programs.
+func RegisterBuiltin(name string, fn object.BuiltinFunction) {
+	builtins[name] = &object.Builtin{Fn: fn}
+}
+
+// pickInteger makes a builtin that gives back whichever of its integer
+// arguments wins against all the others, where better(a, b) says a beats b
+func pickInteger(name string, better func(a, b int64) bool) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if len(args) == 0 {
+			return newError("%s wan make at least one argument, you give am 0", name)
+		}
+		var best *object.Integer
+		for i, arg := range args {
+			n, ok := arg.(*object.Integer)
+			if !ok {
+				return newError("%s wan make INTEGER, but argument %d na %s", name, i+1, arg.Type())
+			}
+			if best == nil || better(n.Value, best.Value) {
+				best = n
+			}
+		}
+		return best
+	}
+}
+
+// curry binds the first arguments of a function, returning a new function
+// that takes the rest
+func curry(args ...object.Object) object.Object {
+	if len(args) < 2 {
+		return newError("curry wan make function and at least one argument, you give am %d", len(args))
+	}
+
+	fn := args[0]
+	if fn.Type() != object.FUNCTION_OBJ && fn.Type() != object.BUILTIN_OBJ {
+		return newError("I no fit curry %s", fn.Type())
+	}
+
+	bound := append([]object.Object{}, args[1:]...)
+	return &object.Builtin{
+		Fn: func(rest ...object.Object) object.Object {
+			all := append(append([]object.Object{}, bound...), rest...)
+			return applyFunction(fn, all)
+		},
+	}
+}
+
+// compose joins two functions into one that calls the second with its
+// argument, then the first with what that gave back. Like the VM's, the
+// composed function takes exactly one argument.
+func compose(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("compose wan make two functions, you give am %d argument", len(args))
+	}
+	for _, fn := range args {
+		if fn.Type() != object.FUNCTION_OBJ && fn.Type() != object.BUILTIN_OBJ {
+			return newError("I no fit compose %s", fn.Type())
+		}
+	}
+
+	f, g := args[0], args[1]
+	return &object.Builtin{
+		Fn: func(callArgs ...object.Object) object.Object {
+			if len(callArgs) != 1 {
+				return newError("function wan make 1 argument, you give am %d", len(callArgs))
+			}
+			inner := applyFunction(g, callArgs)
+			if isError(inner) {
+				return inner
+			}
+			return applyFunction(f, []object.Object{inner})
+		},
+	}
+}
+
+// findAll scans a string a character at a time and gives back, in order,
+// the characters the predicate is truthy for. Given a pattern instead of a
+// predicate, it gives back every match of the pattern.
+func findAll(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("find_all wan make string and function or pattern, you give am %d argument", len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newError("find_all wan make STRING, you give am %s", args[0].Type())
+	}
+
+	if pattern, ok := args[1].(*object.String); ok {
+		re, err := compilePattern(pattern.Value)
+		if err != nil {
+			return err
+		}
+		found := []object.Object{}
+		for _, match := range re.FindAllString(str.Value, -1) {
+			found = append(found, &object.String{Value: match})
+		}
+		return &object.Array{Elements: found}
+	}
+
+	fn := args[1]
+	if fn.Type() != object.FUNCTION_OBJ && fn.Type() != object.BUILTIN_OBJ {
+		return newError("find_all wan make function or pattern, you give am %s", fn.Type())
+	}
+
+	found := []object.Object{}
+	for _, r := range str.Value {
+		ch := &object.String{Value: string(r)}
+		result := applyFunction(fn, []object.Object{ch})
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			found = append(found, ch)
+		}
+	}
+	return &object.Array{Elements: found}
+}
+
+// memoize wraps a function so each distinct set of arguments is only worked
+// out once. Later calls with the same arguments get the remembered result.
+func memoize(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("memoize wan make one argument, you give am %d", len(args))
+	}
+
+	fn := args[0]
+	if fn.Type() != object.FUNCTION_OBJ && fn.Type() != object.BUILTIN_OBJ {
+		return newError("I no fit memoize %s", fn.Type())
+	}
+
+	cache := make(map[string]object.Object)
+	return &object.Builtin{
+		Fn: func(callArgs ...object.Object) object.Object {
+			key := memoKey(callArgs)
+			if result, ok := cache[key]; ok {
+				return result
+			}
+
+			result := applyFunction(fn, callArgs)
+			// Errors aren't remembered, so a later call can try again
+			if !isError(result) {
+				cache[key] = result
+			}
+			return result
+		},
+	}
+}
+
+// benchmark calls a zero-argument function n times and gives back the
+// average time one call took, in milliseconds
+func benchmark(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("benchmark wan make function and count, you give am %d argument", len(args))
+	}
+
+	fn := args[0]
+	if fn.Type() != object.FUNCTION_OBJ && fn.Type() != object.BUILTIN_OBJ {
+		return newError("I no fit benchmark %s", fn.Type())
+	}
+	count, ok := args[1].(*object.Integer)
+	if !ok {
+		return newError("benchmark count must be INTEGER, you give am %s", args[1].Type())
+	}
+	if count.Value < 1 {
+		return newError("benchmark must run at least once, you give am %d", count.Value)
+	}
+
+	start := now()
+	for i := int64(0); i < count.Value; i++ {
+		if result := applyFunction(fn, nil); isError(result) {
+			return result
+		}
+	}
+	elapsed := now().Sub(start)
+
+	millis := float64(elapsed) / float64(time.Millisecond)
+	return &object.Float{Value: millis / float64(count.Value)}
+}
+
+// memoKey renders arguments into a cache key. The type is part of the key
+// so 1 and "1" differ, and functions are keyed by identity since two
+// functions can print the same but close over different variables.
+func memoKey(args []object.Object) string {
+	var key strings.Builder
+	for _, arg := range args {
+		switch arg.Type() {
+		case object.FUNCTION_OBJ, object.BUILTIN_OBJ:
+			fmt.Fprintf(&key, "%s@%p,", arg.Type(), arg)
+		default:
+			fmt.Fprintf(&key, "%s:%q,", arg.Type(), arg.Inspect())
+		}
+	}
+	return key.String()
+}
+
+// =============================================================================
+// Helpers
+// =============================================================================
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRU
+	}
+	return LIE
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NOTHING:
+		return false
+	case TRU:
+		return true
+	case LIE:
+		return false
+	default:
+		return true
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat widens an Integer or Float to float64
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
 	}
 }
 
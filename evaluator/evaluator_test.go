@@ -0,0 +1,2471 @@
+package evaluator
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"pidgin-lang/ast"
+	"pidgin-lang/lexer"
+	"pidgin-lang/object"
+	"pidgin-lang/parser"
+	"pidgin-lang/token"
+)
+
+// ============================================================================
+// Number Tests
+// ============================================================================
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"-5", -5},
+		{"5 + 5 * 2", 15},
+		{"5 / 2", 2}, // integer division truncates
+		{"10 % 3", 1},
+		{"-7 % 3", -1}, // remainder takes the sign of the left side
+		{"2 + 10 % 4 * 3", 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"0.5", 0.5},
+		{"-0.5", -0.5},
+		{"10.0 / 4", 2.5},
+		{"5.0 / 2", 2.5},
+		{"5 / 2.0", 2.5},
+		{"1.5 + 1.5", 3.0},
+		{"2 * 0.5", 1.0},
+		{"1 - 0.25", 0.75},
+		{"7.5 % 2", 1.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testFloatObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestEvalIntegerComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"18 reach 18", true},
+		{"17 reach 18", false},
+		{"5 >= 3", true},
+		{"3 >= 5", false},
+		{"3 <= 3", true},
+		{"5 <= 3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testBooleanObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestEvalFloatComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"3.14 big pass 3", true},
+		{"0.5 no reach 0.25", false},
+		{"2.0 be 2", true},
+		{"2.5 na 2.5", true},
+		{"2.5 reach 2", true},
+		{"2 >= 2.5", false},
+		{"2.5 <= 2.5", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testBooleanObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestEvalStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"apple" no reach "banana"`, true},
+		{`"apple" big pass "banana"`, false},
+		{`"pear" > "peach"`, true},
+		{`"pea" < "peach"`, true},
+		{`"Zebra" < "apple"`, true},
+		{`"abi" reach "abi"`, true},
+		{`"abi" >= "abeg"`, true},
+		{`"" <= "a"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testBooleanObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+
+	// Strings and numbers still don't compare
+	testErrorObject(t, testEval(`"apple" no reach 5`), "I no fit do no reach wit STRING and INTEGER")
+	testErrorObject(t, testEval(`2.5 big pass "a"`), "I no fit do big pass wit FLOAT and STRING")
+}
+
+func TestEvalComparisonChainEvaluatesMiddleOnce(t *testing.T) {
+	// next counts its calls; each result is [chain's value, calls so far]
+	setup := "make calls be 0\ndo next() { calls be calls + 1; bring 5 }\n"
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"make r be 1 < next() < 10; [r, calls]", "[tru, 1]"},
+		{"make r be 1 < next() < 3; [r, calls]", "[lie, 1]"},
+		// The first comparison fails, so the rest of the chain never runs
+		{"make r be 8 < next() < next() + 1; [r, calls]", "[lie, 1]"},
+		{"make r be 1 < next() < next() + 1 < 10; [r, calls]", "[tru, 2]"},
+		{"do f(x) { bring 0 reach x * 2 reach -4 }; [f(1), f(-2), f(-3)]", "[lie, tru, lie]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := testEval(setup + tt.input).Inspect(); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEvalComparisonChainScope(t *testing.T) {
+	// The hidden variable the middle operand went into is gone once the
+	// chain is done
+	env := object.NewEnvironment()
+	program := parser.New(lexer.New("do f() { bring 5 }\n1 < f() < 10")).ParseProgram()
+	testBooleanObject(t, Eval(program, env), true)
+
+	if _, ok := env.Get("chain@2:5"); ok {
+		t.Errorf("expected the chain's hidden variable to be gone")
+	}
+}
+
+func TestEvalFloatDivisionByZero(t *testing.T) {
+	testErrorObject(t, testEval("1.5 / 0"), "Omo! You no fit divide by zero o!")
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	// 2^32 * 2^32 doesn't fit in 48 bits
+	input := "4294967296 * 4294967296"
+
+	testErrorObject(t, testEval(input), "Number too big for Pidgin")
+
+	OverflowToFloat = true
+	defer func() { OverflowToFloat = false }()
+
+	testFloatObject(t, testEval(input), 4294967296.0*4294967296.0)
+	testFloatObject(t, testEval("140737488355327 + 1"), 140737488355328.0)
+	testIntegerObject(t, testEval("140737488355327 - 1"), 140737488355326)
+	// The smallest integer has no 48-bit opposite
+	testFloatObject(t, testEval("-140737488355328 / -1"), 140737488355328.0)
+	testFloatObject(t, testEval("make n be -140737488355328\nmake m be -n\nm"), 140737488355328.0)
+	testFloatObject(t, testEval("-140737488355328 * -1"), 140737488355328.0)
+}
+
+func TestIntegerLiteralRange(t *testing.T) {
+	// Literals past 48 bits are refused, as the VM's compiler refuses them,
+	// whatever the overflow mode
+	OverflowToFloat = true
+	defer func() { OverflowToFloat = false }()
+
+	testIntegerObject(t, testEval("140737488355327"), 140737488355327)
+	testIntegerObject(t, testEval("-140737488355328"), -140737488355328)
+	testErrorObject(t, testEval("140737488355328"), "Number too big for Pidgin: 140737488355328")
+	testErrorObject(t, testEval("0x800000000000"), "Number too big for Pidgin: 140737488355328")
+	testErrorObject(t, testEval("-140737488355329"), "Number too big for Pidgin: -140737488355329")
+}
+
+func TestEvalModuloByZero(t *testing.T) {
+	testErrorObject(t, testEval("10 % 0"), "Omo! You no fit divide by zero o!")
+	testErrorObject(t, testEval("10.5 % 0"), "Omo! You no fit divide by zero o!")
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"3.14", "3.14"},
+		{"10.0 / 4", "2.5"},
+		{"2.0 * 2", "4.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := testEval(tt.input).Inspect(); got != tt.expected {
+				t.Errorf("Inspect() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAddDispatch(t *testing.T) {
+	// Two numbers always add; only a string on either side concatenates
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"5 + 3", int64(8)},
+		{"5 + 3.0", 8.0},
+		{"2.5 + 5", 7.5},
+		{"0.5 + 0.25", 0.75},
+		{"-1 + 0.5", -0.5},
+		{`"a" + 1`, "a1"},
+		{`1 + "a"`, "1a"},
+		{`"a" + 2.5`, "a2.5"},
+		{`3.0 + "a"`, "3.0a"},
+		{`"5" + "3"`, "53"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, evaluated, expected)
+			case float64:
+				testFloatObject(t, evaluated, expected)
+			case string:
+				str, ok := evaluated.(*object.String)
+				if !ok {
+					t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				}
+				if str.Value != expected {
+					t.Errorf("String has wrong value. got=%q, want=%q", str.Value, expected)
+				}
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Logical Operator Tests
+// ============================================================================
+
+// logical builds left <op> right by hand, so each case controls its
+// operands exactly
+func logical(left ast.Expression, operator string, right ast.Expression) *ast.Program {
+	return &ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{
+		Expression: &ast.InfixExpression{Left: left, Operator: operator, Right: right},
+	}}}
+}
+
+func TestLogicalAnd(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"tru and tru", true},
+		{"tru and lie", false},
+		{"lie and tru", false},
+		{"lie and lie", false},
+		// Like the VM, the operand that decided the result comes back
+		{"1 and 2", int64(2)},
+		{"nothing and 2", nil},
+		{"make x be 5\n1 no reach x and x no reach 10", true},
+		{"make x be 15\n1 no reach x and x no reach 10", false},
+		{"1 no reach 5 no reach 10", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case bool:
+				testBooleanObject(t, evaluated, expected)
+			case int64:
+				testIntegerObject(t, evaluated, expected)
+			default:
+				if evaluated != NOTHING {
+					t.Errorf("expected nothing, got %s", evaluated.Inspect())
+				}
+			}
+		})
+	}
+}
+
+func TestLogicalOr(t *testing.T) {
+	tru := &ast.Boolean{Token: token.Token{Type: token.TRU, Literal: "tru"}, Value: true}
+	lie := &ast.Boolean{Token: token.Token{Type: token.LIE, Literal: "lie"}, Value: false}
+
+	tests := []struct {
+		left, right ast.Expression
+		expected    bool
+	}{
+		{tru, tru, true},
+		{tru, lie, true},
+		{lie, tru, true},
+		{lie, lie, false},
+	}
+
+	for _, operator := range []string{"abi", "or"} {
+		for _, tt := range tests {
+			evaluated := Eval(logical(tt.left, operator, tt.right), object.NewEnvironment())
+			if !testBooleanObject(t, evaluated, tt.expected) {
+				t.Errorf("%s %s %s", tt.left, operator, tt.right)
+			}
+		}
+	}
+
+	// The deciding operand comes back, not a fresh boolean
+	evaluated := Eval(logical(&ast.NothingLiteral{}, "abi", &ast.IntegerLiteral{Value: 7}), object.NewEnvironment())
+	testIntegerObject(t, evaluated, 7)
+}
+
+func TestLogicalOperatorsFromSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"tru abi lie", true},
+		{"lie or lie", false},
+		{"nothing abi 7", 7},
+		{"lie and tru abi 9", 9},
+		{"make x be 0\nsuppose x na 1 abi x na 0 { 1 } abi { 2 }", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case bool:
+				testBooleanObject(t, evaluated, expected)
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			}
+		})
+	}
+}
+
+func TestLogicalShortCircuit(t *testing.T) {
+	tru := &ast.Boolean{Token: token.Token{Type: token.TRU, Literal: "tru"}, Value: true}
+	lie := &ast.Boolean{Token: token.Token{Type: token.LIE, Literal: "lie"}, Value: false}
+	tick := &ast.CallExpression{Function: &ast.Identifier{Value: "tick"}}
+
+	tests := []struct {
+		program       *ast.Program
+		expectedCalls int
+	}{
+		{parser.New(lexer.New("lie and tick()")).ParseProgram(), 0},
+		{parser.New(lexer.New("nothing and tick()")).ParseProgram(), 0},
+		{parser.New(lexer.New("tru and tick()")).ParseProgram(), 1},
+		{parser.New(lexer.New("tick() and tick()")).ParseProgram(), 2},
+		{logical(tru, "abi", tick), 0},
+		{logical(lie, "abi", tick), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.program.String(), func(t *testing.T) {
+			calls := 0
+			env := object.NewEnvironment()
+			env.Set("tick", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+				calls++
+				return TRU
+			}})
+
+			if result := Eval(tt.program, env); isError(result) {
+				t.Fatalf("unexpected error: %s", result.Inspect())
+			}
+			if calls != tt.expectedCalls {
+				t.Errorf("right side ran %d times, want %d", calls, tt.expectedCalls)
+			}
+		})
+	}
+
+	// Errors on the left stop before the right side too
+	testErrorObject(t, testEval("(1 / 0) and yarn(1)"), "Omo! You no fit divide by zero o!")
+}
+
+// shortCircuitSetup counts the calls to check, which brings back its argument
+const shortCircuitSetup = `
+make calls be 0
+make hit be 0
+do check(result) {
+	calls be calls + 1
+	bring result
+}
+`
+
+func TestShortCircuitConditions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64 // calls to check * 10 + what the program counted
+	}{
+		// suppose: a false left comparison skips the right one
+		{"make a be 5; make b be 3; make c be 9;\nsuppose a no reach b and check(b no reach c) { hit be 1 };\ncalls * 10 + hit", 0},
+		{"make a be 1; make b be 3; make c be 9;\nsuppose a no reach b and check(b no reach c) { hit be 1 };\ncalls * 10 + hit", 11},
+		{"make a be 1; make b be 3; make c be 2;\nsuppose a no reach b and check(b no reach c) { hit be 1 };\ncalls * 10 + hit", 10},
+		{"make a be 1; make b be 3;\nsuppose a no reach b abi check(b no reach 0) { hit be 1 };\ncalls * 10 + hit", 1},
+		{"make a be 5; make b be 3;\nsuppose a no reach b abi check(b no reach 0) { hit be 1 } abi { hit be 2 };\ncalls * 10 + hit", 12},
+		{"make a be 5; make b be 3;\nsuppose (a no reach b and check(tru)) abi check(a big pass b) { hit be 1 };\ncalls * 10 + hit", 11},
+		// Loops test the condition each round, skipping the right side once
+		// the left one fails
+		{"make i be 0;\ndey do while i no reach 3 and check(i no reach 10) { i be i + 1 };\ncalls * 10 + i", 33},
+		{"make i be 0;\ndey do while i no reach 10 and check(i no reach 3) { i be i + 1 };\ncalls * 10 + i", 43},
+		{"make i be 0;\ndey do while i big pass 5 abi check(i no reach 2) { i be i + 1 };\ncalls * 10 + i", 32},
+		{"count i from 1 reach 5 {\nsuppose i % 2 be 0 and check(i big pass 2) { hit be hit + 1 }\n};\ncalls * 10 + hit", 21},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(shortCircuitSetup+tt.input), tt.expected)
+		})
+	}
+}
+
+// ============================================================================
+// Variable Tests
+// ============================================================================
+
+func TestAssignStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"make x be 1\nx be 2\nx", 2},
+		{"make x be 1\nx be x + 41", 42},
+		{"make counter be 0\ndey do while counter no reach 5 { counter be counter + 1 }\ncounter", 5},
+		// A function can change a variable made outside it
+		{"make calls be 0\ndo tick() { calls be calls + 1 }\ntick()\ntick()\ncalls", 2},
+		// make inside a function makes a new local; assignment changes the outer one
+		{"make x be 1\ndo f() { make x be 5 }\nf()\nx", 1},
+		{"make x be 1\ndo f() { x be 5 }\nf()\nx", 5},
+		{"make total be 0\ncount i from 1 reach 10 { total be total + i }\ntotal", 55},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestShadowBuiltin(t *testing.T) {
+	// The environment is checked before the builtins, so a program's own
+	// definition of a builtin name wins
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"make len be 3\nlen", 3},
+		{"make len be 3\nlen be len + 1\nlen", 4},
+		{"do len(x) { bring 99 }\nlen(\"ab\")", 99},
+		{"do f() { make len be 2\nbring len }\nf() + len(\"abc\")", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+
+	testErrorObject(t, testEval("make len be 3\nlen(\"abcd\")"), "Dis one no be function: INTEGER")
+}
+
+func TestAssignUndeclared(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x be 5", "You never make x, so you no fit change am"},
+		{"do f() { make y be 1 }\nf()\ny be 2", "You never make y, so you no fit change am"},
+		{"len be 5", "You never make len, so you no fit change am"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+// ============================================================================
+// Array Tests
+// ============================================================================
+
+func TestArrayLiterals(t *testing.T) {
+	evaluated := testEval("[1, 2 * 2, 3 + 3]")
+
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong number of elements. got=%d", len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+
+	if got := evaluated.Inspect(); got != "[1, 4, 6]" {
+		t.Errorf("Inspect() = %q, want %q", got, "[1, 4, 6]")
+	}
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", int64(1)},
+		{"[1, 2, 3][1]", int64(2)},
+		{"[1, 2, 3][2]", int64(3)},
+		{"make i be 0\n[1][i]", int64(1)},
+		{"[1, 2, 3][1 + 1]", int64(3)},
+		{"make myArray be [1, 2, 3]\nmyArray[2]", int64(3)},
+		{"make myArray be [1, 2, 3]\nmyArray[0] + myArray[1] + myArray[2]", int64(6)},
+		{"[1, 2, 3][-1]", int64(3)},
+		{"[1, 2, 3][-3]", int64(1)},
+		{"[[1, 2], [3, 4]][1][0]", int64(3)},
+		{"[1, 2, 3][3]", "Index 3 no dey inside array wey get 3 items"},
+		{"[1, 2, 3][-4]", "Index -4 no dey inside array wey get 3 items"},
+		{"[][0]", "Index 0 no dey inside array wey get 0 items"},
+		{`[1, 2]["one"]`, "Array index must be INTEGER, you give am STRING"},
+		{"5[0]", "I no fit index INTEGER"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, evaluated, expected)
+			case string:
+				testErrorObject(t, evaluated, expected)
+			}
+		})
+	}
+}
+
+func TestLenOfArray(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"len([])", 0},
+		{"len([1, 2, 3])", 3},
+		{`len(["a", "b"])`, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+// ============================================================================
+// Hash Tests
+// ============================================================================
+
+func TestHashLiterals(t *testing.T) {
+	input := `make two be "two"
+{
+	"one": 10 - 9,
+	two: 1 + 1,
+	"thr" + "ee": 6 / 2,
+	4: 4,
+	tru: 5,
+	lie: 6
+}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRU.HashKey():                              5,
+		LIE.HashKey():                              6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+			continue
+		}
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+
+	want := "{one: 1, two: 2, three: 3, 4: 4, tru: 5, lie: 6}"
+	if got := result.Inspect(); got != want {
+		t.Errorf("Inspect() = %q, want %q", got, want)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, int64(5)},
+		{`{"foo": 5}["bar"]`, nil},
+		{`make key be "foo"
+{"foo": 5}[key]`, int64(5)},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, int64(5)},
+		{`{tru: 5}[tru]`, int64(5)},
+		{`{lie: 5}[lie]`, int64(5)},
+		{`{1: 5}["1"]`, nil}, // 1 and "1" are different keys
+		{`{"a": 1, "a": 2}["a"]`, int64(2)},
+		{`{"a": 1}[[1]]`, "I no fit use ARRAY as hash key"},
+		{`{[1]: 1}`, "I no fit use ARRAY as hash key"},
+		{`{"a": 1}[1.5]`, "I no fit use FLOAT as hash key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, evaluated, expected)
+			case string:
+				testErrorObject(t, evaluated, expected)
+			case nil:
+				if evaluated != NOTHING {
+					t.Errorf("expected nothing, got=%T (%+v)", evaluated, evaluated)
+				}
+			}
+		})
+	}
+}
+
+func TestLenOfHash(t *testing.T) {
+	testIntegerObject(t, testEval(`len({"a": 1, "b": 2})`), 2)
+	testIntegerObject(t, testEval(`len({})`), 0)
+}
+
+// ============================================================================
+// Builtin Tests
+// ============================================================================
+
+func TestBuiltinAsValue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"make f be len\nf(\"abc\")", int64(3)},
+		{"make check be type\ncheck(5)", "INTEGER"},
+		{"do apply(fn, x) { bring fn(x) }\napply(len, \"wetin\")", int64(5)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, evaluated, expected)
+			case string:
+				str, ok := evaluated.(*object.String)
+				if !ok {
+					t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				}
+				if str.Value != expected {
+					t.Errorf("String has wrong value. got=%q, want=%q", str.Value, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestCurry(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"do add(a, b) { bring a + b }\nmake addFive be curry(add, 5)\naddFive(10)", 15},
+		{"do sub(a, b) { bring a - b }\nmake tenMinus be curry(sub, 10)\ntenMinus(3)", 7},
+		{"do add3(a, b, c) { bring a + b + c }\ncurry(add3, 1, 2)(3)", 6},
+		{"do add3(a, b, c) { bring a + b + c }\ncurry(curry(add3, 1), 2)(3)", 6},
+		{"curry(len, \"wetin\")()", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestCurryErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"curry(5, 1)", "I no fit curry INTEGER"},
+		{"do f(a) { bring a }\ncurry(f)", "curry wan make function and at least one argument, you give am 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestCompose(t *testing.T) {
+	const setup = "do inc(x) { bring x + 1 }\ndo double(x) { bring x * 2 }\n"
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"compose(inc, double)(5)", 11},
+		{"compose(double, inc)(5)", 12},
+		{"compose(compose(inc, inc), double)(10)", 22},
+		{`compose(len, upper)("wetin")`, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(setup+tt.input), tt.expected)
+		})
+	}
+
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{"compose(1, inc)", "I no fit compose INTEGER"},
+		{"compose(inc)", "compose wan make two functions, you give am 1 argument"},
+		{"compose(inc, len)(5)", "I no fit check length of INTEGER"},
+		{"compose(inc, inc)(1, 2)", "function wan make 1 argument, you give am 2"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(setup+tt.input), tt.expected)
+		})
+	}
+}
+
+func TestIsError(t *testing.T) {
+	// Errors stop the interpreter before is_error sees them
+	testBooleanObject(t, testEval("is_error(5)"), false)
+	testBooleanObject(t, testEval(`is_error("Omo!")`), false)
+	testErrorObject(t, testEval("is_error(1 / 0)"), "Omo! You no fit divide by zero o!")
+	testErrorObject(t, testEval("is_error()"), "is_error wan make one argument, you give am 0")
+}
+
+func TestTryRescue(t *testing.T) {
+	const setup = "do risky(x) { bring 10 / x }\n"
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { 10 / 0 } rescue err { err }", "Omo! You no fit divide by zero o!"},
+		{"try { ghost } rescue err { err }", "I no sabi dis one: ghost"},
+		{"try { risky(0) } rescue err { err }", "Omo! You no fit divide by zero o!"},
+		{`try { risky(5) } rescue err { "no wahala" }`, "2"},
+		{`do safe(x) { try { bring risky(x) } rescue err { bring "failed" } }
+safe(0)`, "failed"},
+		{`try { try { 1 / 0 } rescue a { "inner" } } rescue b { "outer" }`, "inner"},
+		{`try { try { 1 / 0 } rescue a { ghost } } rescue b { b }`, "I no sabi dis one: ghost"},
+		// The rescue name only lives in the rescue block
+		{`make err be "before"
+try { 1 / 0 } rescue err { err }
+err`, "before"},
+		{`count i from 1 reach 5 { try { suppose i na 3 { comot } } rescue err { } }
+try { 1 / 0 } rescue err { "still caught" }`, "still caught"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEval(setup + tt.input)
+			if result == nil || result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// Errors outside any try block, or from a rescue block, still stop the program
+	testErrorObject(t, testEval(setup+"risky(0)"), "Omo! You no fit divide by zero o!")
+	testErrorObject(t, testEval(setup+"try { 1 } rescue err { 2 }\nrisky(0)"), "Omo! You no fit divide by zero o!")
+	testErrorObject(t, testEval(setup+"try { risky(0) } rescue err { ghost }"), "I no sabi dis one: ghost")
+}
+
+func TestFlip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"flip(5)", false},
+		{"flip(0)", false},
+		{"flip(2.5)", false},
+		{`flip("wetin")`, false},
+		{`flip("")`, false},
+		{"flip(nothing)", true},
+		{"flip(tru)", false},
+		{"flip(lie)", true},
+		{"flip(len)", false},
+		{"flip([])", false},
+		{"do apply(fn, x) { bring fn(x) }\napply(flip, lie)", true},
+		{"curry(flip, nothing)()", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testBooleanObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+
+	testErrorObject(t, testEval("flip(1, 2)"), "flip wan make one argument, you give am 2")
+}
+
+func TestCoalesce(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"coalesce(nothing, 2, 3)", 2},
+		{"coalesce(1, nothing)", 1},
+		{"coalesce(nothing, lie, 3)", false},
+		{`coalesce(nothing, nothing, "last")`, "last"},
+		{"coalesce(nothing, nothing)", nil},
+		{"coalesce()", nil},
+		{"coalesce(7)", 7},
+		{"coalesce(nothing)", nil},
+		{"make seen be 0\ndo note(x) { seen be seen + 1\nbring x }\ncoalesce(note(1), note(2))\nseen", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, evaluated, int64(expected))
+			case bool:
+				testBooleanObject(t, evaluated, expected)
+			case string:
+				str, ok := evaluated.(*object.String)
+				if !ok || str.Value != expected {
+					t.Errorf("expected %q, got %s", expected, evaluated.Inspect())
+				}
+			default:
+				if evaluated != NOTHING {
+					t.Errorf("expected nothing, got %s", evaluated.Inspect())
+				}
+			}
+		})
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`upper("how far")`, "HOW FAR"},
+		{`upper("Lagôs")`, "LAGÔS"},
+		{`lower("NA WA O")`, "na wa o"},
+		{`lower("LAGÔS")`, "lagôs"},
+		{`reverse("abc")`, "cba"},
+		{`reverse("Lagôs")`, "sôgaL"},
+		{`reverse("")`, ""},
+		{`reverse("a")`, "a"},
+		{`upper(reverse("oga"))`, "AGO"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Fatalf("expected STRING, got %s (%s)", evaluated.Type(), evaluated.Inspect())
+			}
+			if str.Value != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, str.Value)
+			}
+		})
+	}
+
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{"upper(5)", "upper wan make STRING, you give am INTEGER"},
+		{"lower([])", "lower wan make STRING, you give am ARRAY"},
+		{`reverse("a", "b")`, "reverse wan make one argument, you give am 2"},
+		{"reverse()", "reverse wan make one argument, you give am 0"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestTrimAffix(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Present
+		{`trim_prefix("foobar", "foo")`, "bar"},
+		{`trim_suffix("foobar", "bar")`, "foo"},
+		{`trim_prefix("foofoo", "foo")`, "foo"},
+		{`trim_prefix("Lagôs", "La")`, "gôs"},
+		{`trim_suffix("foobar", "foobar")`, ""},
+		// Absent, or only at the other end
+		{`trim_prefix("foobar", "bar")`, "foobar"},
+		{`trim_suffix("foobar", "foo")`, "foobar"},
+		{`trim_prefix("foo", "foobar")`, "foo"},
+		// Empty
+		{`trim_prefix("foobar", "")`, "foobar"},
+		{`trim_suffix("foobar", "")`, "foobar"},
+		{`trim_prefix("", "foo")`, ""},
+		{`trim_suffix("", "")`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Fatalf("expected STRING, got %s (%s)", evaluated.Type(), evaluated.Inspect())
+			}
+			if str.Value != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, str.Value)
+			}
+		})
+	}
+
+	testErrorObject(t, testEval(`trim_prefix("foo")`), "trim_prefix wan make 2 argument, you give am 1")
+	testErrorObject(t, testEval(`trim_suffix("foo", 1)`), "trim_suffix wan make STRING, you give am INTEGER")
+}
+
+// withInput makes the input builtin read from source and returns where
+// its prompts go, putting stdin and stdout back when the test ends
+func withInput(t *testing.T, source string) *bytes.Buffer {
+	t.Helper()
+	savedIn, savedOut := stdin, stdout
+	t.Cleanup(func() { stdin, stdout = savedIn, savedOut })
+
+	var prompts bytes.Buffer
+	SetInput(strings.NewReader(source))
+	SetOutput(&prompts)
+	return &prompts
+}
+
+func TestInput(t *testing.T) {
+	prompts := withInput(t, "Ada\nLagôs\r\n\nlast")
+
+	expected := []string{"Ada", "Lagôs", "", "last"}
+	for _, want := range expected {
+		evaluated := testEval(`input("Name? ")`)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("expected STRING, got %s (%s)", evaluated.Type(), evaluated.Inspect())
+		}
+		if str.Value != want {
+			t.Errorf("expected %q, got %q", want, str.Value)
+		}
+	}
+
+	// Once the input runs out, input gives nothing
+	if evaluated := testEval("input()"); evaluated != NOTHING {
+		t.Errorf("expected nothing at the end of input, got %s", evaluated.Inspect())
+	}
+
+	if got := prompts.String(); got != strings.Repeat("Name? ", len(expected)) {
+		t.Errorf("expected a prompt per read, got %q", got)
+	}
+}
+
+func TestInputWithoutPrompt(t *testing.T) {
+	prompts := withInput(t, "5\n")
+
+	testBooleanObject(t, testEval(`input() be "5"`), true)
+	if prompts.Len() != 0 {
+		t.Errorf("expected no prompt, got %q", prompts.String())
+	}
+}
+
+func TestInputErrors(t *testing.T) {
+	withInput(t, "")
+	testErrorObject(t, testEval(`input("a", "b")`), "input wan make prompt or nothing, you give am 2 argument")
+
+	stdin = bufio.NewReader(failingReader{})
+	testErrorObject(t, testEval("input()"), "I no fit read input: disk don spoil")
+}
+
+// failingReader fails every read
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("disk don spoil")
+}
+
+func TestSetOutput(t *testing.T) {
+	out := withInput(t, "Ada\n")
+
+	// Everything that prints goes to the same place, in the order it ran
+	testEval(`yarn("first", 2)
+pretty_print([3])
+input("name? ")`)
+
+	expected := "first\n2\n[\n  3\n]\nname? "
+	if out.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, out.String())
+	}
+}
+
+func TestPrettyPrint(t *testing.T) {
+	saved := stdout
+	t.Cleanup(func() { stdout = saved })
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"name": "Ada", "scores": [90, 85], "tags": [], "meta": {}, "ok": tru}`, `{
+  "name": "Ada",
+  "scores": [
+    90,
+    85
+  ],
+  "tags": [],
+  "meta": {},
+  "ok": tru
+}`},
+		{`[[1, [2]], {1: nothing}]`, `[
+  [
+    1,
+    [
+      2
+    ]
+  ],
+  {
+    1: nothing
+  }
+]`},
+		{`"wetin"`, `"wetin"`},
+		{`2.5`, `2.5`},
+		{`[]`, `[]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var out bytes.Buffer
+			SetOutput(&out)
+
+			result := testEval("pretty_print(" + tt.input + ")")
+			if result != NOTHING {
+				t.Fatalf("expected nothing, got %s", result.Inspect())
+			}
+			if out.String() != tt.expected+"\n" {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, out.String())
+			}
+		})
+	}
+
+	testErrorObject(t, testEval("pretty_print(1, 2)"), "pretty_print wan make one argument, you give am 2")
+}
+
+func TestPrettyPrintStopsAtMaxDepth(t *testing.T) {
+	saved := stdout
+	t.Cleanup(func() { stdout = saved })
+
+	var out bytes.Buffer
+	SetOutput(&out)
+
+	// An array that holds itself would go on forever
+	loop := &object.Array{}
+	loop.Elements = []object.Object{loop}
+	builtins["pretty_print"].Fn(loop)
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	deepest := strings.Repeat("  ", maxPrettyDepth) + "[...]"
+	if len(lines) != 2*maxPrettyDepth+1 || lines[maxPrettyDepth] != deepest {
+		t.Errorf("expected %d lines with %q in the middle, got:\n%s", 2*maxPrettyDepth+1, deepest, out.String())
+	}
+}
+
+func TestRepeatString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`repeat_string("-", 10)`, "----------"},
+		{`repeat_string("ab", 3)`, "ababab"},
+		{`repeat_string("ô", 2)`, "ôô"},
+		{`repeat_string("ab", 1)`, "ab"},
+		{`repeat_string("ab", 0)`, ""},
+		{`repeat_string("", 5)`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Fatalf("expected STRING, got %s (%s)", evaluated.Type(), evaluated.Inspect())
+			}
+			if str.Value != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, str.Value)
+			}
+		})
+	}
+
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{`repeat_string("ab", -1)`, "repeat_string no fit repeat -1 times"},
+		{`repeat_string("ab")`, "repeat_string wan make 2 argument, you give am 1"},
+		{`repeat_string(5, 2)`, "repeat_string wan make STRING, you give am INTEGER"},
+		{`repeat_string("ab", 2.5)`, "repeat_string wan make INTEGER count, you give am FLOAT"},
+		{`repeat_string("ab", 1000000000000)`, "repeat_string go make string wey too long"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestToNumber(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`to_number("42")`, 42},
+		{`to_number(" -7 ")`, -7},
+		{`to_number("+3")`, 3},
+		{`to_number("0")`, 0},
+		{`to_number("140737488355327")`, 140737488355327},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{`to_number("abc")`, `to_number no fit turn "abc" to number`},
+		{`to_number("4.5")`, `to_number no fit turn "4.5" to number`},
+		{`to_number("")`, `to_number no fit turn "" to number`},
+		{`to_number(42)`, "to_number wan make STRING, you give am INTEGER"},
+		{`to_number()`, "to_number wan make one argument, you give am 0"},
+		{`to_number("140737488355328")`, "Number too big for Pidgin"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestToText(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`to_text(tru)`, "tru"},
+		{`to_text(lie)`, "lie"},
+		{`to_text(42)`, "42"},
+		{`to_text(-2.5)`, "-2.5"},
+		{`to_text("wetin")`, "wetin"},
+		{`to_text(nothing)`, "nothing"},
+		{`to_text([1, "a"])`, "[1, a]"},
+		{`to_text(to_number("42"))`, "42"},
+		{`to_number(to_text(42))`, "42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, evaluated.Inspect())
+			}
+		})
+	}
+
+	testErrorObject(t, testEval(`to_text(1, 2)`), "to_text wan make one argument, you give am 2")
+}
+
+func TestAbsMinMax(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"abs(5)", 5},
+		{"abs(-5)", 5},
+		{"abs(0)", 0},
+		{"abs(-140737488355327)", 140737488355327},
+		{"min(3, 1, 2)", 1},
+		{"min(-4, 7)", -4},
+		{"min(9)", 9},
+		{"max(3, 1, 2)", 3},
+		{"max(-4, -7)", -4},
+		{"max(9)", 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{"abs(2.5)", "abs wan make INTEGER, you give am FLOAT"},
+		{"abs()", "abs wan make one argument, you give am 0"},
+		{"min()", "min wan make at least one argument, you give am 0"},
+		{"max()", "max wan make at least one argument, you give am 0"},
+		{`min(1, "2")`, "min wan make INTEGER, but argument 2 na STRING"},
+		{"max(1.5, 2)", "max wan make INTEGER, but argument 1 na FLOAT"},
+		// The smallest integer has no positive twin, so abs overflows like '-' does
+		{"abs(-140737488355328)", "Number too big for Pidgin"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []int64
+	}{
+		{"range(3)", []int64{0, 1, 2}},
+		{"range(2, 5)", []int64{2, 3, 4}},
+		{"range(-2, 1)", []int64{-2, -1, 0}},
+		{"range(1)", []int64{0}},
+		{"range(0)", []int64{}},
+		{"range(-3)", []int64{}},
+		{"range(5, 2)", []int64{}},
+		{"range(4, 4)", []int64{}},
+		{"range(-140737488355328, -140737488355326)", []int64{-140737488355328, -140737488355327}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Fatalf("expected ARRAY, got %s (%s)", evaluated.Type(), evaluated.Inspect())
+			}
+			if len(array.Elements) != len(tt.expected) {
+				t.Fatalf("expected %d elements, got %d (%s)", len(tt.expected), len(array.Elements), array.Inspect())
+			}
+			for i, expected := range tt.expected {
+				testIntegerObject(t, array.Elements[i], expected)
+			}
+		})
+	}
+
+	// The numbers are real array items, so they can be indexed and counted
+	testIntegerObject(t, testEval("make r be range(10, 20)\nr[3] + len(r)"), 23)
+
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{"range()", "range wan make stop or start and stop, you give am 0 argument"},
+		{"range(1, 2, 3)", "range wan make stop or start and stop, you give am 3 argument"},
+		{`range("3")`, "range wan make INTEGER, but argument 1 na STRING"},
+		{"range(0, 2.5)", "range wan make INTEGER, but argument 2 na FLOAT"},
+		{"range(1000000000000)", "range go make array wey too long"},
+		{"range(-140737488355328, 140737488355327)", "range go make array wey too long"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestCharacterTests(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`is_digit("7")`, true},
+		{`is_digit("42")`, true},
+		{`is_digit("4a")`, false},
+		{`is_digit("")`, false},
+		{`is_letter("a")`, true},
+		{`is_letter("Wetin")`, true},
+		{`is_letter("é")`, true},
+		{`is_letter("1")`, false},
+		{`is_space(" ")`, true},
+		{`is_space("  ")`, true},
+		{`is_space("a ")`, false},
+		{`is_space("")`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testBooleanObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+
+	testErrorObject(t, testEval("is_digit(7)"), "is_digit wan make STRING, you give am INTEGER")
+	testErrorObject(t, testEval("is_space()"), "is_space wan make one argument, you give am 0")
+}
+
+func TestFindAll(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`find_all("a1b2c3", do(ch) { bring is_digit(ch) })`, []string{"1", "2", "3"}},
+		{`find_all("a1b2c3", is_letter)`, []string{"a", "b", "c"}},
+		{`find_all("How far", is_space)`, []string{" "}},
+		{`find_all("abc", is_digit)`, []string{}},
+		{`find_all("", is_digit)`, []string{}},
+		// Characters, not bytes
+		{`find_all("né1", is_letter)`, []string{"n", "é"}},
+		// Any truthy result counts
+		{`find_all("xyz", do(ch) { suppose ch na "y" { bring 1 } })`, []string{"y"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, ok := testEval(tt.input).(*object.Array)
+			if !ok {
+				t.Fatalf("expected ARRAY, got %s", testEval(tt.input).Inspect())
+			}
+			if len(result.Elements) != len(tt.expected) {
+				t.Fatalf("expected %d characters, got %s", len(tt.expected), result.Inspect())
+			}
+			for i, want := range tt.expected {
+				str, ok := result.Elements[i].(*object.String)
+				if !ok || str.Value != want {
+					t.Errorf("element %d: expected %q, got %s", i, want, result.Elements[i].Inspect())
+				}
+			}
+		})
+	}
+
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{`find_all(123, is_digit)`, "find_all wan make STRING, you give am INTEGER"},
+		{`find_all("abc", 5)`, "find_all wan make function or pattern, you give am INTEGER"},
+		{`find_all("abc")`, "find_all wan make string and function or pattern, you give am 1 argument"},
+		{`find_all("abc", do(ch) { bring ch / 2 })`, "I no fit do / wit STRING and INTEGER"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestRegexBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`matches("hello123", "[0-9]+")`, "tru"},
+		{`matches("hello", "^[0-9]+$")`, "lie"},
+		{`find("call 0803-555-1234 now", "[0-9]{4}-[0-9]{3}-[0-9]{4}")`, "0803-555-1234"},
+		{`find("abc", "[0-9]")`, "nothing"},
+		// An empty match is still a match
+		{`len(find("abc", "x*"))`, "0"},
+		{`find_all("a1 b22 c333", "[0-9]+")`, "[1, 22, 333]"},
+		{`find_all("How far", "[a-z]+")`, "[ow, far]"},
+		{`len(find_all("abc", "[0-9]"))`, "0"},
+		// The same pattern again comes from the cache
+		{`count i from 1 reach 3 { matches("a" + i, "^a[0-9]$") }
+find_all("a1", "[0-9]")`, "[1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEval(tt.input)
+			if result == nil || result.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{`matches("a", "(ab")`, "Dis pattern no correct: error parsing regexp: missing closing ): `(ab`"},
+		{`find("a", "[z-a]")`, "Dis pattern no correct: error parsing regexp: invalid character class range: `z-a`"},
+		{`find_all("a", "*")`, "Dis pattern no correct: error parsing regexp: missing argument to repetition operator: `*`"},
+		{`matches(5, "[0-9]")`, "matches wan make STRING, you give am INTEGER"},
+		{`find("abc")`, "find wan make 2 argument, you give am 1"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestStringBuilder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"build(make_builder())", ""},
+		{`make b be make_builder(); append(b, "How "); append(b, "far"); build(b)`, "How far"},
+		// append gives the builder back, so calls can be chained
+		{`build(append(append(make_builder(), "a"), "b"))`, "ab"},
+		// Other values go in the way '+' joins them to a string
+		{`build(append(append(append(make_builder(), 1), 2.5), tru))`, "12.5tru"},
+		{`make b be make_builder(); append(b, "abc"); len(b)`, "3"},
+		{"type(make_builder())", "BUILDER"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEval(tt.input)
+			if result == nil || result.Inspect() != tt.expected {
+				t.Errorf("expected %q, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// A large string built both ways comes out the same
+	built := testEval(`make b be make_builder()
+count i from 1 reach 5000 { append(b, i); append(b, " ") }
+build(b)`)
+	joined := testEval(`make s be ""
+count i from 1 reach 5000 { s be s + i + " " }
+s`)
+	str, ok := built.(*object.String)
+	if !ok {
+		t.Fatalf("expected STRING, got %v", built)
+	}
+	if str.Value != joined.Inspect() {
+		t.Errorf("builder and concatenation gave different strings")
+	}
+	if !strings.HasPrefix(str.Value, "1 2 3 ") || !strings.HasSuffix(str.Value, " 4999 5000 ") {
+		t.Errorf("unexpected ends of built string: %.20q ... %q", str.Value, str.Value[len(str.Value)-20:])
+	}
+
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{`make_builder("a")`, "make_builder no dey take argument, you give am 1"},
+		{`append("a", "b")`, "append wan make BUILDER, you give am STRING"},
+		{`append(make_builder())`, "append wan make builder and value, you give am 1 argument"},
+		{`build("a")`, "build wan make BUILDER, you give am STRING"},
+		{`build()`, "build wan make one argument, you give am 0"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestTakeAndDrop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"take([1, 2, 3, 4], 2)", "[1, 2]"},
+		{"drop([1, 2, 3, 4], 2)", "[3, 4]"},
+		{"take([1, 2, 3, 4], 4)", "[1, 2, 3, 4]"},
+		{"drop([1, 2, 3, 4], 4)", "[]"},
+		{"take([1, 2, 3, 4], 10)", "[1, 2, 3, 4]"},
+		{"drop([1, 2, 3, 4], 10)", "[]"},
+		{"take([1, 2, 3, 4], 0)", "[]"},
+		{"drop([1, 2, 3, 4], 0)", "[1, 2, 3, 4]"},
+		{"take([], 3)", "[]"},
+		{"drop([], 0)", "[]"},
+		{`take(["a", [1], tru], 2)`, "[a, [1]]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			if _, ok := evaluated.(*object.Array); !ok {
+				t.Fatalf("expected ARRAY, got %s (%s)", evaluated.Type(), evaluated.Inspect())
+			}
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, evaluated.Inspect())
+			}
+		})
+	}
+
+	// The pieces are new arrays, so the original stays as it was
+	testIntegerObject(t, testEval("make a be [1, 2, 3];\nmake b be take(a, 2);\nb[0] be 9;\na[0]"), 1)
+	testIntegerObject(t, testEval("make a be [1, 2, 3];\nmake b be drop(a, 1);\nb[0] be 9;\na[1]"), 2)
+
+	failures := []struct {
+		input    string
+		expected string
+	}{
+		{"take([1, 2], -1)", "take no fit take -1 items"},
+		{"drop([1, 2], -3)", "drop no fit drop -3 items"},
+		{"take([1, 2])", "take wan make 2 argument, you give am 1"},
+		{`drop("abc", 1)`, "drop wan make ARRAY, you give am STRING"},
+		{"take([1, 2], 1.5)", "take wan make INTEGER count, you give am FLOAT"},
+	}
+
+	for _, tt := range failures {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`split("a,b,c", ",")`, []string{"a", "b", "c"}},
+		{`split("a, b", ", ")`, []string{"a", "b"}},
+		{`split("abc", ",")`, []string{"abc"}},
+		{`split("a,,b,", ",")`, []string{"a", "", "b", ""}},
+		{`split("", ",")`, []string{""}},
+		{`split("abc", "")`, []string{"a", "b", "c"}},
+		{`split("Lagôs", "")`, []string{"L", "a", "g", "ô", "s"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Fatalf("expected ARRAY, got %s (%s)", evaluated.Type(), evaluated.Inspect())
+			}
+			if len(array.Elements) != len(tt.expected) {
+				t.Fatalf("expected %d parts, got %s", len(tt.expected), array.Inspect())
+			}
+			for i, want := range tt.expected {
+				if str, ok := array.Elements[i].(*object.String); !ok || str.Value != want {
+					t.Errorf("part %d: expected %q, got %s", i, want, array.Elements[i].Inspect())
+				}
+			}
+		})
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`join(["a", "b", "c"], ",")`, "a,b,c"},
+		{`join(["how", "far"], " ")`, "how far"},
+		{`join([], ",")`, ""},
+		{`join(["one"], ", ")`, "one"},
+		// Splitting and joining with the same separator gives the string back
+		{`join(split("a,b,c", ","), ",")`, "a,b,c"},
+		{`join(split("a,,b,", ","), ",")`, "a,,b,"},
+		{`join(split("Lagôs", ""), "")`, "Lagôs"},
+		{`join(split("na so e be", " "), "-")`, "na-so-e-be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Fatalf("expected STRING, got %s (%s)", evaluated.Type(), evaluated.Inspect())
+			}
+			if str.Value != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, str.Value)
+			}
+		})
+	}
+}
+
+func TestSplitJoinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b")`, "split wan make 2 argument, you give am 1"},
+		{`split(5, ",")`, "split wan make STRING, you give am INTEGER"},
+		{`split("a,b", 1)`, "split wan make STRING, you give am INTEGER"},
+		{`join(["a"])`, "join wan make 2 argument, you give am 1"},
+		{`join("abc", ",")`, "join wan make ARRAY, you give am STRING"},
+		{`join(["a"], nothing)`, "join wan make STRING, you give am NOTHING"},
+		{`join(["a", 2, "c"], ",")`, "join fit only join STRING, but item 1 na INTEGER"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	RegisterBuiltin("double", func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("double wan make one argument, you give am %d", len(args))
+		}
+		n, ok := args[0].(*object.Integer)
+		if !ok {
+			return newError("I no fit double %s", args[0].Type())
+		}
+		return &object.Integer{Value: n.Value * 2}
+	})
+	t.Cleanup(func() { delete(builtins, "double") })
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"double(21)", 42},
+		{"double(double(3)) + 1", 13},
+		{"do apply(fn, x) { bring fn(x) }\napply(double, 4)", 8},
+		// A variable of the same name comes first
+		{"make double be 5\ndouble", 5},
+		{"do f(double) { bring double }\nf(9)", 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+
+	testErrorObject(t, testEval(`double("two")`), "I no fit double STRING")
+	testBooleanObject(t, testEval(`type(double) be "BUILTIN"`), true)
+}
+
+func TestMemoize(t *testing.T) {
+	tests := []struct {
+		input         string
+		expected      int64
+		expectedCalls int
+	}{
+		{"fast(3)", 9, 1},
+		{"fast(3) + fast(3) + fast(3)", 27, 1},
+		{"fast(3) + fast(4) + fast(3) + fast(4)", 50, 2},
+		{"add(1, 2) + add(1, 2) + add(2, 1)", 9, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			// tick counts how many times the underlying functions really run
+			calls := 0
+			env := object.NewEnvironment()
+			env.Set("tick", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+				calls++
+				return NOTHING
+			}})
+
+			setup := "do square(n) { tick()\nbring n * n }\nmake fast be memoize(square)\n" +
+				"do plus(a, b) { tick()\nbring a + b }\nmake add be memoize(plus)\n"
+			evaluated := Eval(parser.New(lexer.New(setup+tt.input)).ParseProgram(), env)
+
+			testIntegerObject(t, evaluated, tt.expected)
+			if calls != tt.expectedCalls {
+				t.Errorf("underlying function called %d times, want %d", calls, tt.expectedCalls)
+			}
+		})
+	}
+}
+
+func TestMemoKey(t *testing.T) {
+	// Each pair must land on different cache entries
+	tests := []struct {
+		a, b []object.Object
+	}{
+		{[]object.Object{&object.Integer{Value: 1}}, []object.Object{&object.String{Value: "1"}}},
+		{[]object.Object{&object.Integer{Value: 3}}, []object.Object{&object.Float{Value: 3}}},
+		{[]object.Object{&object.String{Value: "a,b"}}, []object.Object{&object.String{Value: "a"}, &object.String{Value: "b"}}},
+		{[]object.Object{&object.Integer{Value: 1}, &object.Integer{Value: 2}}, []object.Object{&object.Integer{Value: 2}, &object.Integer{Value: 1}}},
+		{[]object.Object{&object.Builtin{}}, []object.Object{&object.Builtin{}}},
+	}
+
+	for _, tt := range tests {
+		if memoKey(tt.a) == memoKey(tt.b) {
+			t.Errorf("memoKey(%v) and memoKey(%v) are both %q", tt.a, tt.b, memoKey(tt.a))
+		}
+	}
+
+	same := []object.Object{&object.Integer{Value: 7}, &object.String{Value: "seven"}}
+	again := []object.Object{&object.Integer{Value: 7}, &object.String{Value: "seven"}}
+	if memoKey(same) != memoKey(again) {
+		t.Errorf("equal arguments gave different keys: %q and %q", memoKey(same), memoKey(again))
+	}
+}
+
+func TestMemoizeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"memoize(5)", "I no fit memoize INTEGER"},
+		{"memoize()", "memoize wan make one argument, you give am 0"},
+		{"do f(n) { bring n }\nmemoize(f, 1)", "memoize wan make one argument, you give am 2"},
+		{"do f(n) { bring 1 / n }\nmemoize(f)(0)", "Omo! You no fit divide by zero o!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestAssert(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // empty when the assert passes
+	}{
+		{"assert(tru)", ""},
+		{"assert(1 na 1, \"fine\")", ""},
+		{"assert(0)", ""},
+		{"assert(lie)", "Assert fail"},
+		{"assert(nothing, \"no value\")", "Assert fail: no value"},
+		{"assert(2 big pass 3, 42)", "Assert fail: 42"},
+		{"assert(tru, \"a\", \"b\")", "assert wan make condition and maybe message, you give am 3 argument"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			if tt.expected == "" {
+				if evaluated != NOTHING {
+					t.Errorf("expected assert to pass, got %s", evaluated.Inspect())
+				}
+				return
+			}
+			testErrorObject(t, evaluated, tt.expected)
+		})
+	}
+}
+
+func TestCopy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"copy([1, [2, 3]])", "[1, [2, 3]]"},
+		{"deep_copy([1, [2, 3]])", "[1, [2, 3]]"},
+		{`deep_copy({"a": [1], "b": {"c": 2}})`, "{a: [1], b: {c: 2}}"},
+		{`copy("abc")`, "abc"},
+		{"deep_copy(5)", "5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := testEval(tt.input).Inspect(); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	testErrorObject(t, testEval("copy()"), "copy wan make one argument, you give am 0")
+	testErrorObject(t, testEval("deep_copy(1, 2)"), "deep_copy wan make one argument, you give am 2")
+}
+
+func TestDeepCopySharesNothing(t *testing.T) {
+	// Pidgin can't change a collection yet, so change the copies from Go
+	source := `[[1, 2], {"inner": [3]}]`
+
+	for _, name := range []string{"copy", "deep_copy"} {
+		t.Run(name, func(t *testing.T) {
+			original := testEval(source).(*object.Array)
+			copied := builtins[name].Fn(original).(*object.Array)
+			if copied == original {
+				t.Fatal("expected a new array")
+			}
+
+			copied.Elements[0].(*object.Array).Elements[0] = &object.Integer{Value: 99}
+			copied.Elements[1].(*object.Hash).Set(&object.String{Value: "inner"}, NOTHING)
+
+			want := "[[1, 2], {inner: [3]}]"
+			if name == "copy" {
+				// The nested collections are the same ones
+				want = "[[99, 2], {inner: nothing}]"
+			}
+			if got := original.Inspect(); got != want {
+				t.Errorf("original became %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDeepCopyCycles(t *testing.T) {
+	// An array holding itself, and an array holding the same hash twice
+	loop := &object.Array{}
+	loop.Elements = []object.Object{&object.Integer{Value: 1}, loop}
+
+	copied := builtins["deep_copy"].Fn(loop).(*object.Array)
+	if copied == loop || copied.Elements[1] != copied {
+		t.Error("expected the copy to hold itself, not the original")
+	}
+
+	shared := object.NewHash()
+	pair := &object.Array{Elements: []object.Object{shared, shared}}
+	copiedPair := builtins["deep_copy"].Fn(pair).(*object.Array)
+	if copiedPair.Elements[0] == shared || copiedPair.Elements[0] != copiedPair.Elements[1] {
+		t.Error("expected both places to hold the same new hash")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"describe(42)", "{type: INTEGER, value: 42}"},
+		{`describe("wetin")`, "{type: STRING, length: 5, value: wetin}"},
+		{`describe([1, "two", [3]])`, "{type: ARRAY, length: 3, value: [1, two, [3]]}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := testEval(tt.input).Inspect(); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	// The length is a number and the value a string, not just their text
+	testIntegerObject(t, testEval(`describe([1, "two", [3]])["length"]`), 3)
+	if str, ok := testEval(`describe(42)["value"]`).(*object.String); !ok || str.Value != "42" {
+		t.Errorf("expected the value as the string 42, got %+v", str)
+	}
+	if got := testEval(`describe(42)["length"]`); got != NOTHING {
+		t.Errorf("expected a number to have no length, got %s", got.Inspect())
+	}
+
+	testErrorObject(t, testEval("describe()"), "describe wan make one argument, you give am 0")
+}
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"42", "42", true},
+		{"2", "2.0", true},
+		{"-7", "-7.0", true},
+		{"1.5", "1.5", true},
+		{`"abc"`, `"ab" + "c"`, true},
+		{"tru", "5 big pass 3", true},
+		{"nothing", "nothing", true},
+		{"1", "2", false},
+		{"1", `"1"`, false},
+		{"1", "tru", false},
+		{"0", "lie", false},
+		{"0", "nothing", false},
+		{`""`, "nothing", false},
+		{"1.5", "2.5", false},
+		{`"abc"`, `"abd"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			input := fmt.Sprintf("hash(%s) be hash(%s)", tt.a, tt.b)
+			testBooleanObject(t, testEval(input), tt.equal)
+		})
+	}
+}
+
+func TestHashIsStable(t *testing.T) {
+	// The same value hashes the same every call, and every run: these
+	// numbers must never change
+	input := `
+	make first be hash("How far")
+	make again be count i from 1 reach 5 { hash("How far") }
+	[first be again, hash("How far"), hash(42), hash(tru), hash(nothing)]
+	`
+	expected := "[tru, 7182596136747415461, 6572895336135381714, 623206522264852908, 3414822860282263665]"
+	if got := testEval(input).Inspect(); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	for _, input := range []string{`hash("")`, "hash(-1)", "hash(-0.5)", "hash(lie)"} {
+		if n := testEval(input).(*object.Integer).Value; n < 0 {
+			t.Errorf("%s: expected a hash of at least 0, got %d", input, n)
+		}
+	}
+}
+
+func TestHashErrors(t *testing.T) {
+	testErrorObject(t, testEval("hash()"), "hash wan make one argument, you give am 0")
+	testErrorObject(t, testEval("hash(1, 2)"), "hash wan make one argument, you give am 2")
+	testErrorObject(t, testEval("hash([1])"), "I no fit hash ARRAY")
+	testErrorObject(t, testEval(`hash({"a": 1})`), "I no fit hash HASH")
+	testErrorObject(t, testEval("hash(do(x) { bring x })"), "I no fit hash FUNCTION")
+}
+
+func TestSetOperations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"unique([3, 1, 3, 2, 1])", "[3, 1, 2]"},
+		{`unique([1, 1.0, "1", tru, tru, nothing, nothing])`, "[1, 1, tru, nothing]"},
+		{"unique([])", "[]"},
+		{"union([1, 2, 2], [2, 3, 3])", "[1, 2, 3]"},
+		{"union([], [4, 4])", "[4]"},
+		{"union([], [])", "[]"},
+		{"intersect([1, 2, 2, 3], [3, 2, 5])", "[2, 3]"},
+		{`intersect(["a", "b"], ["c"])`, "[]"},
+		{"intersect([], [1])", "[]"},
+		{"intersect([2.0, 2], [2])", "[2.0]"},
+		{"difference([1, 2, 2, 3, 3], [2])", "[1, 3]"},
+		{"difference([1, 2], [])", "[1, 2]"},
+		{"difference([], [1])", "[]"},
+		{"difference([1, 2], [2, 1])", "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := testEval(tt.input).Inspect(); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSetOperationsOnCollections(t *testing.T) {
+	// Arrays are only equal to themselves, the way be compares them
+	input := `
+	make a be [1]
+	[unique([a, a, [1]]), intersect([a, [1]], [a]), difference([a, [1]], [a])]
+	`
+	expected := "[[[1], [1]], [[1]], [[1]]]"
+	if got := testEval(input).Inspect(); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	// The same array comes back, not a copy
+	result := testEval("make a be [1]; unique([a, a])[0] be a")
+	testBooleanObject(t, result, true)
+}
+
+func TestSetOperationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"unique()", "unique wan make 1 argument, you give am 0"},
+		{"union([1])", "union wan make 2 argument, you give am 1"},
+		{"intersect([1], [2], [3])", "intersect wan make 2 argument, you give am 3"},
+		{"unique(5)", "unique wan make ARRAY, you give am INTEGER"},
+		{`difference([1], "1")`, "difference wan make ARRAY, you give am STRING"},
+	}
+
+	for _, tt := range tests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		// Every call to work moves the fake clock on 3ms
+		{"benchmark(work, 1)", 3},
+		{"benchmark(work, 4)", 3},
+		{"do twice() { work()\nwork() }\nbenchmark(twice, 5)", 6},
+		{"benchmark(do() { }, 10)", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			defer func(saved func() time.Time) { now = saved }(now)
+			now = func() time.Time { return clock }
+
+			env := object.NewEnvironment()
+			env.Set("work", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+				clock = clock.Add(3 * time.Millisecond)
+				return NOTHING
+			}})
+
+			evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+			testFloatObject(t, evaluated, tt.expected)
+		})
+	}
+}
+
+func TestBenchmarkErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"benchmark(5, 1)", "I no fit benchmark INTEGER"},
+		{"benchmark(do() { }, \"ten\")", "benchmark count must be INTEGER, you give am STRING"},
+		{"benchmark(do() { }, 0)", "benchmark must run at least once, you give am 0"},
+		{"benchmark(do() { })", "benchmark wan make function and count, you give am 1 argument"},
+		{"benchmark(do() { bring 1 / 0 }, 3)", "Omo! You no fit divide by zero o!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+// ============================================================================
+// Loop Tests
+// ============================================================================
+
+func TestCountLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"make total be 0\ncount i from 1 reach 10 { make total be total + i }\ntotal", 55},
+		{"make total be 0\ncount i from 5 reach 5 { make total be total + i }\ntotal", 5},
+		{"make total be 0\ncount i from 3 reach 1 { make total be total + i }\ntotal", 0},
+		{"make total be 0\ncount i from -2 reach 2 { make total be total + i }\ntotal", 0},
+		{"make n be 4\nmake total be 0\ncount i from 1 reach n * 2 { make total be total + i }\ntotal", 36},
+		// The loop variable is put back the way it was after the loop
+		{"make i be 100\ncount i from 1 reach 3 { i }\ni", 100},
+		// Nested loops
+		{"make total be 0\ncount i from 1 reach 3 { count j from 1 reach 3 { make total be total + i * j } }\ntotal", 36},
+		// Changing the variable inside the body moves the count along
+		{"make steps be 0\ncount i from 1 reach 10 { make steps be steps + 1\nmake i be i + 1 }\nsteps", 5},
+		{"do sum(n) { count i from 1 reach n { suppose i na 4 { bring i } } }\nsum(10)", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestCountLoopScope(t *testing.T) {
+	env := object.NewEnvironment()
+	Eval(parser.New(lexer.New("count i from 1 reach 3 { i }")).ParseProgram(), env)
+
+	if _, ok := env.Get("i"); ok {
+		t.Errorf("loop variable i still defined after the loop")
+	}
+}
+
+func TestCountLoopErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`count i from "one" reach 10 { i }`, "Count loop must start from INTEGER, you give am STRING"},
+		{"count i from 1 reach 2.5 { i }", "Count loop must reach INTEGER, you give am FLOAT"},
+		{`count i from 1 reach 10 { make i be "ten" }`, "Count loop variable i must stay INTEGER"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testErrorObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestErrorLine(t *testing.T) {
+	tests := []struct {
+		input string
+		line  int
+	}{
+		{"1 / 0", 1},
+		{"make x be 5\nx + 1\nx / 0", 3},
+		// An error inside a function keeps the line it happened on
+		{"do f(n) {\n  bring n / 0\n}\nf(1)", 2},
+		// A wrong return type belongs to the call
+		{"do f() bring number {\n  bring \"x\"\n}\n\nf()", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			errObj, ok := testEval(tt.input).(*object.Error)
+			if !ok {
+				t.Fatalf("expected an error")
+			}
+			if errObj.Line != tt.line {
+				t.Errorf("expected line %d, got %d", tt.line, errObj.Line)
+			}
+		})
+	}
+}
+
+func TestBreakAndContinue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// Stop at a condition
+		{"make i be 0\ndey do while tru { suppose i na 5 { comot }\nmake i be i + 1 }\ni", 5},
+		// Skip the even numbers
+		{"make i be 0\nmake total be 0\ndey do while i no reach 10 { make i be i + 1\nsuppose i % 2 na 0 { kontinu }\nmake total be total + i }\ntotal", 25},
+		{"make total be 0\ncount i from 1 reach 10 { suppose i na 4 { comot }\nmake total be total + i }\ntotal", 6},
+		{"make total be 0\ncount i from 1 reach 10 { suppose i % 3 na 0 { kontinu }\nmake total be total + i }\ntotal", 37},
+		// comot only leaves the innermost loop
+		{"make total be 0\ncount i from 1 reach 3 { count j from 1 reach 3 { suppose j na 2 { comot }\nmake total be total + 1 } }\ntotal", 3},
+		// bring inside a loop still leaves the function
+		{"do first(n) { count i from 1 reach n { suppose i * i big pass n { bring i } } }\nfirst(30)", 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+}
+
+func TestWhileOtherwise(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"make n be 0\nmake done be 0\ndey do while n no reach 3 { n be n + 1 } otherwise { done be 1 }\ndone", 1},
+		{"make n be 0\nmake done be 0\ndey do while tru { n be n + 1\nsuppose n na 3 { comot } } otherwise { done be 1 }\ndone", 0},
+		{"make done be 0\ndey do while lie { } otherwise { done be 1 }\ndone", 1},
+		// kontinu is not comot, so otherwise still runs
+		{"make n be 0\nmake done be 0\ndey do while n no reach 3 { n be n + 1\nkontinu } otherwise { done be 1 }\ndone", 1},
+		// otherwise gives the loop its value
+		{"make n be 0\ndey do while n no reach 3 { n be n + 1 } otherwise { n * 10 }", 30},
+		// otherwise is outside its loop, so comot there leaves the outer one
+		{"make rounds be 0\ndey do while tru { rounds be rounds + 1\ndey do while lie { } otherwise { comot } }\nrounds", 1},
+		// Search, with otherwise for when nothing was found
+		{"do root(n) { make i be 0\ndey do while i no reach 10 { suppose i * i na n { comot }\ni be i + 1 } otherwise { bring -1 }\nbring i }\nroot(49) * 100 + root(50)", 699},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+
+	// Left with comot, the loop gives nothing
+	if result := testEval("dey do while tru { comot } otherwise { 1 }"); result != NOTHING {
+		t.Errorf("expected nothing, got %s", result.Inspect())
+	}
+}
+
+func TestBreakOutsideLoop(t *testing.T) {
+	// The parser rejects these, so build the AST by hand
+	tests := []struct {
+		program  *ast.Program
+		expected string
+	}{
+		{
+			&ast.Program{Statements: []ast.Statement{&ast.BreakStatement{}}},
+			"'comot' fit only dey inside loop",
+		},
+		{
+			&ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{
+				Expression: &ast.CallExpression{Function: &ast.DoExpression{
+					Body: &ast.BlockStatement{Statements: []ast.Statement{&ast.ContinueStatement{}}},
+				}},
+			}}},
+			"'kontinu' fit only dey inside loop",
+		},
+	}
+
+	for _, tt := range tests {
+		testErrorObject(t, Eval(tt.program, object.NewEnvironment()), tt.expected)
+	}
+}
+
+func TestLoopClosureCapture(t *testing.T) {
+	// Closures capture the loop's environment by reference, not a copy
+	// per iteration, so they all see the variable's latest value
+	tests := []struct {
+		input    string
+		expected []int64
+	}{
+		{
+			"make i be 0\ndey do while i no reach 3 {\nmake i be i + 1\nsuppose i na 1 { make f1 be do() { bring i } }\nsuppose i na 2 { make f2 be do() { bring i } }\nsuppose i na 3 { make f3 be do() { bring i } }\n}\nmake fs be [f1, f2, f3]\n[fs[0](), fs[1](), fs[2]()]",
+			[]int64{3, 3, 3},
+		},
+		// After a count loop the variable goes back to what it was before
+		{
+			"make i be 100\ncount i from 1 reach 3 {\nsuppose i na 1 { make f1 be do() { bring i } }\nsuppose i na 3 { make f3 be do() { bring i } }\n}\n[f1(), f3()]",
+			[]int64{100, 100},
+		},
+		// Called inside the loop, a closure sees the current iteration
+		{
+			"make seen be [0, 0, 0]\ncount i from 1 reach 3 {\nmake f be do() { bring i }\nsuppose f() na 2 { make seen be [1, f(), 3] }\n}\nseen",
+			[]int64{1, 2, 3},
+		},
+		// A function call gives each closure its own copy of the value
+		{
+			"do capture(n) { bring do() { bring n } }\ncount i from 1 reach 3 {\nsuppose i na 1 { make f1 be capture(i) }\nsuppose i na 2 { make f2 be capture(i) }\nsuppose i na 3 { make f3 be capture(i) }\n}\n[f1(), f2(), f3()]",
+			[]int64{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := testEval(tt.input)
+			array, ok := result.(*object.Array)
+			if !ok {
+				t.Fatalf("object is not Array. got=%T (%+v)", result, result)
+			}
+			if len(array.Elements) != len(tt.expected) {
+				t.Fatalf("wrong num of elements. want=%d, got=%d", len(tt.expected), len(array.Elements))
+			}
+			for i, want := range tt.expected {
+				testIntegerObject(t, array.Elements[i], want)
+			}
+		})
+	}
+}
+
+func TestLoopClosureOutlivesVariable(t *testing.T) {
+	// The count loop removes its variable when it ends, so a closure
+	// that reads it afterwards finds nothing there
+	input := "count i from 1 reach 3 { make f be do() { bring i } }\nf()"
+	testErrorObject(t, testEval(input), "I no sabi dis one: i")
+}
+
+// ============================================================================
+// Function Tests
+// ============================================================================
+
+// argumentOrderSetup records each note() and pick() call in order
+const argumentOrderSetup = `
+make order be ""
+do note(s) {
+	order be order + s
+	bring s
+}
+do join3(a, b, c) { bring a + b + c }
+do pick() {
+	order be order + "f"
+	bring join3
+}
+`
+
+func TestCallSupposeResult(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"(suppose tru { do (x) { bring x + 1 } } abi { do (x) { bring x - 1 } })(10)", 11},
+		{"(suppose lie { do (x) { bring x + 1 } } abi { do (x) { bring x - 1 } })(10)", 9},
+		{"suppose 3 big pass 5 { do () { 1 } } abi { do () { 2 } }()", 2},
+		{"make up be tru;\nmake step be suppose up { do (x) { bring x * 2 } } abi { do (x) { bring x } };\nstep(21)", 42},
+		{"do twice(x) { bring x * 2 };\n(suppose tru { twice } abi { len })(4)", 8},
+		{`(suppose lie { do (s) { bring 0 } } abi { len })("wetin")`, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			testIntegerObject(t, testEval(tt.input), tt.expected)
+		})
+	}
+
+	// A suppose without abi gives nothing when its condition is false
+	testErrorObject(t, testEval("(suppose lie { do () { 1 } })()"), "Dis one no be function: NOTHING")
+}
+
+func TestCallArgumentOrder(t *testing.T) {
+	tests := []struct {
+		call     string
+		expected string
+	}{
+		{`join3(note("a"), note("b"), note("c"))`, "abc"},
+		// The function is worked out after its arguments, like in the VM
+		{`pick()(note("a"), note("b"), note("c"))`, "abcf"},
+		{`join3(note("a"), join3(note("b"), note("c"), ""), note("d"))`, "abcd"},
+		{`len(note("a") + note("b"))`, "ab"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(argumentOrderSetup + tt.call + "\norder")
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("%s: expected a String, got %T (%+v)", tt.call, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("%s: expected order %q, got %q", tt.call, tt.expected, str.Value)
+		}
+	}
+}
+
+func TestFunctionReturnType(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected interface{}
+	}{
+		{
+			"matching return",
+			"do add(x, y) bring number { bring x + y }\nadd(2, 3)",
+			int64(5),
+		},
+		{
+			"matching implicit return",
+			"do add(x, y) bring number { x + y }\nadd(2, 3)",
+			int64(5),
+		},
+		{
+			"mismatching return",
+			"do add(x, y) bring number { bring \"five\" }\nadd(2, 3)",
+			"add suppose bring number, but e bring STRING",
+		},
+		{
+			"empty body for nothing",
+			"do noop() bring nothing { }\nnoop()",
+			nil,
+		},
+		{
+			"unknown return type",
+			"do add(x, y) bring wahala { bring x + y }",
+			"I no sabi dis return type: wahala",
+		},
+		{
+			"no annotation",
+			"do pick(x) { bring x }\npick(\"anything\")",
+			"anything",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evaluated := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, evaluated, expected)
+			case string:
+				if errObj, ok := evaluated.(*object.Error); ok {
+					testErrorObject(t, errObj, expected)
+					return
+				}
+				if evaluated.Inspect() != expected {
+					t.Errorf("wrong result. got=%s, want=%s", evaluated.Inspect(), expected)
+				}
+			case nil:
+				if evaluated != NOTHING {
+					t.Errorf("expected nothing, got=%T (%+v)", evaluated, evaluated)
+				}
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Helper Functions
+// ============================================================================
+
+func testEval(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return Eval(program, env)
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	t.Helper()
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	t.Helper()
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	t.Helper()
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testErrorObject(t *testing.T, obj object.Object, expectedMessage string) bool {
+	t.Helper()
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("no error object returned. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if errObj.Message != expectedMessage {
+		t.Errorf("wrong error message. expected=%q, got=%q", expectedMessage, errObj.Message)
+		return false
+	}
+	return true
+}
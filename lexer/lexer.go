@@ -1,13 +1,19 @@
 package lexer
 
-import "pidgin-lang/token"
+import (
+	"fmt"
+
+	"pidgin-lang/token"
+)
 
 type Lexer struct {
 	input        string
-	position     int  // current position in input (points to current char)
-	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
-	line         int  // current line number for error reporting
+	position     int      // current position in input (points to current char)
+	readPosition int      // current reading position in input (after current char)
+	ch           byte     // current char under examination
+	line         int      // current line number for error reporting
+	column       int      // column of the current char, starting from 1
+	errors       []string // problems found while scanning
 }
 
 // New creates a new Lexer instance
@@ -17,8 +23,24 @@ func New(input string) *Lexer {
 	return l
 }
 
+// Errors returns problems found while scanning, like unterminated strings
+func (l *Lexer) Errors() []string {
+	return l.errors
+}
+
+// Position returns the line and column of the next character to scan,
+// which is just past the end of the token NextToken last returned
+func (l *Lexer) Position() (line, column int) {
+	return l.line, l.column
+}
+
 // readChar advances to the next character
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // ASCII NUL signifies EOF
 	} else {
@@ -43,6 +65,8 @@ func (l *Lexer) NextToken() token.Token {
 	l.skipWhitespace()
 
 	tok.Line = l.line
+	tok.Column = l.column
+	startColumn := l.column
 
 	switch l.ch {
 	case '=':
@@ -57,14 +81,26 @@ func (l *Lexer) NextToken() token.Token {
 		tok = l.newToken(token.ASTERISK, l.ch)
 	case '/':
 		tok = l.newToken(token.SLASH, l.ch)
+	case '%':
+		tok = l.newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = l.newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.LTE)
+		} else {
+			tok = l.newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = l.newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.newTwoCharToken(token.GTE)
+		} else {
+			tok = l.newToken(token.GT, l.ch)
+		}
 	case ',':
 		tok = l.newToken(token.COMMA, l.ch)
 	case ';':
 		tok = l.newToken(token.SEMICOLON, l.ch)
+	case ':':
+		tok = l.newToken(token.COLON, l.ch)
 	case '(':
 		tok = l.newToken(token.LPAREN, l.ch)
 	case ')':
@@ -73,10 +109,26 @@ func (l *Lexer) NextToken() token.Token {
 		tok = l.newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = l.newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = l.newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = l.newToken(token.RBRACKET, l.ch)
 	case '"':
+		startLine := l.line
+		str, ok := l.readString()
+		if !ok {
+			// The string swallowed the rest of the input, so there is nothing left to tokenize
+			l.errors = append(l.errors, fmt.Sprintf("line %d: unterminated string started on line %d",
+				l.line, startLine))
+			tok.Type = token.EOF
+			tok.Literal = ""
+			tok.Line = l.line
+			return tok
+		}
 		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok.Literal = str
 		tok.Line = l.line
+		tok.Column = startColumn
 		return tok
 	case 0:
 		tok.Literal = ""
@@ -86,11 +138,12 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
 			tok.Line = l.line
+			tok.Column = startColumn
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
 			tok.Line = l.line
+			tok.Column = startColumn
 			return tok
 		} else {
 			tok = l.newToken(token.ILLEGAL, l.ch)
@@ -103,7 +156,17 @@ func (l *Lexer) NextToken() token.Token {
 
 // newToken creates a new token
 func (l *Lexer) newToken(tokenType token.TokenType, ch byte) token.Token {
-	return token.Token{Type: tokenType, Literal: string(ch), Line: l.line}
+	return token.Token{Type: tokenType, Literal: string(ch), Line: l.line, Column: l.column}
+}
+
+// newTwoCharToken creates a token from the current char and the next one,
+// leaving the lexer on the second char
+func (l *Lexer) newTwoCharToken(tokenType token.TokenType) token.Token {
+	tok := token.Token{Type: tokenType, Line: l.line, Column: l.column}
+	ch := l.ch
+	l.readChar()
+	tok.Literal = string(ch) + string(l.ch)
+	return tok
 }
 
 // readIdentifier reads an identifier (letters and underscores)
@@ -115,17 +178,41 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-// readNumber reads an integer
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer, or a float if a '.' and more digits follow.
+// Integers may use a 0x, 0b, or 0o prefix for hex, binary, or octal.
+// Underscores are read as part of the number (1_000_000); the parser
+// checks that they only sit between digits.
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	position := l.position
-	for isDigit(l.ch) {
+
+	if l.ch == '0' {
+		if isDigitOfBase := radixDigitCheck(l.peekChar()); isDigitOfBase != nil {
+			l.readChar() // consume '0'
+			l.readChar() // consume the base letter
+			for isDigitOfBase(l.ch) || l.ch == '_' {
+				l.readChar()
+			}
+			return token.INT, l.input[position:l.position]
+		}
+	}
+
+	for isDigit(l.ch) || l.ch == '_' {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+
+	if l.ch != '.' || !isDigit(l.peekChar()) {
+		return token.INT, l.input[position:l.position]
+	}
+
+	l.readChar() // consume the '.'
+	for isDigit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+	return token.FLOAT, l.input[position:l.position]
 }
 
-// readString reads a string literal
-func (l *Lexer) readString() string {
+// readString reads a string literal, reporting false if EOF comes before the closing quote
+func (l *Lexer) readString() (string, bool) {
 	position := l.position + 1 // skip the opening quote
 	for {
 		l.readChar()
@@ -136,9 +223,12 @@ func (l *Lexer) readString() string {
 			l.line++
 		}
 	}
+	if l.ch == 0 {
+		return "", false
+	}
 	str := l.input[position:l.position]
 	l.readChar() // consume the closing quote
-	return str
+	return str, true
 }
 
 // skipWhitespace skips spaces, tabs, newlines, carriage returns, and comments
@@ -152,6 +242,8 @@ func (l *Lexer) skipWhitespace() {
 		} else if l.ch == '/' && l.peekChar() == '/' {
 			// Skip single-line comment
 			l.skipComment()
+		} else if l.ch == '/' && l.peekChar() == '*' {
+			l.skipBlockComment()
 		} else {
 			break
 		}
@@ -165,6 +257,28 @@ func (l *Lexer) skipComment() {
 	}
 }
 
+// skipBlockComment skips a /* ... */ comment, counting the lines inside it.
+// Block comments do not nest: the first */ closes the comment.
+func (l *Lexer) skipBlockComment() {
+	startLine := l.line
+	l.readChar() // consume '/'
+	l.readChar() // consume '*'
+
+	for !(l.ch == '*' && l.peekChar() == '/') {
+		if l.ch == 0 {
+			l.errors = append(l.errors, fmt.Sprintf("line %d: unterminated block comment started on line %d", l.line, startLine))
+			return
+		}
+		if l.ch == '\n' {
+			l.line++
+		}
+		l.readChar()
+	}
+
+	l.readChar() // consume '*'
+	l.readChar() // consume '/'
+}
+
 // isLetter checks if a character is a letter or underscore
 func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
@@ -173,4 +287,31 @@ func isLetter(ch byte) bool {
 // isDigit checks if a character is a digit
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
+}
+
+// radixDigitCheck returns the digit check for a number prefix letter
+// (x for hex, b for binary, o for octal), or nil if ch isn't one
+func radixDigitCheck(ch byte) func(byte) bool {
+	switch ch {
+	case 'x', 'X':
+		return isHexDigit
+	case 'b', 'B':
+		return isBinaryDigit
+	case 'o', 'O':
+		return isOctalDigit
+	default:
+		return nil
+	}
+}
+
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func isBinaryDigit(ch byte) bool {
+	return ch == '0' || ch == '1'
+}
+
+func isOctalDigit(ch byte) bool {
+	return '0' <= ch && ch <= '7'
 }
\ No newline at end of file
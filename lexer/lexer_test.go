@@ -11,9 +11,17 @@ func TestNextToken(t *testing.T) {
 make y na 10
 make name be "Chidi"
 yarn("hello")
+10 % 3
+a <= b >= c < d
+[1, 2][0]
+{"a": 1}
 tru
 lie
 nothing
+comot kontinu
+and abi or
+otherwise
+try rescue
 `
 
 	tests := []struct {
@@ -36,9 +44,40 @@ nothing
 		{token.LPAREN, "("},
 		{token.STRING, "hello"},
 		{token.RPAREN, ")"},
+		{token.INT, "10"},
+		{token.PERCENT, "%"},
+		{token.INT, "3"},
+		{token.IDENT, "a"},
+		{token.LTE, "<="},
+		{token.IDENT, "b"},
+		{token.GTE, ">="},
+		{token.IDENT, "c"},
+		{token.LT, "<"},
+		{token.IDENT, "d"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.LBRACKET, "["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.LBRACE, "{"},
+		{token.STRING, "a"},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
 		{token.TRU, "tru"},
 		{token.LIE, "lie"},
 		{token.NOTHING, "nothing"},
+		{token.COMOT, "comot"},
+		{token.KONTINU, "kontinu"},
+		{token.AND, "and"},
+		{token.ABI, "abi"},
+		{token.OR, "or"},
+		{token.OTHERWISE, "otherwise"},
+		{token.TRY, "try"},
+		{token.RESCUE, "rescue"},
 		{token.EOF, ""},
 	}
 
@@ -58,3 +97,252 @@ nothing
 		}
 	}
 }
+
+func TestTokenColumns(t *testing.T) {
+	input := `make total be add(3, "hi") + 42
+  yarn(total)`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.MAKE, 1, 1},
+		{token.IDENT, 1, 6},
+		{token.BE, 1, 12},
+		{token.IDENT, 1, 15},
+		{token.LPAREN, 1, 18},
+		{token.INT, 1, 19},
+		{token.COMMA, 1, 20},
+		{token.STRING, 1, 22},
+		{token.RPAREN, 1, 26},
+		{token.PLUS, 1, 28},
+		{token.INT, 1, 30},
+		{token.YARN, 2, 3},
+		{token.LPAREN, 2, 7},
+		{token.IDENT, 2, 8},
+		{token.RPAREN, 2, 13},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong for %q. expected=%d:%d, got=%d:%d",
+				i, tok.Literal, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestUnterminatedString(t *testing.T) {
+	input := `make x be "oops
+yarn(x)`
+
+	l := New(input)
+
+	expected := []token.TokenType{token.MAKE, token.IDENT, token.BE, token.EOF}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q (%q)",
+				i, tt, tok.Type, tok.Literal)
+		}
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 lexer error, got %d: %v", len(errors), errors)
+	}
+
+	want := "line 2: unterminated string started on line 1"
+	if errors[0] != want {
+		t.Errorf("wrong error. expected=%q, got=%q", want, errors[0])
+	}
+}
+
+func TestBlockComments(t *testing.T) {
+	input := `make x /* inline */ be 5
+/* one
+   two
+   three */
+yarn(x)
+/* /* */ 10
+`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+	}{
+		{token.MAKE, "make", 1},
+		{token.IDENT, "x", 1},
+		{token.BE, "be", 1},
+		{token.INT, "5", 1},
+		{token.YARN, "yarn", 5},
+		{token.LPAREN, "(", 5},
+		{token.IDENT, "x", 5},
+		{token.RPAREN, ")", 5},
+		// Block comments no dey nest: the first */ closes the comment
+		{token.INT, "10", 6},
+		{token.EOF, "", 7},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Line != tt.expectedLine {
+			t.Fatalf("tests[%d] - line wrong. expected=%d, got=%d",
+				i, tt.expectedLine, tok.Line)
+		}
+	}
+
+	if errors := l.Errors(); len(errors) != 0 {
+		t.Errorf("unexpected lexer errors: %v", errors)
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	input := `make x be 5
+/* dis comment
+no get end`
+
+	l := New(input)
+
+	expected := []token.TokenType{token.MAKE, token.IDENT, token.BE, token.INT, token.EOF}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q (%q)",
+				i, tt, tok.Type, tok.Literal)
+		}
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 lexer error, got %d: %v", len(errors), errors)
+	}
+
+	want := "line 3: unterminated block comment started on line 2"
+	if errors[0] != want {
+		t.Errorf("wrong error. expected=%q, got=%q", want, errors[0])
+	}
+}
+
+func TestFloatLiterals(t *testing.T) {
+	input := `3.14 0.5 10.0 / 4 5.`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "0.5"},
+		{token.FLOAT, "10.0"},
+		{token.SLASH, "/"},
+		{token.INT, "4"},
+		{token.INT, "5"}, // a trailing '.' without digits is not part of the number
+		{token.ILLEGAL, "."},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestRadixIntegerLiterals(t *testing.T) {
+	input := `0xFF 0b1010 0o17 0X1f 0 07`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "0xFF"},
+		{token.INT, "0b1010"},
+		{token.INT, "0o17"},
+		{token.INT, "0X1f"},
+		{token.INT, "0"},
+		{token.INT, "07"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestPositionAfterToken(t *testing.T) {
+	input := "make total be 10 // ten\n\"how\nfar\" >="
+
+	// Each token's end, just past its last character
+	tests := []struct {
+		expectedLiteral string
+		line, column    int
+	}{
+		{"make", 1, 5},
+		{"total", 1, 11},
+		{"be", 1, 14},
+		{"10", 1, 17},
+		{"how\nfar", 3, 5},
+		{">=", 3, 8},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		line, column := l.Position()
+		if line != tt.line || column != tt.column {
+			t.Errorf("tests[%d] - position after %q wrong. expected=%d:%d, got=%d:%d",
+				i, tok.Literal, tt.line, tt.column, line, column)
+		}
+	}
+}
@@ -2,11 +2,18 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 
+	"pidgin-lang/ast"
 	"pidgin-lang/compiler"
 	"pidgin-lang/evaluator"
 	"pidgin-lang/lexer"
@@ -18,6 +25,16 @@ import (
 const VERSION = "0.1.0"
 const PROMPT = "pidgin>> "
 
+// EACH_LINE names the function a program file can define to be run once
+// for every line of standard input, awk-style
+const EACH_LINE = "each_line"
+
+// TEST_SUFFIX marks the files --test runs
+const TEST_SUFFIX = "_test.pdg"
+
+// BYTECODE_SUFFIX marks files saved by --compile, which run without parsing
+const BYTECODE_SUFFIX = ".pdgc"
+
 const WELCOME = `╔═══════════════════════════════════════════════════════════════╗
 ║                    PIDGIN-LANG v0.1                           ║
 ║         Na programming language wey dey use Pidgin            ║
@@ -34,8 +51,20 @@ var (
 	useVM       = flag.Bool("vm", true, "Use bytecode VM (default: true)")
 	showVersion = flag.Bool("version", false, "Show version and exit")
 	showHelp    = flag.Bool("help", false, "Show help and exit")
+	overflow    = flag.String("overflow", "error", "What integer overflow does: error or float")
+	testMode    = flag.Bool("test", false, "Run every *_test.pdg file in a directory")
+	trace       = flag.Bool("trace", false, "Print each VM instruction and the stack as it runs")
+	recoverErrs = flag.Bool("recover", false, "Turn VM runtime errors into values is_error can check")
+	compileTo   = flag.String("compile", "", "Save FILE as bytecode at this path instead of running it")
+	evalCode    = flag.String("eval", "", "Run this code instead of a file")
+	warnShadow  = flag.Bool("warn-shadow", false, "Warn when a parameter or local hides an outer variable")
+	prompt      = flag.String("prompt", "", "Show this prompt in the REPL instead of \""+PROMPT+"\"")
+	noBanner    = flag.Bool("no-banner", false, "Start the REPL without the welcome banner")
 )
 
+// overflowMode is the parsed --overflow flag
+var overflowMode vm.OverflowMode
+
 func main() {
 	flag.Parse()
 
@@ -50,20 +79,41 @@ func main() {
 		return
 	}
 
+	mode, err := vm.ParseOverflowMode(*overflow)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Wahala! %s\n", err)
+		os.Exit(2)
+	}
+	overflowMode = mode
+	evaluator.OverflowToFloat = mode == vm.OverflowFloat
+
 	args := flag.Args()
+	if *testMode {
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		os.Exit(runTestDir(dir, *useVM, os.Stdout))
+	}
+
+	if *compileTo != "" {
+		if len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Wahala! --compile need file wey e go compile")
+			os.Exit(2)
+		}
+		os.Exit(compileFile(args[0], *compileTo, os.Stderr))
+	}
+
+	if *evalCode != "" {
+		os.Exit(runSource(*evalCode, *useVM, os.Stdin, os.Stderr))
+	}
+
 	if len(args) > 0 {
 		// Run file mode
 		runFile(args[0])
 	} else {
 		// REPL mode
-		fmt.Println(WELCOME)
-		if *useVM {
-			fmt.Println("🚀 Using bytecode VM (Level 2 performance)")
-		} else {
-			fmt.Println("⚠️  Using legacy tree-walking interpreter")
-		}
-		fmt.Println()
-		startREPL(os.Stdin, os.Stdout)
+		startREPL(os.Stdin, os.Stdout, replConfigFromFlags(os.Getenv))
 	}
 }
 
@@ -75,6 +125,15 @@ func printHelp() {
 	fmt.Println()
 	fmt.Println("OPTIONS:")
 	fmt.Println("  --vm          Use bytecode VM (default: true)")
+	fmt.Println("  --overflow    Integer overflow: error or float (default: error)")
+	fmt.Println("  --test        Run every *_test.pdg file in a directory")
+	fmt.Println("  --trace       Print each VM instruction and the stack as it runs")
+	fmt.Println("  --recover     Turn VM runtime errors into values is_error can check")
+	fmt.Println("  --compile OUT Save FILE as bytecode in OUT instead of running it")
+	fmt.Println("  --eval CODE   Run CODE instead of a file")
+	fmt.Println("  --warn-shadow Warn when a parameter or local hides an outer variable")
+	fmt.Println("  --prompt TEXT Show TEXT as the REPL prompt")
+	fmt.Println("  --no-banner   Start the REPL without the welcome banner")
 	fmt.Println("  --version     Show version and exit")
 	fmt.Println("  --help        Show this help message")
 	fmt.Println()
@@ -82,25 +141,75 @@ func printHelp() {
 	fmt.Println("  pidgin                  # Start REPL")
 	fmt.Println("  pidgin program.pdg      # Run file with VM")
 	fmt.Println("  pidgin --vm=false file  # Use legacy interpreter")
+	fmt.Println("  pidgin --test tests/    # Run the tests in tests/")
+	fmt.Println("  pidgin --compile app.pdgc app.pdg  # Save bytecode")
+	fmt.Println("  pidgin app.pdgc         # Run saved bytecode")
+	fmt.Println("  pidgin --eval 'yarn(1 + 2)'  # Run a one-liner")
+	fmt.Println()
+	fmt.Println("ENVIRONMENT:")
+	fmt.Println("  PIDGIN_PROMPT     REPL prompt, when --prompt isn't given")
+	fmt.Println("  PIDGIN_NO_BANNER  Set to anything to skip the REPL banner")
 	fmt.Println()
 	fmt.Println("For more info, visit: https://github.com/abdielwilsn/pidgin-lang")
 }
 
-func startREPL(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+// ============================================================================
+// REPL
+// ============================================================================
 
-	// Initialize based on VM flag
-	var env *object.Environment
-	var vmachine *vm.VM
+// replConfig is how a REPL session looks and runs
+type replConfig struct {
+	Prompt   string
+	Banner   bool
+	UseVM    bool
+	Trace    bool
+	Overflow vm.OverflowMode
+}
 
-	if *useVM {
-		vmachine = vm.NewVM()
-	} else {
-		env = object.NewEnvironment()
+// replConfigFromFlags builds the REPL's config from the command line,
+// falling back to the PIDGIN_PROMPT and PIDGIN_NO_BANNER environment
+// variables for what the flags leave unset
+func replConfigFromFlags(getenv func(string) string) replConfig {
+	cfg := replConfig{
+		Prompt:   *prompt,
+		Banner:   !*noBanner && getenv("PIDGIN_NO_BANNER") == "",
+		UseVM:    *useVM,
+		Trace:    *trace,
+		Overflow: overflowMode,
+	}
+	if cfg.Prompt == "" {
+		cfg.Prompt = getenv("PIDGIN_PROMPT")
+	}
+	if cfg.Prompt == "" {
+		cfg.Prompt = PROMPT
 	}
+	return cfg
+}
+
+// startREPL runs lines from in one at a time until the input ends or the
+// user says comot
+func startREPL(in io.Reader, out io.Writer, cfg replConfig) {
+	scanner := bufio.NewScanner(in)
+
+	if cfg.Banner {
+		fmt.Fprintln(out, WELCOME)
+		if cfg.UseVM {
+			fmt.Fprintln(out, "🚀 Using bytecode VM (Level 2 performance)")
+		} else {
+			fmt.Fprintln(out, "⚠️  Using legacy tree-walking interpreter")
+		}
+		fmt.Fprintln(out)
+	}
+
+	// Set up both engines, since :vm can switch between them
+	env := object.NewEnvironment()
+	evaluator.SetOutput(out)
+	vmachine := vm.NewVMWithOutput(out)
+	vmachine.SetOverflowMode(cfg.Overflow)
+	vmachine.Trace = cfg.Trace
 
 	for {
-		fmt.Fprint(out, PROMPT)
+		fmt.Fprint(out, cfg.Prompt)
 		if !scanner.Scan() {
 			return
 		}
@@ -115,6 +224,11 @@ func startREPL(in io.Reader, out io.Writer) {
 			continue
 		}
 
+		if strings.HasPrefix(line, ":") {
+			replCommand(line, out, &cfg)
+			continue
+		}
+
 		l := lexer.New(line)
 		p := parser.New(l)
 		program := p.ParseProgram()
@@ -124,7 +238,7 @@ func startREPL(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		if *useVM {
+		if cfg.UseVM {
 			// Use bytecode VM
 			comp := compiler.New()
 			chunk, err := comp.Compile(program)
@@ -135,7 +249,7 @@ func startREPL(in io.Reader, out io.Writer) {
 
 			result, err := vmachine.Run(chunk)
 			if err != nil {
-				fmt.Fprintf(out, "Runtime wahala: %s\n", err)
+				fmt.Fprintln(out, runtimeWahala(vmErrorLine(err)))
 				continue
 			}
 
@@ -147,7 +261,9 @@ func startREPL(in io.Reader, out io.Writer) {
 		} else {
 			// Use legacy tree-walking interpreter
 			evaluated := evaluator.Eval(program, env)
-			if evaluated != nil {
+			if errObj, ok := evaluated.(*object.Error); ok {
+				fmt.Fprintln(out, runtimeWahala(errObj.Message, errObj.Line))
+			} else if evaluated != nil {
 				// Don't print "nothing" for statements that don't return meaningful values
 				if evaluated.Type() != object.NOTHING_OBJ {
 					io.WriteString(out, evaluated.Inspect())
@@ -158,6 +274,119 @@ func startREPL(in io.Reader, out io.Writer) {
 	}
 }
 
+// ============================================================================
+// REPL Commands
+// ============================================================================
+
+const REPL_HELP = `Commands:
+  :ast CODE   Show how CODE parses
+  :vm on|off  Switch between the bytecode VM and the interpreter
+  :help       Show this list
+  comot       Leave the REPL`
+
+// replCommand runs a REPL line that starts with ':'
+func replCommand(line string, out io.Writer, cfg *replConfig) {
+	name, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+
+	switch name {
+	case ":help":
+		fmt.Fprintln(out, REPL_HELP)
+
+	case ":ast":
+		if rest == "" {
+			fmt.Fprintln(out, "Wahala! :ast need code wey e go parse")
+			return
+		}
+		p := parser.New(lexer.New(rest))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			printParserErrors(out, p.Errors())
+			return
+		}
+		fmt.Fprintln(out, program.String())
+		dumpAST(out, "", reflect.ValueOf(program), 0)
+
+	case ":vm":
+		switch rest {
+		case "on":
+			cfg.UseVM = true
+			fmt.Fprintln(out, "🚀 Using bytecode VM")
+		case "off":
+			cfg.UseVM = false
+			fmt.Fprintln(out, "⚠️  Using tree-walking interpreter")
+		default:
+			fmt.Fprintln(out, "Wahala! Na :vm on or :vm off")
+		}
+
+	default:
+		fmt.Fprintf(out, "Wahala! I no know command %s. Try :help\n", name)
+	}
+}
+
+// dumpAST prints a node and everything under it, one field per line, after
+// the given label. Tokens are left out since String() already shows the
+// source.
+func dumpAST(out io.Writer, label string, v reflect.Value, depth int) {
+	pad := strings.Repeat("  ", depth)
+	fmt.Fprint(out, pad, label)
+	if label != "" {
+		label = " "
+	}
+
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			fmt.Fprintln(out, label+"nil")
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		fmt.Fprintln(out, label+v.Type().String())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() || field.Name == "Token" {
+				continue
+			}
+			dumpAST(out, field.Name+":", v.Field(i), depth+1)
+		}
+
+	case reflect.Slice:
+		if v.Len() == 0 {
+			fmt.Fprintln(out, label+"[]")
+			return
+		}
+		fmt.Fprintln(out)
+		for i := 0; i < v.Len(); i++ {
+			dumpAST(out, "-", v.Index(i), depth+1)
+		}
+
+	case reflect.Map:
+		if v.Len() == 0 {
+			fmt.Fprintln(out, label+"{}")
+			return
+		}
+		// Sort by source text so the dump comes out the same every time
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		fmt.Fprintln(out)
+		for _, key := range keys {
+			dumpAST(out, "- key:", key, depth+1)
+			dumpAST(out, "  value:", v.MapIndex(key), depth+1)
+		}
+
+	case reflect.String:
+		fmt.Fprintf(out, "%s%q\n", label, v.String())
+
+	default:
+		fmt.Fprintf(out, "%s%v\n", label, v.Interface())
+	}
+}
+
 func runFile(filename string) {
 	content, err := os.ReadFile(filename)
 	if err != nil {
@@ -165,42 +394,301 @@ func runFile(filename string) {
 		os.Exit(1)
 	}
 
-	l := lexer.New(string(content))
-	p := parser.New(l)
+	// Saved bytecode skips straight to the VM
+	if strings.HasSuffix(filename, BYTECODE_SUFFIX) {
+		chunk, err := vm.DeserializeChunk(content)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Wahala! I no fit load bytecode: %s\n", err)
+			os.Exit(1)
+		}
+		message, line := runChunk(chunk, os.Stdin)
+		os.Exit(reportRuntimeError(message, line, os.Stderr))
+	}
+
+	os.Exit(runSource(string(content), *useVM, os.Stdin, os.Stderr))
+}
+
+// runSource parses and runs a whole program, the way a file or --eval runs,
+// and returns the exit code
+func runSource(source string, useVM bool, in io.Reader, stderr io.Writer) int {
+	program, ok := parseProgram(source, stderr)
+	if !ok {
+		return 1
+	}
+
+	return runProgram(program, useVM, in, stderr)
+}
+
+// parseProgram parses a whole program, printing any parse errors to stderr
+func parseProgram(source string, stderr io.Writer) (*ast.Program, bool) {
+	p := parser.New(lexer.New(source))
 	program := p.ParseProgram()
 
 	if len(p.Errors()) != 0 {
 		for _, msg := range p.Errors() {
-			fmt.Fprintln(os.Stderr, "Wahala:", msg)
+			fmt.Fprintln(stderr, "Wahala:", msg)
 		}
-		os.Exit(1)
+		return nil, false
 	}
+	return program, true
+}
 
-	if *useVM {
+// compileFile compiles the program in filename and saves its bytecode at
+// out, returning the exit code
+func compileFile(filename, out string, stderr io.Writer) int {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(stderr, "Wahala! I no fit read file: %s\n", err)
+		return 1
+	}
+
+	program, ok := parseProgram(string(content), stderr)
+	if !ok {
+		return 1
+	}
+
+	chunk, err := compiler.New().Compile(program)
+	if err != nil {
+		fmt.Fprintf(stderr, "Compile wahala: %s\n", err)
+		return 1
+	}
+
+	data, err := chunk.Serialize()
+	if err != nil {
+		fmt.Fprintf(stderr, "Wahala! I no fit save bytecode: %s\n", err)
+		return 1
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		fmt.Fprintf(stderr, "Wahala! I no fit write file: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runProgram runs a parsed program on the bytecode VM or the tree-walking
+// interpreter and returns the exit code. Both backends report a runtime
+// error the same way: one "Runtime wahala" line on stderr and exit code 1.
+func runProgram(program *ast.Program, useVM bool, in io.Reader, stderr io.Writer) int {
+	var message string
+	var line int
+
+	if *warnShadow {
+		printShadowWarnings(program, stderr)
+	}
+
+	if useVM {
 		// Use bytecode VM
 		comp := compiler.New()
 		chunk, err := comp.Compile(program)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Compile wahala: %s\n", err)
-			os.Exit(1)
+			fmt.Fprintf(stderr, "Compile wahala: %s\n", err)
+			return 1
 		}
 
-		vmachine := vm.NewVM()
-		_, err = vmachine.Run(chunk)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Runtime wahala: %s\n", err)
-			os.Exit(1)
-		}
+		message, line = runChunk(chunk, in)
 	} else {
 		// Use legacy tree-walking interpreter
 		env := object.NewEnvironment()
+		evaluator.SetOutput(os.Stdout)
 		evaluated := evaluator.Eval(program, env)
+		if evaluated == nil || evaluated.Type() != object.ERROR_OBJ {
+			evaluated = eachLineInterpreter(env, in)
+		}
 
-		if evaluated != nil && evaluated.Type() == object.ERROR_OBJ {
-			fmt.Fprintln(os.Stderr, evaluated.Inspect())
-			os.Exit(1)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			message, line = errObj.Message, errObj.Line
+		}
+	}
+
+	return reportRuntimeError(message, line, stderr)
+}
+
+// printShadowWarnings compiles program only to find parameters and locals
+// that hide an outer variable, so the check works with either backend
+func printShadowWarnings(program *ast.Program, stderr io.Writer) {
+	comp := compiler.New()
+	comp.WarnShadow()
+	comp.Compile(program)
+	for _, warning := range comp.Warnings() {
+		fmt.Fprintln(stderr, warning)
+	}
+}
+
+// runChunk runs compiled bytecode on the VM and returns the message and
+// line of the runtime error it stopped with, if any
+func runChunk(chunk *vm.Chunk, in io.Reader) (string, int) {
+	vmachine := vm.NewVM()
+	vmachine.SetOverflowMode(overflowMode)
+	vmachine.Trace = *trace
+	vmachine.RecoverErrors = *recoverErrs
+	result, err := vmachine.Run(chunk)
+	if err == nil && result.IsError() {
+		err = result.AsError()
+	}
+	if err == nil {
+		err = eachLineVM(vmachine, in)
+	}
+
+	if err == nil {
+		return "", 0
+	}
+	return vmErrorLine(err)
+}
+
+// vmErrorLine splits an error from the VM into its message and line, the
+// parts the interpreter's errors carry
+func vmErrorLine(err error) (string, int) {
+	var runtimeErr *vm.RuntimeError
+	if errors.As(err, &runtimeErr) {
+		return runtimeErr.Message, runtimeErr.Line
+	}
+	return err.Error(), 0
+}
+
+// runtimeWahala words a runtime error the way both backends report it,
+// with the line when it is known
+func runtimeWahala(message string, line int) string {
+	if line > 0 {
+		return fmt.Sprintf("Runtime wahala: %s [line %d]", message, line)
+	}
+	return "Runtime wahala: " + message
+}
+
+// reportRuntimeError prints a runtime error message, if there is one, and
+// returns the exit code
+func reportRuntimeError(message string, line int, stderr io.Writer) int {
+	if message != "" {
+		fmt.Fprintln(stderr, runtimeWahala(message, line))
+		return 1
+	}
+	return 0
+}
+
+// eachLineVM calls the program's each_line function, if it defined one,
+// with every line of in
+func eachLineVM(vmachine *vm.VM, in io.Reader) error {
+	fn, ok := vmachine.Global(EACH_LINE)
+	if !ok {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		// The VM keeps the line only while the program can still reach it
+		line := vmachine.MakeString(scanner.Text())
+		result, err := vmachine.Call(fn, line)
+		if err != nil {
+			return err
+		}
+		if result.IsError() {
+			return result.AsError()
+		}
+	}
+	return scanner.Err()
+}
+
+// eachLineInterpreter is eachLineVM for the tree-walking interpreter
+func eachLineInterpreter(env *object.Environment, in io.Reader) object.Object {
+	fn, ok := env.Get(EACH_LINE)
+	if !ok {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		result := evaluator.Apply(fn, &object.String{Value: scanner.Text()})
+		if result != nil && result.Type() == object.ERROR_OBJ {
+			return result
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return &object.Error{Message: fmt.Sprintf("I no fit read input: %s", err)}
+	}
+	return nil
+}
+
+// runTestDir runs the tests under dir, printing a line per file and a
+// summary to out, and returns the exit code: 1 if any test failed
+func runTestDir(dir string, useVM bool, out io.Writer) int {
+	passed, failed, err := runTests(dir, useVM, out)
+	if err != nil {
+		fmt.Fprintf(out, "Wahala! I no fit find tests: %s\n", err)
+		return 1
+	}
+
+	if passed+failed == 0 {
+		fmt.Fprintf(out, "No %s files inside %s\n", TEST_SUFFIX, dir)
+		return 0
+	}
+
+	fmt.Fprintf(out, "\n%d tests: %d pass, %d fail\n", passed+failed, passed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runTests runs every *_test.pdg file under dir on its own fresh VM or
+// environment. A file fails if it doesn't parse or stops with a runtime
+// error, which includes a failed assert. --recover is ignored here, so an
+// error can't turn into a value and let a broken test pass.
+func runTests(dir string, useVM bool, out io.Writer) (passed, failed int, err error) {
+	recovering := *recoverErrs
+	*recoverErrs = false
+	defer func() { *recoverErrs = recovering }()
+
+	var files []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, TEST_SUFFIX) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, path := range files {
+		name, _ := filepath.Rel(dir, path)
+		if problems := runTestFile(path, useVM); len(problems) > 0 {
+			failed++
+			fmt.Fprintf(out, "FAIL  %s\n", name)
+			for _, problem := range problems {
+				fmt.Fprintf(out, "      %s\n", problem)
+			}
+		} else {
+			passed++
+			fmt.Fprintf(out, "PASS  %s\n", name)
 		}
 	}
+	return passed, failed, nil
+}
+
+// runTestFile runs one test file and returns what went wrong, if anything
+func runTestFile(path string, useVM bool) []string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return []string{fmt.Sprintf("I no fit read file: %s", err)}
+	}
+
+	p := parser.New(lexer.New(string(content)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		problems := make([]string, len(p.Errors()))
+		for i, msg := range p.Errors() {
+			problems[i] = "Wahala: " + msg
+		}
+		return problems
+	}
+
+	var stderr strings.Builder
+	if runProgram(program, useVM, strings.NewReader(""), &stderr) != 0 {
+		return strings.Split(strings.TrimRight(stderr.String(), "\n"), "\n")
+	}
+	return nil
 }
 
 func printParserErrors(out io.Writer, errors []string) {
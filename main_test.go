@@ -0,0 +1,601 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"pidgin-lang/compiler"
+	"pidgin-lang/evaluator"
+	"pidgin-lang/object"
+	"pidgin-lang/vm"
+)
+
+// captureStdout returns everything fn prints to standard output
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- string(out)
+	}()
+
+	fn()
+	w.Close()
+	return <-done
+}
+
+// ============================================================================
+// each_line Tests
+// ============================================================================
+
+const eachLineProgram = `
+do each_line(line) {
+	yarn(len(line), ": ", line)
+}
+`
+
+const eachLineInput = "How far\nI dey\n\nwetin dey happen\n"
+
+const eachLineOutput = "7: How far\n5: I dey\n0: \n16: wetin dey happen\n"
+
+func TestEachLineVM(t *testing.T) {
+	program := parseSource(eachLineProgram).ParseProgram()
+	chunk, err := compiler.New().Compile(program)
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+
+	var out bytes.Buffer
+	vmachine := vm.NewVMWithOutput(&out)
+	if _, err := vmachine.Run(chunk); err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+	if err := eachLineVM(vmachine, strings.NewReader(eachLineInput)); err != nil {
+		t.Errorf("each_line error: %v", err)
+	}
+
+	if out.String() != eachLineOutput {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", eachLineOutput, out.String())
+	}
+}
+
+func TestEachLineVMKeepsLines(t *testing.T) {
+	// Enough lines for the VM to sweep the ones it no longer needs, while
+	// the one the program keeps in a global stays
+	program := parseSource(`make prev be ""
+do each_line(line) {
+	suppose len(prev) na 0 { prev be line }
+}`).ParseProgram()
+	chunk, err := compiler.New().Compile(program)
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+
+	vmachine := vm.NewVM()
+	if _, err := vmachine.Run(chunk); err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+
+	var input strings.Builder
+	for i := 1; i <= 5000; i++ {
+		fmt.Fprintf(&input, "line %d\n", i)
+	}
+	if err := eachLineVM(vmachine, strings.NewReader(input.String())); err != nil {
+		t.Fatalf("each_line error: %v", err)
+	}
+
+	runtime.GC()
+	prev, _ := vmachine.Global("prev")
+	if got := prev.String(); got != "line 1" {
+		t.Errorf("expected prev to be %q, got %q", "line 1", got)
+	}
+}
+
+func TestEachLineInterpreter(t *testing.T) {
+	program := parseSource(eachLineProgram).ParseProgram()
+	env := object.NewEnvironment()
+
+	var out bytes.Buffer
+	evaluator.SetOutput(&out)
+	defer evaluator.SetOutput(os.Stdout)
+
+	evaluator.Eval(program, env)
+	if result := eachLineInterpreter(env, strings.NewReader(eachLineInput)); result != nil {
+		t.Errorf("each_line error: %s", result.Inspect())
+	}
+
+	// The interpreter's yarn prints each argument on its own line
+	want := strings.Join([]string{
+		"7", ": ", "How far",
+		"5", ": ", "I dey",
+		"0", ": ", "",
+		"16", ": ", "wetin dey happen",
+	}, "\n") + "\n"
+	if out.String() != want {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", want, out.String())
+	}
+}
+
+func TestEachLineErrorStops(t *testing.T) {
+	program := parseSource("do each_line(line) { bring 1 / 0 }").ParseProgram()
+	chunk, err := compiler.New().Compile(program)
+	if err != nil {
+		t.Fatalf("compilation error: %v", err)
+	}
+
+	vmachine := vm.NewVM()
+	if _, err := vmachine.Run(chunk); err != nil {
+		t.Fatalf("execution error: %v", err)
+	}
+
+	if err := eachLineVM(vmachine, strings.NewReader("a\nb\n")); err == nil {
+		t.Error("expected division by zero error, got nil")
+	}
+}
+
+func TestNoEachLineLeavesInputAlone(t *testing.T) {
+	env := object.NewEnvironment()
+	evaluator.Eval(parseSource("make x be 1").ParseProgram(), env)
+
+	if result := eachLineInterpreter(env, strings.NewReader("unused\n")); result != nil {
+		t.Errorf("expected nothing to run, got %s", result.Inspect())
+	}
+}
+
+// ============================================================================
+// Error Parity Tests
+// ============================================================================
+
+func TestRunProgramErrorParity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // stderr from both backends
+	}{
+		{"1 / 0", "Runtime wahala: Omo! You no fit divide by zero o! [line 1]\n"},
+		{"10 % 0", "Runtime wahala: Omo! You no fit divide by zero o! [line 1]\n"},
+		{"type(1, 2)", "Runtime wahala: type wan make one argument, you give am 2 [line 1]\n"},
+		{"make x be 5\nyarn(x)\nx / 0\nyarn(x)", "Runtime wahala: Omo! You no fit divide by zero o! [line 3]\n"},
+		{"do each_line(line) { bring flip(1, 2) }", "Runtime wahala: flip wan make one argument, you give am 2 [line 1]\n"},
+		{"assert(1 na 2, \"one no be two\")", "Runtime wahala: Assert fail: one no be two [line 1]\n"},
+		{"assert(nothing)", "Runtime wahala: Assert fail [line 1]\n"},
+		{"assert()", "Runtime wahala: assert wan make condition and maybe message, you give am 0 argument [line 1]\n"},
+		// A closure can't read a count loop's variable once the loop is done
+		{"count i from 1 reach 3 { make f be do() { bring i } }\nyarn(f())", "Runtime wahala: I no sabi dis one: i [line 1]\n"},
+		{"do g() { count i from 1 reach 3 { make f be do() { bring i } } bring f }\ng()()", "Runtime wahala: I no sabi dis one: i [line 1]\n"},
+	}
+
+	for _, tt := range tests {
+		for _, useVM := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s/vm=%v", tt.input, useVM), func(t *testing.T) {
+				var stderr bytes.Buffer
+				var code int
+				captureStdout(t, func() {
+					code = runProgram(parseSource(tt.input).ParseProgram(), useVM, strings.NewReader("a line\n"), &stderr)
+				})
+
+				if code != 1 {
+					t.Errorf("expected exit code 1, got %d", code)
+				}
+				if stderr.String() != tt.expected {
+					t.Errorf("wrong stderr.\nwant=%q\ngot= %q", tt.expected, stderr.String())
+				}
+			})
+		}
+	}
+}
+
+func TestRunProgramSuccess(t *testing.T) {
+	for _, useVM := range []bool{true, false} {
+		var stderr bytes.Buffer
+		var code int
+		out := captureStdout(t, func() {
+			code = runProgram(parseSource(`yarn("how far")`).ParseProgram(), useVM, strings.NewReader(""), &stderr)
+		})
+
+		if code != 0 || stderr.Len() != 0 {
+			t.Errorf("vm=%v: expected a clean exit, got code %d and stderr %q", useVM, code, stderr.String())
+		}
+		if out != "how far\n" {
+			t.Errorf("vm=%v: wrong output %q", useVM, out)
+		}
+	}
+}
+
+func TestRunSource(t *testing.T) {
+	tests := []struct {
+		source string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{`yarn("hi")`, 0, "hi\n", ""},
+		{"make x be 2\nyarn(x * 21)", 0, "42\n", ""},
+		{"make be 1", 1, "", "Wahala: line 1:6: expected next token to be IDENT, got BE instead\nWahala: line 1:6: no prefix parse function for BE found\n"},
+		{"yarn(1 / 0)", 1, "", "Runtime wahala: Omo! You no fit divide by zero o! [line 1]\n"},
+	}
+
+	for _, tt := range tests {
+		for _, useVM := range []bool{true, false} {
+			t.Run(fmt.Sprintf("vm=%v/%s", useVM, tt.source), func(t *testing.T) {
+				var stderr bytes.Buffer
+				var code int
+				out := captureStdout(t, func() {
+					code = runSource(tt.source, useVM, strings.NewReader(""), &stderr)
+				})
+
+				if code != tt.code {
+					t.Errorf("expected exit code %d, got %d", tt.code, code)
+				}
+				if out != tt.stdout {
+					t.Errorf("expected stdout %q, got %q", tt.stdout, out)
+				}
+				if stderr.String() != tt.stderr {
+					t.Errorf("expected stderr %q, got %q", tt.stderr, stderr.String())
+				}
+			})
+		}
+	}
+}
+
+func TestRunSourceWarnShadow(t *testing.T) {
+	defer func(old bool) { *warnShadow = old }(*warnShadow)
+	*warnShadow = true
+
+	source := "make x be 1;\ndo f(x) {\n    bring x\n}\nyarn(f(2))"
+	for _, useVM := range []bool{true, false} {
+		var stderr bytes.Buffer
+		out := captureStdout(t, func() {
+			runSource(source, useVM, strings.NewReader(""), &stderr)
+		})
+
+		if out != "2\n" {
+			t.Errorf("vm=%v: expected stdout %q, got %q", useVM, "2\n", out)
+		}
+		if expected := "You dey shadow outer 'x' for line 2\n"; stderr.String() != expected {
+			t.Errorf("vm=%v: expected stderr %q, got %q", useVM, expected, stderr.String())
+		}
+	}
+}
+
+func TestRunSourceOverflowParity(t *testing.T) {
+	defer func(mode vm.OverflowMode) {
+		overflowMode = mode
+		evaluator.OverflowToFloat = mode == vm.OverflowFloat
+	}(overflowMode)
+
+	// 2^47 - 1 fits the VM's 48 bits, but twice it doesn't
+	source := "make x be 140737488355327\nyarn(x * 2)"
+	tests := []struct {
+		mode   vm.OverflowMode
+		code   int
+		stdout string
+		stderr string
+	}{
+		{vm.OverflowError, 1, "", "Runtime wahala: Number too big for Pidgin [line 2]\n"},
+		{vm.OverflowFloat, 0, "2.81474976710654e+14\n", ""},
+	}
+
+	for _, tt := range tests {
+		overflowMode = tt.mode
+		evaluator.OverflowToFloat = tt.mode == vm.OverflowFloat
+
+		for _, useVM := range []bool{true, false} {
+			var stderr bytes.Buffer
+			var code int
+			out := captureStdout(t, func() {
+				code = runSource(source, useVM, strings.NewReader(""), &stderr)
+			})
+
+			if code != tt.code {
+				t.Errorf("mode=%d vm=%v: expected exit code %d, got %d", tt.mode, useVM, tt.code, code)
+			}
+			if out != tt.stdout {
+				t.Errorf("mode=%d vm=%v: expected stdout %q, got %q", tt.mode, useVM, tt.stdout, out)
+			}
+			if stderr.String() != tt.stderr {
+				t.Errorf("mode=%d vm=%v: expected stderr %q, got %q", tt.mode, useVM, tt.stderr, stderr.String())
+			}
+		}
+	}
+}
+
+// ============================================================================
+// REPL Command Tests
+// ============================================================================
+
+// quietREPL is a REPL session on the VM without the banner
+var quietREPL = replConfig{Prompt: PROMPT, UseVM: true}
+
+func TestREPLCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"ast", ":ast 1 + 2\n", []string{
+			"(1 + 2)\n",
+			"Expression: ast.InfixExpression\n",
+			"Left: ast.IntegerLiteral\n",
+			`Operator: "+"`,
+		}},
+		{"ast parse error", ":ast (\n", []string{"Wahala! Parser don confuse:"}},
+		{"ast without code", ":ast\n", []string{"Wahala! :ast need code"}},
+		{"help", ":help\n", []string{":ast CODE", ":vm on|off"}},
+		{"vm off", ":vm off\nmake x be 2\nx * 21\n", []string{"tree-walking interpreter", "42\n"}},
+		{"vm on", ":vm on\n1 + 2\n", []string{"bytecode VM", "3\n"}},
+		{"vm bad", ":vm maybe\n", []string{"Wahala! Na :vm on or :vm off"}},
+		{"unknown", ":wetin\n", []string{"I no know command :wetin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			startREPL(strings.NewReader(tt.input), &out, quietREPL)
+
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("expected output to contain %q, got:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestREPLVMSwitch(t *testing.T) {
+	// Arrays only run in the interpreter, so each line shows which one ran it
+	var out bytes.Buffer
+	startREPL(strings.NewReader(":vm off\n[1, 2]\n:vm on\n[1, 2]\n"), &out, quietREPL)
+
+	interpreted := strings.Index(out.String(), "[1, 2]\n")
+	compiled := strings.Index(out.String(), "Compile wahala")
+	if interpreted < 0 || compiled < interpreted {
+		t.Errorf("expected :vm off then :vm on to switch engines, got:\n%s", out.String())
+	}
+}
+
+func TestREPLRuntimeError(t *testing.T) {
+	// Both engines report a runtime error the way a file run does
+	var out bytes.Buffer
+	startREPL(strings.NewReader("1 / 0\n:vm off\n1 / 0\n"), &out, quietREPL)
+
+	wahala := "Runtime wahala: Omo! You no fit divide by zero o! [line 1]\n"
+	want := PROMPT + wahala + PROMPT + "⚠️  Using tree-walking interpreter\n" + PROMPT + wahala + PROMPT
+	if out.String() != want {
+		t.Errorf("wrong output.\nwant=%q\ngot= %q", want, out.String())
+	}
+}
+
+func TestREPLPromptAndBanner(t *testing.T) {
+	cfg := quietREPL
+	cfg.Prompt = "abeg> "
+
+	var out bytes.Buffer
+	startREPL(strings.NewReader("1 + 2\n"), &out, cfg)
+	if expected := "abeg> 3\nabeg> "; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+
+	cfg.Banner = true
+	out.Reset()
+	startREPL(strings.NewReader(""), &out, cfg)
+	if !strings.HasPrefix(out.String(), WELCOME) || !strings.HasSuffix(out.String(), "abeg> ") {
+		t.Errorf("expected the banner then the prompt, got:\n%s", out.String())
+	}
+}
+
+func TestREPLConfigFromFlags(t *testing.T) {
+	defer func(old string) { *prompt = old }(*prompt)
+	defer func(old bool) { *noBanner = old }(*noBanner)
+
+	var env map[string]string
+	getenv := func(name string) string { return env[name] }
+
+	tests := []struct {
+		name       string
+		flagPrompt string
+		flagQuiet  bool
+		env        map[string]string
+		prompt     string
+		banner     bool
+	}{
+		{"defaults", "", false, nil, PROMPT, true},
+		{"flags", "abeg> ", true, nil, "abeg> ", false},
+		{"environment", "", false, map[string]string{"PIDGIN_PROMPT": "oya> ", "PIDGIN_NO_BANNER": "1"}, "oya> ", false},
+		{"flag beats environment", "abeg> ", false, map[string]string{"PIDGIN_PROMPT": "oya> "}, "abeg> ", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*prompt, *noBanner, env = tt.flagPrompt, tt.flagQuiet, tt.env
+			cfg := replConfigFromFlags(getenv)
+			if cfg.Prompt != tt.prompt || cfg.Banner != tt.banner {
+				t.Errorf("expected prompt %q and banner %t, got %q and %t", tt.prompt, tt.banner, cfg.Prompt, cfg.Banner)
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Test Runner Tests
+// ============================================================================
+
+func TestRunTests(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"math_test.pdg":       "assert(1 + 1 na 2)\nassert(3 big pass 2, \"three big pass two\")",
+		"sub/len_test.pdg":    "assert(len(\"abc\") na 4, \"len be wrong\")",
+		"crash_test.pdg":      "make x be 1 / 0",
+		"syntax_test.pdg":     "make x be",
+		"helper.pdg":          "assert(lie)", // not a test file, so never run
+		"sub/nested_test.pdg": "do double(n) { bring n * 2 }\nassert(double(4) na 8)",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := strings.Join([]string{
+		"FAIL  crash_test.pdg",
+		"      Runtime wahala: Omo! You no fit divide by zero o! [line 1]",
+		"PASS  math_test.pdg",
+		"FAIL  sub/len_test.pdg",
+		"      Runtime wahala: Assert fail: len be wrong [line 1]",
+		"PASS  sub/nested_test.pdg",
+		"FAIL  syntax_test.pdg",
+		"      Wahala: line 1:10: no prefix parse function for EOF found",
+	}, "\n") + "\n"
+
+	for _, useVM := range []bool{true, false} {
+		t.Run(fmt.Sprintf("vm=%v", useVM), func(t *testing.T) {
+			var out bytes.Buffer
+			passed, failed, err := runTests(dir, useVM, &out)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if passed != 2 || failed != 3 {
+				t.Errorf("expected 2 passed and 3 failed, got %d and %d", passed, failed)
+			}
+			if out.String() != expected {
+				t.Errorf("wrong report.\nwant=%q\ngot= %q", expected, out.String())
+			}
+		})
+	}
+}
+
+func TestRunTestsIgnoresRecover(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a_test.pdg"), []byte("assert(1 na 2, \"x\")\nyarn(\"done\")"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	*recoverErrs = true
+	defer func() { *recoverErrs = false }()
+
+	var out bytes.Buffer
+	if code := runTestDir(dir, true, &out); code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.HasPrefix(out.String(), "FAIL  a_test.pdg\n      Runtime wahala: Assert fail: x [line 1]\n") {
+		t.Errorf("expected the test to fail, got %q", out.String())
+	}
+	if !*recoverErrs {
+		t.Errorf("expected --recover to be left as it was")
+	}
+}
+
+func TestRunTestDirExitCode(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ok_test.pdg"), []byte("assert(tru)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if code := runTestDir(dir, true, &out); code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+	if !strings.HasSuffix(out.String(), "1 tests: 1 pass, 0 fail\n") {
+		t.Errorf("wrong summary: %q", out.String())
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "bad_test.pdg"), []byte("assert(lie)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if code := runTestDir(dir, true, &out); code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+}
+
+// ============================================================================
+// Bytecode File Tests
+// ============================================================================
+
+func TestCompileFile(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "hello.pdg")
+	saved := filepath.Join(dir, "hello"+BYTECODE_SUFFIX)
+	program := "do greet(who) { bring \"How far, \" + who }\nyarn(greet(\"Ada\"))"
+	if err := os.WriteFile(source, []byte(program), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	if code := compileFile(source, saved, &stderr); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr.String())
+	}
+
+	data, err := os.ReadFile(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk, err := vm.DeserializeChunk(data)
+	if err != nil {
+		t.Fatalf("saved file doesn't load: %v", err)
+	}
+
+	var message string
+	out := captureStdout(t, func() {
+		message, _ = runChunk(chunk, strings.NewReader(""))
+	})
+	if message != "" {
+		t.Errorf("unexpected runtime error: %s", message)
+	}
+	if out != "How far, Ada\n" {
+		t.Errorf("wrong output %q", out)
+	}
+}
+
+func TestCompileFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"parse error", "make be 1", "Wahala: "},
+		{"compile error", "undefined_var", "Compile wahala: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := filepath.Join(dir, "bad.pdg")
+			saved := filepath.Join(dir, "bad"+BYTECODE_SUFFIX)
+			if err := os.WriteFile(source, []byte(tt.source), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var stderr bytes.Buffer
+			if code := compileFile(source, saved, &stderr); code != 1 {
+				t.Errorf("expected exit code 1, got %d", code)
+			}
+			if !strings.HasPrefix(stderr.String(), tt.expected) {
+				t.Errorf("expected stderr to start with %q, got %q", tt.expected, stderr.String())
+			}
+			if _, err := os.Stat(saved); err == nil {
+				t.Error("expected no bytecode file to be written")
+			}
+		})
+	}
+}
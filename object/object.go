@@ -3,6 +3,8 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"hash/fnv"
+	"strconv"
 	"strings"
 
 	"pidgin-lang/ast"
@@ -12,6 +14,7 @@ type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	STRING_OBJ       = "STRING"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NOTHING_OBJ      = "NOTHING"
@@ -19,6 +22,11 @@ const (
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	BUILTIN_OBJ      = "BUILTIN"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	BUILDER_OBJ      = "BUILDER"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 )
 
 // Object is the interface all values must implement
@@ -31,6 +39,13 @@ type Object interface {
 // Primitive Types
 // =============================================================================
 
+// Integers are limited to 48 bits, the payload of the VM's NaN-boxed
+// values, so both backends overflow at the same place
+const (
+	MAX_INT_48 = 140737488355327  // 2^47 - 1
+	MIN_INT_48 = -140737488355328 // -2^47
+)
+
 // Integer represents an integer value
 type Integer struct {
 	Value int64
@@ -39,6 +54,21 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+// Float represents a floating-point value
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	// Keep whole floats looking like floats so 4.0 doesn't print as 4
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
 // String represents a string value
 type String struct {
 	Value string
@@ -66,6 +96,98 @@ type Nothing struct{}
 func (n *Nothing) Type() ObjectType { return NOTHING_OBJ }
 func (n *Nothing) Inspect() string  { return "nothing" }
 
+// =============================================================================
+// Collections
+// =============================================================================
+
+// Array represents an ordered list of values
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	elements := []string{}
+	for _, el := range a.Elements {
+		elements = append(elements, el.Inspect())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashKey identifies a hash key by type and value, so 1 and "1" differ
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by values that can be used as hash keys
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+// HashPair keeps the original key object next to its value
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash maps keys to values, remembering the order keys were first added in
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Order []HashKey
+}
+
+// NewHash creates an empty hash
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+// Set adds or replaces the value for key
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if _, exists := h.Pairs[hashKey]; !exists {
+		h.Order = append(h.Order, hashKey)
+	}
+	h.Pairs[hashKey] = HashPair{Key: key.(Object), Value: value}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	pairs := []string{}
+	for _, hashKey := range h.Order {
+		pair := h.Pairs[hashKey]
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Builder collects pieces of a string. Adding to it changes it in place, so
+// a string built a piece at a time is copied once instead of every time.
+type Builder struct {
+	Builder strings.Builder
+}
+
+func (b *Builder) Type() ObjectType { return BUILDER_OBJ }
+func (b *Builder) Inspect() string  { return "builder" }
+
 // =============================================================================
 // Special Types
 // =============================================================================
@@ -78,9 +200,22 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Break signals a comot making its way out to the nearest loop
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "comot" }
+
+// Continue signals a kontinu making its way out to the nearest loop
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "kontinu" }
+
 // Error represents a runtime error
 type Error struct {
 	Message string
+	Line    int // source line the error came from, 0 if not known
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
@@ -94,6 +229,7 @@ func (e *Error) Inspect() string  { return "Wahala: " + e.Message }
 type Function struct {
 	Name       string
 	Parameters []*ast.Identifier
+	ReturnType string // declared return type, empty if not annotated
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
@@ -113,7 +249,11 @@ func (f *Function) Inspect() string {
 	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") {\n")
+	out.WriteString(") ")
+	if f.ReturnType != "" {
+		out.WriteString("bring " + f.ReturnType + " ")
+	}
+	out.WriteString("{\n")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n}")
 
@@ -167,4 +307,28 @@ func (e *Environment) Get(name string) (Object, bool) {
 func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
-}
\ No newline at end of file
+}
+
+// Assign changes an existing variable in whichever scope defines it.
+// It reports false if the variable was never defined.
+func (e *Environment) Assign(name string, val Object) (Object, bool) {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		return val, true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return nil, false
+}
+
+// GetLocal retrieves a variable from this environment only, ignoring outer scopes
+func (e *Environment) GetLocal(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	return obj, ok
+}
+
+// Delete removes a variable from this environment
+func (e *Environment) Delete(name string) {
+	delete(e.store, name)
+}
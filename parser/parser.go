@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"pidgin-lang/ast"
 	"pidgin-lang/lexer"
@@ -13,7 +14,7 @@ import (
 const (
 	_ int = iota
 	LOWEST
-	OR          // abi (when used as or)
+	OR          // abi, or
 	AND         // and
 	EQUALS      // be, na
 	LESSGREATER // big pass, no reach
@@ -31,13 +32,19 @@ var precedences = map[token.TokenType]int{
 	token.BIG:      LESSGREATER, // for "big pass"
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.LTE:      LESSGREATER,
+	token.GTE:      LESSGREATER,
+	token.REACH:    LESSGREATER, // for "reach" (>=)
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.PERCENT:  PRODUCT,
 	token.AND:      AND,
 	token.ABI:      OR,
+	token.OR:       OR,
 	token.LPAREN:   CALL,
+	token.LBRACKET: CALL,
 }
 
 // Parser holds the state for parsing tokens into an AST
@@ -48,8 +55,20 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 
+	// Where curToken and peekToken end, just past their last character
+	curEnd  ast.Position
+	peekEnd ast.Position
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// Expressions that were written in parentheses, which never chain
+	// with a comparison outside them
+	grouped map[ast.Expression]bool
+
+	// How many loops enclose the current statement, so comot and
+	// kontinu outside a loop can be reported while parsing
+	loopDepth int
 }
 
 type (
@@ -62,12 +81,15 @@ func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
 		errors: []string{},
+
+		grouped: make(map[ast.Expression]bool),
 	}
 
 	// Register prefix parse functions
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.TRU, p.parseBoolean)
 	p.registerPrefix(token.LIE, p.parseBoolean)
@@ -79,22 +101,32 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.SUPPOSE, p.parseSupposeExpression)
 	p.registerPrefix(token.DEY, p.parseWhileExpression)
 	p.registerPrefix(token.DO, p.parseDoExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.YARN, p.parseYarnExpression)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
 	// Register infix parse functions
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
 	p.registerInfix(token.BE, p.parseInfixExpression)
 	p.registerInfix(token.NA, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LTE, p.parseInfixExpression)
+	p.registerInfix(token.GTE, p.parseInfixExpression)
 	p.registerInfix(token.BIG, p.parseCompoundComparison)   // big pass
 	p.registerInfix(token.NO, p.parseCompoundComparison)    // no reach
+	p.registerInfix(token.REACH, p.parseCompoundComparison) // reach
 	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.ABI, p.parseInfixExpression) // abi between two values is 'or'
+	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
 	// Read two tokens to initialize curToken and peekToken
 	p.nextToken()
@@ -113,7 +145,29 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
+	p.curEnd = p.peekEnd
 	p.peekToken = p.l.NextToken()
+	p.peekEnd.Line, p.peekEnd.Column = p.l.Position()
+}
+
+// startOf gives the position of a token's first character
+func startOf(tok token.Token) ast.Position {
+	return ast.Position{Line: tok.Line, Column: tok.Column}
+}
+
+// finish gives node the span from start to the end of the current token.
+// A node that failed to parse is left alone.
+func (p *Parser) finish(node ast.Node, start ast.Position) {
+	if node, ok := node.(interface{ SetSpan(start, end ast.Position) }); ok {
+		node.SetSpan(start, p.curEnd)
+	}
+}
+
+// curIdentifier builds an identifier from the current token
+func (p *Parser) curIdentifier() *ast.Identifier {
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.finish(ident, startOf(p.curToken))
+	return ident
 }
 
 func (p *Parser) curTokenIs(t token.TokenType) bool {
@@ -153,14 +207,20 @@ func (p *Parser) Errors() []string {
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("line %d: expected next token to be %s, got %s instead",
-		p.peekToken.Line, t, p.peekToken.Type)
+	msg := fmt.Sprintf("line %d:%d: expected next token to be %s, got %s instead",
+		p.peekToken.Line, p.peekToken.Column, t, p.peekToken.Type)
 	p.errors = append(p.errors, msg)
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("line %d: no prefix parse function for %s found",
-		p.curToken.Line, t)
+	if t == token.ILLEGAL {
+		// The lexer didn't know the character, so name it instead of the token type
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d: I no understand dis character '%s'",
+			p.curToken.Line, p.curToken.Column, p.curToken.Literal))
+		return
+	}
+	msg := fmt.Sprintf("line %d:%d: no prefix parse function for %s found",
+		p.curToken.Line, p.curToken.Column, t)
 	p.errors = append(p.errors, msg)
 }
 
@@ -169,14 +229,22 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
+	// The program spans everything its statements were parsed from
+	start := startOf(p.curToken)
 	for !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
+			p.finish(program, start)
 		}
 		p.nextToken()
 	}
 
+	// Lexer errors come first since they usually explain any parse errors after them
+	if lexErrors := p.l.Errors(); len(lexErrors) > 0 {
+		p.errors = append(append([]string{}, lexErrors...), p.errors...)
+	}
+
 	return program
 }
 
@@ -186,6 +254,14 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseMakeStatement()
 	case token.BRING:
 		return p.parseBringStatement()
+	case token.COMOT, token.KONTINU:
+		return p.parseLoopControlStatement()
+	case token.IDENT:
+		// A statement starting 'x be' changes x; anywhere else 'be' compares
+		if p.peekTokenIs(token.BE) {
+			return p.parseAssignStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -199,18 +275,58 @@ func (p *Parser) parseMakeStatement() *ast.MakeStatement {
 		return nil
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Name = p.curIdentifier()
 
 	// Expect 'be' or 'na' after identifier
 	if !p.peekTokenIs(token.BE) && !p.peekTokenIs(token.NA) {
-		p.errors = append(p.errors, fmt.Sprintf("line %d: expected 'be' or 'na' after variable name, got %s",
-			p.peekToken.Line, p.peekToken.Type))
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d: expected 'be' or 'na' after variable name, got %s",
+			p.peekToken.Line, p.peekToken.Column, p.peekToken.Type))
 		return nil
 	}
 	p.nextToken()
 
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
+	p.finish(stmt, startOf(stmt.Token))
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseAssignStatement parses: x be x + 1
+func (p *Parser) parseAssignStatement() *ast.AssignStatement {
+	stmt := &ast.AssignStatement{Token: p.curToken}
+	stmt.Name = p.curIdentifier()
+
+	p.nextToken()
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	p.finish(stmt, startOf(stmt.Token))
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseLoopControlStatement parses: comot or kontinu
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.curToken
+	if p.loopDepth == 0 {
+		p.errors = append(p.errors, fmt.Sprintf(
+			"line %d:%d: '%s' fit only dey inside loop", tok.Line, tok.Column, tok.Literal))
+		return nil
+	}
+
+	var stmt ast.Statement = &ast.ContinueStatement{Token: tok}
+	if tok.Type == token.COMOT {
+		stmt = &ast.BreakStatement{Token: tok}
+	}
+	p.finish(stmt, startOf(tok))
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -225,6 +341,7 @@ func (p *Parser) parseBringStatement() *ast.BringStatement {
 
 	p.nextToken()
 	stmt.ReturnValue = p.parseExpression(LOWEST)
+	p.finish(stmt, startOf(stmt.Token))
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -236,6 +353,7 @@ func (p *Parser) parseBringStatement() *ast.BringStatement {
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.parseExpression(LOWEST)
+	p.finish(stmt, startOf(stmt.Token))
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -250,32 +368,58 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		p.noPrefixParseFnError(p.curToken.Type)
 		return nil
 	}
+	// Every expression built here, including a grouped one's parentheses
+	// and each operator applied to it, starts where its first token does
+	start := startOf(p.curToken)
 	leftExp := prefix()
+	p.finish(leftExp, start)
 
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
 		}
+		// A '[' at the start of a line begins a new array, not an index
+		if p.peekTokenIs(token.LBRACKET) && p.peekToken.Line != p.curToken.Line {
+			return leftExp
+		}
 		p.nextToken()
 		leftExp = infix(leftExp)
+		p.finish(leftExp, start)
 	}
 
 	return leftExp
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	// 'count' only starts a loop when a variable name follows it, so
+	// programs can still use count as an ordinary variable
+	if p.curToken.Literal == "count" && p.peekTokenIs(token.IDENT) {
+		return p.parseForExpression()
+	}
+	return p.curIdentifier()
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
+	// Base 0 understands 0x/0b/0o prefixes and underscores between digits
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("line %d: could not parse %q as integer",
-			p.curToken.Line, p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.numberError("integer")
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.numberError("float")
 		return nil
 	}
 
@@ -283,6 +427,17 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// numberError reports a number literal that strconv rejected, calling out
+// misplaced digit separators since those are the usual cause
+func (p *Parser) numberError(kind string) {
+	msg := fmt.Sprintf("line %d: could not parse %q as %s",
+		p.curToken.Line, p.curToken.Literal, kind)
+	if strings.Contains(p.curToken.Literal, "_") {
+		msg += " ('_' fit only dey between two digits)"
+	}
+	p.errors = append(p.errors, msg)
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -324,7 +479,7 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
-	return expression
+	return p.chainComparison(expression)
 }
 
 // parseCompoundComparison handles "big pass" and "no reach"
@@ -344,12 +499,114 @@ func (p *Parser) parseCompoundComparison(left ast.Expression) ast.Expression {
 			return nil
 		}
 		expression.Operator = "no reach"
+	} else if p.curTokenIs(token.REACH) {
+		expression.Operator = "reach"
 	}
 
 	p.nextToken()
 	expression.Right = p.parseExpression(LESSGREATER)
 
-	return expression
+	return p.chainComparison(expression)
+}
+
+// orderingOperators are the comparisons that can be chained
+var orderingOperators = map[string]bool{
+	"<": true, ">": true, "<=": true, ">=": true,
+	"big pass": true, "no reach": true, "reach": true,
+}
+
+// chainComparison desugars a chained comparison like 1 no reach x no reach 10
+// into (1 no reach x) and (x no reach 10). The middle operand appears in
+// both comparisons. A variable or literal is simply read twice; anything
+// else is worked out once into a hidden variable the second comparison
+// reads, so 1 < next() < 10 calls next a single time. The result is a
+// ChainExpression, so a longer chain like a < b < c < d keeps extending
+// the same one.
+func (p *Parser) chainComparison(expression *ast.InfixExpression) ast.Expression {
+	if !orderingOperators[expression.Operator] || expression.Right == nil {
+		return expression
+	}
+	if p.grouped[expression.Left] {
+		return expression
+	}
+
+	// The comparison we are chaining onto: either a plain comparison or
+	// the last link of a chain we already desugared
+	var scope *ast.ChainExpression
+	var left, previous *ast.InfixExpression
+	switch operand := expression.Left.(type) {
+	case *ast.ChainExpression:
+		scope, left = operand, operand.Chain
+		previous = left.Right.(*ast.InfixExpression)
+	case *ast.InfixExpression:
+		if !orderingOperators[operand.Operator] {
+			return expression
+		}
+		scope = &ast.ChainExpression{Token: operand.Token}
+		left, previous = operand, operand
+	default:
+		return expression
+	}
+
+	// The operand before this comparison didn't parse, and already said so
+	if previous.Right == nil {
+		return expression
+	}
+
+	middle := previous.Right
+	if !isSimpleOperand(middle) {
+		middle = p.bindOperand(previous)
+	}
+
+	link := &ast.InfixExpression{
+		Token:    expression.Token,
+		Operator: expression.Operator,
+		Left:     middle,
+		Right:    expression.Right,
+	}
+	p.finish(link, middle.NodeSpan().Start)
+
+	chain := &ast.InfixExpression{
+		Token:    token.Token{Type: token.AND, Literal: "and", Line: expression.Token.Line, Column: expression.Token.Column},
+		Operator: "and",
+		Left:     left,
+		Right:    link,
+	}
+	p.finish(chain, left.NodeSpan().Start)
+	scope.Chain = chain
+
+	return scope
+}
+
+// bindOperand makes comparison keep its right operand in a hidden variable
+// as it works it out, and returns that variable for the next comparison in
+// the chain to read. The name can't clash since '@' can't appear in one.
+func (p *Parser) bindOperand(comparison *ast.InfixExpression) *ast.Identifier {
+	value := comparison.Right
+	span := value.NodeSpan()
+	name := fmt.Sprintf("chain@%d:%d", span.Start.Line, span.Start.Column)
+
+	hidden := &ast.Identifier{Token: comparison.Token, Value: name}
+	hidden.SetSpan(span.Start, span.End)
+
+	bind := &ast.BindExpression{Token: comparison.Token, Name: hidden, Value: value}
+	bind.SetSpan(span.Start, span.End)
+	comparison.Right = bind
+
+	return hidden
+}
+
+// isSimpleOperand reports whether evaluating exp has no side effects
+func isSimpleOperand(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral,
+		*ast.Boolean, *ast.NothingLiteral:
+		return true
+	case *ast.PrefixExpression:
+		return exp.Operator == "-" && isSimpleOperand(exp.Right)
+	default:
+		return false
+	}
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
@@ -361,6 +618,9 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 		return nil
 	}
 
+	if exp != nil {
+		p.grouped[exp] = true
+	}
 	return exp
 }
 
@@ -394,36 +654,167 @@ func (p *Parser) parseSupposeExpression() ast.Expression {
 func (p *Parser) parseWhileExpression() ast.Expression {
 	expression := &ast.WhileExpression{Token: p.curToken}
 
-	// Expect 'do' after 'dey'
-	if !p.expectPeek(token.DO) {
+	// Beginners often drop one of the three keywords. Say what the loop
+	// should look like, then carry on as if it was there so the rest of
+	// the loop doesn't pile up confusing errors.
+	missing := false
+	if p.peekTokenIs(token.DO) {
+		p.nextToken()
+	} else {
+		missing = true
+	}
+	if p.peekTokenIs(token.WHILE) {
+		p.nextToken()
+	} else {
+		missing = true
+	}
+	if missing {
+		p.loopKeywordError(expression.Token)
+	}
+
+	return p.parseWhileConditionAndBody(expression)
+}
+
+// parseWhileConditionAndBody parses the rest of a loop after 'dey do while'
+func (p *Parser) parseWhileConditionAndBody(expression *ast.WhileExpression) ast.Expression {
+	p.nextToken()
+	expression.Condition = p.parseExpression(LOWEST)
+
+	if !p.peekTokenIs(token.LBRACE) {
+		p.errors = append(p.errors, fmt.Sprintf(
+			"line %d:%d: Loop body suppose start with '{' after the condition, got %s",
+			p.peekToken.Line, p.peekToken.Column, p.peekToken.Type))
 		return nil
 	}
+	p.nextToken()
 
-	// Expect 'while' after 'do'
-	if !p.expectPeek(token.WHILE) {
+	expression.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.OTHERWISE) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		// Not part of the loop, so comot here leaves an outer loop
+		expression.Otherwise = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
+// parseForExpression parses: count i from 1 reach 10 { ... }
+func (p *Parser) parseForExpression() ast.Expression {
+	expression := &ast.ForExpression{Token: p.curToken}
+
+	p.nextToken()
+	expression.Variable = p.curIdentifier()
+
+	if !p.peekTokenIs(token.IDENT) || p.peekToken.Literal != "from" {
+		p.countShapeError(p.peekToken)
 		return nil
 	}
+	p.nextToken()
 
+	// Stop before 'reach' so it isn't read as a comparison
 	p.nextToken()
-	expression.Condition = p.parseExpression(LOWEST)
+	expression.From = p.parseExpression(LESSGREATER)
 
-	if !p.expectPeek(token.LBRACE) {
+	if !p.peekTokenIs(token.REACH) {
+		p.countShapeError(p.peekToken)
 		return nil
 	}
+	p.nextToken()
+
+	p.nextToken()
+	expression.To = p.parseExpression(LOWEST)
 
+	if !p.peekTokenIs(token.LBRACE) {
+		p.errors = append(p.errors, fmt.Sprintf(
+			"line %d:%d: Loop body suppose start with '{' after the count, got %s",
+			p.peekToken.Line, p.peekToken.Column, p.peekToken.Type))
+		return nil
+	}
+	p.nextToken()
+
+	expression.Body = p.parseLoopBody()
+
+	return expression
+}
+
+// parseLoopBody parses a loop's block, where comot and kontinu are allowed
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseBlockStatement()
+}
+
+// countShapeError reports a count loop missing its 'from' or 'reach'
+func (p *Parser) countShapeError(tok token.Token) {
+	p.errors = append(p.errors, fmt.Sprintf(
+		"line %d:%d: Count loop suppose look like 'count i from 1 reach 10', got %s",
+		tok.Line, tok.Column, tok.Type))
+}
+
+// loopKeywordError reports a loop that doesn't start with 'dey do while'
+func (p *Parser) loopKeywordError(tok token.Token) {
+	p.errors = append(p.errors, fmt.Sprintf(
+		"line %d:%d: Loop suppose start with 'dey do while'", tok.Line, tok.Column))
+}
+
+// parseTryExpression parses: try { ... } rescue err { ... }
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
 	expression.Body = p.parseBlockStatement()
 
+	if !p.peekTokenIs(token.RESCUE) {
+		p.tryShapeError(p.peekToken)
+		return nil
+	}
+	p.nextToken()
+
+	if !p.peekTokenIs(token.IDENT) {
+		p.tryShapeError(p.peekToken)
+		return nil
+	}
+	p.nextToken()
+	expression.Name = p.curIdentifier()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Rescue = p.parseBlockStatement()
+
 	return expression
 }
 
+// tryShapeError reports a try missing its 'rescue' or the name after it
+func (p *Parser) tryShapeError(tok token.Token) {
+	p.errors = append(p.errors, fmt.Sprintf(
+		"line %d:%d: Try suppose look like 'try { ... } rescue err { ... }', got %s",
+		tok.Line, tok.Column, tok.Type))
+}
+
 // parseDoExpression parses function definition: do name(params) { body }
 func (p *Parser) parseDoExpression() ast.Expression {
 	expression := &ast.DoExpression{Token: p.curToken}
 
+	// 'do while' is a loop missing its 'dey'
+	if p.peekTokenIs(token.WHILE) {
+		p.loopKeywordError(p.curToken)
+		p.nextToken()
+		return p.parseWhileConditionAndBody(&ast.WhileExpression{Token: p.curToken})
+	}
+
 	// Check if next token is an identifier (named function)
 	if p.peekTokenIs(token.IDENT) {
 		p.nextToken()
-		expression.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		expression.Name = p.curIdentifier()
 	}
 
 	if !p.expectPeek(token.LPAREN) {
@@ -432,11 +823,27 @@ func (p *Parser) parseDoExpression() ast.Expression {
 
 	expression.Parameters = p.parseFunctionParameters()
 
+	// Optional return type: do name(params) bring number { body }
+	if p.peekTokenIs(token.BRING) {
+		p.nextToken()
+		if !p.peekTokenIs(token.IDENT) && !p.peekTokenIs(token.NOTHING) {
+			p.errors = append(p.errors, fmt.Sprintf("line %d: expected return type after 'bring', got %s",
+				p.peekToken.Line, p.peekToken.Type))
+			return nil
+		}
+		p.nextToken()
+		expression.ReturnType = p.curIdentifier()
+	}
+
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
+	// comot and kontinu can't reach through a function to an outer loop
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	expression.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 
 	return expression
 }
@@ -451,13 +858,13 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 
 	p.nextToken()
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident := p.curIdentifier()
 	identifiers = append(identifiers, ident)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken() // skip comma
 		p.nextToken() // move to next identifier
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		ident := p.curIdentifier()
 		identifiers = append(identifiers, ident)
 	}
 
@@ -471,7 +878,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 // parseYarnExpression parses: yarn("message") or yarn(expression)
 func (p *Parser) parseYarnExpression() ast.Expression {
 	// Treat yarn as an identifier so it can be called
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident := p.curIdentifier()
 
 	if !p.peekTokenIs(token.LPAREN) {
 		return ident
@@ -488,6 +895,60 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	return exp
 }
 
+// parseArrayLiteral parses: [1, 2, 3]
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	return array
+}
+
+// parseHashLiteral parses: {"key": value, ...}
+// Blocks are only ever parsed straight after suppose, abi, a loop condition
+// or a function's parameters, so a '{' anywhere an expression is expected
+// can only start a hash.
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken, Pairs: make(map[ast.Expression]ast.Expression)}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Keys = append(hash.Keys, key)
+		hash.Pairs[key] = value
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return hash
+}
+
+// parseIndexExpression parses: arr[0]
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	list := []ast.Expression{}
 
@@ -525,6 +986,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	p.finish(block, startOf(block.Token))
 
 	return block
 }
\ No newline at end of file
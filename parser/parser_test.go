@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"pidgin-lang/ast"
@@ -44,6 +46,98 @@ func TestMakeStatements(t *testing.T) {
 	}
 }
 
+func TestAssignStatements(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      string
+	}{
+		{"x be 5", "x", "5"},
+		{"counter be counter + 1", "counter", "(counter + 1)"},
+		{"count be count + 1", "count", "(count + 1)"},
+		{"name be \"Chidi\";", "name", "\"Chidi\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			if len(program.Statements) != 1 {
+				t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+					len(program.Statements))
+			}
+
+			stmt, ok := program.Statements[0].(*ast.AssignStatement)
+			if !ok {
+				t.Fatalf("stmt is not *ast.AssignStatement. got=%T", program.Statements[0])
+			}
+			if stmt.Name.Value != tt.expectedIdentifier {
+				t.Errorf("stmt.Name.Value not '%s'. got=%s", tt.expectedIdentifier, stmt.Name.Value)
+			}
+			if got := stmt.Value.String(); got != tt.expectedValue {
+				t.Errorf("stmt.Value is %q, want %q", got, tt.expectedValue)
+			}
+		})
+	}
+}
+
+func TestDeclarationVersusAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // statement type for each line
+	}{
+		{"make x be 1\nx be 2", []string{"*ast.MakeStatement", "*ast.AssignStatement"}},
+		{"make x na 1\nx be x * 2", []string{"*ast.MakeStatement", "*ast.AssignStatement"}},
+		// 'be' only assigns at the start of a statement; elsewhere it compares
+		{"5 be 5", []string{"*ast.ExpressionStatement"}},
+		{"x na 5", []string{"*ast.ExpressionStatement"}},
+		{"(x) be 5", []string{"*ast.ExpressionStatement"}},
+		{"suppose x be 5 { x be 6 }", []string{"*ast.ExpressionStatement"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			if len(program.Statements) != len(tt.expected) {
+				t.Fatalf("expected %d statements, got=%d", len(tt.expected), len(program.Statements))
+			}
+			for i, stmt := range program.Statements {
+				if got := fmt.Sprintf("%T", stmt); got != tt.expected[i] {
+					t.Errorf("statement %d is %s, want %s", i, got, tt.expected[i])
+				}
+			}
+		})
+	}
+
+	// Inside a block the same rule applies
+	program := New(lexer.New("suppose x be 5 { x be 6 }")).ParseProgram()
+	suppose := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.SupposeExpression)
+	if _, ok := suppose.Condition.(*ast.InfixExpression); !ok {
+		t.Errorf("condition is %T, want *ast.InfixExpression", suppose.Condition)
+	}
+	if _, ok := suppose.Consequence.Statements[0].(*ast.AssignStatement); !ok {
+		t.Errorf("body statement is %T, want *ast.AssignStatement", suppose.Consequence.Statements[0])
+	}
+}
+
+func TestYarnIsNotAVariableName(t *testing.T) {
+	// yarn is a keyword, so unlike the other builtins it can't be shadowed
+	p := New(lexer.New("make yarn be 5"))
+	p.ParseProgram()
+
+	expected := "line 1:6: expected next token to be IDENT, got YARN instead"
+	if len(p.Errors()) == 0 || p.Errors()[0] != expected {
+		t.Errorf("expected error %q, got %v", expected, p.Errors())
+	}
+}
+
 func TestBringStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -118,6 +212,216 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	testIntegerLiteral(t, stmt.Expression, 5)
 }
 
+func TestComparisonChaining(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 no reach x no reach 10", "((1 no reach x) and (x no reach 10))"},
+		{"a < b <= c", "((a < b) and (b <= c))"},
+		{"a < b < c < d", "(((a < b) and (b < c)) and (c < d))"},
+		{"0 reach -n big pass -10", "((0 reach (-n)) and ((-n) big pass (-10)))"},
+		{"a + 1 < b < c * 2", "(((a + 1) < b) and (b < (c * 2)))"},
+		// Equality is not an ordering, so it does not chain
+		{"a < b be tru", "((a < b) be tru)"},
+		// Nor does a comparison someone put in parentheses
+		{"(a < b) < c", "((a < b) < c)"},
+		{"a < (b < c)", "(a < (b < c))"},
+		{"(a < b < c) < d", "(((a < b) and (b < c)) < d)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestComparisonChainingBindsMiddle(t *testing.T) {
+	// A middle operand that isn't a variable or literal is worked out once,
+	// and the next comparison reads the hidden variable it went into
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 < f(x) < 10", "((1 < f(x)) and (chain@1:5 < 10))"},
+		{"0 reach n * 2 reach -4", "((0 reach (n * 2)) and (chain@1:9 reach (-4)))"},
+		{"a < f() < g() < b", "(((a < f()) and (chain@1:5 < g())) and (chain@1:11 < b))"},
+		{"a < x < f() < b", "(((a < x) and (x < f())) and (chain@1:9 < b))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	program := New(lexer.New("1 < f(x) < 10")).ParseProgram()
+	chain := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ChainExpression).Chain
+	bind, ok := chain.Left.(*ast.InfixExpression).Right.(*ast.BindExpression)
+	if !ok {
+		t.Fatalf("expected the middle operand to be a BindExpression, got %T", chain.Left.(*ast.InfixExpression).Right)
+	}
+	if read := chain.Right.(*ast.InfixExpression).Left; read != bind.Name {
+		t.Errorf("expected the second comparison to read %s, got %s", bind.Name, read)
+	}
+}
+
+func TestComparisonChainingErrors(t *testing.T) {
+	// An operand that didn't parse is reported as usual, not chained onto
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 < ) < 2", "line 1:5: no prefix parse function for ) found"},
+		{"(1 <) < 2", "line 1:5: no prefix parse function for ) found"},
+		{"1 < 2 < ", "line 1:9: no prefix parse function for EOF found"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("%q: expected parser error, got none", tt.input)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestErrorsIncludeColumn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"make x 5", "line 1:8: expected 'be' or 'na' after variable name"},
+		{"make x be (1 + 2", "line 1:17: expected next token to be ), got EOF"},
+		{"\n  make x be }", "line 2:13: no prefix parse function for }"},
+		{"make x be @", "line 1:11: I no understand dis character '@'"},
+		{"yarn(1)\nmake x be 2 + #", "line 2:15: I no understand dis character '#'"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser error for %q, got none", tt.input)
+			continue
+		}
+
+		if !strings.HasPrefix(errors[0], tt.expected) {
+			t.Errorf("wrong error for %q. expected prefix %q, got %q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestIllegalCharacter(t *testing.T) {
+	p := New(lexer.New("yarn(1)\nmake x be @"))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser error, got none")
+	}
+	if errors[0] != "line 2:11: I no understand dis character '@'" {
+		t.Errorf("wrong error. got %q", errors[0])
+	}
+	for _, err := range errors {
+		if strings.Contains(err, "ILLEGAL") {
+			t.Errorf("expected the character, not the token type, got %q", err)
+		}
+	}
+}
+
+func TestDigitSeparators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"1_000", 1000},
+		{"1_000_000", 1000000},
+		{"0xFF_FF", 65535},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		testIntegerLiteral(t, stmt.Expression, tt.expected)
+	}
+}
+
+func TestInvalidDigitSeparators(t *testing.T) {
+	tests := []string{"1__0", "1_", "100_", "1_.5"}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser error for %q, got none", input)
+			continue
+		}
+
+		if !strings.Contains(errors[0], "could not parse") || !strings.Contains(errors[0], "'_'") {
+			t.Errorf("unhelpful error for %q: %q", input, errors[0])
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"0.5", 0.5},
+		{"10.0", 10.0},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+
+		if literal.TokenLiteral() != tt.input {
+			t.Errorf("literal.TokenLiteral not %q. got=%q", tt.input, literal.TokenLiteral())
+		}
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"how far"`
 
@@ -231,6 +535,9 @@ func TestInfixExpressions(t *testing.T) {
 		{"5 na 5", 5, "na", 5},
 		{"tru be tru", true, "be", true},
 		{"tru na lie", true, "na", false},
+		{"tru and lie", true, "and", false},
+		{"tru abi lie", true, "abi", false},
+		{"tru or lie", true, "or", false},
 	}
 
 	for _, tt := range tests {
@@ -266,6 +573,9 @@ func TestCompoundComparisons(t *testing.T) {
 		{"3 no reach 5", 3, "no reach", 5},
 		{"x big pass y", "x", "big pass", "y"},
 		{"a no reach b", "a", "no reach", "b"},
+		{"age reach 18", "age", "reach", 18},
+		{"x >= 5", "x", ">=", 5},
+		{"x <= 5", "x", "<=", 5},
 	}
 
 	for _, tt := range tests {
@@ -356,6 +666,31 @@ func TestSupposeAbiExpression(t *testing.T) {
 	}
 }
 
+func TestSupposeAbiConditionAndElse(t *testing.T) {
+	// The first abi is part of the condition, the second starts the else
+	input := `suppose x abi y { x } abi { y }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp := stmt.Expression.(*ast.SupposeExpression)
+
+	if !testInfixExpression(t, exp.Condition, "x", "abi", "y") {
+		return
+	}
+
+	if exp.Alternative == nil {
+		t.Fatalf("exp.Alternative was nil")
+	}
+
+	if len(exp.Alternative.Statements) != 1 {
+		t.Errorf("alternative is not 1 statement. got=%d", len(exp.Alternative.Statements))
+	}
+}
+
 func TestDoExpression(t *testing.T) {
 	input := `do add(x, y) { bring x + y }`
 
@@ -403,6 +738,55 @@ func TestDoExpression(t *testing.T) {
 	testInfixExpression(t, bodyStmt.ReturnValue, "x", "+", "y")
 }
 
+func TestDoExpressionReturnType(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedReturnType string
+	}{
+		{`do add(x, y) bring number { bring x + y }`, "number"},
+		{`do greet() bring nothing { yarn("hi") }`, "nothing"},
+		{`do add(x, y) { bring x + y }`, ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function, ok := stmt.Expression.(*ast.DoExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.DoExpression. got=%T", stmt.Expression)
+		}
+
+		if tt.expectedReturnType == "" {
+			if function.ReturnType != nil {
+				t.Errorf("expected no return type, got=%s", function.ReturnType.Value)
+			}
+			continue
+		}
+
+		if function.ReturnType == nil {
+			t.Fatalf("expected return type %q, got none", tt.expectedReturnType)
+		}
+
+		if function.ReturnType.Value != tt.expectedReturnType {
+			t.Errorf("return type wrong. want=%q, got=%q", tt.expectedReturnType, function.ReturnType.Value)
+		}
+	}
+}
+
+func TestDoExpressionMissingReturnType(t *testing.T) {
+	l := lexer.New(`do add(x, y) bring { bring x + y }`)
+	p := New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser error for missing return type, got none")
+	}
+}
+
 func TestCallExpression(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5)"
 
@@ -430,6 +814,195 @@ func TestCallExpression(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
 
+func TestCallSupposeExpression(t *testing.T) {
+	for _, input := range []string{
+		"(suppose ok { do () { 1 } } abi { do () { 2 } })(3)",
+		"suppose ok { do () { 1 } } abi { do () { 2 } }(3)",
+	} {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		call, ok := stmt.Expression.(*ast.CallExpression)
+		if !ok {
+			t.Fatalf("%q: stmt.Expression is not ast.CallExpression. got=%T", input, stmt.Expression)
+		}
+		if _, ok := call.Function.(*ast.SupposeExpression); !ok {
+			t.Errorf("%q: call.Function is not ast.SupposeExpression. got=%T", input, call.Function)
+		}
+		if len(call.Arguments) != 1 {
+			t.Fatalf("%q: wrong number of arguments. want 1, got=%d", input, len(call.Arguments))
+		}
+		testLiteralExpression(t, call.Arguments[0], 3)
+	}
+}
+
+func TestArrayLiteral(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("wrong number of elements. want 3, got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestEmptyArrayLiteral(t *testing.T) {
+	l := lexer.New("[]")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 0 {
+		t.Errorf("expected no elements, got=%d", len(array.Elements))
+	}
+}
+
+func TestIndexExpression(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Left, "myArray") {
+		return
+	}
+
+	testInfixExpression(t, exp.Index, 1, "+", 1)
+}
+
+func TestArrayOnNewLineIsNotIndex(t *testing.T) {
+	l := lexer.New("make i be 0\n[1, 2][i]")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected 2 statements, got=%d: %s", len(program.Statements), program.String())
+	}
+
+	stmt := program.Statements[1].(*ast.ExpressionStatement)
+	if _, ok := stmt.Expression.(*ast.IndexExpression); !ok {
+		t.Errorf("expected second statement to index an array literal, got=%T", stmt.Expression)
+	}
+}
+
+func TestHashLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"one": 1, "two": 2}`, `{"one": 1, "two": 2}`},
+		{`{}`, "{}"},
+		{`{1: "a", tru: "b"}`, `{1: "a", tru: "b"}`},
+		{`{"sum": 1 + 2, "big": 3 * 4}`, `{"sum": (1 + 2), "big": (3 * 4)}`},
+		{`{"one": 1,}`, `{"one": 1}`},
+		{"{\n  \"one\": 1,\n  \"two\": 2\n}", `{"one": 1, "two": 2}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			stmt := program.Statements[0].(*ast.ExpressionStatement)
+			hash, ok := stmt.Expression.(*ast.HashLiteral)
+			if !ok {
+				t.Fatalf("stmt.Expression is not ast.HashLiteral. got=%T", stmt.Expression)
+			}
+
+			if hash.String() != tt.expected {
+				t.Errorf("expected=%q, got=%q", tt.expected, hash.String())
+			}
+		})
+	}
+}
+
+func TestHashLiteralVersusBlock(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// After suppose, a loop condition or function parameters, '{' opens a block
+		{`suppose tru { 1 }`, "suppose tru 1"},
+		{`dey do while x { x }`, "dey do while x x"},
+		// Anywhere an expression is expected, '{' opens a hash
+		{`make h be {"a": 1}`, `make h be {"a": 1}`},
+		{`len({"a": 1})`, `len({"a": 1})`},
+		{`suppose tru { {"a": 1} }`, `suppose tru {"a": 1}`},
+		{`do f() { bring {"a": 1} }`, `do f() bring {"a": 1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			if got := program.String(); got != tt.expected {
+				t.Errorf("expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHashLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"a" 1}`, "line 1:6: expected next token to be :, got INT instead"},
+		{`{"a": 1 "b": 2}`, "line 1:9: expected next token to be ,, got STRING instead"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			p.ParseProgram()
+
+			errors := p.Errors()
+			if len(errors) == 0 {
+				t.Fatalf("expected parser error, got none")
+			}
+			if errors[0] != tt.expected {
+				t.Errorf("wrong first error.\nwant=%q\ngot= %q", tt.expected, errors[0])
+			}
+		})
+	}
+}
+
 func TestYarnExpression(t *testing.T) {
 	input := `yarn("How far!")`
 
@@ -476,6 +1049,405 @@ func TestWhileExpression(t *testing.T) {
 	}
 }
 
+func TestWhileOtherwise(t *testing.T) {
+	input := `dey do while x no reach 10 { x be x + 1 } otherwise { yarn(x) }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not 1 statement. got=%d", len(program.Statements))
+	}
+	exp, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.WhileExpression)
+	if !ok {
+		t.Fatalf("expression is not ast.WhileExpression. got=%T", program.Statements[0])
+	}
+	if exp.Otherwise == nil || len(exp.Otherwise.Statements) != 1 {
+		t.Fatalf("expected otherwise block with 1 statement, got %+v", exp.Otherwise)
+	}
+
+	want := "dey do while (x no reach 10) x be (x + 1) otherwise yarn(x)"
+	if got := program.String(); got != want {
+		t.Errorf("wrong String().\nwant=%q\ngot= %q", want, got)
+	}
+
+	// Without otherwise there is no block
+	p = New(lexer.New("dey do while x { x }"))
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+	if exp := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.WhileExpression); exp.Otherwise != nil {
+		t.Errorf("expected no otherwise block, got %s", exp.Otherwise)
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	input := `try { 10 / x } rescue err { yarn(err) }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not 1 statement. got=%d", len(program.Statements))
+	}
+	exp, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("expression is not ast.TryExpression. got=%T", program.Statements[0])
+	}
+	if len(exp.Body.Statements) != 1 || len(exp.Rescue.Statements) != 1 {
+		t.Fatalf("expected one statement in each block, got %s", exp)
+	}
+	if exp.Name.Value != "err" {
+		t.Errorf("rescue name wrong. want=err, got=%s", exp.Name.Value)
+	}
+
+	want := "try (10 / x) rescue err yarn(err)"
+	if got := program.String(); got != want {
+		t.Errorf("wrong String().\nwant=%q\ngot= %q", want, got)
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try x", "line 1:5: expected next token to be {, got IDENT instead"},
+		{"try { x }", "line 1:10: Try suppose look like 'try { ... } rescue err { ... }', got EOF"},
+		{"try { x } rescue { x }", "line 1:18: Try suppose look like 'try { ... } rescue err { ... }', got {"},
+		{"try { x } rescue err x", "line 1:22: expected next token to be {, got IDENT instead"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			p.ParseProgram()
+
+			errors := p.Errors()
+			if len(errors) == 0 {
+				t.Fatalf("expected parser error, got none")
+			}
+			if errors[0] != tt.expected {
+				t.Errorf("wrong first error.\nwant=%q\ngot= %q", tt.expected, errors[0])
+			}
+		})
+	}
+}
+
+func TestWhileOtherwiseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"dey do while x { x } otherwise x", "line 1:32: expected next token to be {, got IDENT instead"},
+		// otherwise isn't inside the loop
+		{"dey do while x { x } otherwise { comot }", "line 1:34: 'comot' fit only dey inside loop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			p.ParseProgram()
+
+			errors := p.Errors()
+			if len(errors) == 0 {
+				t.Fatalf("expected parser error, got none")
+			}
+			if errors[0] != tt.expected {
+				t.Errorf("wrong first error.\nwant=%q\ngot= %q", tt.expected, errors[0])
+			}
+		})
+	}
+}
+
+func TestWhileMissingKeywordErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"dey while x no reach 10 { x }", "line 1:1: Loop suppose start with 'dey do while'"},
+		{"do while x no reach 10 { x }", "line 1:1: Loop suppose start with 'dey do while'"},
+		{"dey do x no reach 10 { x }", "line 1:1: Loop suppose start with 'dey do while'"},
+		{"dey x no reach 10 { x }", "line 1:1: Loop suppose start with 'dey do while'"},
+		{"make x be 0\n  dey while x no reach 10 { x }", "line 2:3: Loop suppose start with 'dey do while'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			p.ParseProgram()
+
+			errors := p.Errors()
+			if len(errors) == 0 {
+				t.Fatalf("expected parser error, got none")
+			}
+
+			if errors[0] != tt.expected {
+				t.Errorf("wrong first error.\nwant=%q\ngot= %q", tt.expected, errors[0])
+			}
+
+			// Carrying on past a missing keyword keeps this to one error
+			if len(errors) != 1 {
+				t.Errorf("expected only the loop error, got=%q", errors)
+			}
+		})
+	}
+}
+
+func TestWhileMissingBodyBrace(t *testing.T) {
+	l := lexer.New("dey do while x no reach 10 x }")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser error, got none")
+	}
+
+	expected := "line 1:28: Loop body suppose start with '{' after the condition, got IDENT"
+	if errors[0] != expected {
+		t.Errorf("wrong first error.\nwant=%q\ngot= %q", expected, errors[0])
+	}
+}
+
+func TestForExpression(t *testing.T) {
+	input := `count i from 1 reach n + 1 { make total be total + i }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.ForExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.ForExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Variable, "i") {
+		return
+	}
+	if !testLiteralExpression(t, exp.From, 1) {
+		return
+	}
+	if !testInfixExpression(t, exp.To, "n", "+", 1) {
+		return
+	}
+
+	if len(exp.Body.Statements) != 1 {
+		t.Fatalf("body has not 1 statement. got=%d", len(exp.Body.Statements))
+	}
+}
+
+func TestCountIsStillAnIdentifier(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"make count be 0", "make count be 0"},
+		{"count + 1", "(count + 1)"},
+		{"yarn(count)", "yarn(count)"},
+		{"make from be 2", "make from be 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			if got := program.String(); got != tt.expected {
+				t.Errorf("expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestForExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"count i to 10 { i }", "line 1:9: Count loop suppose look like 'count i from 1 reach 10', got IDENT"},
+		{"count i from 1 { i }", "line 1:16: Count loop suppose look like 'count i from 1 reach 10', got {"},
+		{"count i from 1 reach 10 i }", "line 1:25: Loop body suppose start with '{' after the count, got IDENT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			p.ParseProgram()
+
+			errors := p.Errors()
+			if len(errors) == 0 {
+				t.Fatalf("expected parser error, got none")
+			}
+
+			if errors[0] != tt.expected {
+				t.Errorf("wrong first error.\nwant=%q\ngot= %q", tt.expected, errors[0])
+			}
+		})
+	}
+}
+
+func TestBreakAndContinueStatements(t *testing.T) {
+	input := `dey do while tru { suppose x { comot } kontinu }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	loop, ok := stmt.Expression.(*ast.WhileExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.WhileExpression. got=%T", stmt.Expression)
+	}
+	if len(loop.Body.Statements) != 2 {
+		t.Fatalf("body has not 2 statements. got=%d", len(loop.Body.Statements))
+	}
+
+	suppose := loop.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.SupposeExpression)
+	if _, ok := suppose.Consequence.Statements[0].(*ast.BreakStatement); !ok {
+		t.Errorf("expected ast.BreakStatement. got=%T", suppose.Consequence.Statements[0])
+	}
+	if _, ok := loop.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Errorf("expected ast.ContinueStatement. got=%T", loop.Body.Statements[1])
+	}
+}
+
+func TestBreakAndContinueOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"comot", "line 1:1: 'comot' fit only dey inside loop"},
+		{"make x be 1\nkontinu", "line 2:1: 'kontinu' fit only dey inside loop"},
+		{"suppose tru { comot }", "line 1:15: 'comot' fit only dey inside loop"},
+		// A function body starts fresh, even inside a loop
+		{"dey do while tru { do f() { comot } }", "line 1:29: 'comot' fit only dey inside loop"},
+		// The loop is over once its body closes
+		{"count i from 1 reach 3 { i }\nkontinu", "line 2:1: 'kontinu' fit only dey inside loop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := lexer.New(tt.input)
+			p := New(l)
+			p.ParseProgram()
+
+			errors := p.Errors()
+			if len(errors) != 1 {
+				t.Fatalf("expected 1 parser error, got=%q", errors)
+			}
+			if errors[0] != tt.expected {
+				t.Errorf("wrong error.\nwant=%q\ngot= %q", tt.expected, errors[0])
+			}
+		})
+	}
+}
+
+func TestUnterminatedStringError(t *testing.T) {
+	input := `make greeting be "How far`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser error for unterminated string, got none")
+	}
+
+	if !strings.Contains(errors[0], "unterminated string started on line 1") {
+		t.Errorf("first error does not mention unterminated string. got=%q", errors[0])
+	}
+
+	for _, stmt := range program.Statements {
+		if makeStmt, ok := stmt.(*ast.MakeStatement); ok {
+			if _, ok := makeStmt.Value.(*ast.StringLiteral); ok {
+				t.Errorf("unterminated string produced a string literal: %s", makeStmt.String())
+			}
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	// node names the node to check by its Go type and String(); the first
+	// match in the tree is used. End is just past the node's last character.
+	tests := []struct {
+		input     string
+		node      string
+		startLine int
+		startCol  int
+		endLine   int
+		endCol    int
+	}{
+		{"(5 + 5)", "*ast.InfixExpression (5 + 5)", 1, 1, 1, 8},
+		{"(5 + 5) * 2", "*ast.InfixExpression ((5 + 5) * 2)", 1, 1, 1, 12},
+		{"2 * (5 + 5)", "*ast.InfixExpression (5 + 5)", 1, 5, 1, 12},
+		{"1 + 2 * 3", "*ast.InfixExpression (2 * 3)", 1, 5, 1, 10},
+		{"-x", "*ast.PrefixExpression (-x)", 1, 1, 1, 3},
+		{"no be done", "*ast.PrefixExpression (no bedone)", 1, 1, 1, 11},
+		{"x big pass 10", "*ast.InfixExpression (x big pass 10)", 1, 1, 1, 14},
+		{"1 < x < 10", "*ast.InfixExpression (x < 10)", 1, 5, 1, 11},
+		{"1 < x < 10", "*ast.InfixExpression ((1 < x) and (x < 10))", 1, 1, 1, 11},
+		{"make total be 0", "*ast.Identifier total", 1, 6, 1, 11},
+		{"make x be 1 + 2;", "*ast.MakeStatement make x be (1 + 2)", 1, 1, 1, 16},
+		{"x be x + 1", "*ast.AssignStatement x be (x + 1)", 1, 1, 1, 11},
+		{"add(1, 22)", "*ast.CallExpression add(1, 22)", 1, 1, 1, 11},
+		{"add(1, 22)", "*ast.IntegerLiteral 22", 1, 8, 1, 10},
+		{`yarn("hi")`, `*ast.StringLiteral "hi"`, 1, 6, 1, 10},
+		{`yarn("hi")`, `*ast.CallExpression yarn("hi")`, 1, 1, 1, 11},
+		{"a[10]", "*ast.IndexExpression (a[10])", 1, 1, 1, 6},
+		{"[1, 2]", "*ast.ArrayLiteral [1, 2]", 1, 1, 1, 7},
+		{`{"a": 1}`, `*ast.HashLiteral {"a": 1}`, 1, 1, 1, 9},
+		{"suppose x {\n  1\n} abi {\n  2\n}", "*ast.SupposeExpression suppose x 1 abi 2", 1, 1, 5, 2},
+		{"suppose x {\n  1\n} abi {\n  2\n}", "*ast.BlockStatement 2", 3, 7, 5, 2},
+		{"do f(a) {\n  bring a\n}", "*ast.BringStatement bring a", 2, 3, 2, 10},
+		{"do f(a) {\n  bring a\n}", "*ast.Identifier a", 1, 6, 1, 7},
+		{"dey do while x { comot }", "*ast.BreakStatement comot", 1, 18, 1, 23},
+		{"count i from 1 reach 3 { }", "*ast.ForExpression count i from 1 reach 3 ", 1, 1, 1, 27},
+		{"try { 1 } rescue err { 2 }", "*ast.Identifier err", 1, 18, 1, 21},
+		{"make s be \"one\ntwo\"", "*ast.MakeStatement make s be \"one\ntwo\"", 1, 1, 2, 5},
+		{"make a be 1\n\nyarn(a)", "*ast.Program make a be 1yarn(a)", 1, 1, 3, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input+" "+tt.node, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+
+			var found ast.Node
+			ast.Walk(program, func(n ast.Node) bool {
+				if found == nil && fmt.Sprintf("%T %s", n, n.String()) == tt.node {
+					found = n
+				}
+				return found == nil
+			})
+			if found == nil {
+				t.Fatalf("no node %q in %q", tt.node, program.String())
+			}
+
+			span := found.NodeSpan()
+			expected := ast.Span{
+				Start: ast.Position{Line: tt.startLine, Column: tt.startCol},
+				End:   ast.Position{Line: tt.endLine, Column: tt.endCol},
+			}
+			if span != expected {
+				t.Errorf("wrong span. expected %v, got %v", expected, span)
+			}
+		})
+	}
+}
+
 // =============================================================================
 // Helper functions
 // =============================================================================
@@ -625,6 +1597,10 @@ func TestOperatorPrecedence(t *testing.T) {
 		{"a + b - c", "((a + b) - c)"},
 		{"a * b * c", "((a * b) * c)"},
 		{"a * b / c", "((a * b) / c)"},
+		{"a + b % c", "(a + (b % c))"},
+		{"a + 1 >= b * 2", "((a + 1) >= (b * 2))"},
+		{"a reach b + 1", "(a reach (b + 1))"},
+		{"a % b * c", "((a % b) * c)"},
 		{"a + b / c", "(a + (b / c))"},
 		{"a + b * c + d / e - f", "(((a + (b * c)) + (d / e)) - f)"},
 		{"1 + (2 + 3) + 4", "((1 + (2 + 3)) + 4)"},
@@ -632,6 +1608,16 @@ func TestOperatorPrecedence(t *testing.T) {
 		{"2 / (5 + 5)", "(2 / (5 + 5))"},
 		{"-(5 + 5)", "(-(5 + 5))"},
 		{"!(tru be tru)", "(!(tru be tru))"},
+		{"10.0 / 4 + 0.5", "((10.0 / 4) + 0.5)"},
+		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
+		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"-a[0]", "(-(a[0]))"},
+		{"a and b abi c", "((a and b) abi c)"},
+		{"a abi b and c", "(a abi (b and c))"},
+		{"a abi b or c", "((a abi b) or c)"},
+		{"a or b and c or d", "((a or (b and c)) or d)"},
+		{"a na 1 abi b big pass 2", "((a na 1) abi (b big pass 2))"},
+		{"!a abi b", "((!a) abi b)"},
 	}
 
 	for _, tt := range tests {
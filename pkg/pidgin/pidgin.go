@@ -0,0 +1,148 @@
+// Package pidgin runs Pidgin programs from Go. It wraps the whole
+// lex → parse → compile → run pipeline, so a host program only hands over
+// source code and gets back the program's value or the first error.
+package pidgin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"pidgin-lang/ast"
+	"pidgin-lang/compiler"
+	"pidgin-lang/evaluator"
+	"pidgin-lang/lexer"
+	"pidgin-lang/object"
+	"pidgin-lang/parser"
+	"pidgin-lang/vm"
+)
+
+// SyntaxError is returned when the source doesn't parse
+type SyntaxError struct {
+	Errors []string // Every parser error, in order
+}
+
+func (e *SyntaxError) Error() string {
+	return "Wahala: " + strings.Join(e.Errors, "; ")
+}
+
+// RuntimeError is returned when a program stops with an error while it runs
+type RuntimeError struct {
+	Message string
+	Line    int // Source line, or 0 when the interpreter ran the program
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Line == 0 {
+		return "Runtime wahala: " + e.Message
+	}
+	return fmt.Sprintf("Runtime wahala: %s [line %d]", e.Message, e.Line)
+}
+
+// Result is the value a program on the VM ended with. A string, function
+// or error value points at memory NaN-boxing hides from the garbage
+// collector, so the Result holds on to it: keep the Result, not just its
+// Value, for as long as you use one of those.
+type Result struct {
+	Value vm.Value
+	owner any // What Value points at, or the VM that made a function
+}
+
+func (r Result) String() string {
+	return r.Value.String()
+}
+
+// result wraps value, made by machine, in a Result that owns it
+func result(value vm.Value, machine *vm.VM) Result {
+	switch {
+	case value.IsString():
+		return Result{Value: value, owner: value.AsString()}
+	case value.IsError():
+		return Result{Value: value, owner: value.AsError()}
+	case value.IsFunc():
+		// A closure's upvalues can lead to more of the VM's objects
+		return Result{Value: value, owner: machine}
+	}
+	return Result{Value: value}
+}
+
+// ============================================================================
+// Running Programs
+// ============================================================================
+
+// Run runs source on the bytecode VM and returns the value of its last
+// statement. yarn prints to standard output.
+func Run(source string) (Result, error) {
+	return run(source, os.Stdout)
+}
+
+// Eval is an alias for Run, for hosts that think of source as an
+// expression to work out
+func Eval(source string) (Result, error) { return Run(source) }
+
+// RunCaptured runs source on the bytecode VM and returns what it printed
+// with yarn. After a runtime error the output up to the error comes back
+// along with it.
+func RunCaptured(source string) (string, error) {
+	var out bytes.Buffer
+	_, err := run(source, &out)
+	return out.String(), err
+}
+
+func run(source string, out io.Writer) (Result, error) {
+	nothing := Result{Value: vm.NewNothing()}
+
+	program, err := parse(source)
+	if err != nil {
+		return nothing, err
+	}
+
+	chunk, err := compiler.New().Compile(program)
+	if err != nil {
+		return nothing, fmt.Errorf("Compile wahala: %w", err)
+	}
+
+	machine := vm.NewVMWithOutput(out)
+	value, err := machine.Run(chunk)
+	if err == nil && value.IsError() {
+		err = value.AsError()
+	}
+	var runtimeErr *vm.RuntimeError
+	if errors.As(err, &runtimeErr) {
+		return nothing, &RuntimeError{Message: runtimeErr.Message, Line: runtimeErr.Line}
+	} else if err != nil {
+		return nothing, err
+	}
+
+	return result(value, machine), nil
+}
+
+// RunInterpreter is Run for the tree-walking interpreter
+func RunInterpreter(source string) (object.Object, error) {
+	program, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	evaluator.SetOutput(os.Stdout)
+	result := evaluator.Eval(program, object.NewEnvironment())
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Message: errObj.Message}
+	}
+	if result == nil {
+		result = evaluator.NOTHING
+	}
+	return result, nil
+}
+
+func parse(source string) (*ast.Program, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &SyntaxError{Errors: p.Errors()}
+	}
+	return program, nil
+}
@@ -0,0 +1,233 @@
+package pidgin
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"pidgin-lang/object"
+	"pidgin-lang/vm"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"make x be 10\nx / 4", "2"},
+		{"7.5 - 2", "5.5"},
+		{`"How " + "far"`, "How far"},
+		{"make x be 1", "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			result, err := Run(tt.source)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if result.String() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result.String())
+			}
+
+			value, err := RunInterpreter(tt.source)
+			if err != nil {
+				t.Fatalf("interpreter: unexpected error: %s", err)
+			}
+			if value.Inspect() != tt.expected {
+				t.Errorf("interpreter: expected %s, got %s", tt.expected, value.Inspect())
+			}
+		})
+	}
+}
+
+func TestRunSyntaxError(t *testing.T) {
+	const source = "make be 1"
+	const expected = "line 1:6: expected next token to be IDENT, got BE instead"
+
+	_, vmErr := Run(source)
+	_, interpErr := RunInterpreter(source)
+
+	for _, err := range []error{vmErr, interpErr} {
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Fatalf("expected a SyntaxError, got %v", err)
+		}
+		if len(syntaxErr.Errors) == 0 || syntaxErr.Errors[0] != expected {
+			t.Errorf("expected first error %q, got %v", expected, syntaxErr.Errors)
+		}
+	}
+}
+
+func TestRunRuntimeError(t *testing.T) {
+	const source = "make x be 1\nx / 0"
+	const message = "Omo! You no fit divide by zero o!"
+
+	_, err := Run(source)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a RuntimeError, got %v", err)
+	}
+	if runtimeErr.Message != message || runtimeErr.Line != 2 {
+		t.Errorf("expected %q on line 2, got %q on line %d", message, runtimeErr.Message, runtimeErr.Line)
+	}
+	if err.Error() != "Runtime wahala: "+message+" [line 2]" {
+		t.Errorf("unexpected error text %q", err.Error())
+	}
+
+	value, err := RunInterpreter(source)
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("interpreter: expected a RuntimeError, got %v (%v)", err, value)
+	}
+	if runtimeErr.Message != message {
+		t.Errorf("interpreter: expected %q, got %q", message, runtimeErr.Message)
+	}
+	if err.Error() != "Runtime wahala: "+message {
+		t.Errorf("interpreter: unexpected error text %q", err.Error())
+	}
+}
+
+func TestRunStringOutlivesProgram(t *testing.T) {
+	result, err := Run(`"na " + "wa"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The chunk that built the string is gone after this
+	runtime.GC()
+	runtime.GC()
+
+	if result.String() != "na wa" {
+		t.Errorf("expected na wa, got %s", result.String())
+	}
+}
+
+func TestRunClosureOutlivesProgram(t *testing.T) {
+	result, err := Run(`do adder(a) {
+	make label be "sum " + a
+	bring do(b) { bring label + ": " + (a + b) }
+}
+adder(1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the Result holds on to the closure and what it captured now
+	runtime.GC()
+	runtime.GC()
+
+	value, err := vm.NewVM().Call(result.Value, vm.NewInt(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.String() != "sum 1: 3" {
+		t.Errorf("expected sum 1: 3, got %s", value.String())
+	}
+	runtime.KeepAlive(result)
+}
+
+func TestRunInterpreterValueTypes(t *testing.T) {
+	value, err := RunInterpreter(`[1, "two"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := value.(*object.Array); !ok {
+		t.Errorf("expected an Array, got %T", value)
+	}
+}
+
+func TestRunCaptured(t *testing.T) {
+	tests := []struct {
+		source  string
+		output  string
+		message string
+	}{
+		{`yarn("How far")`, "How far\n", ""},
+		{"count i from 1 reach 3 { yarn(i * i) }", "1\n4\n9\n", ""},
+		{"make x be 5", "", ""},
+		{"yarn(\"before\")\nyarn(1 / 0)\nyarn(\"after\")", "before\n", "Omo! You no fit divide by zero o!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			output, err := RunCaptured(tt.source)
+			if output != tt.output {
+				t.Errorf("expected output %q, got %q", tt.output, output)
+			}
+
+			var runtimeErr *RuntimeError
+			if tt.message == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+			} else if !errors.As(err, &runtimeErr) || runtimeErr.Message != tt.message {
+				t.Errorf("expected runtime error %q, got %v", tt.message, err)
+			}
+		})
+	}
+}
+
+func TestRunCapturedSyntaxError(t *testing.T) {
+	output, err := RunCaptured("yarn(")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("expected a SyntaxError, got %v", err)
+	}
+	if output != "" {
+		t.Errorf("expected no output, got %q", output)
+	}
+}
+
+func TestRunCapturedConcurrentCompose(t *testing.T) {
+	source := `
+make shout be compose(upper, lower)
+count i from 1 reach 50 { yarn(shout("How Far " + i)) }
+`
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			output, err := RunCaptured(source)
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			if len(output) == 0 || output[:10] != "HOW FAR 1\n" {
+				t.Errorf("unexpected output %q", output)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func ExampleEval() {
+	value, err := Eval("2 + 3")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(value.Value.AsInt())
+	// Output: 5
+}
+
+func ExampleRunCaptured() {
+	output, err := RunCaptured(`
+do greet(name) {
+    yarn("How far, " + name + "!")
+}
+greet("Chidi")
+greet("Ada")
+`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Print(output)
+	// Output:
+	// How far, Chidi!
+	// How far, Ada!
+}
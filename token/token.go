@@ -6,6 +6,7 @@ type Token struct {
 	Type    TokenType
 	Literal string
 	Line    int
+	Column  int // 1-based column of the token's first character
 }
 
 const (
@@ -16,6 +17,7 @@ const (
 	// Identifiers and literals
 	IDENT  TokenType = "IDENT"  // User-defined names: variables, functions (e.g., money, calculateSalary)
 	INT    TokenType = "INT"    // Integer literals 
+	FLOAT  TokenType = "FLOAT"  // Floating-point literals (e.g., 3.14)
 	STRING TokenType = "STRING" // String literals
 
 	// Operators
@@ -25,18 +27,26 @@ const (
 	BANG     TokenType = "!"         
 	ASTERISK TokenType = "*"         
 	SLASH    TokenType = "/"       
+	PERCENT  TokenType = "%" // remainder (e.g., 10 % 3)
 
 	// Comparison (single character)
 	LT TokenType = "<" // <  (less than)
 	GT TokenType = ">" // >  (greater than)
 
+	// Comparison (two character)
+	LTE TokenType = "<=" // <= (less than or equal)
+	GTE TokenType = ">=" // >= (greater than or equal)
+
 	// Delimiters
 	COMMA     TokenType = "," 
+	COLON     TokenType = ":"
 	SEMICOLON TokenType = ";" 
 	LPAREN    TokenType = "(" 
 	RPAREN    TokenType = ")" 
 	LBRACE    TokenType = "{" 
 	RBRACE    TokenType = "}" 
+	LBRACKET  TokenType = "["
+	RBRACKET  TokenType = "]"
 
 	// Keywords (Pidgin-flavored control flow and declarations)
 	MAKE      TokenType = "MAKE"      // make – variable declaration (e.g., make name = "John")
@@ -53,31 +63,43 @@ const (
 	LIE       TokenType = "LIE"       // lie – boolean false
 	NOTHING   TokenType = "NOTHING"   // nothing – null / none value
 	AND       TokenType = "AND"       // and – logical AND
+	OR        TokenType = "OR"        // or – logical OR, same as abi between two values
 	NO        TokenType = "NO"        // no – logical NOT or part of negation (e.g., "no be")
 	BIG       TokenType = "BIG"       // big – part of comparison (e.g., "big pass" for >)
 	PASS      TokenType = "PASS"      // pass – greater than in Pidgin style ("big pass") or no-op
-	REACH     TokenType = "REACH"     // reach – part of comparison (e.g., "no reach" for <)
+	REACH     TokenType = "REACH"     // reach – at least (>=) on its own, less than (<) in "no reach"
+	COMOT     TokenType = "COMOT"     // comot – leave the loop early (break)
+	KONTINU   TokenType = "KONTINU"   // kontinu – skip to the loop's next round (continue)
+	OTHERWISE TokenType = "OTHERWISE" // otherwise – runs after a loop that finished without comot
+	TRY       TokenType = "TRY"       // try – run a block and catch its runtime errors (e.g., try { ... } rescue err { ... })
+	RESCUE    TokenType = "RESCUE"    // rescue – the block that runs when a try fails
 )
 
 var keywords = map[string]TokenType{
-	"make":    MAKE,
-	"be":      BE,
-	"na":      NA,
-	"suppose": SUPPOSE,
-	"abi":     ABI,
-	"dey":     DEY,
-	"do":      DO,
-	"while":   WHILE,
-	"bring":   BRING,
-	"yarn":    YARN,
-	"tru":     TRU,
-	"lie":     LIE,
-	"nothing": NOTHING,
-	"and":     AND,
-	"no":      NO,
-	"big":     BIG,
-	"pass":    PASS,
-	"reach":   REACH,
+	"make":      MAKE,
+	"be":        BE,
+	"na":        NA,
+	"suppose":   SUPPOSE,
+	"abi":       ABI,
+	"dey":       DEY,
+	"do":        DO,
+	"while":     WHILE,
+	"bring":     BRING,
+	"yarn":      YARN,
+	"tru":       TRU,
+	"lie":       LIE,
+	"nothing":   NOTHING,
+	"and":       AND,
+	"or":        OR,
+	"no":        NO,
+	"big":       BIG,
+	"pass":      PASS,
+	"reach":     REACH,
+	"comot":     COMOT,
+	"kontinu":   KONTINU,
+	"otherwise": OTHERWISE,
+	"try":       TRY,
+	"rescue":    RESCUE,
 }
 
 func LookupIdent(ident string) TokenType {
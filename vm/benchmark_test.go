@@ -279,14 +279,14 @@ func BenchmarkVM_StackPushPop(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		vm.push(value)
-		_ = vm.pop()
+		_ = vm.push(value)
+		_, _ = vm.pop()
 	}
 }
 
 func BenchmarkVM_StackPeek(b *testing.B) {
 	vm := NewVM()
-	vm.push(NewInt(42))
+	_ = vm.push(NewInt(42))
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -0,0 +1,324 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BuiltinFn is a native function callable from bytecode
+type BuiltinFn func(vm *VM, args []Value) (Value, error)
+
+// Builtin pairs a builtin's Pidgin name with its implementation
+type Builtin struct {
+	Name string
+	Fn   BuiltinFn
+}
+
+// Builtins is indexed by the builtin slot the compiler assigns,
+// so the order here must match the order the compiler defines them in
+var Builtins = []Builtin{
+	{Name: "yarn", Fn: builtinYarn},
+	{Name: "len", Fn: builtinLen},
+	{Name: "type", Fn: builtinType},
+	{Name: "flip", Fn: builtinFlip},
+	{Name: "assert", Fn: builtinAssert},
+	{Name: "coalesce", Fn: builtinCoalesce},
+	{Name: "upper", Fn: stringBuiltin("upper", strings.ToUpper)},
+	{Name: "lower", Fn: stringBuiltin("lower", strings.ToLower)},
+	{Name: "reverse", Fn: stringBuiltin("reverse", reverseString)},
+	{Name: "trim_prefix", Fn: affixBuiltin("trim_prefix", strings.TrimPrefix)},
+	{Name: "trim_suffix", Fn: affixBuiltin("trim_suffix", strings.TrimSuffix)},
+	{Name: "repeat_string", Fn: builtinRepeatString},
+	{Name: "to_number", Fn: builtinToNumber},
+	{Name: "to_text", Fn: builtinToText},
+	{Name: "abs", Fn: builtinAbs},
+	{Name: "min", Fn: pickInteger("min", func(a, b int64) bool { return a < b })},
+	{Name: "max", Fn: pickInteger("max", func(a, b int64) bool { return a > b })},
+	{Name: "compose", Fn: builtinCompose},
+	{Name: "is_error", Fn: builtinIsError},
+}
+
+// maxStringLength is the longest string repeat_string will build
+const maxStringLength = 1 << 30
+
+// callBuiltin invokes the builtin at index with the given arguments
+func (vm *VM) callBuiltin(index int, args []Value) (Value, error) {
+	if index < 0 || index >= len(Builtins) {
+		return NewNothing(), vm.runtimeError("I no sabi builtin number %d", index)
+	}
+	return Builtins[index].Fn(vm, args)
+}
+
+// ============================================================================
+// Builtin Implementations
+// ============================================================================
+
+func builtinYarn(vm *VM, args []Value) (Value, error) {
+	vm.yarn(args)
+	return NewNothing(), nil
+}
+
+func builtinLen(vm *VM, args []Value) (Value, error) {
+	if len(args) != 1 {
+		return NewNothing(), vm.runtimeError("len wan make one argument, you give am %d", len(args))
+	}
+	if !args[0].IsString() {
+		return NewNothing(), vm.runtimeError("I no fit check length of %s", args[0].TypeName())
+	}
+	return NewInt(int64(len(*args[0].AsString()))), nil
+}
+
+func builtinType(vm *VM, args []Value) (Value, error) {
+	if len(args) != 1 {
+		return NewNothing(), vm.runtimeError("type wan make one argument, you give am %d", len(args))
+	}
+	return vm.MakeString(objectTypeName(args[0])), nil
+}
+
+// builtinFlip is the function form of OP_NOT: lie for truthy values, tru for falsey ones
+func builtinFlip(vm *VM, args []Value) (Value, error) {
+	if len(args) != 1 {
+		return NewNothing(), vm.runtimeError("flip wan make one argument, you give am %d", len(args))
+	}
+	return NewBool(args[0].IsFalsey()), nil
+}
+
+// builtinIsError checks for the error values a VM with RecoverErrors set
+// gives in place of stopping
+func builtinIsError(vm *VM, args []Value) (Value, error) {
+	if len(args) != 1 {
+		return NewNothing(), vm.runtimeError("is_error wan make one argument, you give am %d", len(args))
+	}
+	return NewBool(args[0].IsError()), nil
+}
+
+// builtinAssert stops the program when its condition is falsey, with the
+// optional message saying what went wrong. Only a try block can stop the
+// failure, since RecoverErrors doesn't.
+func builtinAssert(vm *VM, args []Value) (Value, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return NewNothing(), vm.runtimeError("assert wan make condition and maybe message, you give am %d argument", len(args))
+	}
+	if args[0].IsTruthy() {
+		return NewNothing(), nil
+	}
+	message := "Assert fail"
+	if len(args) == 2 {
+		message += ": " + vm.valueToString(args[1])
+	}
+	err := vm.runtimeError("%s", message).(*RuntimeError)
+	err.unrecoverable = true
+	return NewNothing(), err
+}
+
+// builtinCoalesce gives back its first argument that isn't nothing, or
+// nothing when they all are
+func builtinCoalesce(vm *VM, args []Value) (Value, error) {
+	for _, arg := range args {
+		if !arg.IsNothing() {
+			return arg, nil
+		}
+	}
+	return NewNothing(), nil
+}
+
+// stringBuiltin makes a builtin that takes one string and gives back fn of it
+func stringBuiltin(name string, fn func(string) string) BuiltinFn {
+	return func(vm *VM, args []Value) (Value, error) {
+		if len(args) != 1 {
+			return NewNothing(), vm.runtimeError("%s wan make one argument, you give am %d", name, len(args))
+		}
+		if !args[0].IsString() {
+			return NewNothing(), vm.runtimeError("%s wan make STRING, you give am %s", name, objectTypeName(args[0]))
+		}
+		return vm.MakeString(fn(*args[0].AsString())), nil
+	}
+}
+
+// builtinToNumber reads a whole number written in a string. One too big
+// for 48 bits follows the overflow mode, like arithmetic does.
+func builtinToNumber(vm *VM, args []Value) (Value, error) {
+	if len(args) != 1 {
+		return NewNothing(), vm.runtimeError("to_number wan make one argument, you give am %d", len(args))
+	}
+	if !args[0].IsString() {
+		return NewNothing(), vm.runtimeError("to_number wan make STRING, you give am %s", objectTypeName(args[0]))
+	}
+
+	str := *args[0].AsString()
+	text := strings.TrimSpace(str)
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return NewNothing(), vm.runtimeError("to_number no fit turn %q to number", str)
+	}
+	if err != nil || n < MIN_INT_48 || n > MAX_INT_48 {
+		if vm.overflow == OverflowFloat {
+			value, _ := strconv.ParseFloat(text, 64)
+			return NewFloat(value), nil
+		}
+		return NewNothing(), vm.overflowError()
+	}
+	return NewInt(n), nil
+}
+
+// builtinToText gives any value as the string yarn would print for it
+func builtinToText(vm *VM, args []Value) (Value, error) {
+	if len(args) != 1 {
+		return NewNothing(), vm.runtimeError("to_text wan make one argument, you give am %d", len(args))
+	}
+	if args[0].IsString() {
+		return args[0], nil
+	}
+	return vm.MakeString(vm.valueToString(args[0])), nil
+}
+
+// builtinAbs gives the distance of an integer from zero. Like negation,
+// abs(MIN_INT_48) is one past MAX_INT_48, so it follows the overflow mode.
+func builtinAbs(vm *VM, args []Value) (Value, error) {
+	if len(args) != 1 {
+		return NewNothing(), vm.runtimeError("abs wan make one argument, you give am %d", len(args))
+	}
+	if !args[0].IsInt() {
+		return NewNothing(), vm.runtimeError("abs wan make INTEGER, you give am %s", objectTypeName(args[0]))
+	}
+
+	n := args[0].AsInt()
+	if n == MIN_INT_48 {
+		if vm.overflow == OverflowFloat {
+			return NewFloat(-float64(n)), nil
+		}
+		return NewNothing(), vm.overflowError()
+	}
+	if n < 0 {
+		return NewInt(-n), nil
+	}
+	return args[0], nil
+}
+
+// pickInteger makes a builtin that gives back whichever of its integer
+// arguments wins against all the others, where better(a, b) says a beats b
+func pickInteger(name string, better func(a, b int64) bool) BuiltinFn {
+	return func(vm *VM, args []Value) (Value, error) {
+		if len(args) == 0 {
+			return NewNothing(), vm.runtimeError("%s wan make at least one argument, you give am 0", name)
+		}
+		best := args[0]
+		for i, arg := range args {
+			if !arg.IsInt() {
+				return NewNothing(), vm.runtimeError("%s wan make INTEGER, but argument %d na %s", name, i+1, objectTypeName(arg))
+			}
+			if better(arg.AsInt(), best.AsInt()) {
+				best = arg
+			}
+		}
+		return best, nil
+	}
+}
+
+// builtinRepeatString gives count copies of a string, one after the other
+func builtinRepeatString(vm *VM, args []Value) (Value, error) {
+	if len(args) != 2 {
+		return NewNothing(), vm.runtimeError("repeat_string wan make 2 argument, you give am %d", len(args))
+	}
+	if !args[0].IsString() {
+		return NewNothing(), vm.runtimeError("repeat_string wan make STRING, you give am %s", objectTypeName(args[0]))
+	}
+	if !args[1].IsInt() {
+		return NewNothing(), vm.runtimeError("repeat_string wan make INTEGER count, you give am %s", objectTypeName(args[1]))
+	}
+
+	str, count := *args[0].AsString(), args[1].AsInt()
+	if count < 0 {
+		return NewNothing(), vm.runtimeError("repeat_string no fit repeat %d times", count)
+	}
+	if len(str) > 0 && count > maxStringLength/int64(len(str)) {
+		return NewNothing(), vm.runtimeError("repeat_string go make string wey too long")
+	}
+	return vm.MakeString(strings.Repeat(str, int(count))), nil
+}
+
+// composedChunk is the code of the function compose gives back, calling
+// its second upvalue with the argument and then its first with the result.
+// Each closure compose makes is a closure like any other, so OP_CALL runs
+// it without knowing a builtin made it. It takes one argument, as the
+// interpreter's composed functions do.
+func composedChunk() *Chunk {
+	c := NewChunk()
+	c.WriteOpcode(OP_GET_LOCAL_0, 0)
+	c.WriteOpcode(OP_GET_UPVALUE, 0)
+	c.WriteByte(1, 0)
+	c.WriteOpcode(OP_CALL_1, 0)
+	c.WriteOpcode(OP_GET_UPVALUE, 0)
+	c.WriteByte(0, 0)
+	c.WriteOpcode(OP_CALL_1, 0)
+	c.WriteOpcode(OP_RETURN, 0)
+	return c
+}
+
+// builtinCompose joins f and g into one function of x that gives f(g(x))
+func builtinCompose(vm *VM, args []Value) (Value, error) {
+	if len(args) != 2 {
+		return NewNothing(), vm.runtimeError("compose wan make two functions, you give am %d argument", len(args))
+	}
+	for _, arg := range args {
+		if !arg.IsFunc() && !arg.IsBuiltin() {
+			return NewNothing(), vm.runtimeError("I no fit compose %s", objectTypeName(arg))
+		}
+	}
+	if vm.composed == nil {
+		vm.composed = &Function{Arity: 1, LocalCount: 1, Chunk: composedChunk()}
+	}
+	return vm.closeOver(vm.composed, args...), nil
+}
+
+// affixBuiltin makes a builtin that takes a string and an affix and gives
+// back fn of them
+func affixBuiltin(name string, fn func(s, affix string) string) BuiltinFn {
+	return func(vm *VM, args []Value) (Value, error) {
+		if len(args) != 2 {
+			return NewNothing(), vm.runtimeError("%s wan make 2 argument, you give am %d", name, len(args))
+		}
+		for _, arg := range args {
+			if !arg.IsString() {
+				return NewNothing(), vm.runtimeError("%s wan make STRING, you give am %s", name, objectTypeName(arg))
+			}
+		}
+		return vm.MakeString(fn(*args[0].AsString(), *args[1].AsString())), nil
+	}
+}
+
+// reverseString reverses s a character at a time, so letters made of more
+// than one byte stay whole
+func reverseString(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// objectTypeName returns the same type names the tree-walking interpreter reports
+func objectTypeName(v Value) string {
+	switch v.GetTag() {
+	case TAG_INT:
+		return "INTEGER"
+	case TAG_FLOAT:
+		return "FLOAT"
+	case TAG_BOOL:
+		return "BOOLEAN"
+	case TAG_NOTHING:
+		return "NOTHING"
+	case TAG_STRING:
+		return "STRING"
+	case TAG_FUNC:
+		return "FUNCTION"
+	case TAG_BUILTIN:
+		return "BUILTIN"
+	case TAG_ERROR:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", v.GetTag())
+	}
+}
@@ -2,6 +2,8 @@ package vm
 
 import (
 	"fmt"
+	"io"
+	"os"
 )
 
 // Chunk represents a sequence of bytecode instructions with associated metadata
@@ -10,6 +12,12 @@ type Chunk struct {
 	Constants []Value           // Constant pool (NaN-boxed values)
 	Lines     []int             // Line numbers for each instruction (for error reporting)
 	strings   map[string]*string // Interned strings for deduplication
+	functions []*Function        // Function constants, kept reachable for the GC
+
+	// Constant pool indices for deduplication: scalars by bit pattern,
+	// strings by content since two copies of a string have different pointers
+	valueIndex  map[Value]int
+	stringIndex map[string]int
 }
 
 // NewChunk creates a new empty chunk
@@ -19,6 +27,9 @@ func NewChunk() *Chunk {
 		Constants: make([]Value, 0, 32),
 		Lines:     make([]int, 0, 256),
 		strings:   make(map[string]*string),
+
+		valueIndex:  make(map[Value]int),
+		stringIndex: make(map[string]int),
 	}
 }
 
@@ -56,16 +67,34 @@ func (c *Chunk) Count() int {
 // AddConstant adds a value to the constant pool and returns its index
 // Deduplicates identical values to save memory
 func (c *Chunk) AddConstant(value Value) int {
-	// Check if we already have this constant
-	for i, existing := range c.Constants {
-		if existing.Equals(value) {
+	// Check if we already have this constant. Lookups go by bits rather
+	// than Equals, so the integer 2 and the float 2.0 stay separate.
+	if value.IsString() {
+		if i, ok := c.stringIndex[*value.AsString()]; ok {
 			return i
 		}
+	} else if i, ok := c.valueIndex[value]; ok {
+		return i
 	}
 
 	// Add new constant
 	c.Constants = append(c.Constants, value)
-	return len(c.Constants) - 1
+	index := len(c.Constants) - 1
+
+	if value.IsString() {
+		c.stringIndex[*value.AsString()] = index
+	} else {
+		c.valueIndex[value] = index
+	}
+	return index
+}
+
+// AddFunction adds a function to the constant pool and returns its index.
+// NaN-boxing hides the pointer from the garbage collector, so the chunk
+// holds on to the function itself as well.
+func (c *Chunk) AddFunction(fn *Function) int {
+	c.functions = append(c.functions, fn)
+	return c.AddConstant(NewFunc(fn))
 }
 
 // GetConstant retrieves a constant by index
@@ -120,13 +149,19 @@ func (c *Chunk) Disassemble(name string) {
 
 // DisassembleInstruction prints a single instruction and returns the next offset
 func (c *Chunk) DisassembleInstruction(offset int) int {
-	fmt.Printf("%04d ", offset)
+	return c.DisassembleInstructionTo(os.Stdout, offset)
+}
+
+// DisassembleInstructionTo writes a single instruction to w and returns the
+// next offset
+func (c *Chunk) DisassembleInstructionTo(w io.Writer, offset int) int {
+	fmt.Fprintf(w, "%04d ", offset)
 
 	// Print line number (with run-length encoding for readability)
 	if offset > 0 && c.Lines[offset] == c.Lines[offset-1] {
-		fmt.Print("   | ")
+		fmt.Fprint(w, "   | ")
 	} else {
-		fmt.Printf("%4d ", c.Lines[offset])
+		fmt.Fprintf(w, "%4d ", c.Lines[offset])
 	}
 
 	instruction := Opcode(c.Code[offset])
@@ -135,50 +170,65 @@ func (c *Chunk) DisassembleInstruction(offset int) int {
 	// Simple instructions (no operands)
 	case OP_CONST_0, OP_CONST_1, OP_CONST_MINUS1,
 		OP_NOTHING, OP_TRU, OP_LIE,
-		OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_NEGATE,
-		OP_EQUAL, OP_NOT_EQUAL, OP_GREATER, OP_LESS, OP_NOT,
+		OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_NEGATE,
+		OP_EQUAL, OP_NOT_EQUAL, OP_GREATER, OP_LESS,
+		OP_GREATER_EQUAL, OP_LESS_EQUAL, OP_NOT,
 		OP_GET_LOCAL_0, OP_GET_LOCAL_1, OP_GET_LOCAL_2, OP_GET_LOCAL_3,
 		OP_SET_LOCAL_0, OP_SET_LOCAL_1,
 		OP_CALL_0, OP_CALL_1, OP_CALL_2,
 		OP_RETURN, OP_BRING,
-		OP_POP, OP_DUP, OP_CONCAT, OP_HALT:
-		return c.simpleInstruction(instruction, offset)
+		OP_POP, OP_DUP, OP_SWAP, OP_OVER, OP_CONCAT, OP_END_TRY, OP_THROW, OP_HALT:
+		return c.simpleInstruction(w, instruction, offset)
 
 	// Byte operand instructions
 	case OP_CONST_I8:
-		return c.byteInstruction(instruction, offset)
+		return c.byteInstruction(w, instruction, offset)
+
+	// Shifts (1-byte power of two)
+	case OP_SHIFT_LEFT, OP_SHIFT_RIGHT:
+		return c.byteInstruction(w, instruction, offset)
 
 	// Short operand instructions
 	case OP_CONST_I16:
-		return c.shortInstruction(instruction, offset)
+		return c.shortInstruction(w, instruction, offset)
 
 	// Constant instructions (2-byte index into constants pool)
 	case OP_CONSTANT:
-		return c.constantInstruction(instruction, offset)
+		return c.constantInstruction(w, instruction, offset)
 
 	// Local variable instructions (1-byte slot)
-	case OP_GET_LOCAL, OP_SET_LOCAL:
-		return c.byteInstruction(instruction, offset)
+	case OP_GET_LOCAL, OP_SET_LOCAL, OP_GET_UPVALUE, OP_SET_UPVALUE:
+		return c.byteInstruction(w, instruction, offset)
 
 	// Global variable instructions (2-byte index)
 	case OP_GET_GLOBAL, OP_SET_GLOBAL:
-		return c.shortInstruction(instruction, offset)
+		return c.shortInstruction(w, instruction, offset)
+
+	// Unbound mark (2-byte index of the name)
+	case OP_UNBOUND:
+		return c.constantInstruction(w, instruction, offset)
 
 	// Jump instructions (2-byte offset)
-	case OP_JUMP, OP_JUMP_IF_LIE, OP_JUMP_IF_TRU:
-		return c.jumpInstruction(instruction, 1, offset)
+	case OP_JUMP, OP_JUMP_IF_LIE, OP_JUMP_IF_TRU, OP_JUMP_IF_LIE_PEEK, OP_JUMP_IF_TRU_PEEK:
+		return c.jumpInstruction(w, instruction, 1, offset)
 
 	// Loop instruction (2-byte backward offset)
 	case OP_LOOP:
-		return c.jumpInstruction(instruction, -1, offset)
+		return c.jumpInstruction(w, instruction, -1, offset)
+
+	// Long jump instructions (3-byte offset)
+	case OP_JUMP_LONG, OP_TRY:
+		return c.longJumpInstruction(w, instruction, 1, offset)
+	case OP_LOOP_LONG:
+		return c.longJumpInstruction(w, instruction, -1, offset)
 
 	// Call instructions with argument count
-	case OP_CALL, OP_YARN:
-		return c.byteInstruction(instruction, offset)
+	case OP_CALL, OP_TAIL_CALL, OP_YARN:
+		return c.byteInstruction(w, instruction, offset)
 
-	// Closure instruction
+	// Closure instruction (shows the function it closes over)
 	case OP_CLOSURE:
-		return c.shortInstruction(instruction, offset)
+		return c.constantInstruction(w, instruction, offset)
 
 	// Builtin instruction (builtin index + arg count)
 	case OP_BUILTIN:
@@ -186,53 +236,60 @@ func (c *Chunk) DisassembleInstruction(offset int) int {
 		builtinIdx := c.Code[offset]
 		offset++
 		argCount := c.Code[offset]
-		fmt.Printf("%-16s %4d (args: %d)\n", instruction.String(), builtinIdx, argCount)
+		fmt.Fprintf(w, "%-16s %4d (args: %d)\n", instruction.String(), builtinIdx, argCount)
 		return offset + 1
 
 	default:
-		fmt.Printf("Unknown opcode %d\n", instruction)
+		fmt.Fprintf(w, "Unknown opcode %d\n", instruction)
 		return offset + 1
 	}
 }
 
 // simpleInstruction disassembles instructions with no operands
-func (c *Chunk) simpleInstruction(op Opcode, offset int) int {
-	fmt.Printf("%s\n", op.String())
+func (c *Chunk) simpleInstruction(w io.Writer, op Opcode, offset int) int {
+	fmt.Fprintf(w, "%s\n", op.String())
 	return offset + 1
 }
 
 // byteInstruction disassembles instructions with a 1-byte operand
-func (c *Chunk) byteInstruction(op Opcode, offset int) int {
+func (c *Chunk) byteInstruction(w io.Writer, op Opcode, offset int) int {
 	slot := c.Code[offset+1]
-	fmt.Printf("%-16s %4d\n", op.String(), slot)
+	fmt.Fprintf(w, "%-16s %4d\n", op.String(), slot)
 	return offset + 2
 }
 
 // shortInstruction disassembles instructions with a 2-byte operand
-func (c *Chunk) shortInstruction(op Opcode, offset int) int {
+func (c *Chunk) shortInstruction(w io.Writer, op Opcode, offset int) int {
 	value := uint16(c.Code[offset+1])<<8 | uint16(c.Code[offset+2])
-	fmt.Printf("%-16s %4d\n", op.String(), value)
+	fmt.Fprintf(w, "%-16s %4d\n", op.String(), value)
 	return offset + 3
 }
 
 // constantInstruction disassembles OP_CONSTANT (shows the constant value)
-func (c *Chunk) constantInstruction(op Opcode, offset int) int {
+func (c *Chunk) constantInstruction(w io.Writer, op Opcode, offset int) int {
 	constantIdx := uint16(c.Code[offset+1])<<8 | uint16(c.Code[offset+2])
-	fmt.Printf("%-16s %4d '", op.String(), constantIdx)
+	fmt.Fprintf(w, "%-16s %4d '", op.String(), constantIdx)
 
 	if int(constantIdx) < len(c.Constants) {
 		constant := c.Constants[constantIdx]
-		fmt.Printf("%s", constant.String())
+		fmt.Fprintf(w, "%s", constant.String())
 	}
 
-	fmt.Printf("'\n")
+	fmt.Fprintf(w, "'\n")
 	return offset + 3
 }
 
 // jumpInstruction disassembles jump instructions
-func (c *Chunk) jumpInstruction(op Opcode, sign int, offset int) int {
+func (c *Chunk) jumpInstruction(w io.Writer, op Opcode, sign int, offset int) int {
 	jump := int16(uint16(c.Code[offset+1])<<8 | uint16(c.Code[offset+2]))
 	target := offset + 3 + sign*int(jump)
-	fmt.Printf("%-16s %4d -> %d\n", op.String(), offset, target)
+	fmt.Fprintf(w, "%-16s %4d -> %d\n", op.String(), offset, target)
 	return offset + 3
 }
+
+func (c *Chunk) longJumpInstruction(w io.Writer, op Opcode, sign int, offset int) int {
+	jump := int(c.Code[offset+1])<<16 | int(c.Code[offset+2])<<8 | int(c.Code[offset+3])
+	target := offset + 4 + sign*jump
+	fmt.Fprintf(w, "%-16s %4d -> %d\n", op.String(), offset, target)
+	return offset + 4
+}
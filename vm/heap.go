@@ -0,0 +1,86 @@
+package vm
+
+// ============================================================================
+// Heap - Objects made while running
+// ============================================================================
+
+// HEAP_MIN is how many objects the heap holds before its first sweep
+const HEAP_MIN = 1024
+
+// NaN-boxing hides a value's pointer from Go's garbage collector, so objects
+// the program makes while it runs (closures, error values, strings from the
+// host) go into vm.heap to stay alive. When the heap fills up, sweep keeps
+// only the objects the program can still reach and lets Go collect the rest.
+
+// hold keeps obj alive for as long as the program can reach it. Anything
+// live must be on the stack below vm.stackTop, in a global or in a call
+// frame by the time hold is called, since it may sweep first.
+func (vm *VM) hold(obj any) {
+	if vm.heap == nil {
+		vm.heap = make(map[any]struct{})
+		vm.heapLimit = HEAP_MIN
+	}
+	if len(vm.heap) >= vm.heapLimit {
+		vm.sweep()
+	}
+	vm.heap[obj] = struct{}{}
+}
+
+// sweep drops the objects nothing reachable refers to any more: not the
+// stack, the globals, the functions running, or the upvalues of any
+// closure those lead to. The limit then grows with what survived, so a
+// program that keeps a lot doesn't sweep on every object.
+func (vm *VM) sweep() {
+	live := make(map[any]struct{}, len(vm.heap))
+	for _, value := range vm.stack[:vm.stackTop] {
+		markValue(value, live)
+	}
+	for _, value := range vm.globals {
+		markValue(value, live)
+	}
+	for i := 0; i < vm.frameCount; i++ {
+		markFunction(vm.frames[i].function, live)
+	}
+
+	for obj := range vm.heap {
+		if _, ok := live[obj]; !ok {
+			delete(vm.heap, obj)
+		}
+	}
+	vm.heapLimit = max(HEAP_MIN, 2*len(vm.heap))
+}
+
+// markValue records the object value points at, if any, as live
+func markValue(value Value, live map[any]struct{}) {
+	switch {
+	case value.IsString():
+		live[value.AsString()] = struct{}{}
+	case value.IsError():
+		live[value.AsError()] = struct{}{}
+	case value.IsFunc():
+		markFunction(value.AsFunc(), live)
+	}
+}
+
+// markFunction records fn as live, along with whatever its upvalues hold
+func markFunction(fn *Function, live map[any]struct{}) {
+	if fn == nil {
+		return
+	}
+	if _, seen := live[fn]; seen {
+		return
+	}
+	live[fn] = struct{}{}
+	for _, upvalue := range fn.Upvalues {
+		markValue(*upvalue.Location, live)
+	}
+}
+
+// MakeString gives s as a string value the VM keeps alive for as long as
+// the program can reach it, for hosts that pass in text while running
+func (vm *VM) MakeString(s string) Value {
+	ptr := new(string)
+	*ptr = s
+	vm.hold(ptr)
+	return NewString(ptr)
+}
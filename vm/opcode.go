@@ -27,6 +27,13 @@ const (
 	OP_MUL    Opcode = 12 // a * b
 	OP_DIV    Opcode = 13 // a / b
 	OP_NEGATE Opcode = 14 // -a
+	OP_MOD    Opcode = 15 // a % b
+
+	// a * 2^n and a / 2^n, which the compiler emits for multiplying or
+	// dividing by a constant power of two. Integers shift; anything else
+	// gives exactly what OP_MUL or OP_DIV would.
+	OP_SHIFT_LEFT  Opcode = 16 // a * 2^n: [u8 n]
+	OP_SHIFT_RIGHT Opcode = 17 // a / 2^n, rounding toward zero: [u8 n]
 
 	// ========================================================================
 	// Comparison (20-29)
@@ -37,6 +44,9 @@ const (
 	OP_GREATER   Opcode = 22 // a big pass b (greater than)
 	OP_LESS      Opcode = 23 // a no reach b (less than)
 
+	OP_GREATER_EQUAL Opcode = 24 // a reach b (greater than or equal)
+	OP_LESS_EQUAL    Opcode = 25 // a <= b (less than or equal)
+
 	// ========================================================================
 	// Logical (30-34)
 	// ========================================================================
@@ -66,10 +76,26 @@ const (
 	// ========================================================================
 
 	OP_JUMP        Opcode = 45 // Unconditional jump: [i16 offset]
-	OP_JUMP_IF_LIE Opcode = 46 // Jump if false: [i16 offset]
-	OP_JUMP_IF_TRU Opcode = 47 // Jump if true: [i16 offset]
+	OP_JUMP_IF_LIE Opcode = 46 // Pop condition, jump if false: [i16 offset]
+	OP_JUMP_IF_TRU Opcode = 47 // Pop condition, jump if true: [i16 offset]
 	OP_LOOP        Opcode = 48 // Jump backward: [u16 offset]
 
+	// The peek variants leave the condition on the stack, for 'and' and
+	// 'abi' whose result is the operand that decided them
+	OP_JUMP_IF_LIE_PEEK Opcode = 49 // Jump if false, keeping condition: [i16 offset]
+	OP_JUMP_IF_TRU_PEEK Opcode = 50 // Jump if true, keeping condition: [i16 offset]
+
+	// Long forms, for jumps too far for a 16-bit offset
+	OP_JUMP_LONG Opcode = 51 // Unconditional jump forward: [u24 offset]
+	OP_LOOP_LONG Opcode = 52 // Jump backward: [u24 offset]
+
+	// A try block runs between OP_TRY and OP_END_TRY. A runtime error in
+	// between, even in a function it calls, unwinds the stack to where
+	// OP_TRY left it, pushes the error's message and jumps to the rescue
+	// code at OP_TRY's target.
+	OP_TRY     Opcode = 53 // Start a try block: [u24 offset to rescue]
+	OP_END_TRY Opcode = 54 // Leave the innermost try block
+
 	// ========================================================================
 	// Functions (55-64)
 	// ========================================================================
@@ -78,10 +104,16 @@ const (
 	OP_CALL_1  Opcode = 56 // Call function with 1 arg
 	OP_CALL_2  Opcode = 57 // Call function with 2 args
 	OP_CALL    Opcode = 58 // Call function: [u8 argCount]
-	OP_CLOSURE Opcode = 59 // Create closure: [u16 funcIndex]
-	OP_RETURN  Opcode = 60 // Return from function
+	OP_CLOSURE Opcode = 59 // Push a closure over a function constant: [u16 funcIndex]
+	OP_RETURN  Opcode = 60 // Return the value the function body ended with
 	OP_BRING   Opcode = 61 // Return value (Pidgin's 'bring')
 
+	OP_TAIL_CALL Opcode = 62 // Call whose result the caller brings back: [u8 argCount]
+
+	// A closure's captured variables, by their index in its Upvalues
+	OP_GET_UPVALUE Opcode = 63 // Get captured var: [u8 index]
+	OP_SET_UPVALUE Opcode = 64 // Set captured var: [u8 index]
+
 	// ========================================================================
 	// Builtins (65-74)
 	// ========================================================================
@@ -93,8 +125,10 @@ const (
 	// Stack Manipulation (75-79)
 	// ========================================================================
 
-	OP_POP Opcode = 75 // Pop and discard top value
-	OP_DUP Opcode = 76 // Duplicate top value
+	OP_POP  Opcode = 75 // Pop and discard top value
+	OP_DUP  Opcode = 76 // Duplicate top value
+	OP_SWAP Opcode = 77 // Exchange the top two values
+	OP_OVER Opcode = 78 // Copy the value under the top onto the top
 
 	// ========================================================================
 	// String Operations (80-84)
@@ -107,6 +141,14 @@ const (
 	// ========================================================================
 
 	OP_HALT Opcode = 85 // Stop execution
+
+	// A variable that has gone out of scope holds this mark, so a closure
+	// that captured it fails on reading it as if the name were unknown
+	OP_UNBOUND Opcode = 86 // Push the mark for an unbound name: [u16 name index]
+
+	// Rescue code that only tidies up hands the error on to the next try
+	// block out with the message the rescue was given
+	OP_THROW Opcode = 87 // Pop a message and raise it as a runtime error
 )
 
 // OpcodeNames maps opcodes to their string names for debugging
@@ -128,6 +170,10 @@ var OpcodeNames = map[Opcode]string{
 	OP_MUL:    "OP_MUL",
 	OP_DIV:    "OP_DIV",
 	OP_NEGATE: "OP_NEGATE",
+	OP_MOD:    "OP_MOD",
+
+	OP_SHIFT_LEFT:  "OP_SHIFT_LEFT",
+	OP_SHIFT_RIGHT: "OP_SHIFT_RIGHT",
 
 	// Comparison
 	OP_EQUAL:     "OP_EQUAL",
@@ -135,6 +181,9 @@ var OpcodeNames = map[Opcode]string{
 	OP_GREATER:   "OP_GREATER",
 	OP_LESS:      "OP_LESS",
 
+	OP_GREATER_EQUAL: "OP_GREATER_EQUAL",
+	OP_LESS_EQUAL:    "OP_LESS_EQUAL",
+
 	// Logical
 	OP_NOT: "OP_NOT",
 
@@ -156,6 +205,14 @@ var OpcodeNames = map[Opcode]string{
 	OP_JUMP_IF_TRU: "OP_JUMP_IF_TRU",
 	OP_LOOP:        "OP_LOOP",
 
+	OP_JUMP_IF_LIE_PEEK: "OP_JUMP_IF_LIE_PEEK",
+	OP_JUMP_IF_TRU_PEEK: "OP_JUMP_IF_TRU_PEEK",
+
+	OP_JUMP_LONG: "OP_JUMP_LONG",
+	OP_LOOP_LONG: "OP_LOOP_LONG",
+	OP_TRY:       "OP_TRY",
+	OP_END_TRY:   "OP_END_TRY",
+
 	// Functions
 	OP_CALL_0:  "OP_CALL_0",
 	OP_CALL_1:  "OP_CALL_1",
@@ -165,19 +222,28 @@ var OpcodeNames = map[Opcode]string{
 	OP_RETURN:  "OP_RETURN",
 	OP_BRING:   "OP_BRING",
 
+	OP_TAIL_CALL: "OP_TAIL_CALL",
+
+	OP_GET_UPVALUE: "OP_GET_UPVALUE",
+	OP_SET_UPVALUE: "OP_SET_UPVALUE",
+
 	// Builtins
 	OP_YARN:    "OP_YARN",
 	OP_BUILTIN: "OP_BUILTIN",
 
 	// Stack Manipulation
-	OP_POP: "OP_POP",
-	OP_DUP: "OP_DUP",
+	OP_POP:  "OP_POP",
+	OP_DUP:  "OP_DUP",
+	OP_SWAP: "OP_SWAP",
+	OP_OVER: "OP_OVER",
 
 	// String Operations
 	OP_CONCAT: "OP_CONCAT",
 
 	// Special
-	OP_HALT: "OP_HALT",
+	OP_HALT:    "OP_HALT",
+	OP_UNBOUND: "OP_UNBOUND",
+	OP_THROW:   "OP_THROW",
 }
 
 // String returns the name of the opcode
@@ -202,6 +268,7 @@ var OpcodeOperandCount = map[Opcode]int{
 	OP_MUL:          0,
 	OP_DIV:          0,
 	OP_NEGATE:       0,
+	OP_MOD:          0,
 	OP_EQUAL:        0,
 	OP_NOT_EQUAL:    0,
 	OP_GREATER:      0,
@@ -220,8 +287,14 @@ var OpcodeOperandCount = map[Opcode]int{
 	OP_BRING:        0,
 	OP_POP:          0,
 	OP_DUP:          0,
+	OP_SWAP:         0,
+	OP_OVER:         0,
 	OP_CONCAT:       0,
 	OP_HALT:         0,
+	OP_THROW:        0,
+
+	OP_GREATER_EQUAL: 0,
+	OP_LESS_EQUAL:    0,
 
 	// 1 byte operand
 	OP_CONST_I8:    1,
@@ -229,6 +302,13 @@ var OpcodeOperandCount = map[Opcode]int{
 	OP_SET_LOCAL:   1,
 	OP_CALL:        1,
 	OP_YARN:        1,
+	OP_TAIL_CALL:   1,
+
+	OP_GET_UPVALUE: 1,
+	OP_SET_UPVALUE: 1,
+
+	OP_SHIFT_LEFT:  1,
+	OP_SHIFT_RIGHT: 1,
 
 	// 2 byte operands
 	OP_CONST_I16:   2,
@@ -240,7 +320,16 @@ var OpcodeOperandCount = map[Opcode]int{
 	OP_JUMP_IF_TRU: 2,
 	OP_LOOP:        2,
 	OP_CLOSURE:     2,
+	OP_UNBOUND:     2,
 	OP_BUILTIN:     2, // builtinIndex + argCount
+
+	OP_JUMP_IF_LIE_PEEK: 2,
+	OP_JUMP_IF_TRU_PEEK: 2,
+
+	// 3 byte operands
+	OP_JUMP_LONG: 3,
+	OP_LOOP_LONG: 3,
+	OP_TRY:       3,
 }
 
 // GetOperandCount returns the number of operand bytes for an opcode
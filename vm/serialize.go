@@ -0,0 +1,343 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Bytecode File Format
+//
+// A compiled program is saved as:
+//
+//	magic "PDGC" | version (u8) | chunk
+//
+// and a chunk as:
+//
+//	code length, code bytes | line count, lines | constant count, constants
+//
+// Lengths, counts and lines are unsigned varints. Each constant is a tag
+// byte followed by its payload:
+//
+//	int      signed varint
+//	float    8 bytes, little-endian IEEE 754 bits
+//	bool     1 byte
+//	nothing  no payload
+//	string   length, bytes
+//	builtin  index
+//	function arity, local count, name and return type (as strings), captures,
+//	         chunk
+//
+// where captures is a count followed by each capture's local flag (1 byte)
+// and index.
+//
+// Strings are interned again when a chunk is loaded, so the loaded chunk
+// owns them just like a freshly compiled one.
+
+const (
+	BYTECODE_MAGIC   = "PDGC"
+	BYTECODE_VERSION = 10
+)
+
+// ErrBadBytecode is wrapped by every error DeserializeChunk returns
+var ErrBadBytecode = errors.New("bad bytecode file")
+
+// Constant tags in the bytecode file, independent of the NaN-boxing tags
+const (
+	constInt byte = iota
+	constFloat
+	constBool
+	constNothing
+	constString
+	constBuiltin
+	constFunc
+)
+
+// ============================================================================
+// Serialization
+// ============================================================================
+
+// Serialize encodes the chunk, with every function it holds, in the
+// bytecode file format
+func (c *Chunk) Serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(BYTECODE_MAGIC)
+	buf.WriteByte(BYTECODE_VERSION)
+
+	w := &chunkWriter{buf: &buf, open: make(map[*Function]bool)}
+	if err := w.chunk(c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// chunkWriter writes chunks, remembering which functions it is inside so a
+// function that holds itself can't send it round forever
+type chunkWriter struct {
+	buf  *bytes.Buffer
+	open map[*Function]bool
+}
+
+func (w *chunkWriter) uvarint(n uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	w.buf.Write(tmp[:binary.PutUvarint(tmp[:], n)])
+}
+
+func (w *chunkWriter) varint(n int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	w.buf.Write(tmp[:binary.PutVarint(tmp[:], n)])
+}
+
+func (w *chunkWriter) text(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *chunkWriter) chunk(c *Chunk) error {
+	w.uvarint(uint64(len(c.Code)))
+	w.buf.Write(c.Code)
+
+	w.uvarint(uint64(len(c.Lines)))
+	for _, line := range c.Lines {
+		w.uvarint(uint64(line))
+	}
+
+	w.uvarint(uint64(len(c.Constants)))
+	for i, value := range c.Constants {
+		if err := w.constant(value); err != nil {
+			return fmt.Errorf("constant %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (w *chunkWriter) constant(value Value) error {
+	switch {
+	case value.IsFloat():
+		w.buf.WriteByte(constFloat)
+		var tmp [8]byte
+		binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(value.AsFloat()))
+		w.buf.Write(tmp[:])
+	case value.IsInt():
+		w.buf.WriteByte(constInt)
+		w.varint(value.AsInt())
+	case value.IsBool():
+		w.buf.WriteByte(constBool)
+		if value.AsBool() {
+			w.buf.WriteByte(1)
+		} else {
+			w.buf.WriteByte(0)
+		}
+	case value.IsNothing():
+		w.buf.WriteByte(constNothing)
+	case value.IsString():
+		w.buf.WriteByte(constString)
+		w.text(*value.AsString())
+	case value.IsBuiltin():
+		w.buf.WriteByte(constBuiltin)
+		w.uvarint(uint64(value.AsBuiltin()))
+	case value.IsFunc():
+		fn := value.AsFunc()
+		if w.open[fn] {
+			return fmt.Errorf("function %q holds itself", fn.Name)
+		}
+		w.open[fn] = true
+		defer delete(w.open, fn)
+
+		w.buf.WriteByte(constFunc)
+		w.uvarint(uint64(fn.Arity))
+		w.uvarint(uint64(fn.LocalCount))
+		w.text(fn.Name)
+		w.text(fn.ReturnType)
+		w.uvarint(uint64(len(fn.Captures)))
+		for _, capture := range fn.Captures {
+			if capture.IsLocal {
+				w.buf.WriteByte(1)
+			} else {
+				w.buf.WriteByte(0)
+			}
+			w.uvarint(uint64(capture.Index))
+		}
+		return w.chunk(fn.Chunk)
+	default:
+		return fmt.Errorf("%s values can't be saved", value.TypeName())
+	}
+	return nil
+}
+
+// ============================================================================
+// Deserialization
+// ============================================================================
+
+// DeserializeChunk decodes a chunk written by Serialize
+func DeserializeChunk(data []byte) (*Chunk, error) {
+	if !bytes.HasPrefix(data, []byte(BYTECODE_MAGIC)) {
+		return nil, fmt.Errorf("%w: not a Pidgin bytecode file", ErrBadBytecode)
+	}
+	data = data[len(BYTECODE_MAGIC):]
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: file ends early", ErrBadBytecode)
+	}
+	if data[0] != BYTECODE_VERSION {
+		return nil, fmt.Errorf("%w: version %d, this Pidgin reads version %d",
+			ErrBadBytecode, data[0], BYTECODE_VERSION)
+	}
+
+	r := &chunkReader{data: data[1:]}
+	chunk := r.chunk()
+	if r.err == nil && len(r.data) > 0 {
+		r.fail("%d extra bytes after the program", len(r.data))
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return chunk, nil
+}
+
+// chunkReader reads chunks, keeping the first error it meets so the
+// reading code doesn't have to check after every field
+type chunkReader struct {
+	data []byte
+	err  error
+}
+
+func (r *chunkReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s", ErrBadBytecode, fmt.Sprintf(format, args...))
+	}
+}
+
+func (r *chunkReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(r.data)
+	if size <= 0 {
+		r.fail("file ends early")
+		return 0
+	}
+	r.data = r.data[size:]
+	return n
+}
+
+func (r *chunkReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	n, size := binary.Varint(r.data)
+	if size <= 0 {
+		r.fail("file ends early")
+		return 0
+	}
+	r.data = r.data[size:]
+	return n
+}
+
+// count reads a length and checks the file still has at least that many
+// bytes, so a corrupt length can't make us allocate the world
+func (r *chunkReader) count() int {
+	n := r.uvarint()
+	if r.err == nil && n > uint64(len(r.data)) {
+		r.fail("file ends early")
+		return 0
+	}
+	return int(n)
+}
+
+func (r *chunkReader) raw(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.fail("file ends early")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *chunkReader) u8() byte {
+	if b := r.raw(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *chunkReader) text() string {
+	return string(r.raw(r.count()))
+}
+
+func (r *chunkReader) chunk() *Chunk {
+	chunk := NewChunk()
+
+	chunk.Code = append(chunk.Code, r.raw(r.count())...)
+
+	lines := r.count()
+	for i := 0; i < lines && r.err == nil; i++ {
+		chunk.Lines = append(chunk.Lines, int(r.uvarint()))
+	}
+	if r.err == nil && len(chunk.Lines) != len(chunk.Code) {
+		r.fail("%d lines for %d bytes of code", len(chunk.Lines), len(chunk.Code))
+	}
+
+	constants := r.count()
+	for i := 0; i < constants && r.err == nil; i++ {
+		r.constant(chunk, i)
+	}
+	return chunk
+}
+
+// constant reads the constant at index i into chunk
+func (r *chunkReader) constant(chunk *Chunk, i int) {
+	var index int
+	switch tag := r.u8(); tag {
+	case constInt:
+		n := r.varint()
+		if n < MIN_INT_48 || n > MAX_INT_48 {
+			r.fail("constant %d: integer %d too big", i, n)
+			return
+		}
+		index = chunk.AddConstant(NewInt(n))
+	case constFloat:
+		bits := r.raw(8)
+		if bits == nil {
+			return
+		}
+		index = chunk.AddConstant(NewFloat(math.Float64frombits(binary.LittleEndian.Uint64(bits))))
+	case constBool:
+		index = chunk.AddConstant(NewBool(r.u8() != 0))
+	case constNothing:
+		index = chunk.AddConstant(NewNothing())
+	case constString:
+		index = chunk.AddConstant(NewString(chunk.InternString(r.text())))
+	case constBuiltin:
+		n := r.uvarint()
+		if n >= uint64(len(Builtins)) {
+			r.fail("constant %d: no builtin %d", i, n)
+			return
+		}
+		index = chunk.AddConstant(NewBuiltin(int(n)))
+	case constFunc:
+		fn := &Function{Arity: int(r.uvarint()), LocalCount: int(r.uvarint())}
+		fn.Name = r.text()
+		fn.ReturnType = r.text()
+		captures := r.count()
+		for j := 0; j < captures && r.err == nil; j++ {
+			fn.Captures = append(fn.Captures, Capture{IsLocal: r.u8() != 0, Index: int(r.uvarint())})
+		}
+		fn.Chunk = r.chunk()
+		index = chunk.AddFunction(fn)
+	default:
+		r.fail("constant %d: unknown tag %d", i, tag)
+		return
+	}
+
+	// Compiled pools never hold the same constant twice, so each one lands
+	// at the index the code refers to it by
+	if r.err == nil && index != i {
+		r.fail("constant %d repeats constant %d", i, index)
+	}
+}
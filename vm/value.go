@@ -2,7 +2,12 @@ package vm
 
 import (
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"unsafe"
+
+	"pidgin-lang/object"
 )
 
 // NaN Boxing Value Representation
@@ -16,6 +21,9 @@ import (
 // Our encoding uses the mantissa (52 bits) for:
 // - Type tag (3 bits) in bits 48-50
 // - Payload (48 bits) in bits 0-47
+//
+// Anything that is not a quiet NaN is a plain float64. Floats that are
+// themselves NaN get stored as a signalling NaN so they never look boxed.
 
 const (
 	// Quiet NaN base with sign bit = 0
@@ -29,15 +37,22 @@ const (
 	TAG_FUNC    = 4 // 100 - pointer to function object
 	TAG_BUILTIN = 5 // 101 - builtin function index
 	TAG_ERROR   = 6 // 110 - pointer to error object
-	// TAG_RESERVED = 7 for future use
+	TAG_UNBOUND = 7 // 111 - variable gone out of scope (index of its name)
+
+	// Floats are stored unboxed, so this tag is never in the bits;
+	// GetTag reports it for any value that is not a quiet NaN
+	TAG_FLOAT = 8
+
+	// Bit pattern used for float NaN, outside the quiet NaN space
+	CANONICAL_NAN = 0x7FF0000000000001
 
 	TAG_SHIFT    = 48
 	TAG_MASK     = 0x7
 	PAYLOAD_MASK = 0x0000FFFFFFFFFFFF
 
-	// 48-bit integer limits
-	MAX_INT_48 = 140737488355327  // 2^47 - 1
-	MIN_INT_48 = -140737488355328 // -2^47
+	// 48-bit integer limits, shared with the interpreter
+	MAX_INT_48 = object.MAX_INT_48
+	MIN_INT_48 = object.MIN_INT_48
 )
 
 // Value is a NaN-boxed 64-bit value that can represent:
@@ -47,6 +62,7 @@ type Value uint64
 // Type names for debugging and error messages
 const (
 	TypeInt     = "number"
+	TypeFloat   = "number"
 	TypeBool    = "boolean"
 	TypeNothing = "nothing"
 	TypeString  = "string"
@@ -59,13 +75,22 @@ const (
 // Constructors
 // ============================================================================
 
-// NewInt creates a NaN-boxed integer value
+// NewInt creates a NaN-boxed integer value. Only the low 48 bits are kept,
+// so callers check i is within MIN_INT_48..MAX_INT_48 first.
 func NewInt(i int64) Value {
 	// Sign-extend to 48 bits
 	i48 := uint64(i) & PAYLOAD_MASK
 	return Value(QNAN_BASE | (TAG_INT << TAG_SHIFT) | i48)
 }
 
+// NewFloat creates a float value. Floats are stored as their own bits.
+func NewFloat(f float64) Value {
+	if math.IsNaN(f) {
+		return Value(CANONICAL_NAN)
+	}
+	return Value(math.Float64bits(f))
+}
+
 // NewBool creates a NaN-boxed boolean value
 func NewBool(b bool) Value {
 	var val uint64
@@ -103,48 +128,78 @@ func NewError(e *RuntimeError) Value {
 	return Value(QNAN_BASE | (TAG_ERROR << TAG_SHIFT) | ptr)
 }
 
+// NewUnbound creates the mark a variable holds once it has gone out of
+// scope. index picks the variable's name out of the VM's unbound names.
+func NewUnbound(index int) Value {
+	return Value(QNAN_BASE | (TAG_UNBOUND << TAG_SHIFT) | uint64(index))
+}
+
 // ============================================================================
 // Type Checking
 // ============================================================================
 
 // GetTag extracts the type tag from a NaN-boxed value
 func (v Value) GetTag() uint8 {
+	if v.IsFloat() {
+		return TAG_FLOAT
+	}
 	return uint8((v >> TAG_SHIFT) & TAG_MASK)
 }
 
+// IsFloat checks if the value is a float (anything outside the quiet NaN space)
+func (v Value) IsFloat() bool {
+	return uint64(v)&QNAN_BASE != QNAN_BASE
+}
+
+// IsNumber checks if the value is an integer or a float
+func (v Value) IsNumber() bool {
+	return v.IsInt() || v.IsFloat()
+}
+
+// hasTag checks for a boxed value with the given tag. Comparing the top
+// 16 bits checks the quiet NaN bits and the tag together, so floats never match.
+func (v Value) hasTag(tag uint64) bool {
+	return uint64(v)>>TAG_SHIFT == QNAN_BASE>>TAG_SHIFT|tag
+}
+
 // IsInt checks if the value is an integer
 func (v Value) IsInt() bool {
-	return v.GetTag() == TAG_INT
+	return v.hasTag(TAG_INT)
 }
 
 // IsBool checks if the value is a boolean
 func (v Value) IsBool() bool {
-	return v.GetTag() == TAG_BOOL
+	return v.hasTag(TAG_BOOL)
 }
 
 // IsNothing checks if the value is nothing/null
 func (v Value) IsNothing() bool {
-	return v.GetTag() == TAG_NOTHING
+	return v.hasTag(TAG_NOTHING)
 }
 
 // IsString checks if the value is a string
 func (v Value) IsString() bool {
-	return v.GetTag() == TAG_STRING
+	return v.hasTag(TAG_STRING)
 }
 
 // IsFunc checks if the value is a function
 func (v Value) IsFunc() bool {
-	return v.GetTag() == TAG_FUNC
+	return v.hasTag(TAG_FUNC)
 }
 
 // IsBuiltin checks if the value is a builtin function
 func (v Value) IsBuiltin() bool {
-	return v.GetTag() == TAG_BUILTIN
+	return v.hasTag(TAG_BUILTIN)
 }
 
 // IsError checks if the value is an error
 func (v Value) IsError() bool {
-	return v.GetTag() == TAG_ERROR
+	return v.hasTag(TAG_ERROR)
+}
+
+// IsUnbound checks if the value marks a variable gone out of scope
+func (v Value) IsUnbound() bool {
+	return v.hasTag(TAG_UNBOUND)
 }
 
 // ============================================================================
@@ -163,6 +218,19 @@ func (v Value) AsInt() int64 {
 	return i48
 }
 
+// AsFloat extracts a float value
+func (v Value) AsFloat() float64 {
+	return math.Float64frombits(uint64(v))
+}
+
+// AsNumber widens an integer or float value to float64
+func (v Value) AsNumber() float64 {
+	if v.IsInt() {
+		return float64(v.AsInt())
+	}
+	return v.AsFloat()
+}
+
 // AsBool extracts a boolean value
 func (v Value) AsBool() bool {
 	return (v & 1) != 0
@@ -191,6 +259,11 @@ func (v Value) AsError() *RuntimeError {
 	return (*RuntimeError)(unsafe.Pointer(ptr))
 }
 
+// AsUnbound extracts the index of an unbound variable's name
+func (v Value) AsUnbound() int {
+	return int(v & PAYLOAD_MASK)
+}
+
 // ============================================================================
 // Type Name
 // ============================================================================
@@ -200,6 +273,8 @@ func (v Value) TypeName() string {
 	switch v.GetTag() {
 	case TAG_INT:
 		return TypeInt
+	case TAG_FLOAT:
+		return TypeFloat
 	case TAG_BOOL:
 		return TypeBool
 	case TAG_NOTHING:
@@ -217,6 +292,31 @@ func (v Value) TypeName() string {
 	}
 }
 
+// ReturnTypes maps the type names a function can declare after 'bring' to
+// the tags of the values each one accepts
+var ReturnTypes = map[string][]uint8{
+	"number":   {TAG_INT, TAG_FLOAT},
+	"string":   {TAG_STRING},
+	"boolean":  {TAG_BOOL},
+	"nothing":  {TAG_NOTHING},
+	"function": {TAG_FUNC, TAG_BUILTIN},
+}
+
+// returnTypeAllows reports whether a function declared to bring typeName
+// may bring back v. An error value always may, as the interpreter lets an
+// error through instead of checking it.
+func returnTypeAllows(typeName string, v Value) bool {
+	if v.IsError() {
+		return true
+	}
+	for _, tag := range ReturnTypes[typeName] {
+		if v.GetTag() == tag {
+			return true
+		}
+	}
+	return false
+}
+
 // ============================================================================
 // String Representation
 // ============================================================================
@@ -226,6 +326,8 @@ func (v Value) String() string {
 	switch v.GetTag() {
 	case TAG_INT:
 		return fmt.Sprintf("%d", v.AsInt())
+	case TAG_FLOAT:
+		return formatFloat(v.AsFloat())
 	case TAG_BOOL:
 		if v.AsBool() {
 			return "tru"
@@ -282,6 +384,11 @@ func (v Value) Equals(other Value) bool {
 		return true
 	}
 
+	// Numbers compare by value, so 2.0 be 2
+	if v.IsNumber() && other.IsNumber() {
+		return v.AsNumber() == other.AsNumber()
+	}
+
 	// Different types are never equal
 	if v.GetTag() != other.GetTag() {
 		return false
@@ -296,6 +403,16 @@ func (v Value) Equals(other Value) bool {
 	return false
 }
 
+// formatFloat prints a float the way the tree-walking interpreter does,
+// always keeping a decimal point so 2.0 doesn't look like the integer 2
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
 // ============================================================================
 // Helper Types
 // ============================================================================
@@ -306,10 +423,44 @@ type Function struct {
 	Chunk      *Chunk // Bytecode chunk
 	Name       string // Function name (for debugging)
 	LocalCount int    // Total local variables (including parameters)
+	ReturnType string // Declared return type, empty if not annotated
+
+	// Captures says where OP_CLOSURE finds each upvalue, and Upvalues holds
+	// them once it has. The function in the constant pool only has
+	// Captures; each closure made from it is a copy with its own Upvalues.
+	Captures []Capture
+	Upvalues []*Upvalue
+}
+
+// Capture is where a closure gets one of its upvalues when it is made: a
+// local of the function making it, or one of that function's own upvalues
+type Capture struct {
+	IsLocal bool
+	Index   int
+}
+
+// Upvalue is a variable a closure captured. While the function that made
+// the variable is still running it points at that function's stack slot;
+// once the function returns it holds the value itself, so every closure
+// sharing the variable still sees the same one.
+type Upvalue struct {
+	Location *Value // The variable: a stack slot while open, Closed once closed
+	Closed   Value
+
+	slot int      // Stack slot while open
+	next *Upvalue // Next open upvalue, lower on the stack
 }
 
 // RuntimeError represents a runtime error
 type RuntimeError struct {
 	Message string
 	Line    int
+
+	// A failed assert is thrown even with RecoverErrors, so it never
+	// becomes a value a statement throws away
+	unrecoverable bool
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("Wahala dey o! %s [line %d]\n", e.Message, e.Line) // "There's trouble!"
 }
@@ -1,6 +1,7 @@
 package vm
 
 import (
+	"math"
 	"testing"
 )
 
@@ -61,6 +62,35 @@ func TestNewNothing(t *testing.T) {
 	}
 }
 
+func TestNewFloat(t *testing.T) {
+	tests := []float64{0, 1.5, -2.25, 3.14, 1e300, -1e-300}
+
+	for _, f := range tests {
+		v := NewFloat(f)
+		if !v.IsFloat() {
+			t.Errorf("NewFloat(%g).IsFloat() = false, want true", f)
+		}
+		if v.IsInt() || v.IsBool() || v.IsNothing() || v.IsString() {
+			t.Errorf("NewFloat(%g) looks like a boxed value (tag %d)", f, v.GetTag())
+		}
+		if got := v.AsFloat(); got != f {
+			t.Errorf("NewFloat(%g).AsFloat() = %g", f, got)
+		}
+	}
+
+	// NaN must not land in the quiet NaN space the boxed values use
+	nan := NewFloat(math.NaN())
+	if !nan.IsFloat() || !math.IsNaN(nan.AsFloat()) {
+		t.Errorf("NewFloat(NaN) = %#x, want a float NaN", uint64(nan))
+	}
+
+	for _, v := range []Value{NewInt(0), NewBool(true), NewNothing(), NewBuiltin(0)} {
+		if v.IsFloat() {
+			t.Errorf("boxed value %s reports IsFloat() = true", v)
+		}
+	}
+}
+
 func TestNewString(t *testing.T) {
 	str := "Wetin dey happen?"
 	v := NewString(&str)
@@ -236,6 +266,8 @@ func TestString(t *testing.T) {
 		{"int zero", NewInt(0), "0"},
 		{"int positive", NewInt(42), "42"},
 		{"int negative", NewInt(-42), "-42"},
+		{"float", NewFloat(2.5), "2.5"},
+		{"whole float", NewFloat(3), "3.0"},
 		{"bool true", NewBool(true), "tru"},
 		{"bool false", NewBool(false), "lie"},
 		{"nothing", NewNothing(), "nothing"},
@@ -321,6 +353,9 @@ func TestEquals(t *testing.T) {
 		{"nothing equal", NewNothing(), NewNothing(), true},
 		{"different types int/bool", NewInt(1), NewBool(true), false},
 		{"different types int/nothing", NewInt(0), NewNothing(), false},
+		{"float equal", NewFloat(1.5), NewFloat(1.5), true},
+		{"int and whole float", NewInt(2), NewFloat(2), true},
+		{"int and float", NewInt(2), NewFloat(2.5), false},
 		{"string equal", NewString(stringPtr("test")), NewString(stringPtr("test")), true},
 		{"string not equal", NewString(stringPtr("test")), NewString(stringPtr("other")), false},
 	}
@@ -334,6 +369,36 @@ func TestEquals(t *testing.T) {
 	}
 }
 
+func TestStringEqualsInterned(t *testing.T) {
+	// Strings interned in the same chunk share a pointer, so they are
+	// bit-identical and Equals answers from its first check
+	chunk := NewChunk()
+	a := NewString(chunk.InternString("how far"))
+	b := NewString(chunk.InternString("how far"))
+	if a != b {
+		t.Fatalf("Expected interned strings to be bit-identical, got %#x and %#x", uint64(a), uint64(b))
+	}
+	if !a.Equals(b) {
+		t.Error("Interned strings should be equal")
+	}
+
+	// The same text interned in another chunk lives somewhere else, and
+	// still has to compare equal by content
+	other := NewChunk()
+	c := NewString(other.InternString("how far"))
+	if a == c {
+		t.Fatal("Expected strings from different chunks to have different pointers")
+	}
+	if !a.Equals(c) || !c.Equals(a) {
+		t.Error("Equal strings from different chunks should be equal")
+	}
+
+	d := NewString(other.InternString("how body"))
+	if a.Equals(d) {
+		t.Error("Different strings from different chunks should not be equal")
+	}
+}
+
 // ============================================================================
 // Edge Cases and Boundary Tests
 // ============================================================================
@@ -377,6 +442,12 @@ func TestMultipleStringPointers(t *testing.T) {
 // Helper Functions
 // ============================================================================
 
+// stringPtrs keeps test strings reachable, since NaN-boxed values hide
+// their pointers from the garbage collector
+var stringPtrs []*string
+
 func stringPtr(s string) *string {
-	return &s
+	ptr := &s
+	stringPtrs = append(stringPtrs, ptr)
+	return ptr
 }
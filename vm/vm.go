@@ -1,8 +1,11 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
-	"strings"
+	"io"
+	"math"
+	"os"
 )
 
 const (
@@ -23,11 +26,77 @@ type VM struct {
 	// Global variables
 	globals map[string]Value
 
-	// Current chunk being executed (for single-chunk execution)
+	// Names of the variables OP_UNBOUND marked, which its marks index
+	unbound      []string
+	unboundIndex map[string]int
+
+	// Upvalues still pointing into the stack, highest slot first
+	openUpvalues *Upvalue
+
+	// Chunk of the function currently executing
 	chunk *Chunk
 
+	// Objects made while running, and how many before the next sweep
+	heap      map[any]struct{}
+	heapLimit int
+
+	// The top-level program, run as the bottom call frame
+	script Function
+
+	// The function compose closes over, made on first use so no two VMs
+	// share its chunk
+	composed *Function
+
 	// Instruction pointer (for single-chunk execution without call frames)
 	ip int
+
+	// Instructions left before execute pauses (-1 for no limit)
+	fuel int
+
+	// Set when execute ran out of fuel; ip and stackTop are saved so the
+	// next RunSteps on the same chunk carries on where it stopped
+	paused bool
+
+	// MaxSteps is how many instructions one run may execute before it
+	// stops with an error, so a runaway loop can't hang the host
+	// (0 for no limit)
+	MaxSteps int
+
+	// Instructions executed by earlier RunSteps slices of this run
+	steps int
+
+	// What integer arithmetic does when a result leaves the 48-bit range
+	overflow OverflowMode
+
+	// Where yarn writes its output
+	Out io.Writer
+
+	// Trace prints each instruction and the stack before it runs, to Out
+	Trace bool
+
+	// RecoverErrors turns recoverable runtime errors into error values the
+	// program can check with is_error, instead of stopping it
+	RecoverErrors bool
+}
+
+// OverflowMode picks what happens when integer arithmetic overflows
+type OverflowMode int
+
+const (
+	OverflowError OverflowMode = iota // Stop with a runtime error (default)
+	OverflowFloat                     // Give the result as a float instead
+)
+
+// ParseOverflowMode reads the value of the --overflow flag
+func ParseOverflowMode(s string) (OverflowMode, error) {
+	switch s {
+	case "error":
+		return OverflowError, nil
+	case "float":
+		return OverflowFloat, nil
+	default:
+		return OverflowError, fmt.Errorf("unknown overflow mode %q (use error or float)", s)
+	}
 }
 
 // CallFrame represents a single function call on the call stack
@@ -35,22 +104,44 @@ type CallFrame struct {
 	function *Function // Function being executed
 	ip       int       // Instruction pointer for this frame
 	slots    int       // Base pointer: where this frame's locals start on stack
+	handlers []handler // Try blocks running in this frame, innermost last
+}
+
+// handler is where a runtime error inside a try block goes
+type handler struct {
+	rescue   int // Position of the rescue code in the frame's chunk
+	stackTop int // Stack height when the try block started
 }
 
-// NewVM creates a new virtual machine
+// NewVM creates a new virtual machine that prints to standard output
 func NewVM() *VM {
+	return NewVMWithOutput(os.Stdout)
+}
+
+// NewVMWithOutput creates a new virtual machine that prints to out
+func NewVMWithOutput(out io.Writer) *VM {
 	return &VM{
 		globals:    make(map[string]Value),
 		stackTop:   0,
 		frameCount: 0,
+		fuel:       -1,
+		Out:        out,
 	}
 }
 
+// SetOverflowMode sets what integer arithmetic does when it overflows
+func (vm *VM) SetOverflowMode(mode OverflowMode) {
+	vm.overflow = mode
+}
+
 // Reset clears the VM state for reuse
 func (vm *VM) Reset() {
 	vm.stackTop = 0
 	vm.frameCount = 0
+	vm.closeUpvalues(0) // A run that stopped early may have left some open
 	vm.ip = 0
+	vm.paused = false
+	vm.steps = 0
 }
 
 // ============================================================================
@@ -58,21 +149,22 @@ func (vm *VM) Reset() {
 // ============================================================================
 
 // push adds a value to the top of the stack
-func (vm *VM) push(value Value) {
+func (vm *VM) push(value Value) error {
 	if vm.stackTop >= STACK_MAX {
-		panic("Stack overflow")
+		return vm.stackOverflowError()
 	}
 	vm.stack[vm.stackTop] = value
 	vm.stackTop++
+	return nil
 }
 
 // pop removes and returns the value from the top of the stack
-func (vm *VM) pop() Value {
+func (vm *VM) pop() (Value, error) {
 	if vm.stackTop <= 0 {
-		panic("Stack underflow")
+		return NewNothing(), vm.runtimeError("Stack don empty, nothing to pop")
 	}
 	vm.stackTop--
-	return vm.stack[vm.stackTop]
+	return vm.stack[vm.stackTop], nil
 }
 
 // peek returns the value at distance from the top of the stack without removing it
@@ -86,11 +178,74 @@ func (vm *VM) peek(distance int) Value {
 
 // Run executes bytecode in a chunk and returns the result
 func (vm *VM) Run(chunk *Chunk) (Value, error) {
+	vm.start(chunk)
+	vm.fuel = -1
+
+	return vm.execute()
+}
+
+// Call runs a function value with the given arguments and returns its
+// result. Globals set by earlier runs are still visible to the function.
+// String arguments must stay reachable while the VM may use them, for
+// example by making them with MakeString.
+func (vm *VM) Call(fn Value, args ...Value) (Value, error) {
+	chunk := NewChunk()
+	for _, arg := range args {
+		idx := chunk.AddConstant(arg)
+		chunk.WriteOpcode(OP_CONSTANT, 0)
+		chunk.WriteByte(byte(idx>>8), 0)
+		chunk.WriteByte(byte(idx&0xFF), 0)
+	}
+
+	idx := chunk.AddConstant(fn)
+	chunk.WriteOpcode(OP_CONSTANT, 0)
+	chunk.WriteByte(byte(idx>>8), 0)
+	chunk.WriteByte(byte(idx&0xFF), 0)
+	chunk.WriteOpcode(OP_CALL, 0)
+	chunk.WriteByte(byte(len(args)), 0)
+	chunk.WriteOpcode(OP_HALT, 0)
+
+	return vm.Run(chunk)
+}
+
+// Global returns the value of a global variable
+func (vm *VM) Global(name string) (Value, bool) {
+	val, ok := vm.globals[name]
+	return val, ok
+}
+
+// StackDepth returns how many values are on the stack. After a program
+// halts this is 1: the value of its last statement.
+func (vm *VM) StackDepth() int {
+	return vm.stackTop
+}
+
+// start resets the VM and sets up the bottom call frame for chunk
+func (vm *VM) start(chunk *Chunk) {
 	vm.Reset()
+	vm.script = Function{Name: "script", Chunk: chunk}
+	vm.frames[0] = CallFrame{function: &vm.script}
+	vm.frameCount = 1
 	vm.chunk = chunk
 	vm.ip = 0
+}
 
-	return vm.execute()
+// RunSteps executes at most maxSteps instructions of chunk. It returns
+// halted=false when it runs out of steps first; calling RunSteps again with
+// the same chunk resumes from where it paused. The value is only meaningful
+// once halted is true.
+func (vm *VM) RunSteps(chunk *Chunk, maxSteps int) (value Value, halted bool, err error) {
+	if !vm.paused || vm.script.Chunk != chunk {
+		vm.start(chunk)
+	}
+	vm.paused = false
+	vm.fuel = maxSteps
+
+	value, err = vm.execute()
+	if vm.paused {
+		vm.steps += maxSteps
+	}
+	return value, !vm.paused, err
 }
 
 // execute is the main execution loop with direct threading dispatch
@@ -100,9 +255,25 @@ func (vm *VM) execute() (Value, error) {
 		stackTop = vm.stackTop
 		ip       = vm.ip
 		code     = vm.chunk.Code
+		fuel     = vm.fuel // Negative never reaches zero, so no limit
+		trace    = vm.Trace
 		a, b     Value // For binary operations
+		err      error // A recoverable error, for fail to handle
+
+		// Stack index of the current frame's local slot 0
+		slots = vm.frames[vm.frameCount-1].slots
 	)
 
+	// The step limit shares the fuel counter, so it costs nothing extra
+	// per instruction. Whichever runs out first decides what happens.
+	limited := false
+	if vm.MaxSteps > 0 {
+		if left := vm.MaxSteps - vm.steps; fuel < 0 || left <= fuel {
+			fuel = left
+			limited = true
+		}
+	}
+
 	// Inline helper to read next byte
 	readByte := func() byte {
 		b := code[ip]
@@ -120,6 +291,33 @@ func (vm *VM) execute() (Value, error) {
 	// Main dispatch loop
 dispatch:
 	for {
+		// Out of steps: past MaxSteps that's an error, otherwise save our
+		// place so RunSteps can pick up from here
+		if fuel == 0 {
+			vm.stackTop = stackTop
+			vm.ip = ip
+			if limited {
+				return NewNothing(), vm.runtimeError("Program dey waka too long")
+			}
+			vm.fuel = 0
+			vm.paused = true
+			return NewNothing(), nil
+		}
+		fuel--
+
+		// No instruction grows the stack by more than one value (calls
+		// check room for their locals themselves), so one free slot here
+		// keeps every push in bounds
+		if stackTop >= STACK_MAX {
+			vm.stackTop = stackTop
+			vm.ip = ip
+			return NewNothing(), vm.stackOverflowError()
+		}
+
+		if trace {
+			vm.traceInstruction(stackTop, ip)
+		}
+
 		// Fetch instruction
 		instruction := Opcode(readByte())
 
@@ -190,13 +388,31 @@ dispatch:
 			// Fast path for integers (most common case)
 			if a.IsInt() && b.IsInt() {
 				result := a.AsInt() + b.AsInt()
-				vm.stack[stackTop] = NewInt(result)
+				if result > MAX_INT_48 || result < MIN_INT_48 {
+					if vm.overflow != OverflowFloat {
+						vm.stackTop = stackTop
+						vm.ip = ip
+						err = vm.overflowError()
+						goto fail
+					}
+					vm.stack[stackTop] = NewFloat(float64(result))
+				} else {
+					vm.stack[stackTop] = NewInt(result)
+				}
 				stackTop++
 				goto dispatch
 			}
 
-			// Slow path for string concatenation
-			if a.IsString() || b.IsString() {
+			// Any other pair of numbers adds as floats. This must come
+			// before the string check so numbers never concatenate.
+			if a.IsNumber() && b.IsNumber() {
+				vm.stack[stackTop] = NewFloat(a.AsNumber() + b.AsNumber())
+				stackTop++
+				goto dispatch
+			}
+
+			// Slow path for string concatenation, once either side is a string
+			if (a.IsString() || b.IsString()) && !a.IsBuiltin() && !b.IsBuiltin() {
 				strA := vm.valueToString(a)
 				strB := vm.valueToString(b)
 				result := strA + strB
@@ -209,24 +425,39 @@ dispatch:
 			// Type error
 			vm.stackTop = stackTop
 			vm.ip = ip
-			return NewNothing(), vm.runtimeError(
-				"I no fit add %s and %s", a.TypeName(), b.TypeName(),
-			)
+			err = vm.operandError("add", a, b)
+			goto fail
 
 		case OP_SUB:
 			b = vm.stack[stackTop-1]
 			a = vm.stack[stackTop-2]
 			stackTop -= 2
 
-			if !a.IsInt() || !b.IsInt() {
+			if a.IsInt() && b.IsInt() {
+				result := a.AsInt() - b.AsInt()
+				if result > MAX_INT_48 || result < MIN_INT_48 {
+					if vm.overflow != OverflowFloat {
+						vm.stackTop = stackTop
+						vm.ip = ip
+						err = vm.overflowError()
+						goto fail
+					}
+					vm.stack[stackTop] = NewFloat(float64(result))
+				} else {
+					vm.stack[stackTop] = NewInt(result)
+				}
+				stackTop++
+				goto dispatch
+			}
+
+			if !a.IsNumber() || !b.IsNumber() {
 				vm.stackTop = stackTop
 				vm.ip = ip
-				return NewNothing(), vm.runtimeError(
-					"I no fit subtract %s and %s", a.TypeName(), b.TypeName(),
-				)
+				err = vm.operandError("subtract", a, b)
+				goto fail
 			}
 
-			vm.stack[stackTop] = NewInt(a.AsInt() - b.AsInt())
+			vm.stack[stackTop] = NewFloat(a.AsNumber() - b.AsNumber())
 			stackTop++
 			goto dispatch
 
@@ -235,15 +466,31 @@ dispatch:
 			a = vm.stack[stackTop-2]
 			stackTop -= 2
 
-			if !a.IsInt() || !b.IsInt() {
+			if a.IsInt() && b.IsInt() {
+				result, ok := mulInt48(a.AsInt(), b.AsInt())
+				if !ok {
+					if vm.overflow != OverflowFloat {
+						vm.stackTop = stackTop
+						vm.ip = ip
+						err = vm.overflowError()
+						goto fail
+					}
+					vm.stack[stackTop] = NewFloat(a.AsNumber() * b.AsNumber())
+				} else {
+					vm.stack[stackTop] = NewInt(result)
+				}
+				stackTop++
+				goto dispatch
+			}
+
+			if !a.IsNumber() || !b.IsNumber() {
 				vm.stackTop = stackTop
 				vm.ip = ip
-				return NewNothing(), vm.runtimeError(
-					"I no fit multiply %s and %s", a.TypeName(), b.TypeName(),
-				)
+				err = vm.operandError("multiply", a, b)
+				goto fail
 			}
 
-			vm.stack[stackTop] = NewInt(a.AsInt() * b.AsInt())
+			vm.stack[stackTop] = NewFloat(a.AsNumber() * b.AsNumber())
 			stackTop++
 			goto dispatch
 
@@ -252,38 +499,163 @@ dispatch:
 			a = vm.stack[stackTop-2]
 			stackTop -= 2
 
-			if !a.IsInt() || !b.IsInt() {
+			if !a.IsNumber() || !b.IsNumber() {
 				vm.stackTop = stackTop
 				vm.ip = ip
-				return NewNothing(), vm.runtimeError(
-					"I no fit divide %s and %s", a.TypeName(), b.TypeName(),
-				)
+				err = vm.operandError("divide", a, b)
+				goto fail
 			}
 
-			if b.AsInt() == 0 {
+			if b.AsNumber() == 0 {
 				vm.stackTop = stackTop
 				vm.ip = ip
-				return NewNothing(), vm.runtimeError("I no fit divide by zero o!")
+				err = vm.runtimeError("Omo! You no fit divide by zero o!")
+				goto fail
+			}
+
+			if a.IsInt() && b.IsInt() {
+				// Only MIN_INT_48 / -1 can leave the 48-bit range
+				result := a.AsInt() / b.AsInt()
+				if result > MAX_INT_48 {
+					if vm.overflow != OverflowFloat {
+						vm.stackTop = stackTop
+						vm.ip = ip
+						err = vm.overflowError()
+						goto fail
+					}
+					vm.stack[stackTop] = NewFloat(float64(result))
+				} else {
+					vm.stack[stackTop] = NewInt(result)
+				}
+				stackTop++
+				goto dispatch
 			}
 
-			vm.stack[stackTop] = NewInt(a.AsInt() / b.AsInt())
+			// Like the interpreter, 5.0 / 2 gives 2.5
+			vm.stack[stackTop] = NewFloat(a.AsNumber() / b.AsNumber())
 			stackTop++
 			goto dispatch
 
-		case OP_NEGATE:
+		case OP_MOD:
+			b = vm.stack[stackTop-1]
+			a = vm.stack[stackTop-2]
+			stackTop -= 2
+
+			if !a.IsNumber() || !b.IsNumber() {
+				vm.stackTop = stackTop
+				vm.ip = ip
+				err = vm.operandError("find remainder of", a, b)
+				goto fail
+			}
+
+			if b.AsNumber() == 0 {
+				vm.stackTop = stackTop
+				vm.ip = ip
+				err = vm.runtimeError("Omo! You no fit divide by zero o!")
+				goto fail
+			}
+
+			if a.IsInt() && b.IsInt() {
+				vm.stack[stackTop] = NewInt(a.AsInt() % b.AsInt())
+			} else {
+				vm.stack[stackTop] = NewFloat(math.Mod(a.AsNumber(), b.AsNumber()))
+			}
+			stackTop++
+			goto dispatch
+
+		case OP_SHIFT_LEFT:
+			n := readByte()
 			a = vm.stack[stackTop-1]
 
-			if !a.IsInt() {
+			if a.IsInt() {
+				x := a.AsInt()
+				if x > MAX_INT_48>>n || x < MIN_INT_48>>n {
+					if vm.overflow != OverflowFloat {
+						stackTop--
+						vm.stackTop = stackTop
+						vm.ip = ip
+						err = vm.overflowError()
+						goto fail
+					}
+					vm.stack[stackTop-1] = NewFloat(a.AsNumber() * float64(int64(1)<<n))
+					goto dispatch
+				}
+				vm.stack[stackTop-1] = NewInt(x << n)
+				goto dispatch
+			}
+
+			if !a.IsNumber() {
+				stackTop--
 				vm.stackTop = stackTop
 				vm.ip = ip
-				return NewNothing(), vm.runtimeError(
-					"I no fit negate %s", a.TypeName(),
-				)
+				err = vm.operandError("multiply", a, NewInt(int64(1)<<n))
+				goto fail
 			}
 
-			vm.stack[stackTop-1] = NewInt(-a.AsInt())
+			vm.stack[stackTop-1] = NewFloat(a.AsNumber() * float64(int64(1)<<n))
 			goto dispatch
 
+		case OP_SHIFT_RIGHT:
+			n := readByte()
+			a = vm.stack[stackTop-1]
+
+			if a.IsInt() {
+				// A plain shift rounds down, so bring negative numbers up
+				// first to round toward zero like OP_DIV
+				x := a.AsInt()
+				if x < 0 {
+					x += int64(1)<<n - 1
+				}
+				vm.stack[stackTop-1] = NewInt(x >> n)
+				goto dispatch
+			}
+
+			if !a.IsNumber() {
+				stackTop--
+				vm.stackTop = stackTop
+				vm.ip = ip
+				err = vm.operandError("divide", a, NewInt(int64(1)<<n))
+				goto fail
+			}
+
+			vm.stack[stackTop-1] = NewFloat(a.AsNumber() / float64(int64(1)<<n))
+			goto dispatch
+
+		case OP_NEGATE:
+			a = vm.stack[stackTop-1]
+
+			if a.IsInt() {
+				// -MIN_INT_48 is one past MAX_INT_48
+				if a.AsInt() == MIN_INT_48 {
+					if vm.overflow != OverflowFloat {
+						stackTop--
+						vm.stackTop = stackTop
+						vm.ip = ip
+						err = vm.overflowError()
+						goto fail
+					}
+					vm.stack[stackTop-1] = NewFloat(-a.AsNumber())
+					goto dispatch
+				}
+				vm.stack[stackTop-1] = NewInt(-a.AsInt())
+				goto dispatch
+			}
+
+			if a.IsFloat() {
+				vm.stack[stackTop-1] = NewFloat(-a.AsFloat())
+				goto dispatch
+			}
+
+			stackTop--
+			vm.stackTop = stackTop
+			vm.ip = ip
+			if a.IsBuiltin() {
+				err = vm.builtinMisuseError("negate", a)
+			} else {
+				err = vm.runtimeError("I no fit negate %s", a.TypeName())
+			}
+			goto fail
+
 		// ====================================================================
 		// Comparison
 		// ====================================================================
@@ -311,15 +683,26 @@ dispatch:
 			a = vm.stack[stackTop-2]
 			stackTop -= 2
 
-			if !a.IsInt() || !b.IsInt() {
+			if a.IsInt() && b.IsInt() {
+				vm.stack[stackTop] = NewBool(a.AsInt() > b.AsInt())
+				stackTop++
+				goto dispatch
+			}
+
+			if a.IsString() && b.IsString() {
+				vm.stack[stackTop] = NewBool(*a.AsString() > *b.AsString())
+				stackTop++
+				goto dispatch
+			}
+
+			if !a.IsNumber() || !b.IsNumber() {
 				vm.stackTop = stackTop
 				vm.ip = ip
-				return NewNothing(), vm.runtimeError(
-					"I no fit compare %s and %s", a.TypeName(), b.TypeName(),
-				)
+				err = vm.operandError("compare", a, b)
+				goto fail
 			}
 
-			vm.stack[stackTop] = NewBool(a.AsInt() > b.AsInt())
+			vm.stack[stackTop] = NewBool(a.AsNumber() > b.AsNumber())
 			stackTop++
 			goto dispatch
 
@@ -328,15 +711,82 @@ dispatch:
 			a = vm.stack[stackTop-2]
 			stackTop -= 2
 
-			if !a.IsInt() || !b.IsInt() {
+			if a.IsInt() && b.IsInt() {
+				vm.stack[stackTop] = NewBool(a.AsInt() < b.AsInt())
+				stackTop++
+				goto dispatch
+			}
+
+			if a.IsString() && b.IsString() {
+				vm.stack[stackTop] = NewBool(*a.AsString() < *b.AsString())
+				stackTop++
+				goto dispatch
+			}
+
+			if !a.IsNumber() || !b.IsNumber() {
+				vm.stackTop = stackTop
+				vm.ip = ip
+				err = vm.operandError("compare", a, b)
+				goto fail
+			}
+
+			vm.stack[stackTop] = NewBool(a.AsNumber() < b.AsNumber())
+			stackTop++
+			goto dispatch
+
+		case OP_GREATER_EQUAL:
+			b = vm.stack[stackTop-1]
+			a = vm.stack[stackTop-2]
+			stackTop -= 2
+
+			if a.IsInt() && b.IsInt() {
+				vm.stack[stackTop] = NewBool(a.AsInt() >= b.AsInt())
+				stackTop++
+				goto dispatch
+			}
+
+			if a.IsString() && b.IsString() {
+				vm.stack[stackTop] = NewBool(*a.AsString() >= *b.AsString())
+				stackTop++
+				goto dispatch
+			}
+
+			if !a.IsNumber() || !b.IsNumber() {
 				vm.stackTop = stackTop
 				vm.ip = ip
-				return NewNothing(), vm.runtimeError(
-					"I no fit compare %s and %s", a.TypeName(), b.TypeName(),
-				)
+				err = vm.operandError("compare", a, b)
+				goto fail
 			}
 
-			vm.stack[stackTop] = NewBool(a.AsInt() < b.AsInt())
+			vm.stack[stackTop] = NewBool(a.AsNumber() >= b.AsNumber())
+			stackTop++
+			goto dispatch
+
+		case OP_LESS_EQUAL:
+			b = vm.stack[stackTop-1]
+			a = vm.stack[stackTop-2]
+			stackTop -= 2
+
+			if a.IsInt() && b.IsInt() {
+				vm.stack[stackTop] = NewBool(a.AsInt() <= b.AsInt())
+				stackTop++
+				goto dispatch
+			}
+
+			if a.IsString() && b.IsString() {
+				vm.stack[stackTop] = NewBool(*a.AsString() <= *b.AsString())
+				stackTop++
+				goto dispatch
+			}
+
+			if !a.IsNumber() || !b.IsNumber() {
+				vm.stackTop = stackTop
+				vm.ip = ip
+				err = vm.operandError("compare", a, b)
+				goto fail
+			}
+
+			vm.stack[stackTop] = NewBool(a.AsNumber() <= b.AsNumber())
 			stackTop++
 			goto dispatch
 
@@ -362,10 +812,79 @@ dispatch:
 			stackTop++
 			goto dispatch
 
+		case OP_SWAP:
+			vm.stack[stackTop-1], vm.stack[stackTop-2] = vm.stack[stackTop-2], vm.stack[stackTop-1]
+			goto dispatch
+
+		case OP_OVER:
+			vm.stack[stackTop] = vm.stack[stackTop-2]
+			stackTop++
+			goto dispatch
+
 		// ====================================================================
-		// Variables (simplified for Phase 1 - global only)
+		// Variables
 		// ====================================================================
 
+		// Locals live on the stack, counted from the current frame's slots
+		case OP_GET_LOCAL_0:
+			vm.stack[stackTop] = vm.stack[slots]
+			stackTop++
+			goto dispatch
+
+		case OP_GET_LOCAL_1:
+			vm.stack[stackTop] = vm.stack[slots+1]
+			stackTop++
+			goto dispatch
+
+		case OP_GET_LOCAL_2:
+			vm.stack[stackTop] = vm.stack[slots+2]
+			stackTop++
+			goto dispatch
+
+		case OP_GET_LOCAL_3:
+			vm.stack[stackTop] = vm.stack[slots+3]
+			stackTop++
+			goto dispatch
+
+		case OP_GET_LOCAL:
+			slot := int(readByte())
+			vm.stack[stackTop] = vm.stack[slots+slot]
+			stackTop++
+			goto dispatch
+
+		// Like OP_SET_GLOBAL, setting leaves the value on the stack
+		case OP_SET_LOCAL_0:
+			vm.stack[slots] = vm.stack[stackTop-1]
+			goto dispatch
+
+		case OP_SET_LOCAL_1:
+			vm.stack[slots+1] = vm.stack[stackTop-1]
+			goto dispatch
+
+		case OP_SET_LOCAL:
+			slot := int(readByte())
+			vm.stack[slots+slot] = vm.stack[stackTop-1]
+			goto dispatch
+
+		// Captured variables belong to the closure running in this frame
+		case OP_GET_UPVALUE:
+			upvalue := vm.frames[vm.frameCount-1].function.Upvalues[readByte()]
+			val := *upvalue.Location
+			if val.IsUnbound() {
+				vm.stackTop = stackTop
+				vm.ip = ip
+				err = vm.runtimeError("I no sabi dis one: %s", vm.unbound[val.AsUnbound()])
+				goto throw
+			}
+			vm.stack[stackTop] = val
+			stackTop++
+			goto dispatch
+
+		case OP_SET_UPVALUE:
+			upvalue := vm.frames[vm.frameCount-1].function.Upvalues[readByte()]
+			*upvalue.Location = vm.stack[stackTop-1]
+			goto dispatch
+
 		case OP_GET_GLOBAL:
 			idx := readShort()
 			name := vm.chunk.Constants[idx].AsString()
@@ -373,9 +892,14 @@ dispatch:
 			if !ok {
 				vm.stackTop = stackTop
 				vm.ip = ip
-				return NewNothing(), vm.runtimeError(
-					"I no sabi dis one: %s", *name,
-				)
+				err = vm.runtimeError("I no sabi dis one: %s", *name)
+				goto throw
+			}
+			if val.IsUnbound() {
+				vm.stackTop = stackTop
+				vm.ip = ip
+				err = vm.runtimeError("I no sabi dis one: %s", vm.unbound[val.AsUnbound()])
+				goto throw
 			}
 			vm.stack[stackTop] = val
 			stackTop++
@@ -387,6 +911,12 @@ dispatch:
 			vm.globals[*name] = vm.stack[stackTop-1]
 			goto dispatch
 
+		case OP_UNBOUND:
+			idx := readShort()
+			vm.stack[stackTop] = vm.unboundMark(*vm.chunk.Constants[idx].AsString())
+			stackTop++
+			goto dispatch
+
 		// ====================================================================
 		// Control Flow (simplified for Phase 1)
 		// ====================================================================
@@ -414,11 +944,193 @@ dispatch:
 			}
 			goto dispatch
 
+		case OP_JUMP_IF_LIE_PEEK:
+			offset := int16(readShort())
+			if vm.stack[stackTop-1].IsFalsey() {
+				ip += int(offset)
+			}
+			goto dispatch
+
+		case OP_JUMP_IF_TRU_PEEK:
+			offset := int16(readShort())
+			if vm.stack[stackTop-1].IsTruthy() {
+				ip += int(offset)
+			}
+			goto dispatch
+
 		case OP_LOOP:
 			offset := readShort()
 			ip -= int(offset)
 			goto dispatch
 
+		case OP_JUMP_LONG:
+			offset := int(code[ip])<<16 | int(code[ip+1])<<8 | int(code[ip+2])
+			ip += 3 + offset
+			goto dispatch
+
+		case OP_LOOP_LONG:
+			offset := int(code[ip])<<16 | int(code[ip+1])<<8 | int(code[ip+2])
+			ip += 3 - offset
+			goto dispatch
+
+		case OP_TRY:
+			offset := int(code[ip])<<16 | int(code[ip+1])<<8 | int(code[ip+2])
+			ip += 3
+			frame := &vm.frames[vm.frameCount-1]
+			frame.handlers = append(frame.handlers, handler{rescue: ip + offset, stackTop: stackTop})
+			goto dispatch
+
+		case OP_END_TRY:
+			frame := &vm.frames[vm.frameCount-1]
+			frame.handlers = frame.handlers[:len(frame.handlers)-1]
+			goto dispatch
+
+		case OP_THROW:
+			message := vm.stack[stackTop-1]
+			stackTop--
+			vm.stackTop = stackTop
+			vm.ip = ip
+			err = vm.runtimeError("%s", *message.AsString())
+			goto throw
+
+		// ====================================================================
+		// Functions
+		// ====================================================================
+
+		// Frames aren't reused yet, so a tail call runs as a plain call and
+		// the OP_BRING or OP_RETURN the compiler puts after it hands the
+		// result back
+		case OP_CALL_0, OP_CALL_1, OP_CALL_2, OP_CALL, OP_TAIL_CALL:
+			var argCount int
+			if instruction == OP_CALL || instruction == OP_TAIL_CALL {
+				argCount = int(readByte())
+			} else {
+				argCount = int(instruction - OP_CALL_0)
+			}
+
+			// The compiler pushes the arguments first and the callee last
+			callee := vm.stack[stackTop-1]
+			args := vm.stack[stackTop-1-argCount : stackTop-1]
+
+			if callee.IsBuiltin() {
+				vm.stackTop = stackTop
+				vm.ip = ip
+				result, callErr := vm.callBuiltin(callee.AsBuiltin(), args)
+				stackTop -= argCount + 1
+				if callErr != nil {
+					err = callErr
+					goto fail
+				}
+				vm.stack[stackTop] = result
+				stackTop++
+				goto dispatch
+			}
+
+			if !callee.IsFunc() {
+				vm.stackTop = stackTop
+				vm.ip = ip
+				err = vm.runtimeError("Dis one no be function: %s", callee.TypeName())
+				goto throw
+			}
+
+			fn := callee.AsFunc()
+			if argCount != fn.Arity {
+				vm.stackTop = stackTop
+				vm.ip = ip
+				name := fn.Name
+				if name == "" {
+					name = "function"
+				}
+				err = vm.runtimeError("%s wan make %d argument, you give am %d", name, fn.Arity, argCount)
+				goto throw
+			}
+
+			// Drop the callee so the arguments become the first locals
+			stackTop--
+			base := stackTop - argCount
+
+			if vm.frameCount == FRAMES_MAX || base+fn.LocalCount >= STACK_MAX {
+				vm.stackTop = stackTop
+				vm.ip = ip
+				return NewNothing(), vm.stackOverflowError()
+			}
+
+			// Make room for the function's other locals
+			for stackTop < base+fn.LocalCount {
+				vm.stack[stackTop] = NewNothing()
+				stackTop++
+			}
+
+			vm.frames[vm.frameCount-1].ip = ip
+			vm.frames[vm.frameCount] = CallFrame{function: fn, slots: base}
+			vm.frameCount++
+			slots = base
+
+			vm.chunk = fn.Chunk
+			code = fn.Chunk.Code
+			ip = 0
+			goto dispatch
+
+		// Copy the function constant and give the copy its upvalues, which
+		// are this frame's locals or upvalues of the closure running here
+		case OP_CLOSURE:
+			proto := vm.chunk.Constants[readShort()].AsFunc()
+			closure := *proto
+			closure.Upvalues = make([]*Upvalue, len(proto.Captures))
+			for i, capture := range proto.Captures {
+				if capture.IsLocal {
+					closure.Upvalues[i] = vm.captureUpvalue(slots + capture.Index)
+				} else {
+					closure.Upvalues[i] = vm.frames[vm.frameCount-1].function.Upvalues[capture.Index]
+				}
+			}
+			vm.stackTop = stackTop
+			vm.hold(&closure)
+			vm.stack[stackTop] = NewFunc(&closure)
+			stackTop++
+			goto dispatch
+
+		// OP_BRING hands back the value a bring worked out, and OP_RETURN
+		// the value a body left when it ran off its end. Either way the
+		// value is on top of the stack.
+		case OP_BRING, OP_RETURN:
+			result := vm.stack[stackTop-1]
+			callee := vm.frames[vm.frameCount-1].function
+			vm.frameCount--
+
+			// Bringing from the top level ends the program
+			if vm.frameCount == 0 {
+				vm.stackTop = stackTop
+				vm.ip = ip
+				return result, nil
+			}
+
+			// Throw away the callee's locals and leave the result for the
+			// caller. Closures that captured any of them keep their own copy.
+			stackTop = vm.frames[vm.frameCount].slots
+			if vm.openUpvalues != nil {
+				vm.closeUpvalues(stackTop)
+			}
+
+			caller := &vm.frames[vm.frameCount-1]
+			vm.chunk = caller.function.Chunk
+			code = vm.chunk.Code
+			ip = caller.ip
+			slots = caller.slots
+
+			// The caller checks the declared return type, as the
+			// interpreter does, so a try block in the function can't
+			// rescue its own wrong result
+			if callee.ReturnType != "" && !returnTypeAllows(callee.ReturnType, result) {
+				vm.stackTop = stackTop
+				vm.ip = ip
+				err = vm.returnTypeError(callee, result)
+				goto throw
+			}
+			vm.stack[stackTop] = result
+			stackTop++
+			goto dispatch
+
 		// ====================================================================
 		// Special
 		// ====================================================================
@@ -427,25 +1139,58 @@ dispatch:
 		// Builtins
 		// ====================================================================
 
-		case OP_YARN:
-			argCount := readByte()
+		case OP_BUILTIN:
+			index := int(readByte())
+			argCount := int(readByte())
 
-			// Print each argument
-			for i := byte(0); i < argCount; i++ {
-				idx := stackTop - int(argCount) + int(i)
-				val := vm.stack[idx]
-				fmt.Print(vm.valueToString(val))
+			vm.stackTop = stackTop
+			vm.ip = ip
+			result, callErr := vm.callBuiltin(index, vm.stack[stackTop-argCount:stackTop])
+			stackTop -= argCount
+			if callErr != nil {
+				err = callErr
+				goto fail
 			}
-			fmt.Println()
+			vm.stack[stackTop] = result
+			stackTop++
+			goto dispatch
 
-			// Pop arguments
-			stackTop -= int(argCount)
+		case OP_YARN:
+			argCount := int(readByte())
+
+			// Print the arguments, then pop them
+			vm.yarn(vm.stack[stackTop-argCount : stackTop])
+			stackTop -= argCount
 
 			// Push nothing as result
 			vm.stack[stackTop] = NewNothing()
 			stackTop++
 			goto dispatch
 
+		// ====================================================================
+		// String Operations
+		// ====================================================================
+
+		// The compiler only emits OP_CONCAT for a '+' with a string on one
+		// side, where OP_ADD would concatenate too, so this skips its
+		// number checks
+		case OP_CONCAT:
+			b = vm.stack[stackTop-1]
+			a = vm.stack[stackTop-2]
+			stackTop -= 2
+
+			if a.IsBuiltin() || b.IsBuiltin() {
+				vm.stackTop = stackTop
+				vm.ip = ip
+				err = vm.operandError("add", a, b)
+				goto fail
+			}
+
+			result := vm.valueToString(a) + vm.valueToString(b)
+			vm.stack[stackTop] = NewString(vm.chunk.InternString(result))
+			stackTop++
+			goto dispatch
+
 		case OP_HALT:
 			vm.stackTop = stackTop
 			vm.ip = ip
@@ -463,6 +1208,154 @@ dispatch:
 			)
 		}
 	}
+
+	// Instructions come here with a recoverable error: a bad operand, a
+	// division by zero, an overflow or a builtin's complaint. stackTop is
+	// where the instruction's result would have gone. Normally the error
+	// is thrown; with RecoverErrors it becomes that result instead, unless
+	// a try block is waiting to rescue it or it is a failed assert.
+fail:
+	if vm.RecoverErrors && !vm.inTry() && recoverable(err) {
+		vm.stackTop = stackTop
+		vm.stack[stackTop] = vm.errorValue(err)
+		stackTop++
+		goto dispatch
+	}
+
+	// Errors a try block can rescue, but that never become values, come
+	// straight here. With no try block around them they stop the program.
+throw:
+	if !vm.catch(err) {
+		return NewNothing(), err
+	}
+	stackTop = vm.stackTop
+	slots = vm.frames[vm.frameCount-1].slots
+	code = vm.chunk.Code
+	ip = vm.ip
+	goto dispatch
+}
+
+// ============================================================================
+// Try Blocks
+// ============================================================================
+
+// recoverable reports whether RecoverErrors may turn err into a value
+func recoverable(err error) bool {
+	var runtimeErr *RuntimeError
+	return !errors.As(err, &runtimeErr) || !runtimeErr.unrecoverable
+}
+
+// inTry reports whether any frame has a try block running
+func (vm *VM) inTry() bool {
+	for i := 0; i < vm.frameCount; i++ {
+		if len(vm.frames[i].handlers) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// catch hands err to the innermost running try block. It drops the frames
+// above the try's own, puts the stack back how the try found it with the
+// error's message on top, and points vm.ip at the rescue code. It reports
+// false, changing nothing, when no try block is running.
+func (vm *VM) catch(err error) bool {
+	depth := vm.frameCount - 1
+	for depth >= 0 && len(vm.frames[depth].handlers) == 0 {
+		depth--
+	}
+	if depth < 0 {
+		return false
+	}
+
+	frame := &vm.frames[depth]
+	h := frame.handlers[len(frame.handlers)-1]
+	frame.handlers = frame.handlers[:len(frame.handlers)-1]
+	vm.frameCount = depth + 1
+
+	// Closures made inside the try keep the variables they captured
+	if vm.openUpvalues != nil {
+		vm.closeUpvalues(h.stackTop)
+	}
+
+	message := err.Error()
+	var runtimeErr *RuntimeError
+	if errors.As(err, &runtimeErr) {
+		message = runtimeErr.Message
+	}
+
+	vm.chunk = frame.function.Chunk
+	vm.stack[h.stackTop] = NewString(vm.chunk.InternString(message))
+	vm.stackTop = h.stackTop + 1
+	vm.ip = h.rescue
+	return true
+}
+
+// ============================================================================
+// Upvalues
+// ============================================================================
+
+// unboundMark gives the mark for name gone out of scope. Each name gets
+// one index the first time, so a loop that keeps unbinding it doesn't
+// grow the list.
+func (vm *VM) unboundMark(name string) Value {
+	index, ok := vm.unboundIndex[name]
+	if !ok {
+		if vm.unboundIndex == nil {
+			vm.unboundIndex = make(map[string]int)
+		}
+		index = len(vm.unbound)
+		vm.unbound = append(vm.unbound, name)
+		vm.unboundIndex[name] = index
+	}
+	return NewUnbound(index)
+}
+
+// captureUpvalue returns the open upvalue for a stack slot, making one if no
+// closure has captured the slot yet, so closures share their variables
+func (vm *VM) captureUpvalue(slot int) *Upvalue {
+	var previous *Upvalue
+	upvalue := vm.openUpvalues
+	for upvalue != nil && upvalue.slot > slot {
+		previous = upvalue
+		upvalue = upvalue.next
+	}
+	if upvalue != nil && upvalue.slot == slot {
+		return upvalue
+	}
+
+	created := &Upvalue{Location: &vm.stack[slot], slot: slot, next: upvalue}
+	if previous == nil {
+		vm.openUpvalues = created
+	} else {
+		previous.next = created
+	}
+	return created
+}
+
+// closeOver makes a closure of fn whose upvalues are already closed over
+// values, for builtins that give back a function
+func (vm *VM) closeOver(fn *Function, values ...Value) Value {
+	closure := *fn
+	closure.Upvalues = make([]*Upvalue, len(values))
+	for i, value := range values {
+		upvalue := &Upvalue{Closed: value}
+		upvalue.Location = &upvalue.Closed
+		closure.Upvalues[i] = upvalue
+	}
+	vm.hold(&closure)
+	return NewFunc(&closure)
+}
+
+// closeUpvalues moves the variables in slots from last upward off the stack
+// and into the upvalues that captured them
+func (vm *VM) closeUpvalues(last int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.slot >= last {
+		upvalue := vm.openUpvalues
+		upvalue.Closed = *upvalue.Location
+		upvalue.Location = &upvalue.Closed
+		vm.openUpvalues = upvalue.next
+	}
 }
 
 // ============================================================================
@@ -474,20 +1367,99 @@ func (vm *VM) valueToString(v Value) string {
 	return v.String()
 }
 
+// yarn prints the values on one line, the way OP_YARN and the yarn builtin do
+func (vm *VM) yarn(args []Value) {
+	for _, val := range args {
+		io.WriteString(vm.Out, vm.valueToString(val))
+	}
+	io.WriteString(vm.Out, "\n")
+}
+
+// errorValue makes err into an error value the heap keeps alive
+func (vm *VM) errorValue(err error) Value {
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		runtimeErr = &RuntimeError{Message: err.Error()}
+	}
+	vm.hold(runtimeErr)
+	return NewError(runtimeErr)
+}
+
+// returnTypeError says a function brought back a value its declared return
+// type doesn't allow, the way the interpreter words it
+func (vm *VM) returnTypeError(fn *Function, result Value) error {
+	name := fn.Name
+	if name == "" {
+		name = "dis function"
+	}
+	return vm.runtimeError("%s suppose bring %s, but e bring %s", name, fn.ReturnType, objectTypeName(result))
+}
+
+// stackOverflowError reports a program that ran out of stack or call frames,
+// usually from recursion that never stops
+func (vm *VM) stackOverflowError() error {
+	return vm.runtimeError("Stack don full, program too deep")
+}
+
+// overflowError reports an integer result too big for a 48-bit value
+func (vm *VM) overflowError() error {
+	return vm.runtimeError("Number too big for Pidgin")
+}
+
+// mulInt48 multiplies two 48-bit integers, reporting false when the
+// product doesn't fit in 48 bits
+func mulInt48(x, y int64) (int64, bool) {
+	const small = 1 << 23 // two numbers under 2^23 always fit
+	result := x * y
+	if x > -small && x < small && y > -small && y < small {
+		return result, true
+	}
+
+	// The int64 product itself may have wrapped
+	if x != 0 && result/x != y {
+		return 0, false
+	}
+	return result, result >= MIN_INT_48 && result <= MAX_INT_48
+}
+
+// operandError reports a binary operator given operands it can't handle.
+// Builtin values get their own message, since the usual mistake is
+// forgetting to call them.
+func (vm *VM) operandError(verb string, a, b Value) error {
+	if a.IsBuiltin() {
+		return vm.builtinMisuseError(verb, a)
+	}
+	if b.IsBuiltin() {
+		return vm.builtinMisuseError(verb, b)
+	}
+	return vm.runtimeError("I no fit %s %s and %s", verb, a.TypeName(), b.TypeName())
+}
+
+// builtinMisuseError reports a builtin value used as an operand
+func (vm *VM) builtinMisuseError(verb string, builtin Value) error {
+	return vm.runtimeError(
+		"You fit only call builtin %s, no fit %s am", Builtins[builtin.AsBuiltin()].Name, verb,
+	)
+}
+
+// traceInstruction prints the stack and the instruction at ip, which is
+// about to run
+func (vm *VM) traceInstruction(stackTop, ip int) {
+	fmt.Fprint(vm.Out, "          ")
+	for i := 0; i < stackTop; i++ {
+		fmt.Fprintf(vm.Out, "[ %s ]", vm.stack[i].String())
+	}
+	fmt.Fprintln(vm.Out)
+	vm.chunk.DisassembleInstructionTo(vm.Out, ip)
+}
+
 // runtimeError creates a runtime error with line information
 func (vm *VM) runtimeError(format string, args ...interface{}) error {
-	message := fmt.Sprintf(format, args...)
-
 	// Get line number from current instruction
 	line := 0
 	if vm.ip > 0 && vm.ip <= len(vm.chunk.Lines) {
 		line = vm.chunk.Lines[vm.ip-1]
 	}
 
-	var errorMsg strings.Builder
-	errorMsg.WriteString("Wahala dey o! ") // "There's trouble!"
-	errorMsg.WriteString(message)
-	errorMsg.WriteString(fmt.Sprintf(" [line %d]\n", line))
-
-	return fmt.Errorf("%s", errorMsg.String())
+	return &RuntimeError{Message: fmt.Sprintf(format, args...), Line: line}
 }
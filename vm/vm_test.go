@@ -1,6 +1,10 @@
 package vm
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -52,6 +56,8 @@ func TestManualBytecode_Arithmetic(t *testing.T) {
 		{"10 - 4", 10, 4, OP_SUB, 6},
 		{"6 * 7", 6, 7, OP_MUL, 42},
 		{"20 / 4", 20, 4, OP_DIV, 5},
+		{"10 % 3", 10, 3, OP_MOD, 1},
+		{"-7 % 3", -7, 3, OP_MOD, -1},
 	}
 
 	for _, tt := range tests {
@@ -102,6 +108,69 @@ func TestManualBytecode_Negation(t *testing.T) {
 	}
 }
 
+func TestManualBytecode_NegativeInlineInts(t *testing.T) {
+	// Inline operands are two's complement, so the top bit makes them negative
+	tests := []struct {
+		name     string
+		op       Opcode
+		operand  []byte
+		expected int64
+	}{
+		{"i8 0xFF", OP_CONST_I8, []byte{0xFF}, -1},
+		{"i8 0xFE", OP_CONST_I8, []byte{0xFE}, -2},
+		{"i8 0x80", OP_CONST_I8, []byte{0x80}, -128},
+		{"i8 0x7F", OP_CONST_I8, []byte{0x7F}, 127},
+		{"i16 0xFFFF", OP_CONST_I16, []byte{0xFF, 0xFF}, -1},
+		{"i16 0xFF7F", OP_CONST_I16, []byte{0xFF, 0x7F}, -129},
+		{"i16 0x8000", OP_CONST_I16, []byte{0x80, 0x00}, -32768},
+		{"i16 0x8001", OP_CONST_I16, []byte{0x80, 0x01}, -32767},
+		{"i16 0x7FFF", OP_CONST_I16, []byte{0x7F, 0xFF}, 32767},
+		{"i16 0x00FF", OP_CONST_I16, []byte{0x00, 0xFF}, 255},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunk := NewChunk()
+			chunk.WriteOpcode(tt.op, 1)
+			chunk.WriteBytes(tt.operand, 1)
+			chunk.WriteOpcode(OP_HALT, 1)
+
+			result, err := NewVM().Run(chunk)
+			if err != nil {
+				t.Fatalf("Execution error: %v", err)
+			}
+
+			if !result.IsInt() {
+				t.Fatalf("Expected int result, got %s", result.TypeName())
+			}
+
+			if got := result.AsInt(); got != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestManualBytecode_NegativeInlineIntArithmetic(t *testing.T) {
+	// Bytecode for: -128 - -32768
+	chunk := NewChunk()
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(0x80, 1)
+	chunk.WriteOpcode(OP_CONST_I16, 1)
+	chunk.WriteBytes([]byte{0x80, 0x00}, 1)
+	chunk.WriteOpcode(OP_SUB, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	result, err := NewVM().Run(chunk)
+	if err != nil {
+		t.Fatalf("Execution error: %v", err)
+	}
+
+	if got := result.AsInt(); got != 32640 {
+		t.Errorf("Expected 32640, got %d", got)
+	}
+}
+
 func TestManualBytecode_Comparison(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -117,6 +186,10 @@ func TestManualBytecode_Comparison(t *testing.T) {
 		{"3 > 5", 3, 5, OP_GREATER, false},
 		{"3 < 5", 3, 5, OP_LESS, true},
 		{"5 < 3", 5, 3, OP_LESS, false},
+		{"5 >= 5", 5, 5, OP_GREATER_EQUAL, true},
+		{"3 >= 5", 3, 5, OP_GREATER_EQUAL, false},
+		{"5 <= 5", 5, 5, OP_LESS_EQUAL, true},
+		{"5 <= 3", 5, 3, OP_LESS_EQUAL, false},
 	}
 
 	for _, tt := range tests {
@@ -202,6 +275,172 @@ func TestManualBytecode_StackOperations(t *testing.T) {
 	}
 }
 
+func TestManualBytecode_SwapAndOver(t *testing.T) {
+	// Push 1 then 2, run op, and check everything left on the stack
+	tests := []struct {
+		op       Opcode
+		expected []int64
+	}{
+		{OP_SWAP, []int64{2, 1}},
+		{OP_OVER, []int64{1, 2, 1}},
+		{OP_DUP, []int64{1, 2, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.op.String(), func(t *testing.T) {
+			chunk := NewChunk()
+			chunk.WriteOpcode(OP_CONST_1, 1)
+			chunk.WriteOpcode(OP_CONST_I8, 1)
+			chunk.WriteByte(2, 1)
+			chunk.WriteOpcode(tt.op, 1)
+			chunk.WriteOpcode(OP_HALT, 1)
+
+			vm := NewVM()
+			if _, err := vm.Run(chunk); err != nil {
+				t.Fatalf("Execution error: %v", err)
+			}
+
+			if depth := vm.StackDepth(); depth != len(tt.expected) {
+				t.Fatalf("Expected stack depth %d, got %d", len(tt.expected), depth)
+			}
+			for i, want := range tt.expected {
+				if got := vm.stack[i]; !got.IsInt() || got.AsInt() != want {
+					t.Errorf("slot %d: expected %d, got %s", i, want, got)
+				}
+			}
+		})
+	}
+
+	// SWAP flips the operands of what comes next: 10, 3, SWAP, SUB is 3 - 10
+	chunk := NewChunk()
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(10, 1)
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(3, 1)
+	chunk.WriteOpcode(OP_SWAP, 1)
+	chunk.WriteOpcode(OP_SUB, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	result, err := NewVM().Run(chunk)
+	if err != nil {
+		t.Fatalf("Execution error: %v", err)
+	}
+	if got := result.AsInt(); got != -7 {
+		t.Errorf("Expected -7, got %d", got)
+	}
+}
+
+func TestManualBytecode_Concat(t *testing.T) {
+	pool := NewChunk()
+	text := func(s string) Value { return NewString(pool.InternString(s)) }
+
+	tests := []struct {
+		a, b     Value
+		expected string
+	}{
+		{text("How "), text("far"), "How far"},
+		{text("n="), NewInt(5), "n=5"},
+		{NewFloat(2.5), text("kg"), "2.5kg"},
+		{text(""), NewBool(true), "tru"},
+		{NewNothing(), text("!"), "nothing!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			chunk := NewChunk()
+			for _, v := range []Value{tt.a, tt.b} {
+				idx := chunk.AddConstant(v)
+				chunk.WriteOpcode(OP_CONSTANT, 1)
+				chunk.WriteByte(byte(idx>>8), 1)
+				chunk.WriteByte(byte(idx&0xFF), 1)
+			}
+			chunk.WriteOpcode(OP_CONCAT, 1)
+			chunk.WriteOpcode(OP_HALT, 1)
+
+			result, err := NewVM().Run(chunk)
+			if err != nil {
+				t.Fatalf("Execution error: %v", err)
+			}
+			if !result.IsString() || *result.AsString() != tt.expected {
+				t.Errorf("Expected %q, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	// A builtin can't be joined to a string, same as with OP_ADD
+	chunk := NewChunk()
+	chunk.AddConstant(text("a"))
+	chunk.AddConstant(NewBuiltin(0))
+	var messages []string
+	for _, op := range []Opcode{OP_ADD, OP_CONCAT} {
+		chunk.Code, chunk.Lines = nil, nil
+		chunk.WriteOpcode(OP_CONSTANT, 1)
+		chunk.WriteByte(0, 1)
+		chunk.WriteByte(0, 1)
+		chunk.WriteOpcode(OP_CONSTANT, 1)
+		chunk.WriteByte(0, 1)
+		chunk.WriteByte(1, 1)
+		chunk.WriteOpcode(op, 1)
+		chunk.WriteOpcode(OP_HALT, 1)
+
+		_, err := NewVM().Run(chunk)
+		if err == nil {
+			t.Fatalf("%s: expected an error for a builtin operand", op)
+		}
+		messages = append(messages, err.Error())
+	}
+	if messages[0] != messages[1] {
+		t.Errorf("expected the same error from both, got %q and %q", messages[0], messages[1])
+	}
+}
+
+func TestManualBytecode_ConditionalJumps(t *testing.T) {
+	// Push the condition, then a jump over "push 7". The popping jumps
+	// leave only what comes after; the peeking ones keep the condition.
+	tests := []struct {
+		name          string
+		jump          Opcode
+		condition     Opcode
+		expectedDepth int
+		jumped        bool
+	}{
+		{"JUMP_IF_LIE on lie", OP_JUMP_IF_LIE, OP_LIE, 0, true},
+		{"JUMP_IF_LIE on tru", OP_JUMP_IF_LIE, OP_TRU, 1, false},
+		{"JUMP_IF_TRU on tru", OP_JUMP_IF_TRU, OP_TRU, 0, true},
+		{"JUMP_IF_TRU on lie", OP_JUMP_IF_TRU, OP_LIE, 1, false},
+		{"JUMP_IF_LIE_PEEK on lie", OP_JUMP_IF_LIE_PEEK, OP_LIE, 1, true},
+		{"JUMP_IF_LIE_PEEK on tru", OP_JUMP_IF_LIE_PEEK, OP_TRU, 2, false},
+		{"JUMP_IF_TRU_PEEK on tru", OP_JUMP_IF_TRU_PEEK, OP_TRU, 1, true},
+		{"JUMP_IF_TRU_PEEK on lie", OP_JUMP_IF_TRU_PEEK, OP_LIE, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunk := NewChunk()
+			chunk.WriteOpcode(tt.condition, 1)
+			chunk.WriteOpcode(tt.jump, 1)
+			chunk.WriteByte(0, 1)
+			chunk.WriteByte(2, 1)
+			chunk.WriteOpcode(OP_CONST_I8, 1)
+			chunk.WriteByte(7, 1)
+			chunk.WriteOpcode(OP_HALT, 1)
+
+			vm := NewVM()
+			result, err := vm.Run(chunk)
+			if err != nil {
+				t.Fatalf("Execution error: %v", err)
+			}
+
+			if depth := vm.StackDepth(); depth != tt.expectedDepth {
+				t.Errorf("Expected stack depth %d, got %d", tt.expectedDepth, depth)
+			}
+			if pushed := result.IsInt() && result.AsInt() == 7; pushed == tt.jumped {
+				t.Errorf("Expected jumped=%v, got result %s", tt.jumped, result.String())
+			}
+		})
+	}
+}
+
 func TestManualBytecode_LogicalNot(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -337,75 +576,1109 @@ func TestManualBytecode_GlobalVariables(t *testing.T) {
 	}
 }
 
-// ============================================================================
-// Error Tests
-// ============================================================================
+func TestManualBytecode_CallBuiltinValue(t *testing.T) {
+	// Test: make f be len; f("abc") with len as a builtin value on the stack
+	chunk := NewChunk()
+
+	str := chunk.InternString("abc")
+	strIdx := chunk.AddConstant(NewString(str))
+	lenIdx := chunk.AddConstant(NewBuiltin(1))
+
+	// Push the argument first, then the callee
+	chunk.WriteOpcode(OP_CONSTANT, 1)
+	chunk.WriteByte(byte(strIdx>>8), 1)
+	chunk.WriteByte(byte(strIdx&0xFF), 1)
+	chunk.WriteOpcode(OP_CONSTANT, 1)
+	chunk.WriteByte(byte(lenIdx>>8), 1)
+	chunk.WriteByte(byte(lenIdx&0xFF), 1)
+
+	chunk.WriteOpcode(OP_CALL_1, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	vm := NewVM()
+	result, err := vm.Run(chunk)
+
+	if err != nil {
+		t.Fatalf("Execution error: %v", err)
+	}
+
+	if got := result.AsInt(); got != 3 {
+		t.Errorf("Expected 3, got %d", got)
+	}
+}
+
+func TestManualBytecode_CallFunction(t *testing.T) {
+	// Test: do seven(a, b) { bring 7 }; seven(1, 2) + 1
+	body := NewChunk()
+	body.WriteOpcode(OP_CONST_I8, 1)
+	body.WriteByte(7, 1)
+	body.WriteOpcode(OP_BRING, 1)
 
-func TestVM_DivisionByZero(t *testing.T) {
 	chunk := NewChunk()
+	fnIdx := chunk.AddFunction(&Function{Name: "seven", Arity: 2, LocalCount: 2, Chunk: body})
+
+	chunk.WriteOpcode(OP_CONST_1, 1)
 	chunk.WriteOpcode(OP_CONST_I8, 1)
-	chunk.WriteByte(10, 1)
-	chunk.WriteOpcode(OP_CONST_0, 1)
-	chunk.WriteOpcode(OP_DIV, 1)
+	chunk.WriteByte(2, 1)
+	chunk.WriteOpcode(OP_CONSTANT, 1)
+	chunk.WriteByte(byte(fnIdx>>8), 1)
+	chunk.WriteByte(byte(fnIdx&0xFF), 1)
+	chunk.WriteOpcode(OP_CALL, 1)
+	chunk.WriteByte(2, 1)
+
+	// The arguments must be gone, leaving only the result to add to
+	chunk.WriteOpcode(OP_CONST_1, 1)
+	chunk.WriteOpcode(OP_ADD, 1)
 	chunk.WriteOpcode(OP_HALT, 1)
 
 	vm := NewVM()
-	_, err := vm.Run(chunk)
+	result, err := vm.Run(chunk)
 
-	if err == nil {
-		t.Fatal("Expected division by zero error, got nil")
+	if err != nil {
+		t.Fatalf("Execution error: %v", err)
+	}
+
+	if got := result.AsInt(); got != 8 {
+		t.Errorf("Expected 8, got %d", got)
+	}
+	if vm.stackTop != 1 {
+		t.Errorf("Expected only the result on the stack, got %d values", vm.stackTop)
 	}
 }
 
-func TestVM_TypeErrorArithmetic(t *testing.T) {
+func TestManualBytecode_NestedCalls(t *testing.T) {
+	// Test: do inner() { bring 40 }; do outer() { bring inner() + 2 }; outer()
+	innerBody := NewChunk()
+	innerBody.WriteOpcode(OP_CONST_I8, 1)
+	innerBody.WriteByte(40, 1)
+	innerBody.WriteOpcode(OP_BRING, 1)
+
+	outerBody := NewChunk()
+	innerIdx := outerBody.AddFunction(&Function{Name: "inner", Chunk: innerBody})
+	outerBody.WriteOpcode(OP_CONSTANT, 1)
+	outerBody.WriteByte(byte(innerIdx>>8), 1)
+	outerBody.WriteByte(byte(innerIdx&0xFF), 1)
+	outerBody.WriteOpcode(OP_CALL_0, 1)
+	outerBody.WriteOpcode(OP_CONST_I8, 1)
+	outerBody.WriteByte(2, 1)
+	outerBody.WriteOpcode(OP_ADD, 1)
+	outerBody.WriteOpcode(OP_BRING, 1)
+
 	chunk := NewChunk()
-	chunk.WriteOpcode(OP_CONST_I8, 1)
-	chunk.WriteByte(5, 1)
-	chunk.WriteOpcode(OP_TRU, 1)
-	chunk.WriteOpcode(OP_SUB, 1)
+	outerIdx := chunk.AddFunction(&Function{Name: "outer", Chunk: outerBody})
+	chunk.WriteOpcode(OP_CONSTANT, 1)
+	chunk.WriteByte(byte(outerIdx>>8), 1)
+	chunk.WriteByte(byte(outerIdx&0xFF), 1)
+	chunk.WriteOpcode(OP_CALL_0, 1)
 	chunk.WriteOpcode(OP_HALT, 1)
 
 	vm := NewVM()
-	_, err := vm.Run(chunk)
+	result, err := vm.Run(chunk)
 
-	if err == nil {
-		t.Fatal("Expected type error, got nil")
+	if err != nil {
+		t.Fatalf("Execution error: %v", err)
+	}
+
+	if got := result.AsInt(); got != 42 {
+		t.Errorf("Expected 42, got %d", got)
 	}
 }
 
-func TestVM_UndefinedVariable(t *testing.T) {
+func TestManualBytecode_Closure(t *testing.T) {
+	// Test: do outer(n) { bring do() { bring n } }; outer(7)()
+	// The closure outlives outer, so n has to be closed over by then
+	innerBody := NewChunk()
+	innerBody.WriteOpcode(OP_GET_UPVALUE, 1)
+	innerBody.WriteByte(0, 1)
+	innerBody.WriteOpcode(OP_BRING, 1)
+
+	outerBody := NewChunk()
+	inner := &Function{Chunk: innerBody, Captures: []Capture{{IsLocal: true, Index: 0}}}
+	innerIdx := outerBody.AddFunction(inner)
+	outerBody.WriteOpcode(OP_CLOSURE, 1)
+	outerBody.WriteByte(byte(innerIdx>>8), 1)
+	outerBody.WriteByte(byte(innerIdx&0xFF), 1)
+	outerBody.WriteOpcode(OP_BRING, 1)
+
 	chunk := NewChunk()
+	outerIdx := chunk.AddFunction(&Function{Name: "outer", Arity: 1, LocalCount: 1, Chunk: outerBody})
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(7, 1)
+	chunk.WriteOpcode(OP_CONSTANT, 1)
+	chunk.WriteByte(byte(outerIdx>>8), 1)
+	chunk.WriteByte(byte(outerIdx&0xFF), 1)
+	chunk.WriteOpcode(OP_CALL_1, 1)
+	chunk.WriteOpcode(OP_CALL_0, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
 
-	varName := chunk.InternString("undefined_var")
-	nameIdx := chunk.AddConstant(NewString(varName))
+	vm := NewVM()
+	result, err := vm.Run(chunk)
+	if err != nil {
+		t.Fatalf("Execution error: %v", err)
+	}
+	if got := result.AsInt(); got != 7 {
+		t.Errorf("Expected 7, got %s", result)
+	}
+	if vm.openUpvalues != nil {
+		t.Errorf("Expected every upvalue to be closed once outer returned")
+	}
 
-	chunk.WriteOpcode(OP_GET_GLOBAL, 1)
-	chunk.WriteByte(byte(nameIdx>>8), 1)
-	chunk.WriteByte(byte(nameIdx&0xFF), 1)
+	// The function constant itself is left as it was
+	if inner.Upvalues != nil {
+		t.Errorf("Expected OP_CLOSURE to copy the function, not fill in the constant")
+	}
+}
+
+func TestManualBytecode_Try(t *testing.T) {
+	// Test: 1; try { 5 / 0 } rescue ...
+	// The division fails, so the stack goes back to just the 1 and the
+	// error's message, and ip to the rescue code
+	chunk := NewChunk()
+	chunk.WriteOpcode(OP_CONST_1, 1)
+	chunk.WriteOpcode(OP_TRY, 1) // 1
+	chunk.WriteByte(0, 1)
+	chunk.WriteByte(0, 1)
+	chunk.WriteByte(6, 1) // rescue at 5 + 6
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(5, 1)
+	chunk.WriteOpcode(OP_CONST_0, 1)
+	chunk.WriteOpcode(OP_DIV, 1)
+	chunk.WriteOpcode(OP_END_TRY, 1)
 	chunk.WriteOpcode(OP_HALT, 1)
+	chunk.WriteOpcode(OP_HALT, 1) // 11: rescue
 
 	vm := NewVM()
-	_, err := vm.Run(chunk)
+	result, err := vm.Run(chunk)
+	if err != nil {
+		t.Fatalf("Execution error: %v", err)
+	}
+	if !result.IsString() || *result.AsString() != "Omo! You no fit divide by zero o!" {
+		t.Errorf("Expected the error's message, got %s", result)
+	}
+	if depth := vm.StackDepth(); depth != 2 {
+		t.Errorf("Expected stack depth 2, got %d", depth)
+	}
+	if len(vm.frames[0].handlers) != 0 {
+		t.Errorf("Expected the try block to be finished, got %d handlers", len(vm.frames[0].handlers))
+	}
 
-	if err == nil {
-		t.Fatal("Expected undefined variable error, got nil")
+	// Without the try block the same division stops the program
+	chunk = NewChunk()
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(5, 1)
+	chunk.WriteOpcode(OP_CONST_0, 1)
+	chunk.WriteOpcode(OP_DIV, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+	if _, err := NewVM().Run(chunk); err == nil {
+		t.Errorf("Expected division by zero to stop the program")
 	}
 }
 
-// ============================================================================
-// Disassembly Tests
-// ============================================================================
+func TestManualBytecode_Locals(t *testing.T) {
+	tests := []struct {
+		name  string
+		slot  int
+		setOp Opcode
+		getOp Opcode
+	}{
+		{"slot 0", 0, OP_SET_LOCAL_0, OP_GET_LOCAL_0},
+		{"slot 1", 1, OP_SET_LOCAL_1, OP_GET_LOCAL_1},
+		{"slot 2", 2, OP_SET_LOCAL, OP_GET_LOCAL_2},
+		{"slot 3", 3, OP_SET_LOCAL, OP_GET_LOCAL_3},
+		{"slot 5", 5, OP_SET_LOCAL, OP_GET_LOCAL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Test: do f() { make local be 42; local + 1 } with 6 locals
+			body := NewChunk()
+			body.WriteOpcode(OP_CONST_I8, 1)
+			body.WriteByte(42, 1)
+			body.WriteOpcode(tt.setOp, 1)
+			if tt.setOp == OP_SET_LOCAL {
+				body.WriteByte(byte(tt.slot), 1)
+			}
+			body.WriteOpcode(OP_POP, 1)
+			body.WriteOpcode(tt.getOp, 1)
+			if tt.getOp == OP_GET_LOCAL {
+				body.WriteByte(byte(tt.slot), 1)
+			}
+			body.WriteOpcode(OP_CONST_1, 1)
+			body.WriteOpcode(OP_ADD, 1)
+			body.WriteOpcode(OP_BRING, 1)
+
+			chunk := NewChunk()
+			fnIdx := chunk.AddFunction(&Function{Name: "f", LocalCount: 6, Chunk: body})
+
+			// Something already on the stack, so slots don't start at zero
+			chunk.WriteOpcode(OP_CONST_I8, 1)
+			chunk.WriteByte(7, 1)
+			chunk.WriteOpcode(OP_CONSTANT, 1)
+			chunk.WriteByte(byte(fnIdx>>8), 1)
+			chunk.WriteByte(byte(fnIdx&0xFF), 1)
+			chunk.WriteOpcode(OP_CALL_0, 1)
+			chunk.WriteOpcode(OP_ADD, 1)
+			chunk.WriteOpcode(OP_HALT, 1)
+
+			vm := NewVM()
+			result, err := vm.Run(chunk)
+
+			if err != nil {
+				t.Fatalf("Execution error: %v", err)
+			}
+
+			if got := result.AsInt(); got != 50 {
+				t.Errorf("Expected 50, got %d", got)
+			}
+		})
+	}
+}
+
+func TestManualBytecode_Arguments(t *testing.T) {
+	// Test: do sub(a, b) { bring a - b }; sub(10, 3)
+	body := NewChunk()
+	body.WriteOpcode(OP_GET_LOCAL_0, 1)
+	body.WriteOpcode(OP_GET_LOCAL_1, 1)
+	body.WriteOpcode(OP_SUB, 1)
+	body.WriteOpcode(OP_BRING, 1)
 
-func TestChunk_Disassemble(t *testing.T) {
-	// Create bytecode for: 5 + 3
 	chunk := NewChunk()
+	fnIdx := chunk.AddFunction(&Function{Name: "sub", Arity: 2, LocalCount: 2, Chunk: body})
+
 	chunk.WriteOpcode(OP_CONST_I8, 1)
-	chunk.WriteByte(5, 1)
+	chunk.WriteByte(10, 1)
 	chunk.WriteOpcode(OP_CONST_I8, 1)
 	chunk.WriteByte(3, 1)
-	chunk.WriteOpcode(OP_ADD, 1)
+	chunk.WriteOpcode(OP_CONSTANT, 1)
+	chunk.WriteByte(byte(fnIdx>>8), 1)
+	chunk.WriteByte(byte(fnIdx&0xFF), 1)
+	chunk.WriteOpcode(OP_CALL_2, 1)
 	chunk.WriteOpcode(OP_HALT, 1)
 
-	// This should not panic
-	chunk.Disassemble("test")
+	vm := NewVM()
+	result, err := vm.Run(chunk)
+
+	if err != nil {
+		t.Fatalf("Execution error: %v", err)
+	}
+
+	if got := result.AsInt(); got != 7 {
+		t.Errorf("Expected 7, got %d", got)
+	}
+}
+
+func TestManualBytecode_Builtin(t *testing.T) {
+	// Test: len("abc") and type(5) through OP_BUILTIN
+	chunk := NewChunk()
+	strIdx := chunk.AddConstant(NewString(chunk.InternString("abc")))
+
+	chunk.WriteOpcode(OP_CONSTANT, 1)
+	chunk.WriteByte(byte(strIdx>>8), 1)
+	chunk.WriteByte(byte(strIdx&0xFF), 1)
+	chunk.WriteOpcode(OP_BUILTIN, 1)
+	chunk.WriteBytes([]byte{1, 1}, 1) // len, 1 argument
+
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(5, 1)
+	chunk.WriteOpcode(OP_BUILTIN, 1)
+	chunk.WriteBytes([]byte{2, 1}, 1) // type, 1 argument
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	vm := NewVM()
+	result, err := vm.Run(chunk)
+
+	if err != nil {
+		t.Fatalf("Execution error: %v", err)
+	}
+
+	if got := result.String(); got != "INTEGER" {
+		t.Errorf("Expected INTEGER, got %q", got)
+	}
+
+	// len's result is still underneath
+	if vm.stackTop != 2 {
+		t.Fatalf("Expected 2 values on the stack, got %d", vm.stackTop)
+	}
+	if got := vm.stack[0].AsInt(); got != 3 {
+		t.Errorf("Expected len to give 3, got %d", got)
+	}
+}
+
+// ============================================================================
+// Error Tests
+// ============================================================================
+
+func TestVM_YarnOutput(t *testing.T) {
+	// yarn("hi") both as OP_YARN and through the builtin dispatch
+	tests := []struct {
+		name string
+		emit func(chunk *Chunk)
+	}{
+		{"OP_YARN", func(chunk *Chunk) {
+			chunk.WriteOpcode(OP_YARN, 1)
+			chunk.WriteByte(1, 1)
+		}},
+		{"OP_BUILTIN", func(chunk *Chunk) {
+			chunk.WriteOpcode(OP_BUILTIN, 1)
+			chunk.WriteByte(0, 1) // yarn
+			chunk.WriteByte(1, 1)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunk := NewChunk()
+			idx := chunk.AddConstant(NewString(chunk.InternString("hi")))
+			chunk.WriteOpcode(OP_CONSTANT, 1)
+			chunk.WriteByte(byte(idx>>8), 1)
+			chunk.WriteByte(byte(idx&0xFF), 1)
+			tt.emit(chunk)
+			chunk.WriteOpcode(OP_HALT, 1)
+
+			var out bytes.Buffer
+			vm := NewVMWithOutput(&out)
+			if _, err := vm.Run(chunk); err != nil {
+				t.Fatalf("Execution error: %v", err)
+			}
+
+			if got := out.String(); got != "hi\n" {
+				t.Errorf("Expected %q, got %q", "hi\n", got)
+			}
+		})
+	}
+}
+
+func TestVM_RecoverErrors(t *testing.T) {
+	isError := -1
+	for i, builtin := range Builtins {
+		if builtin.Name == "is_error" {
+			isError = i
+		}
+	}
+
+	// 7 / 0, then is_error of the result, with the result left underneath
+	chunk := NewChunk()
+	chunk.WriteOpcode(OP_CONST_I8, 3)
+	chunk.WriteByte(7, 3)
+	chunk.WriteOpcode(OP_CONST_0, 3)
+	chunk.WriteOpcode(OP_DIV, 3)
+	chunk.WriteOpcode(OP_DUP, 3)
+	chunk.WriteOpcode(OP_BUILTIN, 3)
+	chunk.WriteBytes([]byte{byte(isError), 1}, 3)
+	chunk.WriteOpcode(OP_HALT, 3)
+
+	// Without RecoverErrors the division stops the program
+	if _, err := NewVM().Run(chunk); err == nil || !strings.Contains(err.Error(), "divide by zero") {
+		t.Fatalf("Expected divide by zero error, got %v", err)
+	}
+
+	vm := NewVM()
+	vm.RecoverErrors = true
+	result, err := vm.Run(chunk)
+	if err != nil {
+		t.Fatalf("Execution error: %v", err)
+	}
+	if !result.IsBool() || !result.AsBool() {
+		t.Errorf("Expected is_error to give tru, got %s", result)
+	}
+
+	// The error value took the quotient's place, and knows its line
+	if vm.stackTop != 2 {
+		t.Fatalf("Expected 2 values on the stack, got %d", vm.stackTop)
+	}
+	value := vm.stack[0]
+	if !value.IsError() {
+		t.Fatalf("Expected an error value, got %s", value.TypeName())
+	}
+	if got := value.AsError(); got.Message != "Omo! You no fit divide by zero o!" || got.Line != 3 {
+		t.Errorf("Expected the divide by zero message on line 3, got %q on line %d", got.Message, got.Line)
+	}
+	if got := value.String(); got != "Omo! You no fit divide by zero o!" {
+		t.Errorf("Expected the error to print as its message, got %q", got)
+	}
+
+	// Errors that aren't recoverable still stop the program
+	chunk = NewChunk()
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(7, 1)
+	chunk.WriteOpcode(OP_CALL_0, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+	if _, err := vm.Run(chunk); err == nil || !strings.Contains(err.Error(), "no be function") {
+		t.Errorf("Expected calling a number to stop the program, got %v", err)
+	}
+
+	// So does a failed assert, which would otherwise be thrown away
+	assert := -1
+	for i, builtin := range Builtins {
+		if builtin.Name == "assert" {
+			assert = i
+		}
+	}
+	chunk = NewChunk()
+	chunk.WriteOpcode(OP_LIE, 1)
+	chunk.WriteOpcode(OP_BUILTIN, 1)
+	chunk.WriteBytes([]byte{byte(assert), 1}, 1)
+	chunk.WriteOpcode(OP_POP, 1)
+	chunk.WriteOpcode(OP_NOTHING, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+	if _, err := vm.Run(chunk); err == nil || !strings.Contains(err.Error(), "Assert fail") {
+		t.Errorf("Expected a failed assert to stop the program, got %v", err)
+	}
+}
+
+func TestVM_Trace(t *testing.T) {
+	// 5 + 3
+	chunk := NewChunk()
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(5, 1)
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(3, 1)
+	chunk.WriteOpcode(OP_ADD, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	var out bytes.Buffer
+	vm := NewVMWithOutput(&out)
+	vm.Trace = true
+	if _, err := vm.Run(chunk); err != nil {
+		t.Fatalf("Execution error: %v", err)
+	}
+
+	// Each instruction comes after the stack it is about to work on
+	trace := out.String()
+	for _, want := range []string{"[ 5 ][ 3 ]\n0004    | OP_ADD", "[ 8 ]\n0005    | OP_HALT"} {
+		if !strings.Contains(trace, want) {
+			t.Errorf("Expected trace to contain %q, got:\n%s", want, trace)
+		}
+	}
+
+	// Tracing is off by default
+	out.Reset()
+	vm = NewVMWithOutput(&out)
+	if _, err := vm.Run(chunk); err != nil {
+		t.Fatalf("Execution error: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected no output without Trace, got:\n%s", out.String())
+	}
+}
+
+func TestVM_DivisionByZero(t *testing.T) {
+	chunk := NewChunk()
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(10, 1)
+	chunk.WriteOpcode(OP_CONST_0, 1)
+	chunk.WriteOpcode(OP_DIV, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	vm := NewVM()
+	_, err := vm.Run(chunk)
+
+	if err == nil {
+		t.Fatal("Expected division by zero error, got nil")
+	}
+}
+
+func TestVM_ModuloByZero(t *testing.T) {
+	chunk := NewChunk()
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(10, 1)
+	chunk.WriteOpcode(OP_CONST_0, 1)
+	chunk.WriteOpcode(OP_MOD, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	vm := NewVM()
+	_, err := vm.Run(chunk)
+
+	if err == nil {
+		t.Fatal("Expected division by zero error, got nil")
+	}
+
+	if !strings.Contains(err.Error(), "Omo! You no fit divide by zero o!") {
+		t.Errorf("Expected division by zero error, got %q", err.Error())
+	}
+}
+
+func TestVM_IntegerOverflow(t *testing.T) {
+	// 2^30 * 2^30 doesn't fit in 48 bits
+	big := int64(1 << 30)
+
+	newChunk := func() *Chunk {
+		chunk := NewChunk()
+		idx := chunk.AddConstant(NewInt(big))
+		for i := 0; i < 2; i++ {
+			chunk.WriteOpcode(OP_CONSTANT, 1)
+			chunk.WriteByte(byte(idx>>8), 1)
+			chunk.WriteByte(byte(idx&0xFF), 1)
+		}
+		chunk.WriteOpcode(OP_MUL, 1)
+		chunk.WriteOpcode(OP_HALT, 1)
+		return chunk
+	}
+
+	t.Run("error mode", func(t *testing.T) {
+		vm := NewVM()
+		_, err := vm.Run(newChunk())
+		if err == nil {
+			t.Fatal("Expected overflow error, got nil")
+		}
+		if !strings.Contains(err.Error(), "Number too big for Pidgin") {
+			t.Errorf("Expected overflow error, got %q", err.Error())
+		}
+	})
+
+	t.Run("float mode", func(t *testing.T) {
+		vm := NewVM()
+		vm.SetOverflowMode(OverflowFloat)
+		result, err := vm.Run(newChunk())
+		if err != nil {
+			t.Fatalf("Execution error: %v", err)
+		}
+		if !result.IsFloat() {
+			t.Fatalf("Expected float result, got %s", result.TypeName())
+		}
+		if got, want := result.AsFloat(), float64(big)*float64(big); got != want {
+			t.Errorf("Expected %g, got %g", want, got)
+		}
+	})
+}
+
+func TestVM_IntegerOverflowBoundaries(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        int64
+		b        int64
+		op       Opcode
+		overflow bool
+	}{
+		{"max + 0", MAX_INT_48, 0, OP_ADD, false},
+		{"max + 1", MAX_INT_48, 1, OP_ADD, true},
+		{"min - 0", MIN_INT_48, 0, OP_SUB, false},
+		{"min - 1", MIN_INT_48, 1, OP_SUB, true},
+		{"max * 1", MAX_INT_48, 1, OP_MUL, false},
+		{"max * -1", MAX_INT_48, -1, OP_MUL, false},
+		{"min * -1", MIN_INT_48, -1, OP_MUL, true},
+		{"max * 2", MAX_INT_48, 2, OP_MUL, true},
+		{"min / -1", MIN_INT_48, -1, OP_DIV, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunk := NewChunk()
+			for _, n := range []int64{tt.a, tt.b} {
+				idx := chunk.AddConstant(NewInt(n))
+				chunk.WriteOpcode(OP_CONSTANT, 1)
+				chunk.WriteByte(byte(idx>>8), 1)
+				chunk.WriteByte(byte(idx&0xFF), 1)
+			}
+			chunk.WriteOpcode(tt.op, 1)
+			chunk.WriteOpcode(OP_HALT, 1)
+
+			vm := NewVM()
+			_, err := vm.Run(chunk)
+
+			if tt.overflow && err == nil {
+				t.Error("Expected overflow error, got nil")
+			}
+			if !tt.overflow && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestVM_NegateOverflowBoundaries(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        int64
+		overflow bool
+	}{
+		{"-max", MAX_INT_48, false},
+		{"-(min + 1)", MIN_INT_48 + 1, false},
+		{"-min", MIN_INT_48, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newChunk := func() *Chunk {
+				chunk := NewChunk()
+				idx := chunk.AddConstant(NewInt(tt.a))
+				chunk.WriteOpcode(OP_CONSTANT, 1)
+				chunk.WriteByte(byte(idx>>8), 1)
+				chunk.WriteByte(byte(idx&0xFF), 1)
+				chunk.WriteOpcode(OP_NEGATE, 1)
+				chunk.WriteOpcode(OP_HALT, 1)
+				return chunk
+			}
+
+			result, err := NewVM().Run(newChunk())
+			if tt.overflow {
+				if err == nil || !strings.Contains(err.Error(), "Number too big for Pidgin") {
+					t.Errorf("Expected overflow error, got %v", err)
+				}
+
+				// With floats allowed the true result comes back instead
+				vm := NewVM()
+				vm.SetOverflowMode(OverflowFloat)
+				result, err = vm.Run(newChunk())
+				if err != nil || !result.IsFloat() || result.AsFloat() != -float64(tt.a) {
+					t.Errorf("Expected %g as a float, got %s (%v)", -float64(tt.a), result, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.IsInt() || result.AsInt() != -tt.a {
+				t.Errorf("Expected %d, got %s", -tt.a, result)
+			}
+		})
+	}
+}
+
+func TestVM_ShiftsMatchMulAndDiv(t *testing.T) {
+	operands := NewChunk()
+	values := []Value{
+		NewInt(0), NewInt(1), NewInt(-1), NewInt(7), NewInt(-7), NewInt(9), NewInt(-9),
+		NewInt(1 << 20), NewInt(-(1 << 20) - 3), NewInt(MAX_INT_48), NewInt(MIN_INT_48),
+		NewInt(MAX_INT_48 >> 3), NewInt(MIN_INT_48 >> 3), NewInt(MAX_INT_48>>3 + 1), NewInt(MIN_INT_48>>3 - 1),
+		NewFloat(2.5), NewFloat(-0.75), NewBool(true), NewNothing(),
+		NewString(operands.InternString("wetin")),
+	}
+
+	// run pushes a, then runs code with 2^n as constant 1
+	run := func(mode OverflowMode, a Value, n byte, code ...byte) (Value, error) {
+		chunk := NewChunk()
+		chunk.AddConstant(a)
+		chunk.AddConstant(NewInt(int64(1) << n))
+		chunk.WriteOpcode(OP_CONSTANT, 1)
+		chunk.WriteByte(0, 1)
+		chunk.WriteByte(0, 1)
+		for _, b := range code {
+			chunk.WriteByte(b, 1)
+		}
+		chunk.WriteOpcode(OP_HALT, 1)
+
+		vm := NewVM()
+		vm.SetOverflowMode(mode)
+		return vm.Run(chunk)
+	}
+
+	for _, mode := range []OverflowMode{OverflowError, OverflowFloat} {
+		for _, a := range values {
+			for _, n := range []byte{1, 3, 10, 46} {
+				pairs := []struct {
+					shift Opcode
+					op    Opcode
+				}{{OP_SHIFT_LEFT, OP_MUL}, {OP_SHIFT_RIGHT, OP_DIV}}
+
+				for _, pair := range pairs {
+					name := fmt.Sprintf("%s %s 2^%d", a, pair.op, n)
+					want, wantErr := run(mode, a, n, byte(OP_CONSTANT), 0, 1, byte(pair.op))
+					got, gotErr := run(mode, a, n, byte(pair.shift), n)
+
+					if fmt.Sprint(wantErr) != fmt.Sprint(gotErr) {
+						t.Errorf("%s: expected error %v, got %v", name, wantErr, gotErr)
+						continue
+					}
+					if wantErr == nil && (got != want || got.TypeName() != want.TypeName()) {
+						t.Errorf("%s: expected %s (%s), got %s (%s)", name, want, want.TypeName(), got, got.TypeName())
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestVM_TypeErrorArithmetic(t *testing.T) {
+	chunk := NewChunk()
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(5, 1)
+	chunk.WriteOpcode(OP_TRU, 1)
+	chunk.WriteOpcode(OP_SUB, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	vm := NewVM()
+	_, err := vm.Run(chunk)
+
+	if err == nil {
+		t.Fatal("Expected type error, got nil")
+	}
+}
+
+func TestVM_BuiltinInArithmetic(t *testing.T) {
+	// len + 1
+	chunk := NewChunk()
+	lenIdx := chunk.AddConstant(NewBuiltin(1))
+	chunk.WriteOpcode(OP_CONSTANT, 1)
+	chunk.WriteByte(byte(lenIdx>>8), 1)
+	chunk.WriteByte(byte(lenIdx&0xFF), 1)
+	chunk.WriteOpcode(OP_CONST_1, 1)
+	chunk.WriteOpcode(OP_ADD, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	vm := NewVM()
+	_, err := vm.Run(chunk)
+
+	if err == nil {
+		t.Fatal("Expected builtin misuse error, got nil")
+	}
+
+	expected := "You fit only call builtin len, no fit add am"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error containing %q, got %q", expected, err.Error())
+	}
+}
+
+func TestVM_CallWrongArity(t *testing.T) {
+	body := NewChunk()
+	body.WriteOpcode(OP_NOTHING, 1)
+	body.WriteOpcode(OP_BRING, 1)
+
+	chunk := NewChunk()
+	fnIdx := chunk.AddFunction(&Function{Name: "pair", Arity: 2, LocalCount: 2, Chunk: body})
+	chunk.WriteOpcode(OP_CONST_1, 1)
+	chunk.WriteOpcode(OP_CONSTANT, 1)
+	chunk.WriteByte(byte(fnIdx>>8), 1)
+	chunk.WriteByte(byte(fnIdx&0xFF), 1)
+	chunk.WriteOpcode(OP_CALL_1, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	vm := NewVM()
+	_, err := vm.Run(chunk)
+
+	if err == nil {
+		t.Fatal("Expected arity error, got nil")
+	}
+	if !strings.Contains(err.Error(), "pair wan make 2 argument, you give am 1") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestVM_CallTooDeep(t *testing.T) {
+	// A function that calls itself forever must stop with an error
+	body := NewChunk()
+	chunk := NewChunk()
+	fn := &Function{Name: "forever", Chunk: body}
+	fnIdx := chunk.AddFunction(fn)
+	selfIdx := body.AddFunction(fn)
+
+	body.WriteOpcode(OP_CONSTANT, 1)
+	body.WriteByte(byte(selfIdx>>8), 1)
+	body.WriteByte(byte(selfIdx&0xFF), 1)
+	body.WriteOpcode(OP_CALL_0, 1)
+	body.WriteOpcode(OP_BRING, 1)
+
+	chunk.WriteOpcode(OP_CONSTANT, 1)
+	chunk.WriteByte(byte(fnIdx>>8), 1)
+	chunk.WriteByte(byte(fnIdx&0xFF), 1)
+	chunk.WriteOpcode(OP_CALL_0, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	vm := NewVM()
+	_, err := vm.Run(chunk)
+
+	if err == nil {
+		t.Fatal("Expected stack error, got nil")
+	}
+	if !strings.Contains(err.Error(), "Stack don full") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestVM_PushPopBounds(t *testing.T) {
+	vm := NewVM()
+
+	if _, err := vm.pop(); err == nil || !strings.Contains(err.Error(), "Stack don empty") {
+		t.Errorf("Expected error popping an empty stack, got %v", err)
+	}
+
+	for i := 0; i < STACK_MAX; i++ {
+		if err := vm.push(NewInt(int64(i))); err != nil {
+			t.Fatalf("Unexpected error on push %d: %v", i, err)
+		}
+	}
+	if err := vm.push(NewInt(0)); err == nil || !strings.Contains(err.Error(), "Stack don full") {
+		t.Errorf("Expected error pushing onto a full stack, got %v", err)
+	}
+
+	if val, err := vm.pop(); err != nil || val.AsInt() != STACK_MAX-1 {
+		t.Errorf("Expected %d from a full stack, got %v (%v)", STACK_MAX-1, val, err)
+	}
+}
+
+func TestVM_MaxSteps(t *testing.T) {
+	// A loop that jumps back to itself forever
+	chunk := NewChunk()
+	chunk.WriteOpcode(OP_LOOP, 1)
+	chunk.WriteBytes([]byte{0, 3}, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	vm := NewVM()
+	vm.MaxSteps = 1000
+	_, err := vm.Run(chunk)
+
+	if err == nil {
+		t.Fatal("Expected step limit error, got nil")
+	}
+	if !strings.Contains(err.Error(), "Program dey waka too long") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// The limit covers the whole run, not each RunSteps slice
+	vm = NewVM()
+	vm.MaxSteps = 1000
+	for slice := 1; slice <= 3; slice++ {
+		if _, halted, err := vm.RunSteps(chunk, 300); err != nil || halted {
+			t.Fatalf("slice %d: expected pause, got halted=%v err=%v", slice, halted, err)
+		}
+	}
+	_, _, err = vm.RunSteps(chunk, 300)
+	if err == nil || !strings.Contains(err.Error(), "Program dey waka too long") {
+		t.Errorf("Expected step limit error on slice 4, got %v", err)
+	}
+}
+
+func TestVM_HeapSweep(t *testing.T) {
+	vm := NewVM()
+	vm.frames[0] = CallFrame{function: &vm.script}
+	vm.frameCount = 1
+
+	// A closure kept in a global, and one only its upvalue reaches
+	inner := &Function{Name: "inner"}
+	vm.hold(inner)
+	upvalue := &Upvalue{Closed: NewFunc(inner)}
+	upvalue.Location = &upvalue.Closed
+	outer := &Function{Name: "outer", Upvalues: []*Upvalue{upvalue}}
+	vm.hold(outer)
+	vm.globals["outer"] = NewFunc(outer)
+
+	// One on the stack
+	onStack := &Function{Name: "on stack"}
+	vm.hold(onStack)
+	vm.push(NewFunc(onStack))
+
+	for i := 0; i < 10*HEAP_MIN; i++ {
+		vm.hold(&Function{Name: "junk"})
+	}
+
+	if len(vm.heap) > 2*HEAP_MIN {
+		t.Errorf("heap grew to %d objects, want at most %d", len(vm.heap), 2*HEAP_MIN)
+	}
+	for _, fn := range []*Function{inner, outer, onStack} {
+		if _, ok := vm.heap[fn]; !ok {
+			t.Errorf("sweep dropped reachable function %q", fn.Name)
+		}
+	}
+}
+
+func TestVM_BuiltinWrongArgCount(t *testing.T) {
+	chunk := NewChunk()
+	chunk.WriteOpcode(OP_BUILTIN, 1)
+	chunk.WriteBytes([]byte{1, 0}, 1) // len with no arguments
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	vm := NewVM()
+	_, err := vm.Run(chunk)
+
+	if err == nil {
+		t.Fatal("Expected argument count error, got nil")
+	}
+	if !strings.Contains(err.Error(), "len wan make one argument, you give am 0") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestVM_UndefinedVariable(t *testing.T) {
+	chunk := NewChunk()
+
+	varName := chunk.InternString("undefined_var")
+	nameIdx := chunk.AddConstant(NewString(varName))
+
+	chunk.WriteOpcode(OP_GET_GLOBAL, 1)
+	chunk.WriteByte(byte(nameIdx>>8), 1)
+	chunk.WriteByte(byte(nameIdx&0xFF), 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	vm := NewVM()
+	_, err := vm.Run(chunk)
+
+	if err == nil {
+		t.Fatal("Expected undefined variable error, got nil")
+	}
+}
+
+// ============================================================================
+// Serialization Tests
+// ============================================================================
+
+func TestChunk_SerializeRoundTrip(t *testing.T) {
+	// A function that adds "!" to its argument, called with "hi"
+	body := NewChunk()
+	bang := body.AddConstant(NewString(body.InternString("!")))
+	body.WriteOpcode(OP_GET_LOCAL_0, 2)
+	body.WriteOpcode(OP_CONSTANT, 2)
+	body.WriteBytes([]byte{0, byte(bang)}, 2)
+	body.WriteOpcode(OP_ADD, 2)
+	body.WriteOpcode(OP_BRING, 3)
+
+	chunk := NewChunk()
+	hi := chunk.AddConstant(NewString(chunk.InternString("hi")))
+	fnIdx := chunk.AddFunction(&Function{Name: "shout", Arity: 1, LocalCount: 1, Chunk: body})
+	chunk.AddConstant(NewFloat(2.5))
+	chunk.AddConstant(NewInt(MIN_INT_48))
+	chunk.AddConstant(NewBool(true))
+	chunk.AddConstant(NewNothing())
+	chunk.AddConstant(NewBuiltin(1))
+	chunk.WriteOpcode(OP_CONSTANT, 1)
+	chunk.WriteBytes([]byte{0, byte(hi)}, 1)
+	chunk.WriteOpcode(OP_CONSTANT, 1)
+	chunk.WriteBytes([]byte{0, byte(fnIdx)}, 1)
+	chunk.WriteOpcode(OP_CALL_1, 1)
+	chunk.WriteOpcode(OP_HALT, 4)
+
+	data, err := chunk.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize error: %v", err)
+	}
+	loaded, err := DeserializeChunk(data)
+	if err != nil {
+		t.Fatalf("DeserializeChunk error: %v", err)
+	}
+
+	if len(loaded.Lines) != len(chunk.Lines) || loaded.Lines[len(loaded.Lines)-1] != 4 {
+		t.Errorf("Expected lines %v, got %v", chunk.Lines, loaded.Lines)
+	}
+	for i, want := range chunk.Constants {
+		got := loaded.Constants[i]
+		if want.IsFunc() {
+			fn := got.AsFunc()
+			if !got.IsFunc() || fn.Name != "shout" || fn.Arity != 1 || fn.LocalCount != 1 {
+				t.Errorf("Constant %d: expected function shout, got %s", i, got)
+			}
+			continue
+		}
+		if got.String() != want.String() || got.TypeName() != want.TypeName() {
+			t.Errorf("Constant %d: expected %s, got %s", i, want, got)
+		}
+	}
+
+	// Loaded strings belong to the loaded chunk
+	if s := loaded.Constants[hi].AsString(); s != loaded.InternString("hi") {
+		t.Error("Expected loaded string to be interned in the loaded chunk")
+	}
+
+	result, err := NewVM().Run(loaded)
+	if err != nil {
+		t.Fatalf("Execution error: %v", err)
+	}
+	if !result.IsString() || *result.AsString() != "hi!" {
+		t.Errorf("Expected hi!, got %s", result)
+	}
+}
+
+func TestChunk_SerializeErrors(t *testing.T) {
+	chunk := NewChunk()
+	chunk.AddConstant(NewError(&RuntimeError{Message: "wahala"}))
+	if _, err := chunk.Serialize(); err == nil || !strings.Contains(err.Error(), "error values can't be saved") {
+		t.Errorf("Expected error for an error constant, got %v", err)
+	}
+
+	// A function holding itself would never finish writing
+	body := NewChunk()
+	fn := &Function{Name: "forever", Chunk: body}
+	body.AddFunction(fn)
+	chunk = NewChunk()
+	chunk.AddFunction(fn)
+	if _, err := chunk.Serialize(); err == nil || !strings.Contains(err.Error(), `function "forever" holds itself`) {
+		t.Errorf("Expected error for a function holding itself, got %v", err)
+	}
+}
+
+func TestChunk_DeserializeErrors(t *testing.T) {
+	chunk := NewChunk()
+	chunk.AddConstant(NewString(chunk.InternString("hello")))
+	chunk.AddConstant(NewFloat(1.5))
+	chunk.WriteOpcode(OP_CONSTANT, 1)
+	chunk.WriteBytes([]byte{0, 0}, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+	data, err := chunk.Serialize()
+	if err != nil {
+		t.Fatalf("Serialize error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"not bytecode", []byte("make x be 1"), "not a Pidgin bytecode file"},
+		{"no version", []byte(BYTECODE_MAGIC), "file ends early"},
+		{"wrong version", append([]byte(BYTECODE_MAGIC), 99), "version 99"},
+		{"extra bytes", append(append([]byte{}, data...), 0), "1 extra bytes"},
+		{"unknown constant", append(append([]byte{}, data[:len(data)-9]...), 42), "unknown tag 42"},
+	}
+
+	// Every way of cutting the file short is caught, never a panic
+	for n := len(BYTECODE_MAGIC) + 1; n < len(data); n++ {
+		tests = append(tests, struct {
+			name     string
+			data     []byte
+			expected string
+		}{fmt.Sprintf("cut at %d", n), data[:n], "ends early"})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DeserializeChunk(tt.data)
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !errors.Is(err, ErrBadBytecode) || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Disassembly Tests
+// ============================================================================
+
+func TestChunk_Disassemble(t *testing.T) {
+	// Create bytecode for: 5 + 3
+	chunk := NewChunk()
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(5, 1)
+	chunk.WriteOpcode(OP_CONST_I8, 1)
+	chunk.WriteByte(3, 1)
+	chunk.WriteOpcode(OP_ADD, 1)
+	chunk.WriteOpcode(OP_HALT, 1)
+
+	// This should not panic
+	chunk.Disassemble("test")
+}
+
+func TestChunk_AddConstantDedup(t *testing.T) {
+	chunk := NewChunk()
+
+	// Two separate copies of the same text share one slot
+	first, second := "wetin", "wetin"
+	strIdx := chunk.AddConstant(NewString(&first))
+	if got := chunk.AddConstant(NewString(&second)); got != strIdx {
+		t.Errorf("Expected equal strings to share index %d, got %d", strIdx, got)
+	}
+
+	intIdx := chunk.AddConstant(NewInt(100000))
+	if got := chunk.AddConstant(NewInt(100000)); got != intIdx {
+		t.Errorf("Expected equal ints to share index %d, got %d", intIdx, got)
+	}
+
+	// Numerically equal values of different types must not collapse
+	if got := chunk.AddConstant(NewFloat(100000)); got == intIdx {
+		t.Errorf("Expected float 100000.0 to get its own slot, got the int's index %d", got)
+	}
+
+	if len(chunk.Constants) != 3 {
+		t.Errorf("Expected 3 constants, got %d", len(chunk.Constants))
+	}
 }